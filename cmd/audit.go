@@ -0,0 +1,183 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	helpers "github.com/mudler/luet/cmd/helpers"
+	"github.com/mudler/luet/cmd/util"
+	"github.com/mudler/luet/pkg/api/core/advisory"
+	"github.com/mudler/luet/pkg/api/core/types"
+	pkg "github.com/mudler/luet/pkg/database"
+	tree "github.com/mudler/luet/pkg/tree"
+	"github.com/spf13/cobra"
+)
+
+type AuditResult struct {
+	Name       string              `json:"name"`
+	Category   string              `json:"category"`
+	Version    string              `json:"version"`
+	Advisories []advisory.Advisory `json:"advisories"`
+}
+
+type AuditResults struct {
+	Packages []AuditResult `json:"packages"`
+}
+
+var auditCmd = &cobra.Command{
+	Use: "audit [pkg1] [pkg2] ...",
+	// Skip processing output
+	Annotations: map[string]string{
+		util.CommandProcessOutput: "",
+	},
+	Short: "Check packages against security advisories",
+	Long: `Check the installed packages against the advisories of a local feed:
+
+	$ luet audit --feed /var/lib/advisories
+
+Feeds are YAML or JSON files, keyed by package, with the affected versions
+expressed as version selectors:
+
+	app-misc/foo:
+	- id: CVE-2022-0001
+	  severity: high
+	  summary: Buffer overflow in the parser
+	  affected: ["<1.2.3"]
+	  fixed: "1.2.3"
+
+The feeds can be set in the luet configuration (audit.feeds), and also used to
+block packages with advisories during install and upgrade (audit.block_severity).
+
+To check only some of the installed packages:
+
+	$ luet audit system/foo system/bar
+
+To check a package tree instead of the system:
+
+	$ luet audit --tree ./packages
+
+Only the advisories with a minimum severity can be shown with --severity.
+The command exits with a non-zero status if advisories are found.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var results AuditResults
+
+		feeds, _ := cmd.Flags().GetStringSlice("feed")
+		treePaths, _ := cmd.Flags().GetStringSlice("tree")
+		sev, _ := cmd.Flags().GetString("severity")
+		out, _ := cmd.Flags().GetString("output")
+
+		if len(feeds) == 0 {
+			feeds = util.DefaultContext.Config.Audit.Feeds
+		}
+		if len(feeds) == 0 {
+			util.DefaultContext.Fatal("No advisory feeds configured, use --feed or set audit.feeds in the configuration")
+		}
+		severity, err := advisory.ParseSeverity(sev)
+		helpers.CheckErr(err)
+
+		feed, err := advisory.LoadFeed(feeds...)
+		helpers.CheckErr(err)
+
+		var world types.Packages
+		if len(treePaths) > 0 {
+			reciper := tree.NewInstallerRecipe(pkg.NewInMemoryDatabase(false))
+			for _, t := range treePaths {
+				if err := reciper.Load(t); err != nil {
+					util.DefaultContext.Fatal("Error on load tree ", err)
+				}
+			}
+			world = reciper.GetDatabase().World()
+		} else {
+			world = sys().Database.World()
+		}
+
+		packs := world
+		if len(args) > 0 {
+			packs = types.Packages{}
+			for _, a := range args {
+				p, err := helpers.ParsePackageStr(a)
+				if err != nil {
+					util.DefaultContext.Fatal("Invalid package string ", a, ": ", err.Error())
+				}
+				for _, w := range world {
+					if w.AtomMatches(p) {
+						packs = append(packs, w)
+					}
+				}
+			}
+		}
+
+		findings := feed.Audit(packs).AtLeast(severity)
+		for _, p := range findings.Packages() {
+			r := AuditResult{Name: p.GetName(), Category: p.GetCategory(), Version: p.GetVersion()}
+			for _, f := range findings {
+				if f.Package.GetFingerPrint() == p.GetFingerPrint() {
+					r.Advisories = append(r.Advisories, f.Advisory)
+				}
+			}
+			results.Packages = append(results.Packages, r)
+		}
+
+		switch out {
+		case "yaml", "json":
+			y, err := yaml.Marshal(results)
+			if err != nil {
+				util.DefaultContext.Fatal(err.Error())
+			}
+			if out == "json" {
+				y, err = yaml.YAMLToJSON(y)
+				if err != nil {
+					util.DefaultContext.Fatal(err.Error())
+				}
+			}
+			fmt.Println(string(y))
+		default:
+			if len(findings) == 0 {
+				util.DefaultContext.Success(fmt.Sprintf("No advisories found for %d packages", len(packs.Unique())))
+				return
+			}
+			t := &util.TableWriter{}
+			t.AppendRow([]string{"Package", "Advisory", "Severity", "Fixed in", "Summary"})
+			for _, f := range findings {
+				t.AppendRow([]string{
+					f.Package.HumanReadableString(),
+					f.Advisory.ID,
+					string(f.Advisory.Severity),
+					f.Advisory.Fixed,
+					strings.TrimSpace(f.Advisory.Summary),
+				})
+			}
+			t.Render()
+		}
+
+		if len(findings) != 0 {
+			util.DefaultContext.Fatal(fmt.Sprintf("Found %d advisories affecting %d packages", len(findings), len(findings.Packages())))
+		}
+	},
+}
+
+func init() {
+	auditCmd.Flags().StringSlice("feed", []string{}, "Advisory feed files or directories (defaults to audit.feeds in the configuration)")
+	auditCmd.Flags().StringSliceP("tree", "t", []string{}, "Check the packages of the given trees instead of the installed ones")
+	auditCmd.Flags().String("severity", "", "Show only advisories with the given severity or higher (low, medium, high, critical)")
+	auditCmd.Flags().StringP("output", "o", "terminal", "Output format ( Defaults: terminal, available: json,yaml )")
+
+	RootCmd.AddCommand(auditCmd)
+}
@@ -0,0 +1,125 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	helpers "github.com/mudler/luet/cmd/helpers"
+	"github.com/mudler/luet/cmd/util"
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/mudler/luet/pkg/compiler"
+	versioner "github.com/mudler/luet/pkg/versioner"
+
+	"github.com/spf13/cobra"
+)
+
+// findBuildLog returns the build log of the package in the destination. If the package
+// version is a selector, the log of the highest matching version is returned
+func findBuildLog(dst string, p *types.Package) (string, error) {
+	if !p.IsSelector() && p.GetVersion() != "" {
+		path := compiler.BuildLogPath(dst, p)
+		if _, err := os.Stat(path); err != nil {
+			return "", fmt.Errorf("no build log found for %s in %s", p.HumanReadableString(), dst)
+		}
+		return path, nil
+	}
+
+	pattern := compiler.BuildLogPath(dst, &types.Package{Category: p.GetCategory(), Name: p.GetName(), Version: "*", Arch: p.GetArch()})
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return "", err
+	}
+
+	prefix := strings.TrimSuffix(pattern, "*.log")
+	logs := map[string]string{}
+	versions := []string{}
+	for _, m := range matches {
+		v := strings.TrimSuffix(strings.TrimPrefix(m, prefix), ".log")
+		if p.IsSelector() {
+			if ok, _ := p.SelectorMatchVersion(v, nil); !ok {
+				continue
+			}
+		}
+		logs[v] = m
+		versions = append(versions, v)
+	}
+	if len(versions) == 0 {
+		return "", fmt.Errorf("no build log found for %s in %s", p.HumanReadableString(), dst)
+	}
+
+	versions = versioner.DefaultVersioner().Sort(versions)
+	return logs[versions[len(versions)-1]], nil
+}
+
+var buildLogsCmd = &cobra.Command{
+	Use:   "logs <package>",
+	Short: "Show the build log of a package",
+	Long: `Show the log of the last build of a package in the build destination.
+
+	$ luet build logs utils/yq
+
+Logs are stored in the logs folder of the build destination, and they are kept also for successful builds.
+The output of each build is appended to the log of the package. Use --arch for the packages built for an architecture.
+Use --path to print only the path of the log file:
+
+	$ luet build logs --destination build --path utils/yq@1.0
+`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dst, _ := cmd.Flags().GetString("destination")
+		onlyPath, _ := cmd.Flags().GetBool("path")
+		arch, _ := cmd.Flags().GetString("arch")
+
+		pack, err := helpers.ParsePackageStr(args[0])
+		if err != nil {
+			util.DefaultContext.Fatal("Invalid package string ", args[0], ": ", err.Error())
+		}
+
+		pack.Arch = arch
+		log, err := findBuildLog(dst, pack)
+		helpers.CheckErr(err)
+
+		if onlyPath {
+			fmt.Println(log)
+			return
+		}
+
+		f, err := os.Open(log)
+		helpers.CheckErr(err)
+		defer f.Close()
+
+		_, err = io.Copy(os.Stdout, f)
+		helpers.CheckErr(err)
+	},
+}
+
+func init() {
+	path, err := os.Getwd()
+	if err != nil {
+		util.DefaultContext.Fatal(err)
+	}
+
+	buildLogsCmd.Flags().String("destination", filepath.Join(path, "build"), "Destination folder of the build")
+	buildLogsCmd.Flags().Bool("path", false, "Print only the path of the log file")
+	buildLogsCmd.Flags().String("arch", "", "Architecture the package was built for")
+
+	buildCmd.AddCommand(buildLogsCmd)
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/ghodss/yaml"
 	helpers "github.com/mudler/luet/cmd/helpers"
 	"github.com/mudler/luet/cmd/util"
+	"github.com/mudler/luet/pkg/api/core/sbom"
 	"github.com/mudler/luet/pkg/api/core/types"
 	"github.com/mudler/luet/pkg/api/core/types/artifact"
 	"github.com/mudler/luet/pkg/compiler"
@@ -54,6 +55,10 @@ Builds only the leaf packages:
 
 	$ luet build --full
 
+Build only the packages changed since a git revision, and their reverse dependencies:
+
+	$ luet build --changed-since origin/master
+
 Build package revdeps:
 
 	$ luet build --revdeps utils/yq
@@ -65,6 +70,31 @@ Build package without dependencies (needs the images already in the host, or eit
 Build packages specifying multiple definition trees:
 
 	$ luet build --tree overlay/path --tree overlay/path2 utils/yq ...
+
+Generate a SBOM document (spdx or cyclonedx) alongside each artifact:
+
+	$ luet build --sbom spdx utils/yq
+
+Build all the packages, skipping only the ones depending on failed builds, and write a JUnit report:
+
+	$ luet build --all --keep-going --report report.xml --report-format junit
+
+Generate reproducible artifacts, with the modification times of the files clamped to SOURCE_DATE_EPOCH:
+
+	$ SOURCE_DATE_EPOCH=$(git log -1 --format=%ct) luet build --reproducible utils/yq
+
+Check if a package build is reproducible, building it twice from scratch and comparing the files of the artifacts:
+
+	$ luet build --verify-reproducible utils/yq
+
+Build packages without running their test phase:
+
+	$ luet build --skip-tests utils/yq
+
+Build packages offline, with the sources previously fetched with "luet tree fetch" in a shared cache:
+
+	$ luet tree fetch --sources-cache /var/cache/luet-sources utils/yq
+	$ luet build --sources-cache /var/cache/luet-sources utils/yq
 `, PreRun: func(cmd *cobra.Command, args []string) {
 		viper.BindPFlag("tree", cmd.Flags().Lookup("tree"))
 		viper.BindPFlag("destination", cmd.Flags().Lookup("destination"))
@@ -118,6 +148,22 @@ Build packages specifying multiple definition trees:
 		pretend, _ := cmd.Flags().GetBool("pretend")
 		fromRepo, _ := cmd.Flags().GetBool("from-repositories")
 		fromDockerfiles, _ := cmd.Flags().GetBool("dockerfiles")
+		sbomFormat, _ := cmd.Flags().GetString("sbom")
+		sourcesCache, _ := cmd.Flags().GetString("sources-cache")
+		changedSince, _ := cmd.Flags().GetString("changed-since")
+		arch, _ := cmd.Flags().GetString("arch")
+		keepGoing, _ := cmd.Flags().GetBool("keep-going")
+		skipTests, _ := cmd.Flags().GetBool("skip-tests")
+		reproducible, _ := cmd.Flags().GetBool("reproducible")
+		verifyReproducible, _ := cmd.Flags().GetBool("verify-reproducible")
+		report, _ := cmd.Flags().GetString("report")
+		reportFormat, _ := cmd.Flags().GetString("report-format")
+		compressionLevel, _ := cmd.Flags().GetInt("compression-level")
+
+		helpers.CheckErr(types.CompressionImplementation(compressionType).Validate(compressionLevel))
+		if report != "" && reportFormat != compiler.ReportJSON && reportFormat != compiler.ReportJUnit {
+			util.DefaultContext.Fatal("Invalid report format ", reportFormat, " (available: json, junit)")
+		}
 
 		compilerSpecs := types.NewLuetCompilationspecs()
 
@@ -166,6 +212,11 @@ Build packages specifying multiple definition trees:
 			templateFolders = util.TemplateFolders(util.DefaultContext, installer.BuildTreeResult{}, treePaths)
 		}
 
+		// Apply the system use flags, so they are considered while resolving and building packages
+		useFlags := util.DefaultContext.GetConfig().UseFlags
+		helpers.CheckErr(useFlags.ApplyDatabase(generalRecipe.GetDatabase()))
+		helpers.CheckErr(useFlags.ApplyDatabase(installerRecipe.GetDatabase()))
+
 		util.DefaultContext.Info("Building in", dst)
 
 		if !fileHelpers.Exists(dst) {
@@ -196,7 +247,11 @@ Build packages specifying multiple definition trees:
 			compiler.WithContext(util.DefaultContext),
 			compiler.BackendArgs(backendArgs),
 			compiler.Concurrency(concurrency),
-			compiler.WithCompressionType(types.CompressionImplementation(compressionType))}
+			compiler.KeepGoing(keepGoing),
+			compiler.SkipTests(skipTests),
+			compiler.Reproducible(reproducible),
+			compiler.WithCompressionType(types.CompressionImplementation(compressionType)),
+			compiler.WithCompressionLevel(compressionLevel)}
 
 		if pushFinalImages {
 			compileropts = append(compileropts, compiler.EnablePushFinalImages)
@@ -214,6 +269,20 @@ Build packages specifying multiple definition trees:
 			compileropts = append(compileropts, compiler.EnableGenerateFinalImages)
 		}
 
+		if arch != "" {
+			compileropts = append(compileropts, compiler.WithArch(arch))
+		}
+
+		if sbomFormat != "" {
+			_, err := sbom.ParseFormat(sbomFormat)
+			helpers.CheckErr(err)
+			compileropts = append(compileropts, compiler.WithSBOM(sbomFormat))
+		}
+
+		if sourcesCache != "" {
+			compileropts = append(compileropts, compiler.WithSourcesCache(sourcesCache))
+		}
+
 		luetCompiler := compiler.NewLuetCompiler(compilerBackend, generalRecipe.GetDatabase(), compileropts...)
 
 		if full {
@@ -224,6 +293,41 @@ Build packages specifying multiple definition trees:
 			for _, spec := range specs {
 				util.DefaultContext.Info(":package: Selecting ", spec.GetPackage().GetName(), spec.GetPackage().GetVersion())
 
+				compilerSpecs.Add(spec)
+			}
+		} else if changedSince != "" {
+			files := []string{}
+			for _, t := range treePaths {
+				f, err := tree.ChangedFiles(t, changedSince)
+				helpers.CheckErr(err)
+				files = append(files, f...)
+			}
+			changed, err := tree.ChangedPackages(generalRecipe.GetDatabase(), files, templateFolders)
+			helpers.CheckErr(err)
+
+			// The reverse dependencies are built against the changed packages
+			changedSpecs := types.NewLuetCompilationspecs()
+			for _, p := range changed {
+				for _, r := range append(types.Packages{p}, p.Revdeps(generalRecipe.GetDatabase())...) {
+					spec, err := luetCompiler.FromPackage(r)
+					if err != nil {
+						util.DefaultContext.Fatal("Error: " + err.Error())
+					}
+					changedSpecs.Add(spec)
+				}
+			}
+
+			specs, err := luetCompiler.ComputeMinimumCompilableSet(changedSpecs.Unique().All()...)
+			if err != nil {
+				util.DefaultContext.Fatal(err.Error())
+			}
+			if len(specs) == 0 {
+				util.DefaultContext.Info("No packages changed since", changedSince)
+				return
+			}
+			for _, spec := range specs {
+				util.DefaultContext.Info(":package: Selecting ", spec.GetPackage().GetName(), spec.GetPackage().GetVersion())
+				spec.SetOutputPath(dst)
 				compilerSpecs.Add(spec)
 			}
 		} else if !all {
@@ -311,10 +415,54 @@ Build packages specifying multiple definition trees:
 					util.DefaultContext.Info(p.String())
 				}
 			}
+		} else if verifyReproducible {
+			res, err := luetCompiler.VerifyReproducible(privileged, filepath.Join(dst, "reproducibility"), compilerSpecs)
+			if err != nil {
+				util.DefaultContext.Fatal(err.Error())
+			}
+
+			switch out {
+			case "yaml", "json":
+				y, err := yaml.Marshal(res)
+				helpers.CheckErr(err)
+				if out == "json" {
+					y, err = yaml.YAMLToJSON(y)
+					helpers.CheckErr(err)
+				}
+				fmt.Println(string(y))
+			default:
+				for _, r := range res {
+					if r.Reproducible() {
+						msg := ":white_check_mark: " + r.Package + " is reproducible"
+						if !r.IdenticalArchives {
+							msg += " (the archives differ only in timestamps or ordering, see --reproducible)"
+						}
+						util.DefaultContext.Success(msg)
+						continue
+					}
+					util.DefaultContext.Warning(fmt.Sprintf(":x: %s is not reproducible, %d files differ:", r.Package, len(r.Differences)))
+					for _, d := range r.Differences {
+						util.DefaultContext.Warning("  " + d.String())
+					}
+				}
+			}
+
+			for _, r := range res {
+				if !r.Reproducible() {
+					util.DefaultContext.Fatal(r.Package, "is not reproducible")
+				}
+			}
 		} else {
 
 			artifact, errs = luetCompiler.CompileParallel(privileged, compilerSpecs)
 		}
+		if report != "" && !pretend && !verifyReproducible {
+			if err := luetCompiler.BuildReport().WriteToFile(report, reportFormat); err != nil {
+				util.DefaultContext.Error("Failed writing the build report: " + err.Error())
+			} else {
+				util.DefaultContext.Info("Build report written to", report)
+			}
+		}
 		if len(errs) != 0 {
 			for _, e := range errs {
 				util.DefaultContext.Error("Error: " + e.Error())
@@ -334,7 +482,7 @@ func init() {
 	}
 
 	buildCmd.Flags().StringSliceP("tree", "t", []string{path}, "Path of the tree to use.")
-	buildCmd.Flags().String("backend", "docker", "backend used (docker,img)")
+	buildCmd.Flags().String("backend", "docker", "backend used (docker,img,box)")
 	buildCmd.Flags().Bool("privileged", true, "Privileged (Keep permissions)")
 	buildCmd.Flags().Bool("revdeps", false, "Build with revdeps")
 	buildCmd.Flags().Bool("all", false, "Build all specfiles in the tree")
@@ -345,11 +493,16 @@ func init() {
 	buildCmd.Flags().String("push-final-images-repository", "", "Repository where to push final images to")
 	buildCmd.Flags().Bool("dockerfiles", false, "Source packages also from dockerfiles")
 	buildCmd.Flags().Bool("full", false, "Build all packages (optimized)")
+	buildCmd.Flags().String("changed-since", "", "Build the packages changed in the tree since the given git revision, and their reverse dependencies")
 	buildCmd.Flags().StringSlice("values", []string{}, "Build values file to interpolate with each package")
 	buildCmd.Flags().StringSliceP("backend-args", "a", []string{}, "Backend args")
 
 	buildCmd.Flags().String("destination", filepath.Join(path, "build"), "Destination folder")
-	buildCmd.Flags().String("compression", "none", "Compression alg: none, gzip, zstd")
+	buildCmd.Flags().String("compression", "none", "Compression alg: none, gzip, zstd, xz, lz4")
+	buildCmd.Flags().Int("compression-level", 0, "Compression level (defaults to the one of the compression alg)")
+	buildCmd.Flags().String("arch", "", "Architecture to build the packages for. Without it, the packages are built for the host one and are not marked with an architecture")
+	buildCmd.Flags().String("sbom", "", "Generate a SBOM document for each artifact (spdx, cyclonedx)")
+	buildCmd.Flags().String("sources-cache", "", "Directory where the package sources are cached (defaults to a sources folder in the packages cache)")
 	buildCmd.Flags().String("image-repository", "luet/cache", "Default base image string for generated image")
 	buildCmd.Flags().Bool("push", false, "Push images to a hub")
 	buildCmd.Flags().Bool("pull", false, "Pull images from a hub")
@@ -366,6 +519,12 @@ func init() {
 	buildCmd.Flags().Bool("from-repositories", false, "Consume the user-defined repositories to pull specfiles from")
 	buildCmd.Flags().Bool("rebuild", false, "To combine with --pull. Allows to rebuild the target package even if an image is available, against a local values file")
 	buildCmd.Flags().Bool("pretend", false, "Just print what packages will be compiled")
+	buildCmd.Flags().Bool("skip-tests", false, "Don't run the test phase of the packages")
+	buildCmd.Flags().Bool("keep-going", false, "Keep building after a failure, skipping only the packages depending on the failed ones")
+	buildCmd.Flags().String("report", "", "Write a build report to the given file")
+	buildCmd.Flags().String("report-format", "json", "Format of the build report (json, junit)")
+	buildCmd.Flags().Bool("verify-reproducible", false, "Build the packages twice without reusing images, and report the files which differ")
+	buildCmd.Flags().Bool("reproducible", false, "Generate reproducible artifacts, clamping the modification times to SOURCE_DATE_EPOCH")
 	buildCmd.Flags().StringArrayP("pull-repository", "p", []string{}, "A list of repositories to pull the cache from")
 
 	buildCmd.Flags().StringP("output", "o", "terminal", "Output format ( Defaults: terminal, available: json,yaml )")
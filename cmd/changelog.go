@@ -0,0 +1,177 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/ghodss/yaml"
+	helpers "github.com/mudler/luet/cmd/helpers"
+	"github.com/mudler/luet/cmd/util"
+	"github.com/mudler/luet/pkg/api/core/types"
+	installer "github.com/mudler/luet/pkg/installer"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+type ChangelogResult struct {
+	Name       string          `json:"name"`
+	Category   string          `json:"category"`
+	Version    string          `json:"version"`
+	Repository string          `json:"repository"`
+	Changelog  types.Changelog `json:"changelog"`
+}
+
+type ChangelogResults struct {
+	Packages []ChangelogResult `json:"packages"`
+}
+
+var changelogCmd = &cobra.Command{
+	Use: "changelog <pkg1> <pkg2> ...",
+	// Skip processing output
+	Annotations: map[string]string{
+		util.CommandProcessOutput: "",
+	},
+	Short: "Show packages changelog",
+	Long: `Show the changelog of packages available in the repositories:
+
+	$ luet changelog system/foo
+
+To show only the changes that are not installed yet in the system:
+
+	$ luet changelog --pending system/foo
+
+To show the changes since a specific version:
+
+	$ luet changelog --since 1.0 system/foo
+
+To show the changelog of the installed packages:
+
+	$ luet changelog --installed system/foo
+`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var results ChangelogResults
+
+		installed, _ := cmd.Flags().GetBool("installed")
+		pending, _ := cmd.Flags().GetBool("pending")
+		since, _ := cmd.Flags().GetString("since")
+		out, _ := cmd.Flags().GetString("output")
+
+		packs := types.Packages{}
+		for _, a := range args {
+			pack, err := helpers.ParsePackageStr(a)
+			if err != nil {
+				util.DefaultContext.Fatal("Invalid package string ", a, ": ", err.Error())
+			}
+			packs = append(packs, pack)
+		}
+
+		system := sys()
+		matches := []installer.PackageMatch{}
+		if installed {
+			for _, p := range packs {
+				c, err := system.Database.FindPackageCandidate(p)
+				if err != nil {
+					util.DefaultContext.Fatal("Package ", p.HumanReadableString(), " is not installed")
+				}
+				matches = append(matches, installer.PackageMatch{Package: c})
+			}
+		} else {
+			inst := installer.NewLuetInstaller(
+				installer.LuetInstallerOptions{
+					Concurrency:         util.DefaultContext.Config.General.Concurrency,
+					SolverOptions:       util.DefaultContext.Config.Solver,
+					PackageRepositories: util.DefaultContext.Config.SystemRepositories,
+					Context:             util.DefaultContext,
+				},
+			)
+			synced, err := inst.SyncRepositories()
+			if err != nil {
+				util.DefaultContext.Fatal("Error: " + err.Error())
+			}
+			matches = synced.PackageMatches(synced.ResolveSelectors(packs))
+			if len(matches) == 0 {
+				util.DefaultContext.Fatal("No packages found matching ", packs.Unique())
+			}
+		}
+
+		for _, m := range matches {
+			from := since
+			if pending {
+				c := m.Package.Clone()
+				c.SetVersion(">=0")
+				if i, err := system.Database.FindPackageCandidate(c); err == nil {
+					from = i.GetVersion()
+				}
+			}
+
+			repo := "system"
+			if m.Repo != nil {
+				repo = m.Repo.GetName()
+			}
+			results.Packages = append(results.Packages, ChangelogResult{
+				Name:       m.Package.GetName(),
+				Category:   m.Package.GetCategory(),
+				Version:    m.Package.GetVersion(),
+				Repository: repo,
+				Changelog:  m.Package.GetChangelog().Between(from, m.Package.GetVersion()),
+			})
+		}
+
+		switch out {
+		case "yaml", "json":
+			y, err := yaml.Marshal(results)
+			if err != nil {
+				util.DefaultContext.Fatal(err.Error())
+			}
+			if out == "json" {
+				y, err = yaml.YAMLToJSON(y)
+				if err != nil {
+					util.DefaultContext.Fatal(err.Error())
+				}
+			}
+			fmt.Println(string(y))
+		default:
+			for _, r := range results.Packages {
+				fmt.Println(pterm.LightCyan(fmt.Sprintf("%s/%s-%s", r.Category, r.Name, r.Version)), "("+r.Repository+")")
+				if len(r.Changelog) == 0 {
+					fmt.Println("  No changelog entries")
+				}
+				for _, e := range r.Changelog {
+					header := e.Version
+					if e.Date != "" {
+						header = fmt.Sprintf("%s (%s)", e.Version, e.Date)
+					}
+					fmt.Println("  " + pterm.LightGreen(header))
+					for _, c := range e.Changes {
+						fmt.Println("    - " + c)
+					}
+				}
+				fmt.Println()
+			}
+		}
+	},
+}
+
+func init() {
+	changelogCmd.Flags().Bool("installed", false, "Show the changelog of the installed packages")
+	changelogCmd.Flags().Bool("pending", false, "Show only the entries newer than the installed version")
+	changelogCmd.Flags().String("since", "", "Show only the entries newer than the given version")
+	changelogCmd.Flags().StringP("output", "o", "terminal", "Output format ( Defaults: terminal, available: json,yaml )")
+
+	RootCmd.AddCommand(changelogCmd)
+}
@@ -51,6 +51,8 @@ Change compression method:
 	
 	$ luet create-repo --tree-compression gzip --meta-compression gzip
 
+	$ luet create-repo --tree-compression xz --tree-compression-level 9
+
 Create a repository from the metadata description defined in the luet.yaml config file:
 
 	$ luet create-repo --repo repository1
@@ -90,12 +92,17 @@ Create a repository from the metadata description defined in the luet.yaml confi
 		treetype := viper.GetString("tree-compression")
 		treeName := viper.GetString("tree-filename")
 		metatype := viper.GetString("meta-compression")
+		treeLevel, _ := cmd.Flags().GetInt("tree-compression-level")
+		metaLevel, _ := cmd.Flags().GetInt("meta-compression-level")
 		metaName := viper.GetString("meta-filename")
 		source_repo := viper.GetString("repo")
 		backendType := viper.GetString("backend")
 		fromRepo, _ := cmd.Flags().GetBool("from-repositories")
 		dockerFiles, _ := cmd.Flags().GetBool("dockerfiles")
 
+		helpers.CheckErr(types.CompressionImplementation(treetype).Validate(treeLevel))
+		helpers.CheckErr(types.CompressionImplementation(metatype).Validate(metaLevel))
+
 		treeFile := installer.NewDefaultTreeRepositoryFile()
 		metaFile := installer.NewDefaultMetaRepositoryFile()
 		compilerBackend, err := compiler.NewBackend(util.DefaultContext, backendType)
@@ -159,6 +166,7 @@ Create a repository from the metadata description defined in the luet.yaml confi
 		if treetype != "" {
 			treeFile.SetCompressionType(types.CompressionImplementation(treetype))
 		}
+		treeFile.SetCompressionLevel(treeLevel)
 
 		if treeName != "" {
 			treeFile.SetFileName(treeName)
@@ -167,6 +175,7 @@ Create a repository from the metadata description defined in the luet.yaml confi
 		if metatype != "" {
 			metaFile.SetCompressionType(types.CompressionImplementation(metatype))
 		}
+		metaFile.SetCompressionLevel(metaLevel)
 
 		if metaName != "" {
 			metaFile.SetFileName(metaName)
@@ -194,16 +203,18 @@ func init() {
 	createrepoCmd.Flags().String("type", "disk", "Repository type (disk, http, docker)")
 	createrepoCmd.Flags().Bool("reset-revision", false, "Reset repository revision.")
 	createrepoCmd.Flags().String("repo", "", "Use repository defined in configuration.")
-	createrepoCmd.Flags().String("backend", "docker", "backend used (docker,img)")
+	createrepoCmd.Flags().String("backend", "docker", "backend used (docker,img,box)")
 	createrepoCmd.Flags().Bool("dockerfiles", false, "Read dockerfiles in tree as packages.")
 
 	createrepoCmd.Flags().Bool("force-push", false, "Force overwrite of docker images if already present online")
 	createrepoCmd.Flags().Bool("push-images", false, "Enable/Disable docker image push for docker repositories")
 	createrepoCmd.Flags().Bool("from-metadata", false, "Consider metadata files from the packages folder while indexing the new tree")
 
-	createrepoCmd.Flags().String("tree-compression", "gzip", "Compression alg: none, gzip, zstd")
+	createrepoCmd.Flags().String("tree-compression", "gzip", "Compression alg: none, gzip, zstd, xz, lz4")
+	createrepoCmd.Flags().Int("tree-compression-level", 0, "Compression level of the tree (defaults to the one of the compression alg)")
 	createrepoCmd.Flags().String("tree-filename", installer.TREE_TARBALL, "Repository tree filename")
-	createrepoCmd.Flags().String("meta-compression", "none", "Compression alg: none, gzip, zstd")
+	createrepoCmd.Flags().String("meta-compression", "none", "Compression alg: none, gzip, zstd, xz, lz4")
+	createrepoCmd.Flags().Int("meta-compression-level", 0, "Compression level of the metadata (defaults to the one of the compression alg)")
 	createrepoCmd.Flags().String("meta-filename", installer.REPOSITORY_METAFILE+".tar", "Repository metadata filename")
 	createrepoCmd.Flags().Bool("from-repositories", false, "Consume the user-defined repositories to pull specfiles from")
 	createrepoCmd.Flags().String("snapshot-id", "", "Unique ID to use when creating repository snapshots")
@@ -40,6 +40,10 @@ To not install deps of a package:
 	
 	$ luet install --nodeps utils/busybox ...
 
+To not install the packages recommended by a package:
+
+	$ luet install --no-recommends utils/busybox ...
+
 To force install a package:
 	
 	$ luet install --force utils/busybox ...
@@ -68,6 +72,7 @@ To force install a package:
 		yes := viper.GetBool("yes")
 		downloadOnly, _ := cmd.Flags().GetBool("download-only")
 		relax, _ := cmd.Flags().GetBool("relax")
+		noRecommends, _ := cmd.Flags().GetBool("no-recommends")
 
 		util.DefaultContext.Debug("Solver", util.DefaultContext.Config.Solver.CompactString())
 
@@ -77,6 +82,7 @@ To force install a package:
 			NoDeps:                      nodeps,
 			Force:                       force,
 			OnlyDeps:                    onlydeps,
+			NoRecommends:                noRecommends,
 			PreserveSystemEssentialData: true,
 			DownloadOnly:                downloadOnly,
 			Ask:                         !yes,
@@ -102,6 +108,7 @@ func init() {
 	installCmd.Flags().Bool("relax", false, "Relax installation constraints")
 
 	installCmd.Flags().Bool("onlydeps", false, "Consider **only** package dependencies")
+	installCmd.Flags().Bool("no-recommends", false, "Don't install the packages recommended by the ones being installed")
 	installCmd.Flags().Bool("force", false, "Skip errors and keep going (potentially harmful)")
 	installCmd.Flags().Bool("solver-concurrent", false, "Use concurrent solver (experimental)")
 	installCmd.Flags().BoolP("yes", "y", false, "Don't ask questions")
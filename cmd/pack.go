@@ -38,6 +38,7 @@ Pack can be used to manually replace what "luet build" does automatically by rea
 	$ mkdir -p output/etc/foo
 	$ echo "my config" > output/etc/foo
 	$ luet pack foo/bar@1.1 --source output
+	$ luet pack foo/bar@1.1 --source output --compression xz --compression-level 9
 
 Afterwards, you can use the content generated and associate it with a tree and a corresponding definition.yaml file with "luet create-repo".
 `,
@@ -51,6 +52,7 @@ Afterwards, you can use the content generated and associate it with a tree and a
 
 		dst := viper.GetString("destination")
 		compressionType := viper.GetString("compression")
+		compressionLevel, _ := cmd.Flags().GetInt("compression-level")
 		concurrency := util.DefaultContext.Config.General.Concurrency
 
 		if len(args) != 1 {
@@ -67,6 +69,7 @@ Afterwards, you can use the content generated and associate it with a tree and a
 		spec := &types.LuetCompilationSpec{Package: p}
 		a := artifact.NewPackageArtifact(filepath.Join(dst, p.GetFingerPrint()+".package.tar"))
 		a.CompressionType = types.CompressionImplementation(compressionType)
+		a.CompressionLevel = compressionLevel
 		err = a.Compress(sourcePath, concurrency)
 		if err != nil {
 			util.DefaultContext.Fatal("failed compressing ", packageName, ": ", err.Error())
@@ -92,7 +95,8 @@ func init() {
 	}
 	packCmd.Flags().String("source", path, "Source folder")
 	packCmd.Flags().String("destination", path, "Destination folder")
-	packCmd.Flags().String("compression", "gzip", "Compression alg: none, gzip")
+	packCmd.Flags().String("compression", "gzip", "Compression alg: none, gzip, zstd, xz, lz4")
+	packCmd.Flags().Int("compression-level", 0, "Compression level (defaults to the one of the compression alg)")
 
 	RootCmd.AddCommand(packCmd)
 }
@@ -35,5 +35,6 @@ func init() {
 		NewRepoGetCommand(),
 		NewRepoListCommand(),
 		NewRepoUpdateCommand(),
+		NewRepoDiffCommand(),
 	)
 }
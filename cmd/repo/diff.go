@@ -0,0 +1,227 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package cmd_repo
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/mudler/luet/cmd/util"
+	installer "github.com/mudler/luet/pkg/installer"
+	"github.com/pterm/pterm"
+
+	"github.com/spf13/cobra"
+)
+
+// repoRevisionLoader resolves the revisions of a repository to compare,
+// fetching the latest and the cached one only once
+type repoRevisionLoader struct {
+	repo           *installer.LuetSystemRepository
+	latest, cached *installer.LuetSystemRepository
+}
+
+func (l *repoRevisionLoader) getLatest() (*installer.LuetSystemRepository, error) {
+	if l.latest == nil {
+		r, err := l.repo.Fetch(util.DefaultContext, "")
+		if err != nil {
+			return nil, err
+		}
+		l.latest = r
+	}
+	return l.latest, nil
+}
+
+func (l *repoRevisionLoader) getCached() (*installer.LuetSystemRepository, error) {
+	if l.cached == nil {
+		r, err := l.repo.LoadCached(util.DefaultContext)
+		if err != nil {
+			return nil, err
+		}
+		l.cached = r
+	}
+	return l.cached, nil
+}
+
+// load returns the repository revision selected by a snapshot or a revision number.
+// Revision numbers can refer only to the latest or to the cached revision, as older
+// ones are reachable only by their snapshot.
+func (l *repoRevisionLoader) load(snapshot string, rev int, defaultToCached bool) (*installer.LuetSystemRepository, error) {
+	if snapshot != "" {
+		r, err := l.repo.Fetch(util.DefaultContext, installer.SnapshotReferenceID(snapshot))
+		if err != nil {
+			return nil, err
+		}
+		if rev > 0 && r.GetRevision() != rev {
+			return nil, fmt.Errorf("snapshot '%s' has revision %d, not %d", snapshot, r.GetRevision(), rev)
+		}
+		return r, nil
+	}
+
+	if rev <= 0 {
+		if defaultToCached {
+			r, err := l.getCached()
+			if err != nil {
+				return nil, fmt.Errorf("%s, select the revision to compare with --from-snapshot or --from-rev", err.Error())
+			}
+			return r, nil
+		}
+		return l.getLatest()
+	}
+
+	available := []string{}
+	if r, err := l.getCached(); err == nil {
+		if r.GetRevision() == rev {
+			return r, nil
+		}
+		available = append(available, fmt.Sprintf("%d (cached)", r.GetRevision()))
+	}
+	r, err := l.getLatest()
+	if err != nil {
+		return nil, err
+	}
+	if r.GetRevision() == rev {
+		return r, nil
+	}
+	available = append(available, fmt.Sprintf("%d (latest)", r.GetRevision()))
+
+	return nil, fmt.Errorf("revision %d is not available (available: %s), use snapshots to refer to older revisions", rev, strings.Join(available, ", "))
+}
+
+func printRepoDiff(d *installer.RepositoryDiff) {
+	fmt.Println(pterm.LightCyan(fmt.Sprintf("%s: revision %d -> %d", d.Name, d.From.Revision, d.To.Revision)))
+	if d.Empty() {
+		fmt.Println("No changes")
+		return
+	}
+
+	for _, p := range d.Added {
+		fmt.Println(pterm.LightGreen("+ " + p))
+	}
+	for _, p := range d.Removed {
+		fmt.Println(pterm.LightRed("- " + p))
+	}
+	for _, c := range d.Changed {
+		fmt.Println(pterm.LightYellow(fmt.Sprintf("~ %s: %s -> %s", c.Package, strings.Join(c.From, ", "), strings.Join(c.To, ", "))))
+	}
+
+	if len(d.Dependencies) > 0 {
+		fmt.Println()
+		fmt.Println("Dependencies:")
+		for _, c := range d.Dependencies {
+			fmt.Println("  " + c.Package)
+			for _, r := range c.AddedRequires {
+				fmt.Println(pterm.LightGreen("    + requires " + r))
+			}
+			for _, r := range c.RemovedRequires {
+				fmt.Println(pterm.LightRed("    - requires " + r))
+			}
+			for _, r := range c.AddedConflicts {
+				fmt.Println(pterm.LightGreen("    + conflicts " + r))
+			}
+			for _, r := range c.RemovedConflicts {
+				fmt.Println(pterm.LightRed("    - conflicts " + r))
+			}
+		}
+	}
+
+	if len(d.Checksums) > 0 {
+		fmt.Println()
+		fmt.Println("Artifacts changed:")
+		for _, c := range d.Checksums {
+			fmt.Printf("  %s\n    %s\n    %s\n", c.Package, pterm.LightRed("- "+c.From), pterm.LightGreen("+ "+c.To))
+		}
+	}
+}
+
+func NewRepoDiffCommand() *cobra.Command {
+	var ans = &cobra.Command{
+		Use:   "diff [OPTIONS] name",
+		Short: "Show the changes between two revisions of a repository",
+		Long: `Show the packages added, removed and changed between two revisions of a repository,
+along with the changed dependencies and artifacts.
+
+By default the revision in the local cache is compared with the latest one available.
+Revisions can be selected by their snapshot ID, or by their number if they are
+the cached or the latest one.`,
+		Example: `
+# Show what changed since the last sync of repo1
+$> luet repo diff repo1
+
+# Compare two snapshots
+$> luet repo diff --from-snapshot 20220101000000 --to-snapshot 20220201000000 repo1
+
+# Compare a snapshot with the latest revision, in JSON
+$> luet repo diff --from-snapshot 20220101000000 -o json repo1
+`,
+		Args: cobra.ExactArgs(1),
+		// Skip processing output
+		Annotations: map[string]string{
+			util.CommandProcessOutput: "",
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			out, _ := cmd.Flags().GetString("output")
+			fromSnapshot, _ := cmd.Flags().GetString("from-snapshot")
+			toSnapshot, _ := cmd.Flags().GetString("to-snapshot")
+			fromRev, _ := cmd.Flags().GetInt("from-rev")
+			toRev, _ := cmd.Flags().GetInt("to-rev")
+
+			repo, err := util.DefaultContext.Config.GetSystemRepository(args[0])
+			if err != nil {
+				util.DefaultContext.Fatal(err.Error())
+			}
+
+			loader := &repoRevisionLoader{repo: installer.NewSystemRepository(*repo)}
+
+			from, err := loader.load(fromSnapshot, fromRev, true)
+			if err != nil {
+				util.DefaultContext.Fatal("Error loading the revision to compare from: " + err.Error())
+			}
+			to, err := loader.load(toSnapshot, toRev, false)
+			if err != nil {
+				util.DefaultContext.Fatal("Error loading the revision to compare to: " + err.Error())
+			}
+
+			d := installer.DiffRepositories(from, to)
+
+			out = strings.ToLower(out)
+			switch out {
+			case "yaml", "json":
+				y, err := yaml.Marshal(d)
+				if err != nil {
+					util.DefaultContext.Fatal(err.Error())
+				}
+				if out == "json" {
+					y, err = yaml.YAMLToJSON(y)
+					if err != nil {
+						util.DefaultContext.Fatal(err.Error())
+					}
+				}
+				fmt.Println(string(y))
+			default:
+				printRepoDiff(d)
+			}
+		},
+	}
+
+	ans.Flags().String("from-snapshot", "", "Snapshot ID of the revision to compare from")
+	ans.Flags().String("to-snapshot", "", "Snapshot ID of the revision to compare to")
+	ans.Flags().Int("from-rev", 0, "Revision number to compare from (the cached or the latest one)")
+	ans.Flags().Int("to-rev", 0, "Revision number to compare to (the cached or the latest one)")
+	ans.Flags().StringP("output", "o", "terminal", "Output format ( Defaults: terminal, available: json,yaml )")
+
+	return ans
+}
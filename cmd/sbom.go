@@ -0,0 +1,101 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"fmt"
+
+	helpers "github.com/mudler/luet/cmd/helpers"
+	"github.com/mudler/luet/cmd/util"
+	"github.com/mudler/luet/pkg/api/core/sbom"
+	"github.com/mudler/luet/pkg/api/core/types"
+
+	"github.com/spf13/cobra"
+)
+
+var sbomCmd = &cobra.Command{
+	Use:   "sbom [pkg1] [pkg2] ...",
+	Short: "Generate a SBOM of the installed packages",
+	Long: `Generate a Software Bill of Materials of the packages installed in the system:
+
+	$ luet sbom
+
+The document can be generated in the SPDX (default) or in the CycloneDX format:
+
+	$ luet sbom --format cyclonedx
+
+To restrict the document to a set of installed packages:
+
+	$ luet sbom system/foo system/bar
+
+To write the document to a file:
+
+	$ luet sbom --file system.spdx.json
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		f, _ := cmd.Flags().GetString("format")
+		name, _ := cmd.Flags().GetString("name")
+		file, _ := cmd.Flags().GetString("file")
+
+		format, err := sbom.ParseFormat(f)
+		helpers.CheckErr(err)
+
+		system := sys()
+		components, err := sbom.FromSystem(system.Database, system.Target)
+		helpers.CheckErr(err)
+
+		if len(args) > 0 {
+			packs := types.Packages{}
+			for _, a := range args {
+				pack, err := helpers.ParsePackageStr(a)
+				if err != nil {
+					util.DefaultContext.Fatal("Invalid package string ", a, ": ", err.Error())
+				}
+				packs = append(packs, pack)
+			}
+
+			filtered := []*sbom.Component{}
+			for _, c := range components {
+				for _, p := range packs {
+					if c.Package.AtomMatches(p) {
+						filtered = append(filtered, c)
+						break
+					}
+				}
+			}
+			components = filtered
+		}
+
+		doc := sbom.NewDocument(name, components...)
+		if file != "" {
+			helpers.CheckErr(doc.WriteFile(format, file))
+			util.DefaultContext.Success("SBOM written to", file)
+			return
+		}
+
+		data, err := doc.Marshal(format)
+		helpers.CheckErr(err)
+		fmt.Println(string(data))
+	},
+}
+
+func init() {
+	sbomCmd.Flags().StringP("format", "f", string(sbom.SPDX), "SBOM format (spdx, cyclonedx)")
+	sbomCmd.Flags().String("name", "luet-system", "Name of the SBOM document")
+	sbomCmd.Flags().String("file", "", "Write the document to the given file instead of the standard output")
+
+	RootCmd.AddCommand(sbomCmd)
+}
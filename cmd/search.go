@@ -19,6 +19,7 @@ import (
 	"strings"
 
 	"github.com/ghodss/yaml"
+	helpers "github.com/mudler/luet/cmd/helpers"
 	"github.com/mudler/luet/cmd/util"
 	"github.com/mudler/luet/pkg/api/core/types"
 	installer "github.com/mudler/luet/pkg/installer"
@@ -36,6 +37,10 @@ type PackageResult struct {
 	Hidden     bool     `json:"hidden"`
 	Files      []string `json:"files"`
 	Installed  bool     `json:"installed"`
+	Requires   []string `json:"requires,omitempty"`
+	Conflicts  []string `json:"conflicts,omitempty"`
+	Suggests   []string `json:"suggests,omitempty"`
+	Provides   []string `json:"provides,omitempty"`
 }
 
 type Results struct {
@@ -46,6 +51,16 @@ func (r PackageResult) String() string {
 	return fmt.Sprintf("%s/%s-%s required for %s", r.Category, r.Name, r.Version, r.Target)
 }
 
+// dependencies returns the requires, conflicts or suggests entries of a package in
+// human readable form, with the alternatives separated by '|'
+func dependencies(deps []*types.Package) []string {
+	res := []string{}
+	for _, d := range deps {
+		res = append(res, d.DependencyString())
+	}
+	return res
+}
+
 var rows []string = []string{"Package", "Category", "Name", "Version", "Repository", "License", "Installed"}
 
 func packageToRow(repo string, p *types.Package, installed bool) []string {
@@ -81,6 +96,30 @@ func packageToList(l *util.ListWriter, repo string, p *types.Package, installed
 		Level: 1, Text: fmt.Sprintf("Uri: %s ", strings.Join(p.GetURI(), " ")),
 		Bullet: "->", BulletStyle: pterm.NewStyle(pterm.FgDarkGray),
 	})
+	if len(p.GetRequires()) != 0 {
+		l.AppendItem(pterm.BulletListItem{
+			Level: 1, Text: fmt.Sprintf("Requires: %s", strings.Join(dependencies(p.GetRequires()), ", ")),
+			Bullet: "->", BulletStyle: pterm.NewStyle(pterm.FgDarkGray),
+		})
+	}
+	if len(p.GetConflicts()) != 0 {
+		l.AppendItem(pterm.BulletListItem{
+			Level: 1, Text: fmt.Sprintf("Conflicts: %s", strings.Join(dependencies(p.GetConflicts()), ", ")),
+			Bullet: "->", BulletStyle: pterm.NewStyle(pterm.FgDarkGray),
+		})
+	}
+	if len(p.GetSuggests()) != 0 {
+		l.AppendItem(pterm.BulletListItem{
+			Level: 1, Text: fmt.Sprintf("Suggests: %s", strings.Join(dependencies(p.GetSuggests()), ", ")),
+			Bullet: "->", BulletStyle: pterm.NewStyle(pterm.FgDarkGray),
+		})
+	}
+	if len(p.GetProvides()) != 0 {
+		l.AppendItem(pterm.BulletListItem{
+			Level: 1, Text: fmt.Sprintf("Provides: %s", strings.Join(dependencies(p.GetProvides()), ", ")),
+			Bullet: "->", BulletStyle: pterm.NewStyle(pterm.FgDarkGray),
+		})
+	}
 	l.AppendItem(pterm.BulletListItem{
 		Level: 1, Text: fmt.Sprintf("Installed: %t ", installed),
 		Bullet: "->", BulletStyle: pterm.NewStyle(pterm.FgDarkGray),
@@ -137,6 +176,9 @@ func searchLocally(term string, l *util.ListWriter, t *util.TableWriter, label,
 						Hidden:     pack.IsHidden(),
 						Files:      f,
 						Installed:  true,
+						Requires:   dependencies(pack.GetRequires()),
+						Conflicts:  dependencies(pack.GetConflicts()),
+						Suggests:   dependencies(pack.GetSuggests()),
 					})
 			}
 		} else {
@@ -157,6 +199,9 @@ func searchLocally(term string, l *util.ListWriter, t *util.TableWriter, label,
 							Hidden:     revdep.IsHidden(),
 							Files:      f,
 							Installed:  i,
+							Requires:   dependencies(revdep.GetRequires()),
+							Conflicts:  dependencies(revdep.GetConflicts()),
+							Suggests:   dependencies(revdep.GetSuggests()),
 						})
 				}
 			}
@@ -205,6 +250,9 @@ func searchOnline(term string, l *util.ListWriter, t *util.TableWriter, label, l
 					Repository: m.Repo.GetName(),
 					Hidden:     m.Package.IsHidden(),
 					Installed:  i,
+					Requires:   dependencies(m.Package.GetRequires()),
+					Conflicts:  dependencies(m.Package.GetConflicts()),
+					Suggests:   dependencies(m.Package.GetSuggests()),
 				}
 				if m.Artifact != nil {
 					r.Files = m.Artifact.Files
@@ -225,6 +273,9 @@ func searchOnline(term string, l *util.ListWriter, t *util.TableWriter, label, l
 						Category:   revdep.GetCategory(),
 						Repository: m.Repo.GetName(),
 						Hidden:     revdep.IsHidden(),
+						Requires:   dependencies(revdep.GetRequires()),
+						Conflicts:  dependencies(revdep.GetConflicts()),
+						Suggests:   dependencies(revdep.GetSuggests()),
 					}
 					if m.Artifact != nil {
 						r.Files = m.Artifact.Files
@@ -301,6 +352,71 @@ func searchFiles(term string, l *util.ListWriter, t *util.TableWriter) Results {
 	return results
 }
 
+func searchProviders(term string, l *util.ListWriter, t *util.TableWriter, installedOnly, hidden bool) Results {
+	var results Results
+
+	virtual, err := helpers.ParsePackageStr(term)
+	if err != nil {
+		util.DefaultContext.Fatal("Invalid package string ", term, ": ", err.Error())
+	}
+
+	matches := []installer.PackageMatch{}
+	if installedOnly {
+		packs, _ := sys().Database.FindPackages(virtual)
+		for _, pack := range packs {
+			if pack.IsProviderOf(virtual) {
+				matches = append(matches, installer.PackageMatch{Package: pack})
+			}
+		}
+	} else {
+		inst := installer.NewLuetInstaller(
+			installer.LuetInstallerOptions{
+				Concurrency:         util.DefaultContext.Config.General.Concurrency,
+				SolverOptions:       util.DefaultContext.Config.Solver,
+				PackageRepositories: util.DefaultContext.Config.SystemRepositories,
+				Context:             util.DefaultContext,
+			},
+		)
+		synced, err := inst.SyncRepositories()
+		if err != nil {
+			util.DefaultContext.Fatal("Error: " + err.Error())
+		}
+		matches = synced.SearchProviders(virtual)
+	}
+
+	util.DefaultContext.Info("--- Providers of (" + term + "): ---")
+
+	for _, m := range matches {
+		if m.Package.IsHidden() && !hidden {
+			continue
+		}
+		repo := "system"
+		if m.Repo != nil {
+			repo = m.Repo.GetName()
+		}
+		i := installed(m.Package)
+		t.AppendRow(packageToRow(repo, m.Package, i))
+		packageToList(l, repo, m.Package, i)
+		r := PackageResult{
+			Name:       m.Package.GetName(),
+			Version:    m.Package.GetVersion(),
+			Category:   m.Package.GetCategory(),
+			Repository: repo,
+			Hidden:     m.Package.IsHidden(),
+			Installed:  i,
+			Requires:   dependencies(m.Package.GetRequires()),
+			Conflicts:  dependencies(m.Package.GetConflicts()),
+			Suggests:   dependencies(m.Package.GetSuggests()),
+			Provides:   dependencies(m.Package.GetProvides()),
+		}
+		if m.Artifact != nil {
+			r.Files = m.Artifact.Files
+		}
+		results.Packages = append(results.Packages, r)
+	}
+	return results
+}
+
 var searchCmd = &cobra.Command{
 	Use: "search <term>",
 	// Skip processing output
@@ -336,6 +452,10 @@ It can also show a package revdeps by:
 
 	$ luet search --revdeps <regex>
 
+or list the packages providing a virtual package:
+
+	$ luet search --provides libssl@">=3"
+
 Search can also return results in the terminal in different ways: as terminal output, as json or as yaml.
 
 	$ luet search --json <regex> # JSON output
@@ -361,6 +481,7 @@ Search can also return results in the terminal in different ways: as terminal ou
 		revdeps, _ := cmd.Flags().GetBool("revdeps")
 		tableMode, _ := cmd.Flags().GetBool("table")
 		files, _ := cmd.Flags().GetBool("files")
+		provides, _ := cmd.Flags().GetBool("provides")
 
 		out, _ := cmd.Flags().GetString("output")
 		l := &util.ListWriter{}
@@ -369,6 +490,8 @@ Search can also return results in the terminal in different ways: as terminal ou
 		util.DefaultContext.Debug("Solver", util.DefaultContext.Config.Solver.CompactString())
 
 		switch {
+		case provides:
+			results = searchProviders(args[0], l, t, installed, hidden)
 		case files && installed:
 			results = searchLocalFiles(args[0], l, t)
 		case files && !installed:
@@ -418,6 +541,7 @@ func init() {
 	searchCmd.Flags().Bool("hidden", false, "Include hidden packages")
 	searchCmd.Flags().Bool("table", false, "show output in a table (wider screens)")
 	searchCmd.Flags().Bool("files", false, "Search between packages files")
+	searchCmd.Flags().Bool("provides", false, "Search the packages providing a (virtual) package")
 
 	RootCmd.AddCommand(searchCmd)
 }
@@ -0,0 +1,138 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package cmd_tree
+
+import (
+	"os"
+
+	helpers "github.com/mudler/luet/cmd/helpers"
+	"github.com/mudler/luet/cmd/util"
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/mudler/luet/pkg/compiler"
+	"github.com/mudler/luet/pkg/compiler/backend"
+	"github.com/mudler/luet/pkg/installer"
+
+	pkg "github.com/mudler/luet/pkg/database"
+	tree "github.com/mudler/luet/pkg/tree"
+
+	"github.com/spf13/cobra"
+)
+
+func NewTreeFetchCommand() *cobra.Command {
+
+	var ans = &cobra.Command{
+		Use:   "fetch [OPTIONS] [package...]",
+		Short: "Fetch the sources of the packages in the sources cache",
+		Long: `Downloads and verifies the sources declared in the build specs of the packages, so they can be built offline.
+
+Fetch the sources of all the packages of the tree:
+
+	$ luet tree fetch -t tree
+
+Fetch the sources of a package and of its build dependencies in a specific cache:
+
+	$ luet tree fetch -t tree --sources-cache /var/cache/luet-sources utils/yq
+`,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			t, _ := cmd.Flags().GetStringArray("tree")
+			if len(t) == 0 {
+				util.DefaultContext.Fatal("Mandatory tree param missing.")
+			}
+			util.BindValuesFlags(cmd)
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			treePath, _ := cmd.Flags().GetStringArray("tree")
+			sourcesCache, _ := cmd.Flags().GetString("sources-cache")
+			values := util.ValuesFlags()
+			reciper := tree.NewCompilerRecipe(pkg.NewInMemoryDatabase(false))
+
+			for _, t := range treePath {
+				err := reciper.Load(t)
+				if err != nil {
+					util.DefaultContext.Fatal("Error on load tree ", err)
+				}
+			}
+
+			opts := util.DefaultContext.Config.Solver
+			opts.SolverOptions = types.SolverOptions{Type: types.SolverSingleCoreSimple, Concurrency: 1}
+			luetCompiler := compiler.NewLuetCompiler(
+				backend.NewSimpleDockerBackend(util.DefaultContext),
+				reciper.GetDatabase(),
+				compiler.WithBuildValues(values),
+				compiler.WithContext(util.DefaultContext),
+				compiler.WithTemplateFolder(util.TemplateFolders(util.DefaultContext, installer.BuildTreeResult{}, treePath)),
+				compiler.WithSolverOptions(opts),
+				compiler.WithSourcesCache(sourcesCache),
+			)
+
+			var specs []*types.LuetCompilationSpec
+			if len(args) == 0 {
+				s, err := luetCompiler.FromDatabase(reciper.GetDatabase(), false, "")
+				if err != nil {
+					util.DefaultContext.Fatal("Error: " + err.Error())
+				}
+				specs = s
+			}
+
+			for _, a := range args {
+				pack, err := helpers.ParsePackageStr(a)
+				if err != nil {
+					util.DefaultContext.Fatal("Invalid package string ", a, ": ", err.Error())
+				}
+
+				spec, err := luetCompiler.FromPackage(pack)
+				if err != nil {
+					util.DefaultContext.Fatal("Error: " + err.Error())
+				}
+
+				// The build dependencies are needed as well to build the package offline
+				deps, err := luetCompiler.ComputeDepTree(spec, reciper.GetDatabase())
+				if err != nil {
+					util.DefaultContext.Fatal("Error: " + err.Error())
+				}
+				for _, d := range deps {
+					if !d.Value {
+						continue
+					}
+					s, err := luetCompiler.FromPackage(d.Package)
+					if err != nil {
+						util.DefaultContext.Fatal("Error: " + err.Error())
+					}
+					specs = append(specs, s)
+				}
+			}
+
+			sources := 0
+			for _, s := range specs {
+				sources += len(s.Sources)
+			}
+
+			if err := luetCompiler.FetchSources(specs...); err != nil {
+				util.DefaultContext.Fatal("Error: " + err.Error())
+			}
+			util.DefaultContext.Success(":sparkles: Fetched", sources, "sources")
+		},
+	}
+	path, err := os.Getwd()
+	if err != nil {
+		util.DefaultContext.Fatal(err)
+	}
+	ans.Flags().StringArrayP("tree", "t", []string{path}, "Path of the tree to use.")
+	ans.Flags().StringSlice("values", []string{}, "Build values file to interpolate with each package")
+	ans.Flags().String("sources-cache", "", "Directory where the package sources are cached (defaults to a sources folder in the packages cache)")
+
+	return ans
+}
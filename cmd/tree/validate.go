@@ -25,6 +25,7 @@ import (
 	"strconv"
 	"sync"
 
+	"github.com/mudler/luet/pkg/api/core/license"
 	"github.com/mudler/luet/pkg/api/core/types"
 
 	helpers "github.com/mudler/luet/cmd/helpers"
@@ -79,6 +80,59 @@ func (o *ValidateOpts) AddError(err error) {
 	o.Errors = append(o.Errors, err)
 }
 
+// Selected returns true if the package string is matched by
+// the --matches regexes and not by the --exclude ones
+func (o *ValidateOpts) Selected(pkgstr string) bool {
+	if len(o.Matches) > 0 {
+		matched := false
+		for _, rgx := range o.RegMatches {
+			if rgx.MatchString(pkgstr) {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			return false
+		}
+	}
+
+	for _, rgx := range o.RegExcludes {
+		if rgx.MatchString(pkgstr) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validateLicenses checks the licenses of all the packages of the tree
+// against the policy, every violation is reported as an error
+func validateLicenses(policyFile string, opts *ValidateOpts, reciper tree.Builder) error {
+	c, err := license.LoadPolicy(policyFile)
+	if err != nil {
+		return err
+	}
+	policy, err := license.NewPolicy(c)
+	if err != nil {
+		return err
+	}
+
+	packs := types.Packages{}
+	for _, p := range reciper.GetDatabase().World() {
+		if opts.Selected(fmt.Sprintf("%s/%s-%s", p.GetCategory(), p.GetName(), p.GetVersion())) {
+			packs = append(packs, p)
+		}
+	}
+
+	util.DefaultContext.Info(fmt.Sprintf("Checking licenses of %d packages against %s", len(packs), policyFile))
+	report := policy.Evaluate(packs)
+	for _, v := range report.Violations {
+		opts.AddError(fmt.Errorf("[%9s] %s", "license", v.String()))
+	}
+	return nil
+}
+
 func validatePackage(p *types.Package, checkType string, opts *ValidateOpts, reciper tree.Builder, cacheDeps *pkg.InMemoryDatabase) error {
 	var errstr string
 	var ans error
@@ -147,32 +201,8 @@ func validatePackage(p *types.Package, checkType string, opts *ValidateOpts, rec
 
 	validpkg := true
 
-	if len(opts.Matches) > 0 {
-		matched := false
-		for _, rgx := range opts.RegMatches {
-			if rgx.MatchString(pkgstr) {
-				matched = true
-				break
-			}
-		}
-
-		if !matched {
-			return nil
-		}
-	}
-
-	if len(opts.Excludes) > 0 {
-		excluded := false
-		for _, rgx := range opts.RegExcludes {
-			if rgx.MatchString(pkgstr) {
-				excluded = true
-				break
-			}
-		}
-
-		if excluded {
-			return nil
-		}
+	if !opts.Selected(pkgstr) {
+		return nil
 	}
 
 	util.DefaultContext.Info(fmt.Sprintf("[%9s] Checking package ", checkType)+
@@ -182,6 +212,10 @@ func validatePackage(p *types.Package, checkType string, opts *ValidateOpts, rec
 	all := p.GetRequires()
 	all = append(all, p.GetConflicts()...)
 	for idx, r := range all {
+		if len(r.GetAlternatives()) != 0 {
+			util.DefaultContext.Debug(fmt.Sprintf("[%9s] Checking alternatives", checkType), r.DependencyString())
+			r = availableAlternative(reciper.GetDatabase(), r)
+		}
 
 		var deps types.Packages
 		var err error
@@ -309,6 +343,18 @@ func validatePackage(p *types.Package, checkType string, opts *ValidateOpts, rec
 	return ans
 }
 
+// availableAlternative returns the first alternative of a requires or conflicts
+// entry which is available in the tree, or the first one if none is
+func availableAlternative(db types.PackageDatabase, r *types.Package) *types.Package {
+	alternatives := r.AnyOf()
+	for _, alt := range alternatives {
+		if packs, err := db.FindPackages(alt); err == nil && len(packs) > 0 {
+			return alt
+		}
+	}
+	return alternatives[0]
+}
+
 func validateWorker(i int,
 	wg *sync.WaitGroup,
 	c <-chan *types.Package,
@@ -433,6 +479,7 @@ func NewTreeValidateCommand() *cobra.Command {
 			withSolver, _ := cmd.Flags().GetBool("with-solver")
 			onlyRuntime, _ := cmd.Flags().GetBool("only-runtime")
 			onlyBuildtime, _ := cmd.Flags().GetBool("only-buildtime")
+			licensePolicy, _ := cmd.Flags().GetString("license-policy")
 
 			opts.Excludes = excludes
 			opts.Matches = matches
@@ -463,6 +510,12 @@ func NewTreeValidateCommand() *cobra.Command {
 				wg.Wait()
 			}()
 
+			if licensePolicy != "" {
+				if err := validateLicenses(licensePolicy, &opts, reciper); err != nil {
+					util.DefaultContext.Fatal("Error on license policy ", err)
+				}
+			}
+
 			stringerrs := []string{}
 			for _, e := range opts.Errors {
 				stringerrs = append(stringerrs, e.Error())
@@ -497,6 +550,8 @@ func NewTreeValidateCommand() *cobra.Command {
 		"Exclude matched packages from analysis. (Use string as regex).")
 	ans.Flags().StringSliceVarP(&matches, "matches", "m", []string{},
 		"Analyze only matched packages. (Use string as regex).")
+	ans.Flags().String("license-policy", "",
+		"Check the licenses of the packages against the policy in the given file.")
 
 	return ans
 }
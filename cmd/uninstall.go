@@ -56,8 +56,6 @@ var uninstallCmd = &cobra.Command{
 
 		util.DefaultContext.Config.ConfigProtectSkip = !keepProtected
 
-		util.DefaultContext.Config.Solver.Implementation = types.SolverSingleCoreSimple
-
 		util.DefaultContext.Debug("Solver", util.DefaultContext.Config.Solver.CompactString())
 
 		inst := installer.NewLuetInstaller(installer.LuetInstallerOptions{
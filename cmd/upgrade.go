@@ -16,7 +16,6 @@ package cmd
 
 import (
 	"github.com/mudler/luet/cmd/util"
-	"github.com/mudler/luet/pkg/api/core/types"
 	installer "github.com/mudler/luet/pkg/installer"
 
 	"github.com/spf13/cobra"
@@ -46,8 +45,6 @@ var upgradeCmd = &cobra.Command{
 		yes := viper.GetBool("yes")
 		downloadOnly, _ := cmd.Flags().GetBool("download-only")
 
-		util.DefaultContext.Config.Solver.Implementation = types.SolverSingleCoreSimple
-
 		util.DefaultContext.Debug("Solver", util.DefaultContext.GetConfig().Solver)
 
 		inst := installer.NewLuetInstaller(installer.LuetInstallerOptions{
@@ -25,6 +25,7 @@ import (
 	"strings"
 
 	"github.com/ipfs/go-log/v2"
+	"github.com/mitchellh/mapstructure"
 	extensions "github.com/mudler/cobra-extensions"
 	"github.com/mudler/luet/pkg/api/core/context"
 	gc "github.com/mudler/luet/pkg/api/core/garbagecollector"
@@ -103,7 +104,13 @@ var DefaultContext *context.Context
 func InitContext(cmd *cobra.Command) (ctx *context.Context, err error) {
 
 	c := &types.LuetConfig{}
-	err = viper.Unmarshal(c)
+	// Decode hooks of viper, plus the text unmarshaller to allow
+	// setting the solver implementation by name
+	err = viper.Unmarshal(c, viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+		mapstructure.TextUnmarshallerHookFunc(),
+	)))
 	if err != nil {
 		return
 	}
@@ -115,7 +122,16 @@ func InitContext(cmd *cobra.Command) (ctx *context.Context, err error) {
 	finalizerEnvs, _ := cmd.Flags().GetStringArray("finalizer-env")
 	setCliFinalizerEnvs(c, finalizerEnvs)
 
-	c.Solver.SolverOptions = types.SolverOptions{Type: types.SolverSingleCoreSimple, Concurrency: c.General.Concurrency}
+	if concurrent, err := cmd.Flags().GetBool("solver-concurrent"); err == nil && concurrent {
+		c.Solver.Concurrent = true
+	}
+	c.Solver.SolverOptions = types.SolverOptions{Type: c.Solver.Implementation, Concurrency: c.General.Concurrency, CacheDir: c.Solver.CacheDir}
+	// The optimizing solver already builds the formulas concurrently
+	if c.Solver.Concurrent && c.Solver.Implementation != types.SolverOptimizing {
+		c.Solver.Implementation = types.SolverConcurrent
+		c.Solver.SolverOptions.Type = types.SolverConcurrent
+		c.Solver.SolverOptions.Race = c.Solver.RaceStrategies
+	}
 
 	ctx = context.NewContext(
 		context.WithConfig(c),
@@ -237,6 +253,7 @@ func setDefaults(viper *viper.Viper) {
 	viper.SetDefault("system.rootfs", "/")
 	viper.SetDefault("system.tmpdir_base", filepath.Join(os.TempDir(), "tmpluet"))
 	viper.SetDefault("system.pkgs_cache_path", "packages")
+	viper.SetDefault("system.arch", runtime.GOARCH)
 
 	viper.SetDefault("repos_confdir", []string{"/etc/luet/repos.conf.d"})
 	viper.SetDefault("config_protect_confdir", []string{"/etc/luet/config.protect.d"})
@@ -251,6 +268,14 @@ func setDefaults(viper *viper.Viper) {
 	viper.SetDefault("solver.rate", 0.7)
 	viper.SetDefault("solver.discount", 1.0)
 	viper.SetDefault("solver.max_attempts", 9000)
+	viper.SetDefault("solver.concurrent", false)
+	viper.SetDefault("solver.race", false)
+
+	viper.SetDefault("license_policy.mode", "warn")
+	viper.SetDefault("license_policy.allow_unknown", false)
+
+	viper.SetDefault("audit.feeds", []string{})
+	viper.SetDefault("audit.block_severity", "")
 }
 
 // InitViper inits a new viper
@@ -273,11 +298,13 @@ func InitViper(RootCmd *cobra.Command) {
 	pflags.String("system-dbpath", "", "System db path")
 	pflags.String("system-target", "", "System rootpath")
 	pflags.String("system-engine", "", "System DB engine")
+	pflags.String("system-arch", "", "System architecture of the packages to install (defaults to the host one)")
 
 	pflags.String("solver-type", "", "Solver strategy ( Defaults none, available: "+solver.AvailableResolvers+" )")
 	pflags.Float32("solver-rate", 0.7, "Solver learning rate")
 	pflags.Float32("solver-discount", 1.0, "Solver discount rate")
 	pflags.Int("solver-attempts", 9000, "Solver maximum attempts")
+	pflags.String("solver-cache-dir", "", "Cache the solver results in the given directory")
 	pflags.Bool("live-output", true, "Show live output during build")
 
 	pflags.Bool("same-owner", true, "Maintain same owner on uncompress.")
@@ -287,10 +314,12 @@ func InitViper(RootCmd *cobra.Command) {
 	viper.BindPFlag("system.database_path", pflags.Lookup("system-dbpath"))
 	viper.BindPFlag("system.rootfs", pflags.Lookup("system-target"))
 	viper.BindPFlag("system.database_engine", pflags.Lookup("system-engine"))
+	viper.BindPFlag("system.arch", pflags.Lookup("system-arch"))
 	viper.BindPFlag("solver.type", pflags.Lookup("solver-type"))
 	viper.BindPFlag("solver.discount", pflags.Lookup("solver-discount"))
 	viper.BindPFlag("solver.rate", pflags.Lookup("solver-rate"))
 	viper.BindPFlag("solver.max_attempts", pflags.Lookup("solver-attempts"))
+	viper.BindPFlag("solver.cache_dir", pflags.Lookup("solver-cache-dir"))
 
 	viper.BindPFlag("logging.color", pflags.Lookup("color"))
 	viper.BindPFlag("logging.enable_emoji", pflags.Lookup("emoji"))
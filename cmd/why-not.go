@@ -0,0 +1,136 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ghodss/yaml"
+	helpers "github.com/mudler/luet/cmd/helpers"
+	"github.com/mudler/luet/cmd/util"
+	installer "github.com/mudler/luet/pkg/installer"
+	"github.com/mudler/luet/pkg/solver"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+type WhyNotResult struct {
+	Package     string              `json:"package"`
+	Installable bool                `json:"installable"`
+	Reason      string              `json:"reason,omitempty"`
+	Explanation *solver.Explanation `json:"explanation,omitempty"`
+	Install     []string            `json:"install,omitempty"`
+}
+
+var whyNotCmd = &cobra.Command{
+	Use: "why-not <pkg>",
+	// Skip processing output
+	Annotations: map[string]string{
+		util.CommandProcessOutput: "",
+	},
+	Short: "Show why a package can't be installed",
+	Long: `Check if a package can be installed from the repositories, and show the constraints preventing it:
+
+	$ luet why-not system/foo@1.0
+
+If the package can be installed, the packages that would be installed along with it are shown.
+`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		out, _ := cmd.Flags().GetString("output")
+
+		pack, err := helpers.ParsePackageStr(args[0])
+		if err != nil {
+			util.DefaultContext.Fatal("Invalid package string ", args[0], ": ", err.Error())
+		}
+
+		result := WhyNotResult{Package: pack.HumanReadableString()}
+
+		system := sys()
+		if i, err := system.Database.FindPackage(pack); err == nil {
+			result.Installable = true
+			result.Reason = i.HumanReadableString() + " is already installed"
+		} else {
+			inst := installer.NewLuetInstaller(
+				installer.LuetInstallerOptions{
+					Concurrency:         util.DefaultContext.Config.General.Concurrency,
+					SolverOptions:       util.DefaultContext.Config.Solver,
+					PackageRepositories: util.DefaultContext.Config.SystemRepositories,
+					Context:             util.DefaultContext,
+				},
+			)
+
+			solution, err := inst.WhyNot(pack, system)
+			if err != nil {
+				result.Reason = err.Error()
+				unsat := &solver.UnsatError{}
+				if errors.As(err, &unsat) {
+					result.Reason = "the constraints can't be satisfied"
+					result.Explanation = unsat.Explanation
+				}
+			} else {
+				result.Installable = true
+				for _, a := range solution {
+					if !a.Value {
+						continue
+					}
+					if _, err := system.Database.FindPackage(a.Package); err != nil {
+						result.Install = append(result.Install, a.Package.HumanReadableString())
+					}
+				}
+			}
+		}
+
+		switch out {
+		case "yaml", "json":
+			y, err := yaml.Marshal(result)
+			if err != nil {
+				util.DefaultContext.Fatal(err.Error())
+			}
+			if out == "json" {
+				y, err = yaml.YAMLToJSON(y)
+				if err != nil {
+					util.DefaultContext.Fatal(err.Error())
+				}
+			}
+			fmt.Println(string(y))
+		default:
+			switch {
+			case result.Installable && result.Reason != "":
+				fmt.Println(pterm.LightCyan(result.Package), "can be installed:", result.Reason)
+			case result.Installable:
+				fmt.Println(pterm.LightCyan(result.Package), "can be installed, along with:")
+				for _, p := range result.Install {
+					fmt.Println("  " + p)
+				}
+			case result.Explanation != nil:
+				fmt.Println(pterm.LightCyan(result.Package), "can't be installed,", result.Reason+":")
+				for _, s := range result.Explanation.Steps {
+					fmt.Println("  " + s.Message)
+				}
+			default:
+				fmt.Println(pterm.LightCyan(result.Package), "can't be installed:", result.Reason)
+			}
+		}
+	},
+}
+
+func init() {
+	whyNotCmd.Flags().StringP("output", "o", "terminal", "Output format ( Defaults: terminal, available: json,yaml )")
+
+	RootCmd.AddCommand(whyNotCmd)
+}
@@ -0,0 +1,100 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	helpers "github.com/mudler/luet/cmd/helpers"
+	"github.com/mudler/luet/cmd/util"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+type WhyResult struct {
+	Package string     `json:"package"`
+	Chains  [][]string `json:"chains"`
+}
+
+var whyCmd = &cobra.Command{
+	Use: "why <pkg>",
+	// Skip processing output
+	Annotations: map[string]string{
+		util.CommandProcessOutput: "",
+	},
+	Short: "Show why a package is installed",
+	Long: `Show the chains of installed packages which require a package:
+
+	$ luet why system/foo
+
+Each chain starts from a package which is not required by any other installed package.
+`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		out, _ := cmd.Flags().GetString("output")
+
+		pack, err := helpers.ParsePackageStr(args[0])
+		if err != nil {
+			util.DefaultContext.Fatal("Invalid package string ", args[0], ": ", err.Error())
+		}
+
+		chains, err := sys().Why(pack)
+		if err != nil {
+			util.DefaultContext.Fatal("Error: " + err.Error())
+		}
+
+		result := WhyResult{Package: chains[0][len(chains[0])-1].HumanReadableString()}
+		for _, c := range chains {
+			chain := []string{}
+			for _, p := range c {
+				chain = append(chain, p.HumanReadableString())
+			}
+			result.Chains = append(result.Chains, chain)
+		}
+
+		switch out {
+		case "yaml", "json":
+			y, err := yaml.Marshal(result)
+			if err != nil {
+				util.DefaultContext.Fatal(err.Error())
+			}
+			if out == "json" {
+				y, err = yaml.YAMLToJSON(y)
+				if err != nil {
+					util.DefaultContext.Fatal(err.Error())
+				}
+			}
+			fmt.Println(string(y))
+		default:
+			if len(result.Chains) == 1 && len(result.Chains[0]) == 1 {
+				fmt.Println(pterm.LightCyan(result.Package), "is not required by other installed packages")
+				return
+			}
+			fmt.Println(pterm.LightCyan(result.Package), "is required by:")
+			for _, c := range result.Chains {
+				fmt.Println("  " + strings.Join(c, " -> "))
+			}
+		}
+	},
+}
+
+func init() {
+	whyCmd.Flags().StringP("output", "o", "terminal", "Output format ( Defaults: terminal, available: json,yaml )")
+
+	RootCmd.AddCommand(whyCmd)
+}
@@ -0,0 +1,293 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+// Package advisory matches packages against a local feed of
+// security advisories.
+package advisory
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+	version "github.com/mudler/luet/pkg/versioner"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Severity is the severity of an advisory
+type Severity string
+
+const (
+	SeverityUnknown  Severity = "unknown"
+	SeverityLow      Severity = "low"
+	SeverityMedium   Severity = "medium"
+	SeverityHigh     Severity = "high"
+	SeverityCritical Severity = "critical"
+)
+
+var severityLevels = map[Severity]int{
+	SeverityUnknown:  0,
+	SeverityLow:      1,
+	SeverityMedium:   2,
+	SeverityHigh:     3,
+	SeverityCritical: 4,
+}
+
+// ParseSeverity returns the Severity matching the given string
+func ParseSeverity(s string) (Severity, error) {
+	sev := Severity(strings.ToLower(s))
+	if sev == "" {
+		return SeverityUnknown, nil
+	}
+	if _, ok := severityLevels[sev]; !ok {
+		return "", fmt.Errorf("invalid severity '%s' (available: %s, %s, %s, %s)", s, SeverityLow, SeverityMedium, SeverityHigh, SeverityCritical)
+	}
+	return sev, nil
+}
+
+// AtLeast returns true if the severity is equal or higher than the given one
+func (s Severity) AtLeast(o Severity) bool {
+	return severityLevels[s] >= severityLevels[o]
+}
+
+// Advisory is a known issue affecting a set of versions of a package
+type Advisory struct {
+	ID         string   `json:"id" yaml:"id"`
+	Severity   Severity `json:"severity,omitempty" yaml:"severity,omitempty"`
+	Summary    string   `json:"summary,omitempty" yaml:"summary,omitempty"`
+	Affected   []string `json:"affected" yaml:"affected"`
+	Fixed      string   `json:"fixed,omitempty" yaml:"fixed,omitempty"`
+	References []string `json:"references,omitempty" yaml:"references,omitempty"`
+}
+
+// Affects returns true if the version is matched by any of the affected selectors.
+// Selectors are the ones supported by the versioner (e.g. "<1.2.3", ">=1.0, <1.2"),
+// a version without operators matches only the exact version.
+func (a Advisory) Affects(v string) bool {
+	versioner := version.DefaultVersioner()
+	for _, s := range a.Affected {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if unicode.IsDigit(rune(s[0])) {
+			if s == v {
+				return true
+			}
+			continue
+		}
+		if versioner.ValidateSelector(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Feed is a set of advisories keyed by package (category/name)
+type Feed map[string][]Advisory
+
+// key returns the key of a package in the feed
+func key(p *types.Package) string {
+	if p.GetCategory() == "" {
+		return p.GetName()
+	}
+	return fmt.Sprintf("%s/%s", p.GetCategory(), p.GetName())
+}
+
+// FeedFromYaml decodes a feed from its YAML (or JSON) representation
+func FeedFromYaml(data []byte) (Feed, error) {
+	f := Feed{}
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	for p, advisories := range f {
+		for i, a := range advisories {
+			if a.ID == "" {
+				return nil, fmt.Errorf("advisory of '%s' has no id", p)
+			}
+			if len(a.Affected) == 0 {
+				return nil, fmt.Errorf("advisory '%s' of '%s' has no affected versions", a.ID, p)
+			}
+			sev, err := ParseSeverity(string(a.Severity))
+			if err != nil {
+				return nil, errors.Wrapf(err, "advisory '%s' of '%s'", a.ID, p)
+			}
+			f[p][i].Severity = sev
+		}
+	}
+	return f, nil
+}
+
+// LoadFeed reads and merges the advisories from the given files or
+// directories. Directories are scanned for .yaml, .yml and .json files.
+func LoadFeed(paths ...string) (Feed, error) {
+	feed := Feed{}
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "while reading advisories from '%s'", path)
+		}
+
+		files := []string{path}
+		if fi.IsDir() {
+			files = []string{}
+			entries, err := ioutil.ReadDir(path)
+			if err != nil {
+				return nil, errors.Wrapf(err, "while reading advisories from '%s'", path)
+			}
+			for _, e := range entries {
+				switch filepath.Ext(e.Name()) {
+				case ".yaml", ".yml", ".json":
+					if !e.IsDir() {
+						files = append(files, filepath.Join(path, e.Name()))
+					}
+				}
+			}
+		}
+
+		for _, file := range files {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, errors.Wrapf(err, "while reading advisories from '%s'", file)
+			}
+			f, err := FeedFromYaml(data)
+			if err != nil {
+				return nil, errors.Wrapf(err, "while parsing advisories from '%s'", file)
+			}
+			feed.Merge(f)
+		}
+	}
+	return feed, nil
+}
+
+// Merge adds the advisories of another feed
+func (f Feed) Merge(o Feed) {
+	for p, advisories := range o {
+		f[p] = append(f[p], advisories...)
+	}
+}
+
+// Match returns the advisories affecting the package
+func (f Feed) Match(p *types.Package) []Advisory {
+	res := []Advisory{}
+	for _, a := range f[key(p)] {
+		if a.Affects(p.GetVersion()) {
+			res = append(res, a)
+		}
+	}
+	return res
+}
+
+// Finding is an advisory affecting a package
+type Finding struct {
+	Package  *types.Package
+	Advisory Advisory
+}
+
+func (f Finding) String() string {
+	s := fmt.Sprintf("%s: %s (%s)", f.Package.HumanReadableString(), f.Advisory.ID, f.Advisory.Severity)
+	if f.Advisory.Summary != "" {
+		s += " " + f.Advisory.Summary
+	}
+	if f.Advisory.Fixed != "" {
+		s += fmt.Sprintf(", fixed in %s", f.Advisory.Fixed)
+	}
+	return s
+}
+
+// Findings is a list of advisories affecting packages
+type Findings []Finding
+
+// Audit returns the advisories affecting the given packages, sorted by package
+// and by decreasing severity
+func (f Feed) Audit(packs types.Packages) Findings {
+	res := Findings{}
+	for _, p := range packs.Unique() {
+		for _, a := range f.Match(p) {
+			res = append(res, Finding{Package: p, Advisory: a})
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		pi, pj := res[i].Package.HumanReadableString(), res[j].Package.HumanReadableString()
+		if pi != pj {
+			return pi < pj
+		}
+		return severityLevels[res[i].Advisory.Severity] > severityLevels[res[j].Advisory.Severity]
+	})
+	return res
+}
+
+// AtLeast returns the findings with a severity equal or higher than the given one
+func (f Findings) AtLeast(s Severity) Findings {
+	res := Findings{}
+	for _, finding := range f {
+		if finding.Advisory.Severity.AtLeast(s) {
+			res = append(res, finding)
+		}
+	}
+	return res
+}
+
+// Packages returns the packages affected by the findings
+func (f Findings) Packages() types.Packages {
+	res := types.Packages{}
+	for _, finding := range f {
+		res = append(res, finding.Package)
+	}
+	return res.Unique()
+}
+
+// Enforce audits the packages against the advisory feeds of the context
+// configuration. Findings are reported as warnings, and an error is returned
+// if any of them is at or above the configured blocking severity.
+func Enforce(ctx types.Context, packs types.Packages) error {
+	c := ctx.GetConfig().Audit
+	if len(c.Feeds) == 0 {
+		return nil
+	}
+
+	feed, err := LoadFeed(c.Feeds...)
+	if err != nil {
+		return err
+	}
+
+	findings := feed.Audit(packs)
+	for _, f := range findings {
+		ctx.Warning(":warning: Advisory:", f.String())
+	}
+
+	if c.BlockSeverity == "" {
+		return nil
+	}
+	block, err := ParseSeverity(c.BlockSeverity)
+	if err != nil {
+		return err
+	}
+	if blocked := findings.AtLeast(block); len(blocked) != 0 {
+		names := []string{}
+		for _, p := range blocked.Packages() {
+			names = append(names, p.HumanReadableString())
+		}
+		return fmt.Errorf("packages with advisories of severity %s or higher: %s", block, strings.Join(names, ", "))
+	}
+	return nil
+}
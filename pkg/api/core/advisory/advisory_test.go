@@ -0,0 +1,133 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+package advisory_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/mudler/luet/pkg/api/core/advisory"
+	"github.com/mudler/luet/pkg/api/core/types"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const feedYaml = `
+test/a:
+- id: ADV-1
+  severity: high
+  summary: Remote code execution
+  affected: ["<1.2"]
+  fixed: "1.2"
+- id: ADV-2
+  severity: low
+  affected: ["1.0"]
+test/b:
+- id: ADV-3
+  severity: critical
+  affected: [">=2.0, <2.1"]
+`
+
+var _ = Describe("Advisory", func() {
+	a10 := &types.Package{Name: "a", Category: "test", Version: "1.0"}
+	a11 := &types.Package{Name: "a", Category: "test", Version: "1.1"}
+	a12 := &types.Package{Name: "a", Category: "test", Version: "1.2"}
+	b20 := &types.Package{Name: "b", Category: "test", Version: "2.0.5"}
+	b21 := &types.Package{Name: "b", Category: "test", Version: "2.1"}
+	c := &types.Package{Name: "c", Category: "test", Version: "1.0"}
+
+	Context("Severity", func() {
+		It("parses and compares severities", func() {
+			s, err := ParseSeverity("HIGH")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s).To(Equal(SeverityHigh))
+			Expect(s.AtLeast(SeverityMedium)).To(BeTrue())
+			Expect(s.AtLeast(SeverityCritical)).To(BeFalse())
+
+			s, err = ParseSeverity("")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s).To(Equal(SeverityUnknown))
+
+			_, err = ParseSeverity("foo")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("Feed", func() {
+		It("matches packages by version selectors", func() {
+			f, err := FeedFromYaml([]byte(feedYaml))
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(len(f.Match(a10))).To(Equal(2))
+			Expect(len(f.Match(a11))).To(Equal(1))
+			Expect(f.Match(a11)[0].ID).To(Equal("ADV-1"))
+			Expect(f.Match(a12)).To(BeEmpty())
+			Expect(len(f.Match(b20))).To(Equal(1))
+			Expect(f.Match(b21)).To(BeEmpty())
+			Expect(f.Match(c)).To(BeEmpty())
+		})
+
+		It("rejects invalid advisories", func() {
+			_, err := FeedFromYaml([]byte("test/a:\n- severity: high\n  affected: [\"<1\"]\n"))
+			Expect(err).To(HaveOccurred())
+			_, err = FeedFromYaml([]byte("test/a:\n- id: ADV-1\n"))
+			Expect(err).To(HaveOccurred())
+			_, err = FeedFromYaml([]byte("test/a:\n- id: ADV-1\n  severity: foo\n  affected: [\"<1\"]\n"))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("audits packages", func() {
+			f, err := FeedFromYaml([]byte(feedYaml))
+			Expect(err).ToNot(HaveOccurred())
+
+			findings := f.Audit(types.Packages{b20, a10, a12, c})
+			Expect(len(findings)).To(Equal(3))
+			Expect(findings[0].Package).To(Equal(a10))
+			Expect(findings[0].Advisory.ID).To(Equal("ADV-1"))
+			Expect(findings[1].Advisory.ID).To(Equal("ADV-2"))
+			Expect(findings[2].Package).To(Equal(b20))
+			Expect(findings[0].String()).To(Equal("test/a-1.0: ADV-1 (high) Remote code execution, fixed in 1.2"))
+
+			high := findings.AtLeast(SeverityHigh)
+			Expect(len(high)).To(Equal(2))
+			Expect(len(high.Packages())).To(Equal(2))
+			Expect(findings.AtLeast(SeverityCritical).Packages()).To(Equal(types.Packages{b20}))
+		})
+
+		It("loads feeds from files and directories", func() {
+			dir, err := ioutil.TempDir("", "advisory")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(dir)
+
+			Expect(ioutil.WriteFile(filepath.Join(dir, "a.yaml"), []byte(feedYaml), os.ModePerm)).ToNot(HaveOccurred())
+			Expect(ioutil.WriteFile(filepath.Join(dir, "c.json"), []byte(`{"test/c": [{"id": "ADV-4", "affected": ["<=1.0"]}]}`), os.ModePerm)).ToNot(HaveOccurred())
+			Expect(ioutil.WriteFile(filepath.Join(dir, "README"), []byte("not a feed"), os.ModePerm)).ToNot(HaveOccurred())
+
+			f, err := LoadFeed(dir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(f.Audit(types.Packages{a10, b20, c}))).To(Equal(4))
+			Expect(f.Match(c)[0].Severity).To(Equal(SeverityUnknown))
+
+			f, err = LoadFeed(filepath.Join(dir, "c.json"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(f)).To(Equal(1))
+
+			_, err = LoadFeed(filepath.Join(dir, "missing"))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
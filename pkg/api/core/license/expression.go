@@ -0,0 +1,171 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package license
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Expression is a parsed SPDX license expression
+type Expression interface {
+	// Eval returns true if the expression is satisfied by
+	// the licenses accepted by the given function
+	Eval(accept func(id string) bool) bool
+	// Licenses returns all the license identifiers of the expression
+	Licenses() []string
+	String() string
+}
+
+// License is a single license identifier, optionally with an exception (e.g. "GPL-2.0-only WITH Classpath-exception-2.0")
+type License struct {
+	ID        string
+	Exception string
+}
+
+func (l License) Eval(accept func(id string) bool) bool { return accept(l.String()) }
+func (l License) Licenses() []string                    { return []string{l.String()} }
+
+func (l License) String() string {
+	if l.Exception != "" {
+		return fmt.Sprintf("%s WITH %s", l.ID, l.Exception)
+	}
+	return l.ID
+}
+
+// And is satisfied when both the operands are
+type And struct{ Left, Right Expression }
+
+func (a And) Eval(accept func(id string) bool) bool {
+	return a.Left.Eval(accept) && a.Right.Eval(accept)
+}
+func (a And) Licenses() []string { return append(a.Left.Licenses(), a.Right.Licenses()...) }
+func (a And) String() string     { return fmt.Sprintf("(%s AND %s)", a.Left, a.Right) }
+
+// Or is satisfied when any of the operands is
+type Or struct{ Left, Right Expression }
+
+func (o Or) Eval(accept func(id string) bool) bool {
+	return o.Left.Eval(accept) || o.Right.Eval(accept)
+}
+func (o Or) Licenses() []string { return append(o.Left.Licenses(), o.Right.Licenses()...) }
+func (o Or) String() string     { return fmt.Sprintf("(%s OR %s)", o.Left, o.Right) }
+
+// Parse parses a SPDX license expression.
+// Operators are case insensitive and AND binds tighter than OR.
+func Parse(s string) (Expression, error) {
+	p := &parser{tokens: tokenize(s)}
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("empty license expression")
+	}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("unexpected '%s' in license expression '%s'", p.tokens[p.pos], s)
+	}
+	return e, nil
+}
+
+func tokenize(s string) []string {
+	s = strings.NewReplacer("(", " ( ", ")", " ) ").Replace(s)
+	return strings.Fields(s)
+}
+
+type parser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *parser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func isOperator(t, op string) bool {
+	return strings.EqualFold(t, op)
+}
+
+func (p *parser) parseOr() (Expression, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for isOperator(p.peek(), "OR") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = Or{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expression, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for isOperator(p.peek(), "AND") {
+		p.next()
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = And{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseTerm() (Expression, error) {
+	t := p.next()
+	switch {
+	case t == "":
+		return nil, fmt.Errorf("unexpected end of license expression")
+	case t == "(":
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis in license expression")
+		}
+		return e, nil
+	case t == ")", isOperator(t, "AND"), isOperator(t, "OR"), isOperator(t, "WITH"):
+		return nil, fmt.Errorf("unexpected '%s' in license expression", t)
+	}
+
+	l := License{ID: t}
+	if isOperator(p.peek(), "WITH") {
+		p.next()
+		e := p.next()
+		if e == "" || e == "(" || e == ")" {
+			return nil, fmt.Errorf("missing exception after WITH in license expression")
+		}
+		l.Exception = e
+	}
+	return l, nil
+}
@@ -0,0 +1,172 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+package license_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/api/core/license"
+	"github.com/mudler/luet/pkg/api/core/types"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("License", func() {
+	Context("Expressions", func() {
+		It("parses simple identifiers", func() {
+			e, err := license.Parse("MIT")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(e.Licenses()).To(Equal([]string{"MIT"}))
+		})
+
+		It("parses compound expressions", func() {
+			e, err := license.Parse("(MIT or Apache-2.0) AND GPL-2.0-only WITH Classpath-exception-2.0")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(e.String()).To(Equal("((MIT OR Apache-2.0) AND GPL-2.0-only WITH Classpath-exception-2.0)"))
+			Expect(e.Licenses()).To(Equal([]string{"MIT", "Apache-2.0", "GPL-2.0-only WITH Classpath-exception-2.0"}))
+		})
+
+		It("gives precedence to AND", func() {
+			e, err := license.Parse("MIT OR BSD-3-Clause AND GPL-3.0-only")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(e.String()).To(Equal("(MIT OR (BSD-3-Clause AND GPL-3.0-only))"))
+		})
+
+		It("fails on invalid expressions", func() {
+			for _, s := range []string{"", "MIT AND", "(MIT", "MIT)", "OR MIT", "MIT WITH"} {
+				_, err := license.Parse(s)
+				Expect(err).To(HaveOccurred(), s)
+			}
+		})
+	})
+
+	Context("Policy", func() {
+		mit := &types.Package{Name: "a", Category: "test", Version: "1.0", License: "MIT"}
+		gpl3 := &types.Package{Name: "b", Category: "test", Version: "1.0", License: "GPL-3.0-or-later"}
+		dual := &types.Package{Name: "c", Category: "test", Version: "1.0", License: "GPL-3.0-only OR MIT"}
+		both := &types.Package{Name: "d", Category: "test", Version: "1.0", License: "GPL-3.0-only AND MIT"}
+		exception := &types.Package{Name: "e", Category: "test", Version: "1.0", License: "GPL-2.0-only WITH Classpath-exception-2.0"}
+		unknown := &types.Package{Name: "f", Category: "test", Version: "1.0"}
+
+		It("rejects invalid modes", func() {
+			_, err := license.NewPolicy(types.LuetLicensePolicy{Allow: []string{"MIT"}, Mode: "foo"})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("defaults to warn", func() {
+			p, err := license.NewPolicy(types.LuetLicensePolicy{Allow: []string{"MIT"}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.Enforcing()).To(BeFalse())
+
+			p, err = license.NewPolicy(types.LuetLicensePolicy{Allow: []string{"MIT"}, Mode: "fail"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.Enforcing()).To(BeTrue())
+		})
+
+		It("evaluates allow lists", func() {
+			p, err := license.NewPolicy(types.LuetLicensePolicy{Allow: []string{"mit", "GPL-2.0-only"}})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(p.Check(mit)).To(BeNil())
+			Expect(p.Check(dual)).To(BeNil())
+			Expect(p.Check(exception)).To(BeNil())
+
+			v := p.Check(gpl3)
+			Expect(v).ToNot(BeNil())
+			Expect(v.Reason).To(Equal("not allowed: GPL-3.0-or-later"))
+
+			v = p.Check(both)
+			Expect(v).ToNot(BeNil())
+			Expect(v.Reason).To(Equal("not allowed: GPL-3.0-only"))
+		})
+
+		It("evaluates deny lists with globs", func() {
+			p, err := license.NewPolicy(types.LuetLicensePolicy{Deny: []string{"GPL-3.0*"}, AllowUnknown: true})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(p.Check(mit)).To(BeNil())
+			Expect(p.Check(dual)).To(BeNil())
+			Expect(p.Check(unknown)).To(BeNil())
+
+			v := p.Check(both)
+			Expect(v).ToNot(BeNil())
+			Expect(v.Reason).To(Equal("denied: GPL-3.0-only"))
+		})
+
+		It("denies licenses with exceptions by their identifier", func() {
+			p, err := license.NewPolicy(types.LuetLicensePolicy{Deny: []string{"GPL-2.0-only"}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.Check(exception)).ToNot(BeNil())
+		})
+
+		It("matches whole expressions", func() {
+			p, err := license.NewPolicy(types.LuetLicensePolicy{Allow: []string{"GPL-3.0-only  and MIT"}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.Check(both)).To(BeNil())
+			Expect(p.Check(mit)).ToNot(BeNil())
+
+			p, err = license.NewPolicy(types.LuetLicensePolicy{Deny: []string{"GPL-3.0-only OR MIT"}})
+			Expect(err).ToNot(HaveOccurred())
+			v := p.Check(dual)
+			Expect(v).ToNot(BeNil())
+			Expect(v.Reason).To(Equal("license is denied"))
+		})
+
+		It("reports packages without license", func() {
+			p, err := license.NewPolicy(types.LuetLicensePolicy{Allow: []string{"MIT"}})
+			Expect(err).ToNot(HaveOccurred())
+			v := p.Check(unknown)
+			Expect(v).ToNot(BeNil())
+			Expect(v.String()).To(Equal("test/f-1.0 (unknown): no license declared"))
+		})
+
+		It("generates a per-package report", func() {
+			p, err := license.NewPolicy(types.LuetLicensePolicy{Allow: []string{"MIT"}, Mode: "fail"})
+			Expect(err).ToNot(HaveOccurred())
+
+			r := p.Evaluate(types.Packages{gpl3, mit, both, mit})
+			Expect(r.Checked).To(Equal(3))
+			Expect(len(r.Violations)).To(Equal(2))
+			Expect(r.Violations[0].Package).To(Equal(gpl3))
+			Expect(r.Violations[1].Package).To(Equal(both))
+			Expect(r.Err()).To(HaveOccurred())
+			Expect(r.Err().Error()).To(ContainSubstring("test/b-1.0 (GPL-3.0-or-later): not allowed: GPL-3.0-or-later"))
+
+			Expect(p.Evaluate(types.Packages{mit}).Err()).ToNot(HaveOccurred())
+		})
+
+		It("loads policies from files", func() {
+			dir, err := ioutil.TempDir("", "license")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(dir)
+
+			f := filepath.Join(dir, "policy.yaml")
+			Expect(ioutil.WriteFile(f, []byte("allow:\n- MIT\ndeny:\n- GPL-3.0*\nmode: fail\nallow_unknown: true\n"), os.ModePerm)).ToNot(HaveOccurred())
+
+			c, err := license.LoadPolicy(f)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c).To(Equal(types.LuetLicensePolicy{
+				Allow:        []string{"MIT"},
+				Deny:         []string{"GPL-3.0*"},
+				Mode:         "fail",
+				AllowUnknown: true,
+			}))
+			Expect(c.Enabled()).To(BeTrue())
+		})
+	})
+})
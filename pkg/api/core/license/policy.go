@@ -0,0 +1,284 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+// Package license evaluates the SPDX license expressions of
+// packages against a license policy.
+package license
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// ModeWarn reports the policy violations without failing
+	ModeWarn = "warn"
+	// ModeFail fails on policy violations
+	ModeFail = "fail"
+)
+
+// Policy evaluates package licenses against a set of allowed and denied licenses
+type Policy struct {
+	allow, deny  []string
+	mode         string
+	allowUnknown bool
+}
+
+// NewPolicy returns a Policy from the given configuration
+func NewPolicy(c types.LuetLicensePolicy) (*Policy, error) {
+	p := &Policy{mode: strings.ToLower(c.Mode), allowUnknown: c.AllowUnknown}
+	switch p.mode {
+	case "":
+		p.mode = ModeWarn
+	case ModeWarn, ModeFail:
+	default:
+		return nil, fmt.Errorf("invalid license policy mode '%s' (available: %s, %s)", c.Mode, ModeWarn, ModeFail)
+	}
+
+	for _, l := range c.Allow {
+		a, err := normalize(l)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid allowed license '%s'", l)
+		}
+		p.allow = append(p.allow, a)
+	}
+	for _, l := range c.Deny {
+		d, err := normalize(l)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid denied license '%s'", l)
+		}
+		p.deny = append(p.deny, d)
+	}
+	return p, nil
+}
+
+// LoadPolicy reads a license policy from a YAML file, in the same
+// format of the license_policy section of the luet configuration
+func LoadPolicy(file string) (types.LuetLicensePolicy, error) {
+	c := types.LuetLicensePolicy{}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return c, errors.Wrapf(err, "while reading license policy '%s'", file)
+	}
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return c, errors.Wrapf(err, "while parsing license policy '%s'", file)
+	}
+	return c, nil
+}
+
+// normalize lowercases and collapses the whitespaces of a license or
+// pattern, so it can be matched against other ones
+func normalize(s string) (string, error) {
+	s = strings.ToLower(strings.Join(tokenize(s), " "))
+	s = strings.NewReplacer("( ", "(", " )", ")").Replace(s)
+	_, err := path.Match(s, "")
+	return s, err
+}
+
+func matchAny(patterns []string, license string) bool {
+	l, _ := normalize(license)
+	for _, p := range patterns {
+		if m, _ := path.Match(p, l); m {
+			return true
+		}
+	}
+	return false
+}
+
+// expressions returns the patterns which are compound expressions,
+// so that globs of single identifiers don't match across operators
+func expressions(patterns []string) (res []string) {
+	for _, p := range patterns {
+		if strings.ContainsAny(p, " ()") {
+			res = append(res, p)
+		}
+	}
+	return
+}
+
+// Enforcing returns true if violations have to be treated as failures
+func (p *Policy) Enforcing() bool {
+	return p.mode == ModeFail
+}
+
+func (p *Policy) denied(l License) bool {
+	return matchAny(p.deny, l.String()) || matchAny(p.deny, l.ID)
+}
+
+func (p *Policy) allowed(l License) bool {
+	return len(p.allow) == 0 || matchAny(p.allow, l.String()) || matchAny(p.allow, l.ID)
+}
+
+func (p *Policy) accept(l License) bool {
+	return !p.denied(l) && p.allowed(l)
+}
+
+// Check evaluates the license of a package. It returns nil if the
+// package is compliant with the policy.
+func (p *Policy) Check(pack *types.Package) *Violation {
+	v := &Violation{Package: pack, License: pack.GetLicense()}
+
+	if strings.TrimSpace(v.License) == "" {
+		if p.allowUnknown {
+			return nil
+		}
+		v.Reason = "no license declared"
+		return v
+	}
+
+	// Whole expressions can be listed in the policy too (e.g. "GPL-2.0-only OR MIT")
+	if matchAny(expressions(p.deny), v.License) {
+		v.Reason = "license is denied"
+		return v
+	}
+	if matchAny(expressions(p.allow), v.License) {
+		return nil
+	}
+
+	expr, err := Parse(v.License)
+	if err != nil {
+		// Not a valid expression, treat it as a single license identifier
+		expr = License{ID: strings.TrimSpace(v.License)}
+	}
+
+	licenses := map[string]License{}
+	collect(expr, licenses)
+	if expr.Eval(func(id string) bool { return p.accept(licenses[id]) }) {
+		return nil
+	}
+
+	denied, notAllowed := []string{}, []string{}
+	for id, l := range licenses {
+		switch {
+		case p.denied(l):
+			denied = append(denied, id)
+		case !p.allowed(l):
+			notAllowed = append(notAllowed, id)
+		}
+	}
+	sort.Strings(denied)
+	sort.Strings(notAllowed)
+
+	reasons := []string{}
+	if len(denied) != 0 {
+		reasons = append(reasons, fmt.Sprintf("denied: %s", strings.Join(denied, ", ")))
+	}
+	if len(notAllowed) != 0 {
+		reasons = append(reasons, fmt.Sprintf("not allowed: %s", strings.Join(notAllowed, ", ")))
+	}
+	v.Reason = strings.Join(reasons, "; ")
+	return v
+}
+
+func collect(e Expression, m map[string]License) {
+	switch t := e.(type) {
+	case License:
+		m[t.String()] = t
+	case And:
+		collect(t.Left, m)
+		collect(t.Right, m)
+	case Or:
+		collect(t.Left, m)
+		collect(t.Right, m)
+	}
+}
+
+// Evaluate checks all the given packages and returns a report with the violations found
+func (p *Policy) Evaluate(packs types.Packages) *Report {
+	r := &Report{}
+	for _, pack := range packs.Unique() {
+		r.Checked++
+		if v := p.Check(pack); v != nil {
+			r.Violations = append(r.Violations, *v)
+		}
+	}
+	sort.Slice(r.Violations, func(i, j int) bool {
+		return r.Violations[i].Package.HumanReadableString() < r.Violations[j].Package.HumanReadableString()
+	})
+	return r
+}
+
+// Violation is a package which doesn't comply with the policy
+type Violation struct {
+	Package *types.Package `json:"-"`
+	License string         `json:"license"`
+	Reason  string         `json:"reason"`
+}
+
+func (v Violation) String() string {
+	license := v.License
+	if license == "" {
+		license = "unknown"
+	}
+	return fmt.Sprintf("%s (%s): %s", v.Package.HumanReadableString(), license, v.Reason)
+}
+
+// Report is the result of the evaluation of a set of packages
+type Report struct {
+	Checked    int
+	Violations []Violation
+}
+
+// Err returns an error describing the violations, or nil if there are none
+func (r *Report) Err() error {
+	if len(r.Violations) == 0 {
+		return nil
+	}
+	lines := []string{}
+	for _, v := range r.Violations {
+		lines = append(lines, v.String())
+	}
+	return fmt.Errorf("%d of %d packages violate the license policy:\n%s", len(r.Violations), r.Checked, strings.Join(lines, "\n"))
+}
+
+// Enforce evaluates the packages against the license policy of the
+// context configuration. Violations are reported per package, and an
+// error is returned only if the policy is in fail mode.
+func Enforce(ctx types.Context, packs types.Packages) error {
+	c := ctx.GetConfig().LicensePolicy
+	if !c.Enabled() {
+		return nil
+	}
+	p, err := NewPolicy(c)
+	if err != nil {
+		return err
+	}
+
+	r := p.Evaluate(packs)
+	if len(r.Violations) == 0 {
+		ctx.Debug(fmt.Sprintf("License policy: %d packages checked", r.Checked))
+		return nil
+	}
+
+	for _, v := range r.Violations {
+		if p.Enforcing() {
+			ctx.Error(":no_entry: License policy violation:", v.String())
+		} else {
+			ctx.Warning(":warning: License policy violation:", v.String())
+		}
+	}
+	if p.Enforcing() {
+		return fmt.Errorf("%d of %d packages violate the license policy", len(r.Violations), r.Checked)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package sbom
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+)
+
+const cycloneDXVersion = "1.4"
+
+type cdxDocument struct {
+	BOMFormat    string          `json:"bomFormat"`
+	SpecVersion  string          `json:"specVersion"`
+	SerialNumber string          `json:"serialNumber,omitempty"`
+	Version      int             `json:"version"`
+	Metadata     cdxMetadata     `json:"metadata"`
+	Components   []cdxComponent  `json:"components"`
+	Dependencies []cdxDependency `json:"dependencies,omitempty"`
+}
+
+type cdxMetadata struct {
+	Timestamp string        `json:"timestamp"`
+	Tools     []cdxTool     `json:"tools"`
+	Component *cdxComponent `json:"component,omitempty"`
+}
+
+type cdxTool struct {
+	Name string `json:"name"`
+}
+
+type cdxHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cdxLicense struct {
+	Expression string `json:"expression"`
+}
+
+type cdxExternalReference struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type cdxComponent struct {
+	Type               string                 `json:"type"`
+	BOMRef             string                 `json:"bom-ref,omitempty"`
+	Group              string                 `json:"group,omitempty"`
+	Name               string                 `json:"name"`
+	Version            string                 `json:"version,omitempty"`
+	Description        string                 `json:"description,omitempty"`
+	Licenses           []cdxLicense           `json:"licenses,omitempty"`
+	PURL               string                 `json:"purl,omitempty"`
+	Hashes             []cdxHash              `json:"hashes,omitempty"`
+	ExternalReferences []cdxExternalReference `json:"externalReferences,omitempty"`
+	Components         []cdxComponent         `json:"components,omitempty"`
+}
+
+type cdxDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn,omitempty"`
+}
+
+func newCDXComponent(p *types.Package) cdxComponent {
+	c := cdxComponent{
+		Type:        "application",
+		BOMRef:      purl(p),
+		Group:       p.GetCategory(),
+		Name:        p.GetName(),
+		Version:     p.GetVersion(),
+		Description: p.GetDescription(),
+		PURL:        purl(p),
+	}
+	if p.GetLicense() != "" {
+		c.Licenses = []cdxLicense{{Expression: p.GetLicense()}}
+	}
+	for _, u := range p.GetURI() {
+		c.ExternalReferences = append(c.ExternalReferences, cdxExternalReference{Type: "website", URL: u})
+	}
+	return c
+}
+
+func (d *Document) cycloneDX() ([]byte, error) {
+	doc := cdxDocument{
+		BOMFormat:   "CycloneDX",
+		SpecVersion: cycloneDXVersion,
+		Version:     1,
+		Metadata: cdxMetadata{
+			Timestamp: d.Created.Format(time.RFC3339),
+			Tools:     []cdxTool{{Name: d.Tool}},
+			Component: &cdxComponent{Type: "operating-system", Name: d.Name},
+		},
+		Components: []cdxComponent{},
+	}
+
+	described := map[string]interface{}{}
+	for _, c := range d.Components {
+		described[purl(c.Package)] = nil
+	}
+
+	referenced := map[string]interface{}{}
+	for _, c := range d.Components {
+		comp := newCDXComponent(c.Package)
+		for _, l := range c.Checksums.List() {
+			if l[0] == "sha256" {
+				comp.Hashes = append(comp.Hashes, cdxHash{Alg: "SHA-256", Content: l[1]})
+			}
+		}
+		for _, f := range c.Files {
+			comp.Components = append(comp.Components, cdxComponent{
+				Type: "file",
+				Name: f.Path,
+				Hashes: []cdxHash{
+					{Alg: "SHA-1", Content: f.SHA1},
+					{Alg: "SHA-256", Content: f.SHA256},
+				},
+			})
+		}
+		doc.Components = append(doc.Components, comp)
+
+		dep := cdxDependency{Ref: comp.BOMRef}
+		for _, p := range c.Dependencies {
+			ref := purl(p)
+			// Dependencies which are not part of the document
+			// are still listed as components, so they can be referenced
+			_, isDescribed := described[ref]
+			_, isReferenced := referenced[ref]
+			if !isDescribed && !isReferenced {
+				doc.Components = append(doc.Components, newCDXComponent(p))
+				referenced[ref] = nil
+			}
+			dep.DependsOn = append(dep.DependsOn, ref)
+		}
+		doc.Dependencies = append(doc.Dependencies, dep)
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	doc.SerialNumber = serialNumber(data)
+
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// serialNumber returns an URN UUID derived from the document content
+func serialNumber(data []byte) string {
+	u := sha256.Sum256(data)
+	u[6] = (u[6] & 0x0f) | 0x50 // version 5 (name based)
+	u[8] = (u[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
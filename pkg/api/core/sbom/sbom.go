@@ -0,0 +1,259 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+// Package sbom generates Software Bill of Materials documents
+// out of package artifacts and installed systems, either in the
+// SPDX or in the CycloneDX JSON format.
+package sbom
+
+import (
+	"archive/tar"
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/mudler/luet/pkg/api/core/types/artifact"
+	"github.com/mudler/luet/pkg/helpers"
+
+	"github.com/pkg/errors"
+)
+
+// Format is the SBOM document format
+type Format string
+
+const (
+	SPDX      Format = "spdx"
+	CycloneDX Format = "cyclonedx"
+
+	// Suffix is appended to the package fingerprint to form the SBOM file name
+	Suffix = "sbom"
+
+	noAssertion = "NOASSERTION"
+)
+
+// ParseFormat returns the Format matching the given string
+func ParseFormat(s string) (Format, error) {
+	switch Format(strings.ToLower(s)) {
+	case SPDX:
+		return SPDX, nil
+	case CycloneDX:
+		return CycloneDX, nil
+	}
+	return "", fmt.Errorf("invalid sbom format '%s' (available: %s, %s)", s, SPDX, CycloneDX)
+}
+
+// FileName returns the canonical name of the SBOM file of a package
+func FileName(p *types.Package, f Format) string {
+	return fmt.Sprintf("%s.%s.%s.json", p.GetFingerPrint(), Suffix, f)
+}
+
+// File is a file shipped by a package
+type File struct {
+	Path   string
+	SHA1   string
+	SHA256 string
+}
+
+// Component is a package described in a SBOM document
+type Component struct {
+	Package      *types.Package
+	Checksums    artifact.Checksums
+	Files        []File
+	Dependencies types.Packages
+}
+
+// Document is a SBOM document composed by a set of components
+type Document struct {
+	Name       string
+	Tool       string
+	Created    time.Time
+	Components []*Component
+}
+
+// NewDocument returns a new SBOM document with the given components
+func NewDocument(name string, c ...*Component) *Document {
+	return &Document{
+		Name:       name,
+		Tool:       "luet",
+		Created:    time.Now().UTC(),
+		Components: c,
+	}
+}
+
+// Marshal encodes the document in the given format
+func (d *Document) Marshal(f Format) ([]byte, error) {
+	switch f {
+	case SPDX:
+		return d.spdx()
+	case CycloneDX:
+		return d.cycloneDX()
+	}
+	return nil, fmt.Errorf("invalid sbom format '%s'", f)
+}
+
+// WriteFile writes the document encoded in the given format to dst
+func (d *Document) WriteFile(f Format, dst string) error {
+	data, err := d.Marshal(f)
+	if err != nil {
+		return errors.Wrap(err, "while encoding sbom")
+	}
+	return ioutil.WriteFile(dst, data, os.ModePerm)
+}
+
+// FromArtifact returns the component describing a package artifact.
+// Dependencies are taken from the solution used to build the artifact.
+func FromArtifact(a *artifact.PackageArtifact) (*Component, error) {
+	if a.CompileSpec == nil || a.CompileSpec.GetPackage() == nil {
+		return nil, errors.New("artifact has no package associated")
+	}
+	p := a.CompileSpec.GetPackage()
+
+	c := &Component{Package: p, Checksums: a.Checksums}
+
+	assertions := a.SourceAssertion
+	if len(assertions) == 0 {
+		assertions = a.CompileSpec.GetSourceAssertion()
+	}
+	for _, ass := range assertions {
+		if ass.Value && !ass.Package.Matches(p) {
+			c.Dependencies = append(c.Dependencies, ass.Package)
+		}
+	}
+
+	files, err := archiveFiles(a.Path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "while reading files of '%s'", a.Path)
+	}
+	c.Files = files
+
+	return c, nil
+}
+
+// FromSystem returns the components of the packages installed in the database.
+// The files are hashed from the rootfs they are installed into.
+func FromSystem(db types.PackageDatabase, rootfs string) ([]*Component, error) {
+	res := []*Component{}
+	for _, p := range db.World() {
+		c := &Component{Package: p}
+
+		for _, r := range p.GetRequires() {
+			// Only the installed alternative is a dependency
+			for _, alt := range r.AnyOf() {
+				if dep, err := db.FindPackageCandidate(alt); err == nil {
+					c.Dependencies = append(c.Dependencies, dep)
+					break
+				}
+			}
+		}
+
+		// Packages without files (e.g. virtuals) have no entries
+		files, _ := db.GetPackageFiles(p)
+		for _, f := range files {
+			file, err := hashFile(rootfs, f)
+			if err != nil {
+				return nil, errors.Wrapf(err, "while hashing '%s'", f)
+			}
+			if file != nil {
+				c.Files = append(c.Files, *file)
+			}
+		}
+		res = append(res, c)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Package.HumanReadableString() < res[j].Package.HumanReadableString()
+	})
+	return res, nil
+}
+
+func hashFile(rootfs, path string) (*File, error) {
+	fi, err := os.Lstat(filepath.Join(rootfs, path))
+	if err != nil || !fi.Mode().IsRegular() {
+		// Files removed from the system or not regular aren't hashed
+		return nil, nil
+	}
+	f, err := os.Open(filepath.Join(rootfs, path))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return newFile(path, f)
+}
+
+func newFile(path string, r io.Reader) (*File, error) {
+	s1 := sha1.New()
+	s256 := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(s1, s256), r); err != nil {
+		return nil, err
+	}
+	return &File{
+		Path:   path,
+		SHA1:   fmt.Sprintf("%x", s1.Sum(nil)),
+		SHA256: fmt.Sprintf("%x", s256.Sum(nil)),
+	}, nil
+}
+
+func archiveFiles(path string) ([]File, error) {
+	files := []File{}
+
+	archiveFile, err := os.Open(path)
+	if err != nil {
+		return files, errors.Wrap(err, "Cannot open "+path)
+	}
+	defer archiveFile.Close()
+
+	decompressed, err := helpers.DecompressStream(archiveFile)
+	if err != nil {
+		return files, errors.Wrap(err, "Cannot open "+path)
+	}
+	defer decompressed.Close()
+	tr := tar.NewReader(decompressed)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return []File{}, err
+		}
+		if !hdr.FileInfo().Mode().IsRegular() {
+			continue
+		}
+		f, err := newFile(hdr.Name, tr)
+		if err != nil {
+			return []File{}, err
+		}
+		files = append(files, *f)
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+func purl(p *types.Package) string {
+	if p.GetCategory() == "" {
+		return fmt.Sprintf("pkg:luet/%s@%s", p.GetName(), p.GetVersion())
+	}
+	return fmt.Sprintf("pkg:luet/%s/%s@%s", p.GetCategory(), p.GetName(), p.GetVersion())
+}
@@ -0,0 +1,150 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package sbom_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/mudler/luet/pkg/api/core/sbom"
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/mudler/luet/pkg/api/core/types/artifact"
+	pkg "github.com/mudler/luet/pkg/database"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SBOM", func() {
+	a := &types.Package{Name: "a", Category: "test", Version: "1.0", License: "MIT", Uri: []string{"https://example.com"}}
+	b := &types.Package{Name: "b", Category: "test", Version: "2.0", License: "GPL-2.0-only"}
+
+	var rootfs string
+	var art *artifact.PackageArtifact
+
+	BeforeEach(func() {
+		var err error
+		rootfs, err = ioutil.TempDir("", "sbom")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(os.MkdirAll(filepath.Join(rootfs, "src", "usr", "bin"), os.ModePerm)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(rootfs, "src", "usr", "bin", "a"), []byte("foo"), os.ModePerm)).To(Succeed())
+
+		art = artifact.NewPackageArtifact(filepath.Join(rootfs, "a.package.tar"))
+		art.CompressionType = types.GZip
+		Expect(art.Compress(filepath.Join(rootfs, "src"), 1)).To(Succeed())
+		art.CompileSpec = &types.LuetCompilationSpec{Package: a}
+		art.SourceAssertion = types.PackagesAssertions{
+			{Package: a, Value: true},
+			{Package: b, Value: true},
+			{Package: &types.Package{Name: "c", Category: "test", Version: "1.0"}, Value: false},
+		}
+		Expect(art.Hash()).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(rootfs)
+	})
+
+	Context("Formats", func() {
+		It("parses formats", func() {
+			f, err := ParseFormat("SPDX")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(f).To(Equal(SPDX))
+			_, err = ParseFormat("foo")
+			Expect(err).To(HaveOccurred())
+			Expect(FileName(a, CycloneDX)).To(Equal("a-test-1.0.sbom.cyclonedx.json"))
+		})
+	})
+
+	Context("Artifacts", func() {
+		It("describes files and dependencies", func() {
+			c, err := FromArtifact(art)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Dependencies).To(Equal(types.Packages{b}))
+			Expect(len(c.Files)).To(Equal(1))
+			Expect(c.Files[0].Path).To(Equal("usr/bin/a"))
+			Expect(c.Files[0].SHA256).To(Equal("2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"))
+		})
+
+		It("generates SPDX documents", func() {
+			c, err := FromArtifact(art)
+			Expect(err).ToNot(HaveOccurred())
+			data, err := NewDocument("test", c).Marshal(SPDX)
+			Expect(err).ToNot(HaveOccurred())
+
+			doc := map[string]interface{}{}
+			Expect(json.Unmarshal(data, &doc)).To(Succeed())
+			Expect(doc["spdxVersion"]).To(Equal("SPDX-2.3"))
+			Expect(doc["documentNamespace"]).ToNot(BeEmpty())
+
+			packages := doc["packages"].([]interface{})
+			Expect(len(packages)).To(Equal(2))
+			Expect(packages[0].(map[string]interface{})["licenseDeclared"]).To(Equal("MIT"))
+			Expect(packages[0].(map[string]interface{})["homepage"]).To(Equal("https://example.com"))
+			Expect(len(doc["files"].([]interface{}))).To(Equal(1))
+
+			relationships := []string{}
+			for _, r := range doc["relationships"].([]interface{}) {
+				relationships = append(relationships, r.(map[string]interface{})["relationshipType"].(string))
+			}
+			Expect(relationships).To(Equal([]string{"DESCRIBES", "CONTAINS", "DEPENDS_ON"}))
+		})
+
+		It("generates CycloneDX documents", func() {
+			c, err := FromArtifact(art)
+			Expect(err).ToNot(HaveOccurred())
+			data, err := NewDocument("test", c).Marshal(CycloneDX)
+			Expect(err).ToNot(HaveOccurred())
+
+			doc := map[string]interface{}{}
+			Expect(json.Unmarshal(data, &doc)).To(Succeed())
+			Expect(doc["bomFormat"]).To(Equal("CycloneDX"))
+			Expect(doc["serialNumber"]).To(HavePrefix("urn:uuid:"))
+
+			components := doc["components"].([]interface{})
+			Expect(len(components)).To(Equal(2))
+			first := components[0].(map[string]interface{})
+			Expect(first["purl"]).To(Equal("pkg:luet/test/a@1.0"))
+			Expect(len(first["components"].([]interface{}))).To(Equal(1))
+
+			deps := doc["dependencies"].([]interface{})
+			Expect(deps[0].(map[string]interface{})["dependsOn"]).To(Equal([]interface{}{"pkg:luet/test/b@2.0"}))
+		})
+	})
+
+	Context("Systems", func() {
+		It("describes installed packages", func() {
+			db := pkg.NewInMemoryDatabase(false)
+			installed := a.Clone()
+			installed.PackageRequires = []*types.Package{{Name: "b", Category: "test", Version: ">=0"}}
+			_, err := db.CreatePackage(installed)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = db.CreatePackage(b)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(db.SetPackageFiles(&types.PackageFile{PackageFingerprint: installed.GetFingerPrint(), Files: []string{"usr/bin/a", "usr/bin/missing"}})).To(Succeed())
+
+			components, err := FromSystem(db, filepath.Join(rootfs, "src"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(components)).To(Equal(2))
+			Expect(components[0].Package.GetName()).To(Equal("a"))
+			Expect(len(components[0].Files)).To(Equal(1))
+			Expect(components[0].Dependencies[0].GetName()).To(Equal("b"))
+		})
+	})
+})
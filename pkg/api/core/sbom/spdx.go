@@ -0,0 +1,202 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package sbom
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+)
+
+const spdxVersion = "SPDX-2.3"
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Files             []spdxFile         `json:"files,omitempty"`
+	Relationships     []spdxRelationship `json:"relationships,omitempty"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxPackage struct {
+	SPDXID           string            `json:"SPDXID"`
+	Name             string            `json:"name"`
+	VersionInfo      string            `json:"versionInfo"`
+	DownloadLocation string            `json:"downloadLocation"`
+	Homepage         string            `json:"homepage,omitempty"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	CopyrightText    string            `json:"copyrightText"`
+	Description      string            `json:"description,omitempty"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	Checksums        []spdxChecksum    `json:"checksums,omitempty"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+}
+
+type spdxFile struct {
+	SPDXID    string         `json:"SPDXID"`
+	FileName  string         `json:"fileName"`
+	Checksums []spdxChecksum `json:"checksums"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+var spdxInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9.-]+`)
+
+func spdxID(kind, s string) string {
+	return fmt.Sprintf("SPDXRef-%s-%s", kind, spdxInvalidChars.ReplaceAllString(s, "-"))
+}
+
+func spdxPackageID(p *types.Package) string {
+	return spdxID("Package", fmt.Sprintf("%s-%s-%s", p.GetCategory(), p.GetName(), p.GetVersion()))
+}
+
+func orNoAssertion(s string) string {
+	if s == "" {
+		return noAssertion
+	}
+	return s
+}
+
+func newSPDXPackage(p *types.Package) spdxPackage {
+	pack := spdxPackage{
+		SPDXID:           spdxPackageID(p),
+		Name:             p.GetName(),
+		VersionInfo:      p.GetVersion(),
+		DownloadLocation: noAssertion,
+		LicenseConcluded: noAssertion,
+		LicenseDeclared:  orNoAssertion(p.GetLicense()),
+		CopyrightText:    noAssertion,
+		Description:      p.GetDescription(),
+		ExternalRefs: []spdxExternalRef{
+			{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  purl(p),
+			},
+		},
+	}
+	if len(p.GetURI()) > 0 {
+		pack.Homepage = p.GetURI()[0]
+	}
+	return pack
+}
+
+func (d *Document) spdx() ([]byte, error) {
+	doc := spdxDocument{
+		SPDXVersion: spdxVersion,
+		DataLicense: "CC0-1.0",
+		SPDXID:      "SPDXRef-DOCUMENT",
+		Name:        d.Name,
+		CreationInfo: spdxCreationInfo{
+			Created:  d.Created.Format(time.RFC3339),
+			Creators: []string{"Tool: " + d.Tool},
+		},
+		Packages: []spdxPackage{},
+	}
+
+	described := map[string]interface{}{}
+	for _, c := range d.Components {
+		described[spdxPackageID(c.Package)] = nil
+	}
+
+	referenced := map[string]interface{}{}
+	for _, c := range d.Components {
+		pack := newSPDXPackage(c.Package)
+		pack.FilesAnalyzed = len(c.Files) > 0
+		for _, l := range c.Checksums.List() {
+			if l[0] == "sha256" {
+				pack.Checksums = append(pack.Checksums, spdxChecksum{Algorithm: "SHA256", ChecksumValue: l[1]})
+			}
+		}
+		doc.Packages = append(doc.Packages, pack)
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			SPDXElementID:      doc.SPDXID,
+			RelationshipType:   "DESCRIBES",
+			RelatedSPDXElement: pack.SPDXID,
+		})
+
+		for _, f := range c.Files {
+			file := spdxFile{
+				SPDXID:   spdxID("File", fmt.Sprintf("%s-%x", c.Package.GetFingerPrint(), sha256.Sum256([]byte(f.Path)))),
+				FileName: "./" + f.Path,
+				Checksums: []spdxChecksum{
+					{Algorithm: "SHA1", ChecksumValue: f.SHA1},
+					{Algorithm: "SHA256", ChecksumValue: f.SHA256},
+				},
+			}
+			doc.Files = append(doc.Files, file)
+			doc.Relationships = append(doc.Relationships, spdxRelationship{
+				SPDXElementID:      pack.SPDXID,
+				RelationshipType:   "CONTAINS",
+				RelatedSPDXElement: file.SPDXID,
+			})
+		}
+
+		for _, dep := range c.Dependencies {
+			depID := spdxPackageID(dep)
+			// Dependencies which are not part of the document
+			// are still listed as packages, so they can be referenced
+			_, isDescribed := described[depID]
+			_, isReferenced := referenced[depID]
+			if !isDescribed && !isReferenced {
+				doc.Packages = append(doc.Packages, newSPDXPackage(dep))
+				referenced[depID] = nil
+			}
+			doc.Relationships = append(doc.Relationships, spdxRelationship{
+				SPDXElementID:      pack.SPDXID,
+				RelationshipType:   "DEPENDS_ON",
+				RelatedSPDXElement: depID,
+			})
+		}
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	doc.DocumentNamespace = fmt.Sprintf("https://luet.io/spdx/%s-%x", spdxInvalidChars.ReplaceAllString(d.Name, "-"), sha256.Sum256(data))
+
+	return json.MarshalIndent(doc, "", "  ")
+}
@@ -28,16 +28,18 @@ import (
 	"path"
 	"path/filepath"
 	"runtime"
+	"time"
 
 	"github.com/docker/docker/pkg/pools"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	zstd "github.com/klauspost/compress/zstd"
 	gzip "github.com/klauspost/pgzip"
+	"github.com/pierrec/lz4/v4"
+	"github.com/ulikunitz/xz"
 
 	//"strconv"
 	"strings"
 
-	containerdCompression "github.com/containerd/containerd/archive/compression"
 	bus "github.com/mudler/luet/pkg/api/core/bus"
 	config "github.com/mudler/luet/pkg/api/core/config"
 	"github.com/mudler/luet/pkg/api/core/image"
@@ -64,9 +66,18 @@ type PackageArtifact struct {
 	Files             []string                        `json:"files"`
 	PackageCacheImage string                          `json:"package_cacheimage"`
 	Runtime           *types.Package                  `json:"runtime,omitempty"`
+	SBOM              string                          `json:"sbom,omitempty"`
+	// Arch is the architecture the artifact was built for, empty if architecture independent
+	Arch string `json:"arch,omitempty"`
+
+	// CompressionLevel is the level used by Compress, 0 for the default one of the compression type
+	CompressionLevel int `json:"-" yaml:"-"`
+
+	// Reproducible makes Compress generate archives which depend only on the content
+	Reproducible bool `json:"-" yaml:"-"`
 }
 
-func ImageToArtifact(ctx types.Context, img v1.Image, t types.CompressionImplementation, output string, filter func(h *tar.Header) (bool, error)) (*PackageArtifact, error) {
+func ImageToArtifact(ctx types.Context, img v1.Image, t types.CompressionImplementation, output string, filter func(h *tar.Header) (bool, error), opts ...func(*PackageArtifact)) (*PackageArtifact, error) {
 	_, tmpdiffs, err := image.Extract(ctx, img, filter)
 	if err != nil {
 		return nil, errors.Wrap(err, "Error met while creating tempdir for rootfs")
@@ -75,6 +86,9 @@ func ImageToArtifact(ctx types.Context, img v1.Image, t types.CompressionImpleme
 
 	a := NewPackageArtifact(output)
 	a.CompressionType = t
+	for _, o := range opts {
+		o(a)
+	}
 	err = a.Compress(tmpdiffs, 1)
 	if err != nil {
 		return nil, errors.Wrap(err, "Error met while creating package archive")
@@ -91,6 +105,20 @@ func NewPackageArtifact(path string) *PackageArtifact {
 	return &PackageArtifact{Path: path, Dependencies: []*PackageArtifact{}, Checksums: Checksums{}, CompressionType: types.None}
 }
 
+// WithLevel sets the level of the compression of the artifact
+func WithLevel(level int) func(*PackageArtifact) {
+	return func(a *PackageArtifact) {
+		a.CompressionLevel = level
+	}
+}
+
+// WithReproducible sets the artifact to be compressed in a reproducible archive
+func WithReproducible(b bool) func(*PackageArtifact) {
+	return func(a *PackageArtifact) {
+		a.Reproducible = b
+	}
+}
+
 func NewPackageArtifactFromYaml(data []byte) (*PackageArtifact, error) {
 	p := &PackageArtifact{Checksums: Checksums{}}
 	return p, yaml.Unmarshal(data, p)
@@ -237,52 +265,78 @@ func (a *PackageArtifact) GenerateFinalImage(ctx types.Context, imageName string
 	return nil
 }
 
-// Compress is responsible to archive and compress to the artifact Path.
-// It accepts a source path, which is the content to be archived/compressed
-// and a concurrency parameter.
-func (a *PackageArtifact) Compress(src string, concurrency int) error {
-	switch a.CompressionType {
+// tar archives src to dst, reproducibly if required by the artifact
+func (a *PackageArtifact) tar(src, dst string) error {
+	if !a.Reproducible {
+		return helpers.Tar(src, dst)
+	}
+	epoch, err := helpers.SourceDateEpoch()
+	if err != nil {
+		return err
+	}
+	return helpers.TarReproducible(src, dst, epoch)
+}
 
+// xzDictCaps are the dictionary sizes of the xz levels, as in the xz presets
+var xzDictCaps = []int{0, 1 << 20, 2 << 20, 4 << 20, 4 << 20, 8 << 20, 8 << 20, 16 << 20, 32 << 20, 64 << 20}
+
+var lz4Levels = []lz4.CompressionLevel{lz4.Fast, lz4.Level1, lz4.Level2, lz4.Level3, lz4.Level4, lz4.Level5, lz4.Level6, lz4.Level7, lz4.Level8, lz4.Level9}
+
+// compressor returns a writer compressing to w with the compression type and level of the artifact
+func (a *PackageArtifact) compressor(w io.Writer, concurrency int) (io.WriteCloser, error) {
+	level := a.CompressionLevel
+	switch a.CompressionType {
 	case types.Zstandard:
-		err := helpers.Tar(src, a.Path)
-		if err != nil {
-			return err
+		opts := []zstd.EOption{}
+		if level != 0 {
+			opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
 		}
-		original, err := os.Open(a.Path)
-		if err != nil {
-			return err
+		if a.Reproducible {
+			// Don't let the output depend on the number of CPUs
+			opts = append(opts, zstd.WithEncoderConcurrency(1))
 		}
-		defer original.Close()
-
-		zstdFile := a.getCompressedName()
-		bufferedReader := bufio.NewReader(original)
-
-		// Open a file for writing.
-		dst, err := os.Create(zstdFile)
-		if err != nil {
-			return err
+		return zstd.NewWriter(w, opts...)
+	case types.GZip:
+		if level == 0 {
+			level = gzip.DefaultCompression
 		}
-
-		enc, err := zstd.NewWriter(dst)
+		gw, err := gzip.NewWriterLevel(w, level)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		_, err = io.Copy(enc, bufferedReader)
-		if err != nil {
-			enc.Close()
-			return err
+		if a.Reproducible {
+			gw.Header.ModTime = time.Time{}
+			gw.Header.Name = ""
 		}
-		if err := enc.Close(); err != nil {
-			return err
+		gw.SetConcurrency(1<<20, concurrency)
+		return gw, nil
+	case types.XZ:
+		cfg := xz.WriterConfig{}
+		if level != 0 {
+			cfg.DictCap = xzDictCaps[level]
 		}
+		return cfg.NewWriter(w)
+	case types.LZ4:
+		lw := lz4.NewWriter(w)
+		if err := lw.Apply(lz4.CompressionLevelOption(lz4Levels[level])); err != nil {
+			return nil, err
+		}
+		return lw, nil
+	}
+	return nil, fmt.Errorf("unsupported compression %s", a.CompressionType)
+}
 
-		os.RemoveAll(a.Path) // Remove original
-		//	Debug("Removed artifact", a.Path)
+// Compress is responsible to archive and compress to the artifact Path.
+// It accepts a source path, which is the content to be archived/compressed
+// and a concurrency parameter.
+func (a *PackageArtifact) Compress(src string, concurrency int) error {
+	if err := a.CompressionType.Validate(a.CompressionLevel); err != nil {
+		return err
+	}
 
-		a.Path = zstdFile
-		return nil
-	case types.GZip:
-		err := helpers.Tar(src, a.Path)
+	switch a.CompressionType {
+	case types.Zstandard, types.GZip, types.XZ, types.LZ4:
+		err := a.tar(src, a.Path)
 		if err != nil {
 			return err
 		}
@@ -292,34 +346,38 @@ func (a *PackageArtifact) Compress(src string, concurrency int) error {
 		}
 		defer original.Close()
 
-		gzipfile := a.getCompressedName()
+		compressedFile := a.getCompressedName()
 		bufferedReader := bufio.NewReader(original)
 
 		// Open a file for writing.
-		dst, err := os.Create(gzipfile)
+		dst, err := os.Create(compressedFile)
 		if err != nil {
 			return err
 		}
-		// Create gzip writer.
-		w := gzip.NewWriter(dst)
-		w.SetConcurrency(1<<20, concurrency)
-		defer w.Close()
 		defer dst.Close()
+
+		w, err := a.compressor(dst, concurrency)
+		if err != nil {
+			return err
+		}
 		_, err = io.Copy(w, bufferedReader)
 		if err != nil {
+			w.Close()
+			return err
+		}
+		if err := w.Close(); err != nil {
 			return err
 		}
-		w.Close()
+
 		os.RemoveAll(a.Path) // Remove original
 		//	Debug("Removed artifact", a.Path)
-		//	a.CompressedPath = gzipfile
-		a.Path = gzipfile
+
+		a.Path = compressedFile
 		return nil
-		//a.Path = gzipfile
 
 	// Defaults to tar only (covers when "none" is supplied)
 	default:
-		return helpers.Tar(src, a.getCompressedName())
+		return a.tar(src, a.getCompressedName())
 	}
 }
 
@@ -330,6 +388,12 @@ func (a *PackageArtifact) getCompressedName() string {
 
 	case types.GZip:
 		return a.Path + ".gz"
+
+	case types.XZ:
+		return a.Path + ".xz"
+
+	case types.LZ4:
+		return a.Path + ".lz4"
 	}
 	return a.Path
 }
@@ -337,7 +401,7 @@ func (a *PackageArtifact) getCompressedName() string {
 // GetUncompressedName returns the artifact path without the extension suffix
 func (a *PackageArtifact) GetUncompressedName() string {
 	switch a.CompressionType {
-	case types.Zstandard, types.GZip:
+	case types.Zstandard, types.GZip, types.XZ, types.LZ4:
 		return strings.TrimSuffix(a.Path, filepath.Ext(a.Path))
 	}
 	return a.Path
@@ -557,7 +621,7 @@ func (a *PackageArtifact) Unpack(ctx types.Context, dst string, keepPerms bool,
 	}
 	defer archiveFile.Close()
 
-	decompressed, err := containerdCompression.DecompressStream(archiveFile)
+	decompressed, err := helpers.DecompressStream(archiveFile)
 	if err != nil {
 		return errors.Wrap(err, "Cannot open "+a.Path)
 	}
@@ -592,7 +656,7 @@ func (a *PackageArtifact) FileList() ([]string, error) {
 	}
 	defer archiveFile.Close()
 
-	decompressed, err := containerdCompression.DecompressStream(archiveFile)
+	decompressed, err := helpers.DecompressStream(archiveFile)
 	if err != nil {
 		return files, errors.Wrap(err, "Cannot open "+a.Path)
 	}
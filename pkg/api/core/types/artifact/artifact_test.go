@@ -16,9 +16,11 @@
 package artifact_test
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/mudler/luet/pkg/api/core/types"
 
@@ -229,5 +231,122 @@ RUN echo bar > /test2`))
 			a.CompressionType = types.None
 			Expect(a.GetUncompressedName()).To(Equal("foo.tar"))
 		})
+
+		It("Generates reproducible archives", func() {
+			tmpdir, err := ioutil.TempDir(os.TempDir(), "reproducible")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(tmpdir)
+
+			populate := func(dir string, mtime time.Time) {
+				Expect(os.MkdirAll(filepath.Join(dir, "usr", "bin"), os.ModePerm)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(dir, "usr", "bin", "foo"), []byte("foo"), 0755)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(dir, "bar"), []byte("bar"), 0644)).To(Succeed())
+				Expect(os.Symlink("usr/bin/foo", filepath.Join(dir, "baz"))).To(Succeed())
+				for _, f := range []string{"usr/bin/foo", "usr/bin", "usr", "bar", "."} {
+					Expect(os.Chtimes(filepath.Join(dir, f), mtime, mtime)).To(Succeed())
+				}
+			}
+
+			populate(filepath.Join(tmpdir, "first"), time.Now())
+			populate(filepath.Join(tmpdir, "second"), time.Now().Add(-time.Hour))
+
+			for _, t := range []types.CompressionImplementation{types.None, types.GZip, types.Zstandard} {
+				checksums := []Checksums{}
+				for _, dir := range []string{"first", "second"} {
+					a := NewPackageArtifact(filepath.Join(tmpdir, dir+string(t)+".tar"))
+					a.CompressionType = t
+					a.Reproducible = true
+					Expect(a.Compress(filepath.Join(tmpdir, dir), 2)).To(Succeed())
+					Expect(a.Hash()).To(Succeed())
+					checksums = append(checksums, a.Checksums)
+				}
+				Expect(checksums[0]).To(Equal(checksums[1]), string(t))
+			}
+		})
+
+		It("Compresses and unpacks all the supported formats", func() {
+			tmpdir, err := ioutil.TempDir(os.TempDir(), "compression")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(tmpdir)
+
+			src := filepath.Join(tmpdir, "src")
+			Expect(os.MkdirAll(filepath.Join(src, "usr", "bin"), os.ModePerm)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(src, "usr", "bin", "foo"), []byte("foo"), 0755)).To(Succeed())
+
+			for _, tc := range []struct {
+				t     types.CompressionImplementation
+				level int
+				ext   string
+			}{
+				{types.None, 0, ".tar"},
+				{types.GZip, 9, ".tar.gz"},
+				{types.Zstandard, 19, ".tar.zst"},
+				{types.XZ, 0, ".tar.xz"},
+				{types.XZ, 1, ".tar.xz"},
+				{types.LZ4, 0, ".tar.lz4"},
+				{types.LZ4, 9, ".tar.lz4"},
+			} {
+				name := fmt.Sprintf("%s-%d", tc.t, tc.level)
+				a := NewPackageArtifact(filepath.Join(tmpdir, name+".tar"))
+				a.CompressionType = tc.t
+				a.CompressionLevel = tc.level
+				Expect(a.Compress(src, 1)).To(Succeed())
+				Expect(a.Path).To(Equal(filepath.Join(tmpdir, name+tc.ext)))
+				Expect(a.GetUncompressedName()).To(Equal(filepath.Join(tmpdir, name+".tar")))
+
+				// The format is detected while unpacking
+				b := NewPackageArtifact(a.Path)
+				files, err := b.FileList()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(files).To(Equal([]string{"usr/bin/foo"}), name)
+
+				dst := filepath.Join(tmpdir, name)
+				Expect(os.MkdirAll(dst, os.ModePerm)).To(Succeed())
+				Expect(b.Unpack(ctx, dst, false)).To(Succeed())
+				Expect(fileHelper.Read(filepath.Join(dst, "usr", "bin", "foo"))).To(Equal("foo"))
+			}
+
+			a := NewPackageArtifact(filepath.Join(tmpdir, "invalid.tar"))
+			a.CompressionType = types.GZip
+			a.CompressionLevel = 10
+			Expect(a.Compress(src, 1)).ToNot(Succeed())
+		})
+
+		It("Compares the files of artifacts", func() {
+			tmpdir, err := ioutil.TempDir(os.TempDir(), "diff")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(tmpdir)
+
+			for _, dir := range []string{"first", "second"} {
+				Expect(os.MkdirAll(filepath.Join(tmpdir, dir), os.ModePerm)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(tmpdir, dir, "same"), []byte("same"), 0644)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(tmpdir, dir, "content"), []byte(dir), 0644)).To(Succeed())
+				Expect(os.Symlink(dir, filepath.Join(tmpdir, dir, "link"))).To(Succeed())
+			}
+			Expect(ioutil.WriteFile(filepath.Join(tmpdir, "first", "mode"), []byte("mode"), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(tmpdir, "second", "mode"), []byte("mode"), 0644)).To(Succeed())
+			Expect(os.Chmod(filepath.Join(tmpdir, "second", "mode"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(tmpdir, "first", "removed"), []byte("removed"), 0644)).To(Succeed())
+
+			artifacts := []*PackageArtifact{}
+			for _, dir := range []string{"first", "second"} {
+				a := NewPackageArtifact(filepath.Join(tmpdir, dir+".tar"))
+				Expect(a.Compress(filepath.Join(tmpdir, dir), 1)).To(Succeed())
+				artifacts = append(artifacts, a)
+			}
+
+			diff, err := artifacts[0].Diff(artifacts[1])
+			Expect(err).ToNot(HaveOccurred())
+			Expect(diff).To(Equal([]FileDiff{
+				{Path: "/content", Changes: []string{"content: sha256 a7937b64b8ca (5 bytes) -> 16367aacb67a (6 bytes)"}},
+				{Path: "/link", Changes: []string{"link target: first -> second"}},
+				{Path: "/mode", Changes: []string{"mode: 0644 -> 0755"}},
+				{Path: "/removed", Changes: []string{"only in " + filepath.Join(tmpdir, "first.tar")}},
+			}))
+
+			diff, err = artifacts[0].Diff(artifacts[0])
+			Expect(err).ToNot(HaveOccurred())
+			Expect(diff).To(BeEmpty())
+		})
 	})
 })
@@ -0,0 +1,185 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package artifact
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/mudler/luet/pkg/helpers"
+	"github.com/pkg/errors"
+)
+
+// FileDiff is a file which differs between two artifacts
+type FileDiff struct {
+	Path    string   `json:"path"`
+	Changes []string `json:"changes"`
+}
+
+func (d FileDiff) String() string {
+	return fmt.Sprintf("%s: %s", d.Path, strings.Join(d.Changes, ", "))
+}
+
+type fileEntry struct {
+	typeflag           byte
+	mode               int64
+	uid, gid           int
+	linkname           string
+	size               int64
+	sum                string
+	devmajor, devminor int64
+}
+
+func fileType(typeflag byte) string {
+	switch typeflag {
+	case tar.TypeReg, tar.TypeRegA:
+		return "regular file"
+	case tar.TypeDir:
+		return "directory"
+	case tar.TypeSymlink:
+		return "symlink"
+	case tar.TypeLink:
+		return "hard link"
+	case tar.TypeChar:
+		return "character device"
+	case tar.TypeBlock:
+		return "block device"
+	case tar.TypeFifo:
+		return "fifo"
+	}
+	return fmt.Sprintf("type %q", typeflag)
+}
+
+// entries returns the files in the artifact archive, indexed by their absolute path
+func (a *PackageArtifact) entries() (map[string]fileEntry, error) {
+	res := map[string]fileEntry{}
+
+	archiveFile, err := os.Open(a.Path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot open "+a.Path)
+	}
+	defer archiveFile.Close()
+
+	decompressed, err := helpers.DecompressStream(archiveFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot open "+a.Path)
+	}
+	defer decompressed.Close()
+
+	tr := tar.NewReader(decompressed)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "while reading "+a.Path)
+		}
+
+		e := fileEntry{
+			typeflag: hdr.Typeflag,
+			mode:     hdr.Mode & 07777,
+			uid:      hdr.Uid,
+			gid:      hdr.Gid,
+			linkname: hdr.Linkname,
+			size:     hdr.Size,
+			devmajor: hdr.Devmajor,
+			devminor: hdr.Devminor,
+		}
+		if hdr.Typeflag == tar.TypeRegA {
+			e.typeflag = tar.TypeReg
+		}
+		if e.typeflag == tar.TypeReg {
+			h := sha256.New()
+			if _, err := io.Copy(h, tr); err != nil {
+				return nil, errors.Wrap(err, "while reading "+a.Path)
+			}
+			e.sum = fmt.Sprintf("%x", h.Sum(nil))
+		}
+		res[path.Clean("/"+hdr.Name)] = e
+	}
+	return res, nil
+}
+
+// Diff compares the files of the artifact with the ones of another artifact, returning
+// the files which differ in content, type, mode, ownership or link target. Modification
+// times are not compared.
+func (a *PackageArtifact) Diff(other *PackageArtifact) ([]FileDiff, error) {
+	first, err := a.entries()
+	if err != nil {
+		return nil, err
+	}
+	second, err := other.entries()
+	if err != nil {
+		return nil, err
+	}
+
+	paths := []string{}
+	for p := range first {
+		paths = append(paths, p)
+	}
+	for p := range second {
+		if _, ok := first[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	res := []FileDiff{}
+	for _, p := range paths {
+		f, inFirst := first[p]
+		s, inSecond := second[p]
+
+		changes := []string{}
+		switch {
+		case !inSecond:
+			changes = append(changes, "only in "+a.Path)
+		case !inFirst:
+			changes = append(changes, "only in "+other.Path)
+		case f.typeflag != s.typeflag:
+			changes = append(changes, fmt.Sprintf("type: %s -> %s", fileType(f.typeflag), fileType(s.typeflag)))
+		default:
+			if f.sum != s.sum {
+				changes = append(changes, fmt.Sprintf("content: sha256 %.12s (%d bytes) -> %.12s (%d bytes)", f.sum, f.size, s.sum, s.size))
+			}
+			if f.linkname != s.linkname {
+				changes = append(changes, fmt.Sprintf("link target: %s -> %s", f.linkname, s.linkname))
+			}
+			if f.devmajor != s.devmajor || f.devminor != s.devminor {
+				changes = append(changes, fmt.Sprintf("device: %d:%d -> %d:%d", f.devmajor, f.devminor, s.devmajor, s.devminor))
+			}
+		}
+		if inFirst && inSecond {
+			if f.mode != s.mode {
+				changes = append(changes, fmt.Sprintf("mode: %04o -> %04o", f.mode, s.mode))
+			}
+			if f.uid != s.uid || f.gid != s.gid {
+				changes = append(changes, fmt.Sprintf("owner: %d:%d -> %d:%d", f.uid, f.gid, s.uid, s.gid))
+			}
+		}
+
+		if len(changes) != 0 {
+			res = append(res, FileDiff{Path: p, Changes: changes})
+		}
+	}
+	return res, nil
+}
@@ -43,7 +43,7 @@ func (assertions PackagesAssertions) EnsureOrder(definitiondb PackageDatabase) (
 
 	// Build a topological graph
 	for _, a := range allAssertions {
-		for _, req := range a.Package.GetRequires() {
+		for _, req := range assertions.requires(a.Package) {
 			if def, err := definitiondb.FindPackage(req); err == nil { // Provides: Get a chance of being override here
 				req = def
 			}
@@ -88,6 +88,37 @@ func (assertions PackagesAssertions) Search(f string) *PackageAssert {
 	return nil
 }
 
+// alternatives returns the alternatives of a requirement which are part of
+// the assertions, or the requirement itself if none is
+func (assertions PackagesAssertions) alternatives(r *Package) []*Package {
+	if len(r.GetAlternatives()) == 0 {
+		return []*Package{r}
+	}
+	res := []*Package{}
+	for _, alt := range r.AnyOf() {
+		for _, a := range assertions {
+			if a.Value && a.Package.AtomMatches(alt) {
+				res = append(res, alt)
+				break
+			}
+		}
+	}
+	if len(res) == 0 {
+		return r.AnyOf()[:1]
+	}
+	return res
+}
+
+// requires returns the active requirements of a package, with the alternatives
+// resolved against the assertions
+func (assertions PackagesAssertions) requires(p *Package) []*Package {
+	res := []*Package{}
+	for _, r := range p.GetActiveRequires() {
+		res = append(res, assertions.alternatives(r)...)
+	}
+	return res
+}
+
 func (assertions PackagesAssertions) Order(definitiondb PackageDatabase, fingerprint string) (PackagesAssertions, error) {
 
 	orderedAssertions := PackagesAssertions{}
@@ -107,7 +138,7 @@ func (assertions PackagesAssertions) Order(definitiondb PackageDatabase, fingerp
 		currentPkg := a.Package
 		added := map[string]interface{}{}
 	REQUIRES:
-		for _, requiredDef := range currentPkg.GetRequires() {
+		for _, requiredDef := range assertions.requires(currentPkg) {
 			if def, err := definitiondb.FindPackage(requiredDef); err == nil { // Provides: Get a chance of being override here
 				requiredDef = def
 			}
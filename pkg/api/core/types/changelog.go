@@ -0,0 +1,139 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	fileHelper "github.com/mudler/luet/pkg/helpers/file"
+	version "github.com/mudler/luet/pkg/versioner"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+)
+
+// PackageChangelogFile is the optional file that can be placed next to
+// a package definition to carry its changelog
+const PackageChangelogFile = "changelog.yaml"
+
+// ChangelogEntry represents the release notes of a single package version
+type ChangelogEntry struct {
+	Version string   `json:"version" yaml:"version"`
+	Date    string   `json:"date,omitempty" yaml:"date,omitempty"`
+	Changes []string `json:"changes,omitempty" yaml:"changes,omitempty"`
+}
+
+// Changelog is the list of release notes of a package
+type Changelog []ChangelogEntry
+
+// ChangelogFromYaml decodes a changelog from yaml bytes.
+// It accepts both a plain list of entries or a document with a `changelog` key.
+func ChangelogFromYaml(yml []byte) (Changelog, error) {
+	var wrapped struct {
+		Changelog Changelog `json:"changelog"`
+	}
+	if err := yaml.Unmarshal(yml, &wrapped); err == nil {
+		return wrapped.Changelog, nil
+	}
+
+	c := Changelog{}
+	if err := yaml.Unmarshal(yml, &c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Versions returns the versions in the changelog, sorted from the oldest to the newest
+func (c Changelog) Versions() []string {
+	versions := []string{}
+	seen := map[string]interface{}{}
+	for _, e := range c {
+		if _, ok := seen[e.Version]; ok {
+			continue
+		}
+		seen[e.Version] = nil
+		versions = append(versions, e.Version)
+	}
+	return version.DefaultVersioner().Sort(versions)
+}
+
+// Between returns the entries newer than from and older or equal than to,
+// sorted from the newest to the oldest. An empty from or to leaves the range open.
+func (c Changelog) Between(from, to string) Changelog {
+	v := version.DefaultVersioner()
+	res := Changelog{}
+
+	versions := c.Versions()
+	for i := len(versions) - 1; i >= 0; i-- {
+		ver := versions[i]
+		if from != "" && !v.ValidateSelector(ver, ">"+from) {
+			continue
+		}
+		if to != "" && !v.ValidateSelector(ver, "<="+to) {
+			continue
+		}
+		for _, e := range c {
+			if e.Version == ver {
+				res = append(res, e)
+			}
+		}
+	}
+	return res
+}
+
+// GetChangelog returns the package changelog
+func (p *Package) GetChangelog() Changelog {
+	return p.Changelog
+}
+
+// SetChangelog sets the package changelog
+func (p *Package) SetChangelog(c Changelog) {
+	p.Changelog = c
+}
+
+// LoadChangelog reads the changelog file next to the package definition, if any.
+// Entries defined inline in the package definition take precedence.
+func (p *Package) LoadChangelog() error {
+	if len(p.Changelog) != 0 || p.Path == "" {
+		return nil
+	}
+
+	c, err := readChangelog(p.Path)
+	if err != nil {
+		return err
+	}
+	p.Changelog = c
+	return nil
+}
+
+func readChangelog(dir string) (Changelog, error) {
+	changelogFile := filepath.Join(dir, PackageChangelogFile)
+	if !fileHelper.Exists(changelogFile) {
+		return nil, nil
+	}
+
+	dat, err := ioutil.ReadFile(changelogFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed while reading '%s'", changelogFile)
+	}
+
+	c, err := ChangelogFromYaml(dat)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed while parsing YAML '%s'", changelogFile)
+	}
+	return c, nil
+}
@@ -16,11 +16,19 @@
 package types
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
 	"path/filepath"
+	"strings"
 
 	"github.com/mitchellh/hashstructure/v2"
+	"github.com/pkg/errors"
 
 	"github.com/ghodss/yaml"
 	"github.com/otiai10/copy"
@@ -92,20 +100,105 @@ type CopyField struct {
 	Destination string   `json:"destination"`
 }
 
+// SourceField is a file which is downloaded before the build and
+// injected in the build context
+type SourceField struct {
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+	// Destination is relative to the build context. It defaults to the name of the
+	// downloaded file, or to the root of the build context when extracting
+	Destination string `json:"destination,omitempty"`
+	// Extract unpacks the downloaded tarball in the destination
+	Extract bool `json:"extract,omitempty"`
+}
+
+// Validate returns an error if the source has no url or an invalid sha256 checksum
+func (s SourceField) Validate() error {
+	if s.URL == "" {
+		return errors.New("source without url")
+	}
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return errors.Wrapf(err, "invalid source url '%s'", s.URL)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid source url '%s' (only http and https are supported)", s.URL)
+	}
+	if sum, err := hex.DecodeString(s.SHA256); err != nil || len(sum) != sha256.Size {
+		return fmt.Errorf("invalid sha256 checksum '%s' for source %s", s.SHA256, s.URL)
+	}
+	if filepath.IsAbs(s.Destination) || strings.HasPrefix(filepath.Clean(s.Destination), "..") {
+		return fmt.Errorf("invalid destination '%s' for source %s (must be inside the build context)", s.Destination, s.URL)
+	}
+	return nil
+}
+
+// FileName returns the destination of the source in the build context
+func (s SourceField) FileName() string {
+	if s.Destination != "" {
+		return filepath.Clean(s.Destination)
+	}
+	if s.Extract {
+		return "."
+	}
+	u, err := url.Parse(s.URL)
+	if err != nil || path.Base(u.Path) == "/" || path.Base(u.Path) == "." {
+		return s.SHA256
+	}
+	return path.Base(u.Path)
+}
+
 type CompressionImplementation string
 
 const (
 	None      CompressionImplementation = "none" // e.g. tar for standard packages
 	GZip      CompressionImplementation = "gzip"
 	Zstandard CompressionImplementation = "zstd"
+	XZ        CompressionImplementation = "xz"
+	LZ4       CompressionImplementation = "lz4"
 )
 
+// compressionLevels are the ranges of the levels supported by each compression algorithm
+var compressionLevels = map[CompressionImplementation][2]int{
+	GZip:      {1, 9},
+	Zstandard: {1, 22},
+	XZ:        {1, 9},
+	LZ4:       {1, 9},
+}
+
+// Validate returns an error if the compression algorithm or the level are not supported.
+// Level 0 selects the default level of the algorithm.
+func (c CompressionImplementation) Validate(level int) error {
+	if c == None || c == "" {
+		if level != 0 {
+			return fmt.Errorf("compression level %d requires a compression algorithm", level)
+		}
+		return nil
+	}
+
+	levels, ok := compressionLevels[c]
+	if !ok {
+		return fmt.Errorf("invalid compression algorithm '%s' (available: none, gzip, zstd, xz, lz4)", c)
+	}
+	if level != 0 && (level < levels[0] || level > levels[1]) {
+		return fmt.Errorf("invalid %s compression level %d (available: %d-%d)", c, level, levels[0], levels[1])
+	}
+	return nil
+}
+
 type SubPackage struct {
 	*Package
 	Includes []string `json:"includes,omitempty" yaml:"includes,omitempty"`
 	Excludes []string `json:"excludes,omitempty" yaml:"excludes,omitempty"`
 }
 
+// TestSpec is the test phase of a package, run after the build in a container holding
+// only the package and its runtime dependencies
+type TestSpec struct {
+	Env   []string `json:"env,omitempty"`
+	Steps []string `json:"steps"`
+}
+
 type LuetCompilationSpec struct {
 	Steps           []string           `json:"steps" yaml:"steps,omitempty"` // Are run inside a container and the result layer diff is saved
 	Env             []string           `json:"env"`
@@ -129,7 +222,20 @@ type LuetCompilationSpec struct {
 
 	Copy []CopyField `json:"copy"`
 
+	// Sources are downloaded, verified and injected in the build context before the build
+	Sources []SourceField `json:"sources,omitempty" yaml:"sources,omitempty"`
+
+	// Test is run against the built package before its metadata is written
+	Test *TestSpec `json:"test,omitempty" yaml:"test,omitempty"`
+
 	RequiresFinalImages bool `json:"requires_final_images" yaml:"requires_final_images"`
+
+	// Reproducible generates artifacts which don't depend on the build host and time
+	Reproducible bool `json:"reproducible" yaml:"reproducible"`
+
+	// CompressionType and CompressionLevel override the compression of the artifacts set in the build options
+	CompressionType  CompressionImplementation `json:"compression,omitempty" yaml:"compression,omitempty"`
+	CompressionLevel int                       `json:"compression_level,omitempty" yaml:"compression_level,omitempty"`
 }
 
 // Signature is a portion of the spec that yields a signature for the hash
@@ -145,9 +251,26 @@ type Signature struct {
 	Includes            []string
 	Excludes            []string
 	Copy                []CopyField
+	Sources             []SourceField
 	Requires            Packages
 	RequiresFinalImages bool
 	Dockerfile          string
+	UseFlags            []string `hash:"set"`
+	Arch                string
+}
+
+// HashInclude leaves empty sources, use flags and architecture out of the signature hash, so they don't
+// change the hashes of the packages which don't use them
+func (s Signature) HashInclude(field string, v interface{}) (bool, error) {
+	switch field {
+	case "Sources":
+		return len(s.Sources) != 0, nil
+	case "UseFlags":
+		return len(s.UseFlags) != 0, nil
+	case "Arch":
+		return s.Arch != "", nil
+	}
+	return true, nil
 }
 
 type CompilerOptions struct {
@@ -156,6 +279,11 @@ type CompilerOptions struct {
 	PullFirst, KeepImg, Push bool
 	Concurrency              int
 	CompressionType          CompressionImplementation
+	// CompressionLevel is the level of the compression algorithm, 0 for the default one
+	CompressionLevel int
+
+	// SkipTests doesn't run the test phase of the packages
+	SkipTests bool
 
 	Wait            bool
 	OnlyDeps        bool
@@ -167,10 +295,19 @@ type CompilerOptions struct {
 	PackageTargetOnly bool
 	Rebuild           bool
 
+	// KeepGoing keeps building the packages which don't depend on failed ones
+	KeepGoing bool
+
+	// Reproducible generates artifacts which don't depend on the build host and time
+	Reproducible bool
+
 	BackendArgs []string
 
 	BackendType string
 
+	// Arch is the architecture to build the packages for. Empty to build for the host architecture
+	Arch string
+
 	// TemplatesFolder. should default to tree/templates
 	TemplatesFolder []string
 
@@ -184,6 +321,13 @@ type CompilerOptions struct {
 	PushFinalImagesRepository string
 	RuntimeDatabase           PackageDatabase
 
+	// SBOM format to generate alongside artifacts, disabled if empty
+	SBOMFormat string
+
+	// SourcesCachePath is the directory where the sources of the packages are cached.
+	// Defaults to a sources folder in the packages cache
+	SourcesCachePath string
+
 	Context Context
 }
 
@@ -214,9 +358,12 @@ func (cs *LuetCompilationSpec) signature() Signature {
 		Includes:            cs.Includes,
 		Excludes:            cs.Excludes,
 		Copy:                cs.Copy,
-		Requires:            cs.Package.GetRequires(),
+		Sources:             cs.Sources,
+		Requires:            cs.Package.GetActiveRequires(),
 		Dockerfile:          cs.Package.OriginDockerfile,
 		RequiresFinalImages: cs.RequiresFinalImages,
+		UseFlags:            cs.Package.GetReferencedUses(),
+		Arch:                cs.Package.GetArch(),
 	}
 }
 
@@ -348,7 +495,7 @@ func (cs *LuetCompilationSpec) UnpackedPackage() bool {
 // a compilation spec has an image source when it depends on other packages or have a source image
 // explictly supplied
 func (cs *LuetCompilationSpec) HasImageSource() bool {
-	return (cs.Package != nil && len(cs.GetPackage().GetRequires()) != 0) || cs.GetImage() != "" || (cs.RequiresFinalImages && len(cs.Package.GetRequires()) != 0)
+	return (cs.Package != nil && len(cs.GetPackage().GetActiveRequires()) != 0) || cs.GetImage() != "" || (cs.RequiresFinalImages && len(cs.Package.GetActiveRequires()) != 0)
 }
 
 func (cs *LuetCompilationSpec) Hash() (string, error) {
@@ -358,13 +505,32 @@ func (cs *LuetCompilationSpec) Hash() (string, error) {
 	if err != nil {
 		return "", err
 	}
-	sum, err := dirhash.HashDir(cs.Package.Path, "", dirhash.DefaultHash)
+	sum, err := hashPackageDir(cs.Package.Path)
 	if err != nil {
 		return fmt.Sprint(h), err
 	}
 	return fmt.Sprint(h, sum), err
 }
 
+// hashPackageDir hashes the content of the package folder, except the changelog
+// which doesn't affect the build
+func hashPackageDir(dir string) (string, error) {
+	files, err := dirhash.DirFiles(dir, "")
+	if err != nil {
+		return "", err
+	}
+
+	build := []string{}
+	for _, f := range files {
+		if f != PackageChangelogFile {
+			build = append(build, f)
+		}
+	}
+	return dirhash.DefaultHash(build, func(name string) (io.ReadCloser, error) {
+		return os.Open(filepath.Join(dir, name))
+	})
+}
+
 func (cs *LuetCompilationSpec) CopyRetrieves(dest string) error {
 	var err error
 	if len(cs.Retrieve) > 0 {
@@ -424,6 +590,38 @@ RUN ` + s
 	return spec
 }
 
+// HasTests returns true if the package has a test phase
+func (cs *LuetCompilationSpec) HasTests() bool {
+	return cs.Test != nil && len(cs.Test.Steps) != 0
+}
+
+// RenderTestImage renders the dockerfile running the tests of the package. The rootfs
+// folder of the build context holds the package and its runtime dependencies
+func (cs *LuetCompilationSpec) RenderTestImage() string {
+	spec := `
+FROM scratch
+COPY rootfs /
+WORKDIR /
+ENV PACKAGE_NAME=` + cs.Package.GetName() + `
+ENV PACKAGE_VERSION=` + cs.Package.GetVersion() + `
+ENV PACKAGE_CATEGORY=` + cs.Package.GetCategory()
+
+	if cs.Test == nil {
+		return spec
+	}
+
+	for _, s := range cs.Test.Env {
+		spec = spec + `
+ENV ` + s
+	}
+
+	for _, s := range cs.Test.Steps {
+		spec = spec + `
+RUN ` + s
+	}
+	return spec
+}
+
 // RenderBuildImage renders the dockerfile of the image used as a pre-build step
 func (cs *LuetCompilationSpec) RenderBuildImage() (string, error) {
 	return cs.genDockerfile(cs.GetSeedImage(), cs.GetPreBuildSteps()), nil
@@ -22,6 +22,8 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"strings"
 
 	"github.com/mudler/luet/pkg/api/core/config"
 	fileHelper "github.com/mudler/luet/pkg/helpers/file"
@@ -72,12 +74,40 @@ type LuetSolverOptions struct {
 	Discount       float32    `yaml:"discount,omitempty" mapstructure:"discount"`
 	MaxAttempts    int        `yaml:"max_attempts,omitempty" mapstructure:"max_attempts"`
 	Implementation SolverType `yaml:"implementation,omitempty" mapstructure:"implementation"`
+	Concurrent     bool       `yaml:"concurrent,omitempty" json:"concurrent,omitempty" mapstructure:"concurrent"`
+	RaceStrategies bool       `yaml:"race,omitempty" json:"race,omitempty" mapstructure:"race"`
+	CacheDir       string     `yaml:"cache_dir,omitempty" json:"cache_dir,omitempty" mapstructure:"cache_dir"`
+}
+
+// LuetLicensePolicy is the set of licenses which are accepted
+// or refused for the packages handled by luet.
+// Allow and Deny are lists of SPDX identifiers or expressions, and
+// can contain shell globs (e.g. "GPL-3.0*").
+type LuetLicensePolicy struct {
+	Allow        []string `yaml:"allow,omitempty" mapstructure:"allow"`
+	Deny         []string `yaml:"deny,omitempty" mapstructure:"deny"`
+	Mode         string   `yaml:"mode,omitempty" mapstructure:"mode"`
+	AllowUnknown bool     `yaml:"allow_unknown,omitempty" mapstructure:"allow_unknown"`
+}
+
+// Enabled returns true if the policy has any rule to enforce
+func (p LuetLicensePolicy) Enabled() bool {
+	return len(p.Allow) != 0 || len(p.Deny) != 0
+}
+
+// LuetAuditConfig configures the advisory feeds the packages
+// are checked against.
+// Feeds are files or directories with advisories, packages affected by
+// advisories at or above BlockSeverity are refused on install and upgrade.
+type LuetAuditConfig struct {
+	Feeds         []string `yaml:"feeds,omitempty" mapstructure:"feeds"`
+	BlockSeverity string   `yaml:"block_severity,omitempty" mapstructure:"block_severity"`
 }
 
 // CompactString returns a compact string to display solver options over CLI
 func (opts *LuetSolverOptions) CompactString() string {
-	return fmt.Sprintf("type: %s rate: %f, discount: %f, attempts: %d, initialobserved: %d",
-		opts.Type, opts.LearnRate, opts.Discount, opts.MaxAttempts, 999999)
+	return fmt.Sprintf("type: %s rate: %f, discount: %f, attempts: %d, initialobserved: %d, concurrent: %t, race: %t",
+		opts.Type, opts.LearnRate, opts.Discount, opts.MaxAttempts, 999999, opts.Concurrent, opts.RaceStrategies)
 }
 
 // LuetSystemConfig is the system configuration.
@@ -89,6 +119,16 @@ type LuetSystemConfig struct {
 	Rootfs         string `yaml:"rootfs" mapstructure:"rootfs"`
 	PkgsCachePath  string `yaml:"pkgs_cache_path" mapstructure:"pkgs_cache_path"`
 	TmpDirBase     string `yaml:"tmpdir_base" mapstructure:"tmpdir_base"`
+	Arch           string `yaml:"arch,omitempty" mapstructure:"arch"`
+}
+
+// GetArch returns the architecture of the packages to install in the system.
+// It defaults to the host architecture.
+func (s LuetSystemConfig) GetArch() string {
+	if s.Arch == "" {
+		return runtime.GOARCH
+	}
+	return s.Arch
 }
 
 // Init reads the config and replace user-defined paths with
@@ -196,6 +236,47 @@ func (f Finalizers) Slice() (sl []string) {
 	return
 }
 
+// LuetUseFlags is the system configuration of the packages use flags.
+// Flags prefixed by '-' are disabled. Package specific flags are keyed by
+// "category/name" and are applied after the global ones.
+type LuetUseFlags struct {
+	Global   []string            `yaml:"global,omitempty" mapstructure:"global"`
+	Packages map[string][]string `yaml:"packages,omitempty" mapstructure:"packages"`
+}
+
+// Apply enables and disables the configured use flags in the package
+func (u LuetUseFlags) Apply(p *Package) {
+	flags := append([]string{}, u.Global...)
+	for k, f := range u.Packages {
+		if strings.EqualFold(k, fmt.Sprintf("%s/%s", p.GetCategory(), p.GetName())) {
+			flags = append(flags, f...)
+		}
+	}
+
+	for _, f := range flags {
+		if strings.HasPrefix(f, "-") {
+			p.RemoveUse(strings.TrimPrefix(f, "-"))
+		} else {
+			p.AddUse(f)
+		}
+	}
+}
+
+// ApplyDatabase applies the configured use flags to all the packages of the database
+func (u LuetUseFlags) ApplyDatabase(db PackageDatabase) error {
+	if len(u.Global) == 0 && len(u.Packages) == 0 {
+		return nil
+	}
+
+	for _, p := range db.World() {
+		u.Apply(p)
+		if err := db.UpdatePackage(p); err != nil {
+			return errors.Wrapf(err, "while applying use flags to %s", p.HumanReadableString())
+		}
+	}
+	return nil
+}
+
 // LuetConfig is the general structure which holds
 // all the configuration fields.
 // It includes, Logging, General, System and Solver sub configurations.
@@ -205,6 +286,10 @@ type LuetConfig struct {
 	System  LuetSystemConfig  `yaml:"system" mapstructure:"system"`
 	Solver  LuetSolverOptions `yaml:"solver,omitempty" mapstructure:"solver"`
 
+	LicensePolicy LuetLicensePolicy `yaml:"license_policy,omitempty" mapstructure:"license_policy"`
+	Audit         LuetAuditConfig   `yaml:"audit,omitempty" mapstructure:"audit"`
+	UseFlags      LuetUseFlags      `yaml:"use_flags,omitempty" mapstructure:"use_flags"`
+
 	RepositoriesConfDir  []string         `yaml:"repos_confdir,omitempty" mapstructure:"repos_confdir"`
 	ConfigProtectConfDir []string         `yaml:"config_protect_confdir,omitempty" mapstructure:"config_protect_confdir"`
 	ConfigProtectSkip    bool             `yaml:"config_protect_skip,omitempty" mapstructure:"config_protect_skip"`
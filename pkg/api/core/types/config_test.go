@@ -17,9 +17,11 @@
 package types_test
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 
 	"github.com/mudler/luet/pkg/api/core/context"
@@ -115,4 +117,63 @@ var _ = Describe("Config", func() {
 
 	})
 
+	Context("Solver implementation", func() {
+		It("is selected by name", func() {
+			var t types.SolverType
+			Expect(t.UnmarshalText([]byte("optimizing"))).To(Succeed())
+			Expect(t).To(Equal(types.SolverOptimizing))
+			Expect(t.UnmarshalText([]byte("Concurrent"))).To(Succeed())
+			Expect(t).To(Equal(types.SolverConcurrent))
+			Expect(t.String()).To(Equal("concurrent"))
+		})
+
+		It("is selected by number", func() {
+			var t types.SolverType
+			Expect(t.UnmarshalText([]byte("2"))).To(Succeed())
+			Expect(t).To(Equal(types.SolverOptimizing))
+		})
+
+		It("fails on unknown implementations", func() {
+			var t types.SolverType
+			Expect(t.UnmarshalText([]byte("foo"))).ToNot(Succeed())
+		})
+
+		It("is read from the metadata of the packages", func() {
+			opts := types.LuetSolverOptions{Implementation: types.SolverOptimizing}
+			data, err := json.Marshal(opts)
+			Expect(err).ToNot(HaveOccurred())
+
+			var read types.LuetSolverOptions
+			Expect(json.Unmarshal(data, &read)).To(Succeed())
+			Expect(read.Implementation).To(Equal(types.SolverOptimizing))
+
+			Expect(json.Unmarshal([]byte(`{"Implementation":"concurrent"}`), &read)).To(Succeed())
+			Expect(read.Implementation).To(Equal(types.SolverConcurrent))
+			Expect(json.Unmarshal([]byte(`{"Implementation":"foo"}`), &read)).ToNot(Succeed())
+		})
+	})
+
+	Context("System architecture", func() {
+		It("Defaults to the host one", func() {
+			Expect(types.LuetSystemConfig{}.GetArch()).To(Equal(runtime.GOARCH))
+			Expect(types.LuetSystemConfig{Arch: "riscv64"}.GetArch()).To(Equal("riscv64"))
+		})
+	})
+
+	Context("Use flags", func() {
+		It("Applies global and package flags", func() {
+			u := types.LuetUseFlags{
+				Global:   []string{"ssl", "-gtk"},
+				Packages: map[string][]string{"app/foo": {"gtk", "-ssl"}},
+			}
+
+			foo := &types.Package{Name: "foo", Category: "app", UseFlags: []string{"gtk"}}
+			bar := &types.Package{Name: "bar", Category: "app", UseFlags: []string{"gtk", "qt"}}
+			u.Apply(foo)
+			u.Apply(bar)
+			Expect(foo.GetUses()).To(Equal([]string{"gtk"}))
+			Expect(bar.GetUses()).To(Equal([]string{"qt", "ssl"}))
+		})
+	})
+
 })
@@ -218,7 +218,17 @@ func (t *Package) JSON() ([]byte, error) {
 
 // GetMetadataFilePath returns the canonical name of an artifact metadata file
 func (d *Package) GetMetadataFilePath() string {
-	return fmt.Sprintf("%s.%s", d.GetFingerPrint(), PackageMetaSuffix)
+	return fmt.Sprintf("%s.%s", d.GetArtifactName(), PackageMetaSuffix)
+}
+
+// GetArtifactName returns the canonical name of the package artifacts, without extension.
+// The architecture is part of it, so artifacts built for different architectures
+// can be stored together.
+func (d *Package) GetArtifactName() string {
+	if d.Arch != "" {
+		return fmt.Sprintf("%s-%s", d.GetFingerPrint(), d.Arch)
+	}
+	return d.GetFingerPrint()
 }
 
 // Package represent a standard package definition
@@ -228,12 +238,23 @@ type Package struct {
 	Version          string     `json:"version"`                 // Affects YAML field names too.
 	Category         string     `json:"category"`                // Affects YAML field names too.
 	UseFlags         []string   `json:"use_flags,omitempty"`     // Affects YAML field names too.
+	Arch             string     `json:"arch,omitempty"`          // Affects YAML field names too.
 	State            State      `json:"state,omitempty"`
 	PackageRequires  []*Package `json:"requires"`           // Affects YAML field names too.
 	PackageConflicts []*Package `json:"conflicts"`          // Affects YAML field names too.
 	Provides         []*Package `json:"provides,omitempty"` // Affects YAML field names too.
 	Hidden           bool       `json:"hidden,omitempty"`   // Affects YAML field names too.
 
+	// Alternatives of a requires or conflicts entry: any of them satisfies the requirement
+	Alternatives []*Package `json:"alternatives,omitempty"` // Affects YAML field names too.
+	// UseConditions of a requires or conflicts entry: the entry is considered only if the
+	// use flags of the package are matching. Flags prefixed by '!' have to be disabled
+	UseConditions []string `json:"if_use,omitempty"` // Affects YAML field names too.
+
+	// Recommends and Suggests are weak runtime dependencies, they are not part of the build
+	Recommends []*Package `json:"recommends,omitempty" hash:"ignore"` // Affects YAML field names too.
+	Suggests   []*Package `json:"suggests,omitempty" hash:"ignore"`   // Affects YAML field names too.
+
 	// Annotations are used for core features/options
 	Annotations map[PackageAnnotation]string `json:"annotations,omitempty"` // Affects YAML field names too
 
@@ -250,6 +271,8 @@ type Package struct {
 	TreeDir string `json:"treedir,omitempty"`
 
 	OriginDockerfile string `json:"dockerfile,omitempty"`
+
+	Changelog Changelog `json:"changelog,omitempty" hash:"ignore"`
 }
 
 // State represent the package state
@@ -366,6 +389,17 @@ func (p *Package) SetPath(s string) {
 	p.Path = s
 }
 
+// GetArch returns the architecture of the package.
+// Architecture independent packages have an empty one.
+func (p *Package) GetArch() string {
+	return p.Arch
+}
+
+// SupportsArch returns true if the package can be installed on the given architecture
+func (p *Package) SupportsArch(arch string) bool {
+	return p.Arch == "" || arch == "" || p.Arch == arch
+}
+
 func (p *Package) IsSelector() bool {
 	return strings.ContainsAny(p.GetVersion(), "<>=")
 }
@@ -430,6 +464,72 @@ func (p *Package) RemoveUse(use string) {
 
 }
 
+// HasUse returns true if the use flag is enabled in the package
+func (p *Package) HasUse(use string) bool {
+	for _, v := range p.UseFlags {
+		if v == use {
+			return true
+		}
+	}
+	return false
+}
+
+// UseConditionsMatch returns true if the use conditions of the requires or
+// conflicts entry are satisfied by the use flags of the given package
+func (p *Package) UseConditionsMatch(pack *Package) bool {
+	for _, c := range p.UseConditions {
+		if strings.HasPrefix(c, "!") {
+			if pack.HasUse(strings.TrimPrefix(c, "!")) {
+				return false
+			}
+		} else if !pack.HasUse(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// GetActiveRequires returns the requires of the package whose use conditions are
+// satisfied by the package use flags
+func (p *Package) GetActiveRequires() []*Package {
+	return p.activeDependencies(p.PackageRequires)
+}
+
+// GetActiveConflicts returns the conflicts of the package whose use conditions are
+// satisfied by the package use flags
+func (p *Package) GetActiveConflicts() []*Package {
+	return p.activeDependencies(p.PackageConflicts)
+}
+
+// GetReferencedUses returns the enabled use flags of the package which are referenced
+// by the use conditions of its requires and conflicts
+func (p *Package) GetReferencedUses() []string {
+	referenced := map[string]interface{}{}
+	for _, d := range append(append([]*Package{}, p.PackageRequires...), p.PackageConflicts...) {
+		for _, c := range d.UseConditions {
+			referenced[strings.TrimPrefix(c, "!")] = nil
+		}
+	}
+
+	res := []string{}
+	for _, u := range p.UseFlags {
+		if _, ok := referenced[u]; ok {
+			res = append(res, u)
+		}
+	}
+	return res
+}
+
+func (p *Package) activeDependencies(deps []*Package) []*Package {
+	res := []*Package{}
+	for _, d := range deps {
+		if d.UseConditionsMatch(p) {
+			res = append(res, d)
+		}
+	}
+	return res
+}
+
 // Encode encodes the package to string.
 // It returns an ID which can be used to retrieve the package later on.
 func (p *Package) Encode(db PackageDatabase) (string, error) {
@@ -520,6 +620,58 @@ func (p *Package) GetRequires() []*Package {
 func (p *Package) GetConflicts() []*Package {
 	return p.PackageConflicts
 }
+
+// GetAlternatives returns the alternatives declared in a requires or conflicts entry
+func (p *Package) GetAlternatives() []*Package {
+	return p.Alternatives
+}
+
+// GetRecommends returns the packages which are installed along the package
+// when possible
+func (p *Package) GetRecommends() []*Package {
+	return p.Recommends
+}
+
+// GetSuggests returns the packages which are suggested to be used with the package
+func (p *Package) GetSuggests() []*Package {
+	return p.Suggests
+}
+
+// AnyOf returns the packages which satisfy a requires or conflicts entry:
+// the entry itself, followed by its alternatives
+func (p *Package) AnyOf() []*Package {
+	if len(p.Alternatives) == 0 {
+		return []*Package{p}
+	}
+	first := *p
+	first.Alternatives = nil
+	return append([]*Package{&first}, p.Alternatives...)
+}
+
+// DependencyString returns a human readable string of a requires or conflicts entry,
+// with its alternatives separated by '|'
+func (p *Package) DependencyString() string {
+	res := []string{}
+	for _, a := range p.AnyOf() {
+		res = append(res, a.HumanReadableString())
+	}
+	return strings.Join(res, " | ")
+}
+
+// HashInclude leaves empty alternatives, use conditions and architecture out of the package hash, so they don't
+// change the build hashes of the packages which don't declare them
+func (p *Package) HashInclude(field string, v interface{}) (bool, error) {
+	switch field {
+	case "Alternatives":
+		return len(p.Alternatives) != 0, nil
+	case "UseConditions":
+		return len(p.UseConditions) != 0, nil
+	case "Arch":
+		return p.Arch != "", nil
+	}
+	return true, nil
+}
+
 func (p *Package) Requires(req []*Package) *Package {
 	p.PackageRequires = req
 	return p
@@ -561,6 +713,11 @@ func (p *Package) Expand(definitiondb PackageDatabase) (Packages, error) {
 		return nil, err
 	}
 	for _, w := range all {
+		// Provides: the packages providing p are expanded regardless of their version
+		if w.IsProviderOf(p) {
+			versionsInWorld = append(versionsInWorld, w)
+			continue
+		}
 		match, err := p.SelectorMatchVersion(w.GetVersion(), nil)
 		if err != nil {
 			return nil, err
@@ -579,10 +736,14 @@ func (p *Package) Revdeps(definitiondb PackageDatabase) Packages {
 		if w.Matches(p) {
 			continue
 		}
-		for _, re := range w.GetRequires() {
-			if re.Matches(p) {
-				versionsInWorld = append(versionsInWorld, w)
-				versionsInWorld = append(versionsInWorld, w.Revdeps(definitiondb)...)
+	REQUIRES:
+		for _, req := range w.GetActiveRequires() {
+			for _, re := range req.AnyOf() {
+				if re.Matches(p) {
+					versionsInWorld = append(versionsInWorld, w)
+					versionsInWorld = append(versionsInWorld, w.Revdeps(definitiondb)...)
+					break REQUIRES
+				}
 			}
 		}
 	}
@@ -606,22 +767,25 @@ func walkPackage(p *Package, definitiondb PackageDatabase, visited map[string]in
 		versionsInWorld = append(versionsInWorld, p)
 	}
 
-	for _, re := range p.GetRequires() {
-		versions, _ := re.Expand(definitiondb)
-		for _, r := range versions {
+	for _, req := range p.GetActiveRequires() {
+		for _, re := range req.AnyOf() {
+			versions, _ := re.Expand(definitiondb)
+			for _, r := range versions {
 
-			versionsInWorld = append(versionsInWorld, r)
-			versionsInWorld = append(versionsInWorld, walkPackage(r, definitiondb, visited)...)
+				versionsInWorld = append(versionsInWorld, r)
+				versionsInWorld = append(versionsInWorld, walkPackage(r, definitiondb, visited)...)
+			}
 		}
-
 	}
-	for _, re := range p.GetConflicts() {
-		versions, _ := re.Expand(definitiondb)
-		for _, r := range versions {
+	for _, con := range p.GetActiveConflicts() {
+		for _, re := range con.AnyOf() {
+			versions, _ := re.Expand(definitiondb)
+			for _, r := range versions {
 
-			versionsInWorld = append(versionsInWorld, r)
-			versionsInWorld = append(versionsInWorld, walkPackage(r, definitiondb, visited)...)
+				versionsInWorld = append(versionsInWorld, r)
+				versionsInWorld = append(versionsInWorld, walkPackage(r, definitiondb, visited)...)
 
+			}
 		}
 	}
 	return versionsInWorld.Unique()
@@ -659,20 +823,22 @@ func (pack *Package) scanRequires(definitiondb PackageDatabase, s *Package, visi
 		//return false, errors.Wrap(err, "Package not found in definition db")
 	}
 
-	for _, re := range p.GetRequires() {
-		if re.Matches(s) {
-			return true, nil
-		}
+	for _, req := range p.GetActiveRequires() {
+		for _, re := range req.AnyOf() {
+			if re.Matches(s) {
+				return true, nil
+			}
 
-		packages, _ := re.Expand(definitiondb)
-		for _, pa := range packages {
-			if pa.Matches(s) {
+			packages, _ := re.Expand(definitiondb)
+			for _, pa := range packages {
+				if pa.Matches(s) {
+					return true, nil
+				}
+			}
+			if contains, err := re.scanRequires(definitiondb, s, visited); err == nil && contains {
 				return true, nil
 			}
 		}
-		if contains, err := re.scanRequires(definitiondb, s, visited); err == nil && contains {
-			return true, nil
-		}
 	}
 
 	return false, nil
@@ -761,6 +927,13 @@ func (p *Package) GetRuntimePackage() (*Package, error) {
 			return r, errors.Wrapf(err, "failed while parsing YAML '%s'", definitionFile)
 		}
 		r = &d
+		if len(r.Changelog) == 0 {
+			c, err := readChangelog(p.Path)
+			if err != nil {
+				return r, err
+			}
+			r.Changelog = c
+		}
 	}
 	return r, nil
 }
@@ -798,9 +971,20 @@ func (pack *Package) buildFormula(definitiondb PackageDatabase, db PackageDataba
 		}
 	}
 
-	for _, requiredDef := range p.GetRequires() {
+	for _, requiredDef := range p.GetActiveRequires() {
+		if len(requiredDef.GetAlternatives()) != 0 {
+			f, err := alternativesFormula(A, requiredDef.AnyOf(), definitiondb, db, visited)
+			if err != nil {
+				return nil, err
+			}
+			formulas = append(formulas, f...)
+			continue
+		}
+
 		required, err := definitiondb.FindPackage(requiredDef)
-		if err != nil || requiredDef.IsSelector() {
+		// Provides: a virtual package can be satisfied by any of its providers
+		virtual := err == nil && !requiredDef.IsSelector() && !required.Matches(requiredDef)
+		if err != nil || requiredDef.IsSelector() || virtual {
 			if err == nil {
 				required = requiredDef
 			}
@@ -808,6 +992,15 @@ func (pack *Package) buildFormula(definitiondb PackageDatabase, db PackageDataba
 			if err != nil || len(packages) == 0 {
 				required = requiredDef
 			} else {
+				if virtual {
+					for _, o := range packages {
+						f, err := o.buildFormula(definitiondb, db, visited)
+						if err != nil {
+							return nil, err
+						}
+						formulas = append(formulas, f...)
+					}
+				}
 
 				var ALO []bf.Formula
 				// AMO/ALO - At most/least one
@@ -849,10 +1042,18 @@ func (pack *Package) buildFormula(definitiondb PackageDatabase, db PackageDataba
 
 	}
 
-	for _, requiredDef := range p.GetConflicts() {
+	// A conflict with a group of alternatives is a conflict with each of them
+	conflicts := []*Package{}
+	for _, c := range p.GetActiveConflicts() {
+		conflicts = append(conflicts, c.AnyOf()...)
+	}
+
+	for _, requiredDef := range conflicts {
 		required, err := definitiondb.FindPackage(requiredDef)
-		if err != nil || requiredDef.IsSelector() {
-			if err == nil {
+		// Provides: a conflict with a virtual package is a conflict with all its providers
+		virtual := err == nil && !requiredDef.IsSelector() && !required.Matches(requiredDef)
+		if err != nil || requiredDef.IsSelector() || virtual {
+			if err == nil && !virtual {
 				requiredDef = required
 			}
 			packages, err := definitiondb.FindPackages(requiredDef)
@@ -900,6 +1101,40 @@ func (pack *Package) buildFormula(definitiondb PackageDatabase, db PackageDataba
 	return formulas, nil
 }
 
+// alternativesFormula returns the formulas of a requirement of A which is satisfied by
+// any of the alternatives: at least one of the packages matching them must be selected.
+// Alternatives which are not available are skipped, if none is, the first one is required.
+func alternativesFormula(A bf.Formula, alternatives []*Package, definitiondb PackageDatabase, db PackageDatabase, visited map[string]interface{}) ([]bf.Formula, error) {
+	var formulas, ALO []bf.Formula
+
+	candidates := Packages{}
+	for _, alternative := range alternatives {
+		packages, err := definitiondb.FindPackages(alternative)
+		if err == nil {
+			candidates = append(candidates, packages...)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = append(candidates, alternatives[0]) // Relax failures and trust the def
+	}
+
+	for _, c := range candidates {
+		encoded, err := c.Encode(db)
+		if err != nil {
+			return nil, err
+		}
+		ALO = append(ALO, bf.Var(encoded))
+
+		f, err := c.buildFormula(definitiondb, db, visited)
+		if err != nil {
+			return nil, err
+		}
+		formulas = append(formulas, f...)
+	}
+
+	return append(formulas, bf.Or(bf.Not(A), bf.Or(ALO...))), nil // ALO - At least one
+}
+
 func (pack *Package) BuildFormula(definitiondb PackageDatabase, db PackageDatabase) ([]bf.Formula, error) {
 	return pack.buildFormula(definitiondb, db, make(map[string]interface{}))
 }
@@ -1027,3 +1262,36 @@ func (p *Package) VersionMatchSelector(selector string, v version.Versioner) (bo
 
 	return v.ValidateSelector(p.GetVersion(), selector), nil
 }
+
+// MatchProvide returns true if the package is satisfied by the given provide.
+// A package version is matched against a versioned provide or a provide selector,
+// while a package selector is matched against the version of the provide.
+func (p *Package) MatchProvide(provide *Package) bool {
+	if p.GetPackageName() != provide.GetPackageName() {
+		return false
+	}
+	if p.GetVersion() == provide.GetVersion() {
+		return true
+	}
+
+	if p.IsSelector() {
+		if provide.IsSelector() {
+			return false
+		}
+		match, _ := p.SelectorMatchVersion(provide.GetVersion(), nil)
+		return match
+	}
+
+	match, _ := p.VersionMatchSelector(provide.GetVersion(), nil)
+	return match
+}
+
+// IsProviderOf returns true if any of the package provides satisfies the given package
+func (p *Package) IsProviderOf(virtual *Package) bool {
+	for _, provide := range p.GetProvides() {
+		if virtual.MatchProvide(provide) {
+			return true
+		}
+	}
+	return false
+}
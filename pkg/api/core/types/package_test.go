@@ -18,6 +18,8 @@ package types_test
 import (
 	"regexp"
 
+	"github.com/mitchellh/hashstructure/v2"
+
 	"github.com/mudler/luet/pkg/api/core/types"
 
 	. "github.com/mudler/luet/pkg/database"
@@ -414,6 +416,209 @@ var _ = Describe("Package", func() {
 			a1.RemoveUse("test")
 			Expect(len(a1.GetUses())).To(Equal(0))
 		})
+		It("Filters requires and conflicts by use conditions", func() {
+			ssl := &types.Package{Name: "openssl", Category: "libs", Version: ">=0", UseConditions: []string{"ssl"}}
+			nossl := &types.Package{Name: "libressl", Category: "libs", Version: ">=0", UseConditions: []string{"!ssl"}}
+			gtk := &types.Package{Name: "gtk", Category: "libs", Version: ">=0", UseConditions: []string{"gtk", "!ssl"}}
+			always := &types.Package{Name: "zlib", Category: "libs", Version: ">=0"}
+
+			p := types.NewPackage("A", "1.0", []*types.Package{ssl, always}, []*types.Package{nossl, gtk})
+			Expect(p.GetActiveRequires()).To(Equal([]*types.Package{always}))
+			Expect(p.GetActiveConflicts()).To(Equal([]*types.Package{nossl}))
+
+			p.AddUse("ssl")
+			p.AddUse("gtk")
+			Expect(p.GetActiveRequires()).To(Equal([]*types.Package{ssl, always}))
+			Expect(p.GetActiveConflicts()).To(BeEmpty())
+			Expect(p.GetRequires()).To(HaveLen(2))
+		})
+		It("Returns the use flags referenced by the use conditions", func() {
+			ssl := &types.Package{Name: "openssl", Category: "libs", Version: ">=0", UseConditions: []string{"ssl"}}
+			gtk := &types.Package{Name: "gtk", Category: "libs", Version: ">=0", UseConditions: []string{"gtk", "!qt"}}
+
+			p := types.NewPackage("A", "1.0", []*types.Package{ssl}, []*types.Package{gtk})
+			Expect(p.GetReferencedUses()).To(BeEmpty())
+
+			p.AddUse("X")
+			p.AddUse("qt")
+			p.AddUse("ssl")
+			Expect(p.GetReferencedUses()).To(Equal([]string{"qt", "ssl"}))
+		})
+		It("Ignores the inactive requires in the reverse dependencies", func() {
+			ssl := types.NewPackage("openssl", "1.0", []*types.Package{}, []*types.Package{})
+			revdeps := func(flags ...string) types.Packages {
+				db := NewInMemoryDatabase(false)
+				curl := types.NewPackage("curl", "1.0", []*types.Package{{Name: "openssl", Version: "1.0", UseConditions: []string{"ssl"}}}, []*types.Package{})
+				curl.UseFlags = flags
+				for _, p := range []*types.Package{ssl, curl} {
+					_, err := db.CreatePackage(p)
+					Expect(err).ToNot(HaveOccurred())
+				}
+				return ssl.Revdeps(db)
+			}
+
+			Expect(revdeps()).To(BeEmpty())
+			Expect(revdeps("ssl")).To(HaveLen(1))
+		})
+	})
+
+	Context("Changelog", func() {
+		a := types.NewPackage("A", "1.2", []*types.Package{}, []*types.Package{})
+		a.SetChangelog(types.Changelog{
+			{Version: "1.0", Changes: []string{"Initial release"}},
+			{Version: "1.2", Changes: []string{"Fix foo"}},
+			{Version: "1.1", Changes: []string{"Add bar"}},
+		})
+		It("Returns entries between versions", func() {
+			entries := a.GetChangelog().Between("1.0", "1.2")
+			Expect(len(entries)).To(Equal(2))
+			Expect(entries[0].Version).To(Equal("1.2"))
+			Expect(entries[1].Version).To(Equal("1.1"))
+		})
+		It("Returns all entries with an open range", func() {
+			entries := a.GetChangelog().Between("", "")
+			Expect(len(entries)).To(Equal(3))
+			Expect(entries[2].Version).To(Equal("1.0"))
+			Expect(len(a.GetChangelog().Between("", "1.1"))).To(Equal(2))
+		})
+		It("Decodes both lists and documents", func() {
+			c, err := types.ChangelogFromYaml([]byte("- version: \"1.0\"\n  changes: [\"foo\"]\n"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c).To(Equal(types.Changelog{{Version: "1.0", Changes: []string{"foo"}}}))
+			c, err = types.ChangelogFromYaml([]byte("changelog:\n- version: \"1.0\"\n"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c).To(Equal(types.Changelog{{Version: "1.0"}}))
+		})
+	})
+
+	Context("Weak dependencies", func() {
+		It("Decodes recommends and suggests", func() {
+			p, err := types.PackageFromYaml([]byte(`
+name: "cron"
+category: "app"
+version: "1.0"
+recommends:
+- name: "logrotate"
+  category: "app"
+  version: ">=0"
+suggests:
+- name: "mailx"
+  category: "app"
+  version: ">=0"
+`))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.GetRequires()).To(BeEmpty())
+			Expect(len(p.GetRecommends())).To(Equal(1))
+			Expect(p.GetRecommends()[0].HumanReadableString()).To(Equal("app/logrotate->=0"))
+			Expect(len(p.GetSuggests())).To(Equal(1))
+			Expect(p.GetSuggests()[0].HumanReadableString()).To(Equal("app/mailx->=0"))
+		})
+	})
+
+	Context("Alternatives", func() {
+		It("Decodes alternative groups", func() {
+			p, err := types.PackageFromYaml([]byte(`
+name: "cron"
+category: "app"
+version: "1.0"
+requires:
+- name: "postfix"
+  category: "mta"
+  version: ">=0"
+  alternatives:
+  - name: "exim"
+    category: "mta"
+    version: ">=0"
+`))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(p.GetRequires())).To(Equal(1))
+			group := p.GetRequires()[0]
+			Expect(group.DependencyString()).To(Equal("mta/postfix->=0 | mta/exim->=0"))
+
+			anyOf := group.AnyOf()
+			Expect(len(anyOf)).To(Equal(2))
+			Expect(anyOf[0].GetName()).To(Equal("postfix"))
+			Expect(anyOf[0].GetAlternatives()).To(BeEmpty())
+			Expect(anyOf[1].GetName()).To(Equal("exim"))
+		})
+
+		It("Hashes alternatives only when present", func() {
+			a := types.NewPackage("A", "1.0", []*types.Package{}, []*types.Package{})
+			b := a.Clone()
+			b.Alternatives = []*types.Package{}
+			hashA, err := hashstructure.Hash(a, hashstructure.FormatV2, nil)
+			Expect(err).ToNot(HaveOccurred())
+			hashB, err := hashstructure.Hash(b, hashstructure.FormatV2, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hashA).To(Equal(hashB))
+
+			b.Alternatives = []*types.Package{types.NewPackage("B", "1.0", []*types.Package{}, []*types.Package{})}
+			hashB, err = hashstructure.Hash(b, hashstructure.FormatV2, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hashA).ToNot(Equal(hashB))
+		})
+	})
+
+	Context("Architecture", func() {
+		It("Restricts the package to its architecture", func() {
+			p, err := types.PackageFromYaml([]byte(`
+name: "grub"
+category: "boot"
+version: "2.0"
+arch: "amd64"
+`))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.GetArch()).To(Equal("amd64"))
+			Expect(p.SupportsArch("amd64")).To(BeTrue())
+			Expect(p.SupportsArch("arm64")).To(BeFalse())
+			Expect(p.GetArtifactName()).To(Equal("grub-boot-2.0-amd64"))
+			Expect(p.GetMetadataFilePath()).To(Equal("grub-boot-2.0-amd64.metadata.yaml"))
+
+			noarch := types.NewPackage("A", "1.0", []*types.Package{}, []*types.Package{})
+			Expect(noarch.SupportsArch("arm64")).To(BeTrue())
+			Expect(noarch.GetArtifactName()).To(Equal(noarch.GetFingerPrint()))
+		})
+
+		It("Hashes the architecture", func() {
+			a := types.NewPackage("A", "1.0", []*types.Package{}, []*types.Package{})
+			hashA, err := hashstructure.Hash(a, hashstructure.FormatV2, nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			b := a.Clone()
+			b.Arch = "arm64"
+			hashB, err := hashstructure.Hash(b, hashstructure.FormatV2, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hashA).ToNot(Equal(hashB))
+		})
+	})
+
+	Context("Provides", func() {
+		It("Matches versioned provides", func() {
+			p, err := types.PackageFromYaml([]byte(`
+name: "openssl"
+category: "dev-libs"
+version: "3.0.2"
+provides:
+- name: "libssl"
+  version: "3.0"
+`))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.IsProviderOf(&types.Package{Name: "libssl", Version: ">=3"})).To(BeTrue())
+			Expect(p.IsProviderOf(&types.Package{Name: "libssl", Version: "3.0"})).To(BeTrue())
+			Expect(p.IsProviderOf(&types.Package{Name: "libssl"})).To(BeTrue())
+			Expect(p.IsProviderOf(&types.Package{Name: "libssl", Version: "<3"})).To(BeFalse())
+			Expect(p.IsProviderOf(&types.Package{Name: "libssl", Version: "3.1"})).To(BeFalse())
+			Expect(p.IsProviderOf(&types.Package{Name: "libcrypto", Version: ">=3"})).To(BeFalse())
+		})
+
+		It("Matches provide selectors", func() {
+			p := types.NewPackage("A", "1.3", []*types.Package{}, []*types.Package{})
+			p.SetProvides([]*types.Package{{Name: "B", Version: ">=1.0"}})
+
+			Expect(p.IsProviderOf(&types.Package{Name: "B", Version: "1.2"})).To(BeTrue())
+			Expect(p.IsProviderOf(&types.Package{Name: "B", Version: ">=1.0"})).To(BeTrue())
+			Expect(p.IsProviderOf(&types.Package{Name: "B", Version: "0.9"})).To(BeFalse())
+		})
 	})
 
 	Context("Check Bump build Version", func() {
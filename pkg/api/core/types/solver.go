@@ -16,6 +16,11 @@
 package types
 
 import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
 	"github.com/crillab/gophersat/bf"
 )
 
@@ -23,8 +28,58 @@ type SolverType int
 
 const (
 	SolverSingleCoreSimple SolverType = 0
+	// SolverConcurrent builds the package formulas concurrently
+	SolverConcurrent SolverType = 1
+	// SolverOptimizing picks, among the solutions, the one which changes
+	// less the system and prefers newer packages from higher priority repositories
+	SolverOptimizing SolverType = 2
 )
 
+var solverTypes = map[SolverType]string{
+	SolverSingleCoreSimple: "simple",
+	SolverConcurrent:       "concurrent",
+	SolverOptimizing:       "optimizing",
+}
+
+func (t SolverType) String() string {
+	if s, ok := solverTypes[t]; ok {
+		return s
+	}
+	return strconv.Itoa(int(t))
+}
+
+// UnmarshalText allows to select the solver implementation by name
+// (simple, concurrent, optimizing) or by number in the configuration
+func (t *SolverType) UnmarshalText(text []byte) error {
+	s := strings.ToLower(strings.TrimSpace(string(text)))
+	for k, v := range solverTypes {
+		if v == s {
+			*t = k
+			return nil
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("invalid solver implementation '%s' (available: simple, concurrent, optimizing)", s)
+	}
+	*t = SolverType(n)
+	return nil
+}
+
+// UnmarshalJSON reads the implementation by number, as it is written in the
+// metadata of the packages, or by name
+func (t *SolverType) UnmarshalJSON(data []byte) error {
+	if n, err := strconv.Atoi(string(data)); err == nil {
+		*t = SolverType(n)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	return t.UnmarshalText([]byte(s))
+}
+
 // PackageSolver is an interface to a generic package solving algorithm
 type PackageSolver interface {
 	SetDefinitionDatabase(PackageDatabase)
@@ -51,6 +106,16 @@ type PackageSolver interface {
 type SolverOptions struct {
 	Type        SolverType `yaml:"type,omitempty"`
 	Concurrency int        `yaml:"concurrency,omitempty"`
+	// Race runs different SAT strategies concurrently, taking the first result.
+	// Only used by the concurrent solver
+	Race bool `yaml:"race,omitempty" json:"race,omitempty"`
+	// Priorities are the priorities of the repositories providing the packages, keyed
+	// by package fingerprint. Lower values have higher priority, as in the repositories.
+	// Only used by the optimizing solver
+	Priorities map[string]int `yaml:"-" json:"-"`
+	// CacheDir is the directory where the solver results are cached.
+	// Caching is disabled if empty
+	CacheDir string `yaml:"-" json:"-"`
 }
 
 // PackageResolver assists PackageSolver on unsat cases
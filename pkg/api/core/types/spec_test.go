@@ -76,6 +76,73 @@ var _ = ginkgo.Describe("Spec", func() {
 		})
 	})
 
+	ginkgo.Context("Compression", func() {
+		ginkgo.It("validates algorithms and levels", func() {
+			Expect(None.Validate(0)).To(Succeed())
+			Expect(CompressionImplementation("").Validate(0)).To(Succeed())
+			Expect(None.Validate(1)).ToNot(Succeed())
+			Expect(GZip.Validate(9)).To(Succeed())
+			Expect(GZip.Validate(10)).ToNot(Succeed())
+			Expect(Zstandard.Validate(22)).To(Succeed())
+			Expect(XZ.Validate(0)).To(Succeed())
+			Expect(LZ4.Validate(-1)).ToNot(Succeed())
+			Expect(CompressionImplementation("bzip2").Validate(0)).ToNot(Succeed())
+		})
+	})
+
+	ginkgo.Context("Sources", func() {
+		sum := "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+
+		ginkgo.It("are validated", func() {
+			Expect(SourceField{URL: "https://example.com/foo.tar.gz", SHA256: sum}.Validate()).To(Succeed())
+			Expect(SourceField{URL: "https://example.com/foo.tar.gz", SHA256: sum, Destination: "src/foo"}.Validate()).To(Succeed())
+			Expect(SourceField{SHA256: sum}.Validate()).ToNot(Succeed())
+			Expect(SourceField{URL: "ftp://example.com/foo.tar.gz", SHA256: sum}.Validate()).ToNot(Succeed())
+			Expect(SourceField{URL: "https://example.com/foo.tar.gz"}.Validate()).ToNot(Succeed())
+			Expect(SourceField{URL: "https://example.com/foo.tar.gz", SHA256: sum[1:]}.Validate()).ToNot(Succeed())
+			Expect(SourceField{URL: "https://example.com/foo.tar.gz", SHA256: sum, Destination: "/foo"}.Validate()).ToNot(Succeed())
+			Expect(SourceField{URL: "https://example.com/foo.tar.gz", SHA256: sum, Destination: "../foo"}.Validate()).ToNot(Succeed())
+		})
+
+		ginkgo.It("have a destination in the build context", func() {
+			Expect(SourceField{URL: "https://example.com/foo.tar.gz?a=b", SHA256: sum}.FileName()).To(Equal("foo.tar.gz"))
+			Expect(SourceField{URL: "https://example.com/foo.tar.gz", SHA256: sum, Destination: "src/./bar"}.FileName()).To(Equal("src/bar"))
+			Expect(SourceField{URL: "https://example.com/foo.tar.gz", SHA256: sum, Extract: true}.FileName()).To(Equal("."))
+			Expect(SourceField{URL: "https://example.com/", SHA256: sum}.FileName()).To(Equal(sum))
+		})
+	})
+
+	ginkgo.Context("Tests", func() {
+		ginkgo.It("renders the test image", func() {
+			spec := &LuetCompilationSpec{Package: &Package{Name: "foo", Category: "bar", Version: "1.0"}}
+			Expect(spec.HasTests()).To(BeFalse())
+
+			spec.Test = &TestSpec{Env: []string{"FOO=bar"}, Steps: []string{"foo --version", "foo test"}}
+			Expect(spec.HasTests()).To(BeTrue())
+			Expect(spec.RenderTestImage()).To(Equal(`
+FROM scratch
+COPY rootfs /
+WORKDIR /
+ENV PACKAGE_NAME=foo
+ENV PACKAGE_VERSION=1.0
+ENV PACKAGE_CATEGORY=bar
+ENV FOO=bar
+RUN foo --version
+RUN foo test`))
+		})
+
+		ginkgo.It("are not part of the hash", func() {
+			spec := &LuetCompilationSpec{Image: "foo", Package: &Package{Name: "foo", Category: "Bar"}}
+			hash, err := spec.Hash()
+			Expect(err).ToNot(HaveOccurred())
+
+			spec.Test = &TestSpec{Steps: []string{"foo --version"}}
+			hashTests, err := spec.Hash()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hash).To(Equal(hashTests))
+		})
+	})
+
 	ginkgo.Context("Image hashing", func() {
 		ginkgo.It("is stable", func() {
 			spec1 := &LuetCompilationSpec{
@@ -130,6 +197,130 @@ var _ = ginkgo.Describe("Spec", func() {
 			Expect(hash).ToNot(Equal(hash3))
 			Expect(hash).To(Equal(hashagain))
 		})
+
+		ginkgo.It("is not affected by the changelog", func() {
+			tmpdir, err := ioutil.TempDir("", "hash")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(tmpdir) // clean up
+
+			Expect(ioutil.WriteFile(filepath.Join(tmpdir, "build.yaml"), []byte("image: foo\n"), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(tmpdir, PackageChangelogFile), []byte("- version: \"1.0\"\n"), 0644)).To(Succeed())
+
+			spec := &LuetCompilationSpec{
+				Image:   "foo",
+				Package: &Package{Name: "foo", Category: "Bar", Version: "1.0", Path: tmpdir},
+			}
+			hash, err := spec.Hash()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(ioutil.WriteFile(filepath.Join(tmpdir, PackageChangelogFile), []byte("- version: \"1.1\"\n- version: \"1.0\"\n"), 0644)).To(Succeed())
+			spec.Package.SetChangelog(Changelog{{Version: "1.1"}, {Version: "1.0"}})
+			hashChangelog, err := spec.Hash()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hashChangelog).To(Equal(hash))
+
+			Expect(ioutil.WriteFile(filepath.Join(tmpdir, "build.yaml"), []byte("image: bar\n"), 0644)).To(Succeed())
+			hashBuild, err := spec.Hash()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hashBuild).ToNot(Equal(hash))
+		})
+
+		ginkgo.It("depends on the use flags referenced by the use conditions", func() {
+			spec := func(flags ...string) *LuetCompilationSpec {
+				return &LuetCompilationSpec{
+					Image: "foo",
+					Package: &Package{Name: "foo", Category: "Bar", UseFlags: flags,
+						PackageRequires: []*Package{
+							{Name: "openssl", Category: "libs", Version: ">=0", UseConditions: []string{"ssl"}},
+							{Name: "gtk", Category: "libs", Version: ">=0", UseConditions: []string{"gtk", "!qt"}},
+						},
+					},
+				}
+			}
+
+			hash, err := spec().Hash()
+			Expect(err).ToNot(HaveOccurred())
+			hashSSL, err := spec("ssl").Hash()
+			Expect(err).ToNot(HaveOccurred())
+			hashSSLGtk, err := spec("ssl", "gtk").Hash()
+			Expect(err).ToNot(HaveOccurred())
+			hashGtkSSL, err := spec("gtk", "ssl").Hash()
+			Expect(err).ToNot(HaveOccurred())
+			hashQt, err := spec("qt").Hash()
+			Expect(err).ToNot(HaveOccurred())
+			hashUnused, err := spec("ssl", "X").Hash()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(hash).ToNot(Equal(hashSSL))
+			Expect(hash).ToNot(Equal(hashQt))
+			Expect(hashSSL).ToNot(Equal(hashSSLGtk))
+			Expect(hashSSLGtk).To(Equal(hashGtkSSL))
+			Expect(hashUnused).To(Equal(hashSSL))
+		})
+
+		ginkgo.It("depends on the active requires only", func() {
+			spec := func(flags ...string) *LuetCompilationSpec {
+				return &LuetCompilationSpec{
+					Image: "foo",
+					Package: &Package{Name: "foo", Category: "Bar", UseFlags: flags,
+						PackageRequires: []*Package{
+							{Name: "openssl", Category: "libs", Version: ">=0", UseConditions: []string{"ssl"}},
+						},
+					},
+				}
+			}
+
+			hash, err := spec().Hash()
+			Expect(err).ToNot(HaveOccurred())
+			hashNoRequires, err := (&LuetCompilationSpec{Image: "foo", Package: &Package{Name: "foo", Category: "Bar"}}).Hash()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hash).To(Equal(hashNoRequires))
+			Expect(spec().HasImageSource()).To(BeTrue())
+			Expect((&LuetCompilationSpec{Package: spec().Package}).HasImageSource()).To(BeFalse())
+		})
+
+		ginkgo.It("depends on the sources", func() {
+			spec := func(sources ...SourceField) *LuetCompilationSpec {
+				return &LuetCompilationSpec{
+					Image:   "foo",
+					Sources: sources,
+					Package: &Package{Name: "foo", Category: "Bar"},
+				}
+			}
+			sum := "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+
+			hash, err := spec().Hash()
+			Expect(err).ToNot(HaveOccurred())
+			hashEmpty, err := spec([]SourceField{}...).Hash()
+			Expect(err).ToNot(HaveOccurred())
+			hashSource, err := spec(SourceField{URL: "https://example.com/foo.tar.gz", SHA256: sum}).Hash()
+			Expect(err).ToNot(HaveOccurred())
+			hashExtract, err := spec(SourceField{URL: "https://example.com/foo.tar.gz", SHA256: sum, Extract: true}).Hash()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(hash).To(Equal(hashEmpty))
+			Expect(hash).ToNot(Equal(hashSource))
+			Expect(hashSource).ToNot(Equal(hashExtract))
+		})
+
+		ginkgo.It("depends on the architecture", func() {
+			spec := func(arch string) *LuetCompilationSpec {
+				return &LuetCompilationSpec{
+					Image:   "foo",
+					Package: &Package{Name: "foo", Category: "Bar", Arch: arch},
+				}
+			}
+
+			hash, err := spec("").Hash()
+			Expect(err).ToNot(HaveOccurred())
+			hashAmd64, err := spec("amd64").Hash()
+			Expect(err).ToNot(HaveOccurred())
+			hashArm64, err := spec("arm64").Hash()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(hash).ToNot(Equal(hashAmd64))
+			Expect(hashAmd64).ToNot(Equal(hashArm64))
+		})
 	})
 
 	ginkgo.Context("Simple package build definition", func() {
@@ -15,6 +15,8 @@
 
 package box
 
+import "io"
+
 type Box interface {
 	Run() error
 	Exec() error
@@ -28,6 +30,10 @@ type DefaultBox struct {
 	Args                  []string
 	HostMounts            []string
 	Stdin, Stdout, Stderr bool
+	// HostNetwork shares the host network namespace with the box
+	HostNetwork bool
+	// Output receives the standard output and error of the box in place of the host ones
+	Output io.Writer
 }
 
 func NewBox(cmd string, args, hostmounts, env []string, rootfs string, stdin, stdout, stderr bool) Box {
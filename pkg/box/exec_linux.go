@@ -93,11 +93,11 @@ func (b *DefaultBox) Run() error {
 		execCmd = append(execCmd, "--stdin")
 	}
 
-	if b.Stderr {
+	if b.Stderr || b.Output != nil {
 		execCmd = append(execCmd, "--stderr")
 	}
 
-	if b.Stdout {
+	if b.Stdout || b.Output != nil {
 		execCmd = append(execCmd, "--stdout")
 	}
 	// Encode the command in base64 to avoid bad input from the args given
@@ -129,13 +129,23 @@ func (b *DefaultBox) Run() error {
 	if b.Stdout {
 		cmd.Stdout = os.Stdout
 	}
+
+	if b.Output != nil {
+		cmd.Stdout = b.Output
+		cmd.Stderr = b.Output
+	}
+
+	cloneflags := syscall.CLONE_NEWNS |
+		syscall.CLONE_NEWUTS |
+		syscall.CLONE_NEWIPC |
+		syscall.CLONE_NEWPID |
+		syscall.CLONE_NEWUSER
+	if !b.HostNetwork {
+		cloneflags |= syscall.CLONE_NEWNET
+	}
+
 	cmd.SysProcAttr = &syscall.SysProcAttr{
-		Cloneflags: syscall.CLONE_NEWNS |
-			syscall.CLONE_NEWUTS |
-			syscall.CLONE_NEWIPC |
-			syscall.CLONE_NEWPID |
-			syscall.CLONE_NEWNET |
-			syscall.CLONE_NEWUSER,
+		Cloneflags: uintptr(cloneflags),
 		UidMappings: []syscall.SysProcIDMap{
 			{
 				ContainerID: 0,
@@ -1,6 +1,8 @@
 package compiler
 
 import (
+	"path/filepath"
+
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 
 	"github.com/mudler/luet/pkg/api/core/types"
@@ -16,6 +18,8 @@ func NewBackend(ctx types.Context, s string) (CompilerBackend, error) {
 		compilerBackend = backend.NewSimpleImgBackend(ctx)
 	case backend.DockerBackend:
 		compilerBackend = backend.NewSimpleDockerBackend(ctx)
+	case backend.BoxBackend:
+		compilerBackend = backend.NewSimpleBoxBackend(ctx, filepath.Join(ctx.GetConfig().System.DatabasePath, "images"))
 	default:
 		return nil, errors.New("invalid backend. Unsupported")
 	}
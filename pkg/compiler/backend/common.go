@@ -16,6 +16,8 @@
 package backend
 
 import (
+	"fmt"
+	"io"
 	"os/exec"
 
 	"github.com/mudler/luet/pkg/api/core/types"
@@ -25,6 +27,7 @@ import (
 const (
 	ImgBackend    = "img"
 	DockerBackend = "docker"
+	BoxBackend    = "box"
 )
 
 type Options struct {
@@ -34,15 +37,35 @@ type Options struct {
 	Destination    string
 	Context        string
 	BackendArgs    []string
+	// Platform of the image to build, in the os/arch form. Empty for the host one
+	Platform string
+	// Log receives the output of the backend while building the image, if set
+	Log io.Writer `json:"-"`
 }
 
-func runCommand(ctx types.Context, cmd *exec.Cmd) error {
+// CommandError is returned when a backend command fails, it carries the output of the command
+type CommandError struct {
+	Err    error
+	Output string
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("Failed running command: %s: %s", e.Output, e.Err.Error())
+}
+
+func (e *CommandError) Unwrap() error { return e.Err }
+
+func runCommand(ctx types.Context, cmd *exec.Cmd, log io.Writer) error {
 	output := ""
 	buffered := !ctx.GetConfig().General.ShowBuildOutput
 	writer := NewBackendWriter(buffered, ctx)
 
 	cmd.Stdout = writer
 	cmd.Stderr = writer
+	if log != nil {
+		cmd.Stdout = io.MultiWriter(writer, log)
+		cmd.Stderr = cmd.Stdout
+	}
 
 	if buffered {
 		ctx.Spinner()
@@ -57,7 +80,7 @@ func runCommand(ctx types.Context, cmd *exec.Cmd) error {
 	err = cmd.Wait()
 	if err != nil {
 		output = writer.GetCombinedOutput()
-		return errors.Wrapf(err, "Failed running command: %s", output)
+		return errors.WithStack(&CommandError{Err: err, Output: output})
 	}
 
 	return nil
@@ -69,6 +92,9 @@ func genBuildCommand(opts Options) []string {
 	if context == "" {
 		context = "."
 	}
-	buildarg := append(opts.BackendArgs, "-f", opts.DockerFileName, "-t", opts.ImageName, context)
-	return append([]string{"build"}, buildarg...)
+	buildarg := append([]string{"build"}, opts.BackendArgs...)
+	if opts.Platform != "" {
+		buildarg = append(buildarg, "--platform", opts.Platform)
+	}
+	return append(buildarg, "-f", opts.DockerFileName, "-t", opts.ImageName, context)
 }
@@ -0,0 +1,226 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package backend
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// instruction is a single Dockerfile instruction
+type instruction struct {
+	Command string
+	// From is the image of COPY --from
+	From string
+	Args []string
+	// Line is the original instruction, without the command
+	Line string
+}
+
+// parseDockerfile reads the instructions of a Dockerfile.
+// Only the subset of instructions generated by the compiler is supported:
+// FROM, COPY, ADD, ENV, WORKDIR and RUN.
+func parseDockerfile(r io.Reader) ([]instruction, error) {
+	res := []instruction{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	current := ""
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if current == "" && (line == "" || strings.HasPrefix(line, "#")) {
+			continue
+		}
+
+		// Join continuation lines
+		if strings.HasSuffix(line, "\\") {
+			current += strings.TrimSuffix(line, "\\") + " "
+			continue
+		}
+		current += line
+
+		i, err := parseInstruction(current)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, i)
+		current = ""
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if current != "" {
+		i, err := parseInstruction(current)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, i)
+	}
+
+	if len(res) == 0 || res[0].Command != "FROM" {
+		return nil, errors.New("the Dockerfile must start with a FROM instruction")
+	}
+	return res, nil
+}
+
+func parseInstruction(line string) (instruction, error) {
+	fields := strings.SplitN(line, " ", 2)
+	i := instruction{Command: strings.ToUpper(fields[0])}
+	if len(fields) == 2 {
+		i.Line = strings.TrimSpace(fields[1])
+	}
+
+	switch i.Command {
+	case "FROM":
+		args := strings.Fields(i.Line)
+		if len(args) != 1 {
+			return i, fmt.Errorf("unsupported FROM instruction: %s (multi-stage builds are not supported)", line)
+		}
+		i.Args = args
+	case "COPY", "ADD":
+		args, err := splitWords(i.Line)
+		if err != nil {
+			return i, err
+		}
+		for len(args) > 0 && strings.HasPrefix(args[0], "--") {
+			if strings.HasPrefix(args[0], "--from=") && i.Command == "COPY" {
+				i.From = strings.TrimPrefix(args[0], "--from=")
+			} else {
+				return i, fmt.Errorf("unsupported flag in instruction: %s", line)
+			}
+			args = args[1:]
+		}
+		if len(args) < 2 {
+			return i, fmt.Errorf("%s requires at least a source and a destination: %s", i.Command, line)
+		}
+		i.Args = args
+	case "ENV":
+		args, err := splitWords(i.Line)
+		if err != nil {
+			return i, err
+		}
+		if len(args) == 0 {
+			return i, fmt.Errorf("ENV requires at least an argument: %s", line)
+		}
+		if !strings.Contains(args[0], "=") {
+			// ENV key value form
+			key := args[0]
+			value := strings.TrimSpace(strings.TrimPrefix(i.Line, key))
+			i.Args = []string{key + "=" + strings.Trim(value, `"`)}
+			break
+		}
+		for _, a := range args {
+			if !strings.Contains(a, "=") {
+				return i, fmt.Errorf("invalid ENV instruction: %s", line)
+			}
+		}
+		i.Args = args
+	case "WORKDIR":
+		if i.Line == "" {
+			return i, fmt.Errorf("WORKDIR requires an argument: %s", line)
+		}
+		i.Args = []string{i.Line}
+	case "RUN":
+		if strings.HasPrefix(i.Line, "[") {
+			// Exec form
+			if err := json.Unmarshal([]byte(i.Line), &i.Args); err != nil {
+				return i, errors.Wrapf(err, "invalid RUN instruction: %s", line)
+			}
+		} else {
+			i.Args = []string{"/bin/sh", "-c", i.Line}
+		}
+	default:
+		return i, fmt.Errorf("unsupported instruction: %s", line)
+	}
+
+	return i, nil
+}
+
+// splitWords splits a string by spaces, keeping quoted words together
+func splitWords(s string) ([]string, error) {
+	words := []string{}
+	var word strings.Builder
+	inWord := false
+	quote := rune(0)
+	escaped := false
+
+	for _, c := range s {
+		switch {
+		case escaped:
+			word.WriteRune(c)
+			escaped = false
+		case c == '\\':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				word.WriteRune(c)
+			}
+		case c == '"' || c == '\'':
+			quote = c
+			inWord = true
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in: %s", s)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// expandEnv expands the variables in s from the given environment
+func expandEnv(s string, env []string) string {
+	return os.Expand(s, func(k string) string {
+		for i := len(env) - 1; i >= 0; i-- {
+			if strings.HasPrefix(env[i], k+"=") {
+				return strings.TrimPrefix(env[i], k+"=")
+			}
+		}
+		return ""
+	})
+}
+
+// setEnv sets a variable in the environment, replacing the previous value
+func setEnv(env []string, kv string) []string {
+	key := strings.SplitN(kv, "=", 2)[0]
+	res := []string{}
+	for _, e := range env {
+		if !strings.HasPrefix(e, key+"=") {
+			res = append(res, e)
+		}
+	}
+	return append(res, kv)
+}
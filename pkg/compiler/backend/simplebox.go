@@ -0,0 +1,578 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package backend
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	containerdarchive "github.com/containerd/containerd/archive"
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/match"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	bus "github.com/mudler/luet/pkg/api/core/bus"
+	"github.com/mudler/luet/pkg/api/core/image"
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/mudler/luet/pkg/box"
+	fileHelper "github.com/mudler/luet/pkg/helpers/file"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/pkg/errors"
+)
+
+const defaultPath = "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// SimpleBox is a daemonless backend. Images are pulled and stored in a local
+// OCI layout, and build steps are executed in the image rootfs with box.
+type SimpleBox struct {
+	ctx  types.Context
+	path string
+	sync.Mutex
+}
+
+// NewSimpleBoxBackend returns a daemonless backend storing images in the given directory
+func NewSimpleBoxBackend(ctx types.Context, path string) *SimpleBox {
+	return &SimpleBox{ctx: ctx, path: path}
+}
+
+func (s *SimpleBox) layout() (layout.Path, error) {
+	if fileHelper.Exists(filepath.Join(s.path, "index.json")) {
+		return layout.FromPath(s.path)
+	}
+	if err := os.MkdirAll(s.path, os.ModePerm); err != nil {
+		return "", errors.Wrap(err, "while creating the image store")
+	}
+	return layout.Write(s.path, empty.Index)
+}
+
+// refName returns the fully qualified name of an image reference, so
+// that e.g. "foo/bar" and "foo/bar:latest" point to the same image
+func refName(imagename string) string {
+	ref, err := name.ParseReference(imagename)
+	if err != nil {
+		return imagename
+	}
+	return ref.Name()
+}
+
+func (s *SimpleBox) image(imagename string) (v1.Image, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	l, err := s.layout()
+	if err != nil {
+		return nil, err
+	}
+	index, err := l.ImageIndex()
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	matcher := match.Name(refName(imagename))
+	for _, desc := range manifest.Manifests {
+		if matcher(desc) {
+			return l.Image(desc.Digest)
+		}
+	}
+	return nil, fmt.Errorf("image %s not found", imagename)
+}
+
+func (s *SimpleBox) store(imagename string, img v1.Image) error {
+	s.Lock()
+	defer s.Unlock()
+
+	l, err := s.layout()
+	if err != nil {
+		return err
+	}
+	ref := refName(imagename)
+	return l.ReplaceImage(img, match.Name(ref), layout.WithAnnotations(map[string]string{
+		specs.AnnotationRefName: ref,
+	}))
+}
+
+func platformOption(platform string) []crane.Option {
+	if platform == "" {
+		return nil
+	}
+	p := &v1.Platform{}
+	parts := strings.Split(platform, "/")
+	p.OS = parts[0]
+	if len(parts) > 1 {
+		p.Architecture = parts[1]
+	}
+	if len(parts) > 2 {
+		p.Variant = parts[2]
+	}
+	return []crane.Option{crane.WithPlatform(p)}
+}
+
+// baseImage returns an image from the store, pulling it if not present
+func (s *SimpleBox) baseImage(imagename, platform string) (v1.Image, error) {
+	if imagename == "scratch" {
+		return empty.Image, nil
+	}
+	if img, err := s.image(imagename); err == nil {
+		return img, nil
+	}
+	if err := s.DownloadImage(Options{ImageName: imagename, Platform: platform}); err != nil {
+		return nil, err
+	}
+	return s.image(imagename)
+}
+
+// BuildImage builds the image described by the Dockerfile by running its
+// instructions in a rootfs, and by storing the changes as a new layer.
+func (s *SimpleBox) BuildImage(opts Options) error {
+	imagename := opts.ImageName
+	bus.Manager.Publish(bus.EventImagePreBuild, opts)
+
+	dockerfile := opts.DockerFileName
+	if !filepath.IsAbs(dockerfile) {
+		dockerfile = filepath.Join(opts.SourcePath, dockerfile)
+	}
+	buildContext := opts.Context
+	if buildContext == "" {
+		buildContext = "."
+	}
+	if !filepath.IsAbs(buildContext) {
+		buildContext = filepath.Join(opts.SourcePath, buildContext)
+	}
+
+	f, err := os.Open(dockerfile)
+	if err != nil {
+		return errors.Wrap(err, "Failed reading Dockerfile")
+	}
+	instructions, err := parseDockerfile(f)
+	f.Close()
+	if err != nil {
+		return errors.Wrap(err, "Failed parsing "+dockerfile)
+	}
+
+	s.ctx.Info(":package: Building image " + imagename)
+
+	base, err := s.baseImage(instructions[0].Args[0], opts.Platform)
+	if err != nil {
+		return errors.Wrap(err, "Failed getting base image")
+	}
+	cfg, err := base.ConfigFile()
+	if err != nil {
+		return err
+	}
+	cfg = cfg.DeepCopy()
+
+	lower, err := s.ctx.TempDir("box-lower")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(lower)
+	upper, err := s.ctx.TempDir("box-upper")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(upper)
+
+	for _, dir := range []string{lower, upper} {
+		if _, _, err := image.ExtractTo(s.ctx, base, dir, nil); err != nil {
+			return errors.Wrap(err, "Failed extracting base image")
+		}
+	}
+
+	b := &boxBuild{
+		SimpleBox:  s,
+		rootfs:     upper,
+		context:    buildContext,
+		platform:   opts.Platform,
+		env:        cfg.Config.Env,
+		workdir:    cfg.Config.WorkingDir,
+		showOutput: s.ctx.GetConfig().General.ShowBuildOutput,
+		log:        opts.Log,
+	}
+	if len(b.env) == 0 {
+		b.env = []string{defaultPath}
+	}
+	if b.workdir == "" {
+		b.workdir = "/"
+	}
+
+	for _, i := range instructions[1:] {
+		if err := b.apply(i); err != nil {
+			return errors.Wrapf(err, "Failed running %s %s", i.Command, i.Line)
+		}
+	}
+	if err := b.cleanup(); err != nil {
+		return err
+	}
+
+	layerFile, err := s.ctx.TempFile("box-layer")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(layerFile.Name())
+	err = containerdarchive.WriteDiff(context.Background(), layerFile, lower, upper)
+	layerFile.Close()
+	if err != nil {
+		return errors.Wrap(err, "Failed computing the image layer")
+	}
+
+	layer, err := tarball.LayerFromFile(layerFile.Name())
+	if err != nil {
+		return err
+	}
+	img, err := mutate.Append(base, mutate.Addendum{
+		Layer: layer,
+		History: v1.History{
+			CreatedBy: "luet",
+			Comment:   "box build",
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	cfg.Config.Env = b.env
+	cfg.Config.WorkingDir = b.workdir
+	imgCfg, err := img.ConfigFile()
+	if err != nil {
+		return err
+	}
+	cfg.RootFS = imgCfg.RootFS
+	cfg.History = imgCfg.History
+	img, err = mutate.ConfigFile(img, cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := s.store(imagename, img); err != nil {
+		return errors.Wrap(err, "Failed storing image")
+	}
+
+	s.ctx.Success(":package: Building image " + imagename + " done")
+	bus.Manager.Publish(bus.EventImagePostBuild, opts)
+
+	return nil
+}
+
+// boxBuild holds the state of an image build
+type boxBuild struct {
+	*SimpleBox
+	rootfs, context, platform string
+	env                       []string
+	workdir                   string
+	showOutput                bool
+	resolvConf                bool
+	log                       io.Writer
+}
+
+func (b *boxBuild) rootPath(p string) string {
+	if !path.IsAbs(p) {
+		p = path.Join(b.workdir, p)
+	}
+	return filepath.Join(b.rootfs, p)
+}
+
+func (b *boxBuild) apply(i instruction) error {
+	switch i.Command {
+	case "ENV":
+		for _, kv := range i.Args {
+			b.env = setEnv(b.env, expandEnv(kv, b.env))
+		}
+	case "WORKDIR":
+		workdir := expandEnv(i.Args[0], b.env)
+		if !path.IsAbs(workdir) {
+			workdir = path.Join(b.workdir, workdir)
+		}
+		b.workdir = workdir
+		return os.MkdirAll(b.rootPath(workdir), os.ModePerm)
+	case "COPY", "ADD":
+		return b.copy(i)
+	case "RUN":
+		return b.run(i)
+	}
+	return nil
+}
+
+func (b *boxBuild) copy(i instruction) error {
+	srcs, dst := i.Args[:len(i.Args)-1], expandEnv(i.Args[len(i.Args)-1], b.env)
+	dir := strings.HasSuffix(dst, "/") || len(srcs) > 1
+	dst = b.rootPath(dst)
+
+	src := b.context
+	if i.From != "" {
+		img, err := b.baseImage(i.From, b.platform)
+		if err != nil {
+			return err
+		}
+		_, src, err = image.Extract(b.ctx, img, nil)
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(src)
+	}
+
+	for _, s := range srcs {
+		if i.Command == "ADD" && (strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")) {
+			target := dst
+			if dir {
+				target = filepath.Join(dst, path.Base(s))
+			}
+			if err := download(s, target); err != nil {
+				return err
+			}
+			continue
+		}
+
+		matches, err := filepath.Glob(filepath.Join(src, s))
+		if err != nil {
+			return err
+		}
+		if len(matches) == 0 {
+			return fmt.Errorf("%s: no such file or directory", s)
+		}
+		for _, m := range matches {
+			target := dst
+			if isDir, _ := fileHelper.IsDirectory(m); !isDir && dir {
+				target = filepath.Join(dst, filepath.Base(m))
+			}
+			if err := fileHelper.CopyFile(m, target); err != nil {
+				return errors.Wrapf(err, "Failed copying %s", s)
+			}
+		}
+	}
+	return nil
+}
+
+func download(url, dst string) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed downloading %s: %s", url, resp.Status)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(f, resp.Body)
+	return err
+}
+
+func (b *boxBuild) run(i instruction) error {
+	// Steps share the host network, give them the host resolver if the image has none
+	resolvConf := filepath.Join(b.rootfs, "etc", "resolv.conf")
+	if !b.resolvConf && !fileHelper.Exists(resolvConf) && fileHelper.Exists("/etc/resolv.conf") {
+		if err := os.MkdirAll(filepath.Dir(resolvConf), os.ModePerm); err == nil {
+			if err := fileHelper.CopyFile("/etc/resolv.conf", resolvConf); err == nil {
+				b.resolvConf = true
+			}
+		}
+	}
+
+	args := i.Args
+	// Steps run in the working directory
+	script := fmt.Sprintf("cd %q && exec \"$@\"", b.workdir)
+	writer := NewBackendWriter(!b.showOutput, b.ctx)
+	var output io.Writer = writer
+	if b.log != nil {
+		output = io.MultiWriter(writer, b.log)
+	}
+
+	bx := box.NewBox("/bin/sh", append([]string{"-c", script, "sh"}, args...), []string{}, b.env, b.rootfs, false, false, false)
+	if d, ok := bx.(*box.DefaultBox); ok {
+		d.HostNetwork = true
+		d.Output = output
+	}
+
+	b.ctx.Debug(":package: Running", strings.Join(args, " "))
+	if err := bx.Run(); err != nil {
+		return errors.WithStack(&CommandError{Err: err, Output: writer.GetCombinedOutput()})
+	}
+	return nil
+}
+
+// cleanup removes the files which were added only to run the build steps
+func (b *boxBuild) cleanup() error {
+	if b.resolvConf {
+		return os.RemoveAll(filepath.Join(b.rootfs, "etc", "resolv.conf"))
+	}
+	return nil
+}
+
+func (s *SimpleBox) ExportImage(opts Options) error {
+	imagename := opts.ImageName
+	img, err := s.image(imagename)
+	if err != nil {
+		return err
+	}
+	ref, err := name.ParseReference(imagename)
+	if err != nil {
+		return err
+	}
+
+	s.ctx.Debug(":package: Saving image " + imagename)
+	if err := tarball.WriteToFile(opts.Destination, ref, img); err != nil {
+		return errors.Wrap(err, "Failed exporting image")
+	}
+	s.ctx.Debug(":package: Exported image:", imagename)
+	return nil
+}
+
+// LoadImage loads the images from a tarball into the store
+func (s *SimpleBox) LoadImage(path string) error {
+	s.ctx.Debug(":package: Loading image:", path)
+	manifest, err := tarball.LoadManifest(func() (io.ReadCloser, error) { return os.Open(path) })
+	if err != nil {
+		return errors.Wrap(err, "Failed loading image")
+	}
+
+	for _, m := range manifest {
+		for _, t := range m.RepoTags {
+			tag, err := name.NewTag(t)
+			if err != nil {
+				return err
+			}
+			img, err := tarball.ImageFromPath(path, &tag)
+			if err != nil {
+				return errors.Wrap(err, "Failed loading image")
+			}
+			if err := s.store(t, img); err != nil {
+				return err
+			}
+		}
+	}
+	s.ctx.Success(":package: Loaded image:", path)
+	return nil
+}
+
+func (s *SimpleBox) RemoveImage(opts Options) error {
+	s.Lock()
+	defer s.Unlock()
+
+	l, err := s.layout()
+	if err != nil {
+		return err
+	}
+	if err := l.RemoveDescriptors(match.Name(refName(opts.ImageName))); err != nil {
+		return errors.Wrap(err, "Failed removing image")
+	}
+	s.ctx.Success(":package: Removed image:", opts.ImageName)
+	return nil
+}
+
+func (s *SimpleBox) ImageDefinitionToTar(opts Options) error {
+	if err := s.BuildImage(opts); err != nil {
+		return errors.Wrap(err, "Failed building image")
+	}
+	if err := s.ExportImage(opts); err != nil {
+		return errors.Wrap(err, "Failed exporting image")
+	}
+	if err := s.RemoveImage(opts); err != nil {
+		return errors.Wrap(err, "Failed removing image")
+	}
+	return nil
+}
+
+func (s *SimpleBox) CopyImage(src, dst string) error {
+	s.ctx.Debug(":package: Tagging image:", src, "->", dst)
+	img, err := s.image(src)
+	if err != nil {
+		return errors.Wrap(err, "Failed tagging image")
+	}
+	if err := s.store(dst, img); err != nil {
+		return errors.Wrap(err, "Failed tagging image")
+	}
+	s.ctx.Success(":package: Tagged image:", src, "->", dst)
+	return nil
+}
+
+func (s *SimpleBox) DownloadImage(opts Options) error {
+	imagename := opts.ImageName
+	bus.Manager.Publish(bus.EventImagePrePull, opts)
+
+	s.ctx.Debug(":package: Downloading image " + imagename)
+
+	s.ctx.Spinner()
+	defer s.ctx.SpinnerStop()
+
+	img, err := crane.Pull(imagename, platformOption(opts.Platform)...)
+	if err != nil {
+		return errors.Wrap(err, "Failed pulling image")
+	}
+	if err := s.store(imagename, img); err != nil {
+		return errors.Wrap(err, "Failed storing image")
+	}
+
+	s.ctx.Success(":package: Downloaded image:", imagename)
+	bus.Manager.Publish(bus.EventImagePostPull, opts)
+
+	return nil
+}
+
+func (s *SimpleBox) Push(opts Options) error {
+	imagename := opts.ImageName
+	bus.Manager.Publish(bus.EventImagePrePush, opts)
+
+	img, err := s.image(imagename)
+	if err != nil {
+		return err
+	}
+
+	s.ctx.Spinner()
+	defer s.ctx.SpinnerStop()
+
+	if err := crane.Push(img, imagename); err != nil {
+		return errors.Wrap(err, "Failed pushing image")
+	}
+	s.ctx.Success(":package: Pushed image:", imagename)
+	bus.Manager.Publish(bus.EventImagePostPush, opts)
+	return nil
+}
+
+func (*SimpleBox) ImageAvailable(imagename string) bool {
+	return image.Available(imagename)
+}
+
+// ImageExists check if the given image is available in the store
+func (s *SimpleBox) ImageExists(imagename string) bool {
+	_, err := s.image(imagename)
+	return err == nil
+}
+
+func (s *SimpleBox) ImageReference(a string, ondisk bool) (v1.Image, error) {
+	return s.image(a)
+}
@@ -0,0 +1,124 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package backend_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/image"
+	. "github.com/mudler/luet/pkg/compiler/backend"
+	fileHelper "github.com/mudler/luet/pkg/helpers/file"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Box backend", func() {
+	var tmpdir, store string
+	var b *SimpleBox
+	ctx := context.NewContext()
+
+	BeforeEach(func() {
+		var err error
+		tmpdir, err = ioutil.TempDir(os.TempDir(), "boxbuild")
+		Expect(err).ToNot(HaveOccurred())
+		store = filepath.Join(tmpdir, "store")
+		b = NewSimpleBoxBackend(ctx, store)
+
+		Expect(os.MkdirAll(filepath.Join(tmpdir, "context"), os.ModePerm)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(tmpdir, "context", "foo"), []byte("foo"), os.ModePerm)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpdir)
+	})
+
+	build := func(imagename, dockerfile string) error {
+		Expect(ioutil.WriteFile(filepath.Join(tmpdir, "Dockerfile"), []byte(dockerfile), os.ModePerm)).To(Succeed())
+		return b.BuildImage(Options{
+			ImageName:      imagename,
+			SourcePath:     tmpdir,
+			Context:        "context",
+			DockerFileName: "Dockerfile",
+		})
+	}
+
+	It("Builds images without a daemon", func() {
+		Expect(build("luet/base", `
+FROM scratch
+COPY . /luetbuild
+WORKDIR /luetbuild
+ENV PACKAGE_NAME=enman
+ENV PATH=$PATH:/opt/bin`)).To(Succeed())
+		Expect(b.ImageExists("luet/base")).To(BeTrue())
+		Expect(b.ImageExists("luet/other")).To(BeFalse())
+
+		img, err := b.ImageReference("luet/base", true)
+		Expect(err).ToNot(HaveOccurred())
+		cfg, err := img.ConfigFile()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cfg.Config.WorkingDir).To(Equal("/luetbuild"))
+		Expect(cfg.Config.Env).To(ContainElement("PACKAGE_NAME=enman"))
+		Expect(cfg.Config.Env).To(ContainElement("PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin:/opt/bin"))
+
+		Expect(build("luet/step", `
+FROM luet/base
+COPY --from=luet/base /luetbuild/foo /bar
+COPY foo sub/`)).To(Succeed())
+
+		img, err = b.ImageReference("luet/step", false)
+		Expect(err).ToNot(HaveOccurred())
+		_, rootfs, err := image.Extract(ctx, img, nil)
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(rootfs)
+
+		Expect(fileHelper.Exists(filepath.Join(rootfs, "luetbuild", "foo"))).To(BeTrue())
+		Expect(fileHelper.Exists(filepath.Join(rootfs, "bar"))).To(BeTrue())
+		Expect(fileHelper.Exists(filepath.Join(rootfs, "luetbuild", "sub", "foo"))).To(BeTrue())
+	})
+
+	It("Exports, loads, tags and removes images", func() {
+		Expect(build("luet/base", `
+FROM scratch
+COPY foo /foo`)).To(Succeed())
+
+		dst := filepath.Join(tmpdir, "image.tar")
+		Expect(b.ExportImage(Options{ImageName: "luet/base", Destination: dst})).To(Succeed())
+		Expect(fileHelper.Exists(dst)).To(BeTrue())
+
+		other := NewSimpleBoxBackend(ctx, filepath.Join(tmpdir, "other"))
+		Expect(other.ImageExists("luet/base")).To(BeFalse())
+		Expect(other.LoadImage(dst)).To(Succeed())
+		Expect(other.ImageExists("luet/base")).To(BeTrue())
+
+		Expect(other.CopyImage("luet/base", "luet/copy")).To(Succeed())
+		Expect(other.ImageExists("luet/copy")).To(BeTrue())
+
+		Expect(other.RemoveImage(Options{ImageName: "luet/base"})).To(Succeed())
+		Expect(other.ImageExists("luet/base")).To(BeFalse())
+		Expect(other.ImageExists("luet/copy")).To(BeTrue())
+	})
+
+	It("Fails on unsupported instructions", func() {
+		Expect(build("luet/base", `
+FROM scratch
+USER nobody`)).ToNot(Succeed())
+		Expect(b.ImageExists("luet/base")).To(BeFalse())
+	})
+})
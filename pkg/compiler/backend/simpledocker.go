@@ -49,7 +49,7 @@ func (s *SimpleDocker) BuildImage(opts Options) error {
 	s.ctx.Info(":whale2: Building image " + name)
 	cmd := exec.Command("docker", buildarg...)
 	cmd.Dir = opts.SourcePath
-	err := runCommand(s.ctx, cmd)
+	err := runCommand(s.ctx, cmd, opts.Log)
 	if err != nil {
 		return err
 	}
@@ -88,6 +88,9 @@ func (s *SimpleDocker) DownloadImage(opts Options) error {
 	bus.Manager.Publish(bus.EventImagePrePull, opts)
 
 	buildarg := []string{"pull", name}
+	if opts.Platform != "" {
+		buildarg = append(buildarg, "--platform", opts.Platform)
+	}
 	s.ctx.Debug(":whale: Downloading image " + name)
 
 	s.ctx.Spinner()
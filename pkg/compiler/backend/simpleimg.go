@@ -51,7 +51,7 @@ func (s *SimpleImg) BuildImage(opts Options) error {
 
 	cmd := exec.Command("img", buildarg...)
 	cmd.Dir = opts.SourcePath
-	err := runCommand(s.ctx, cmd)
+	err := runCommand(s.ctx, cmd, opts.Log)
 	if err != nil {
 		return err
 	}
@@ -104,6 +104,9 @@ func (s *SimpleImg) DownloadImage(opts Options) error {
 	bus.Manager.Publish(bus.EventImagePrePull, opts)
 
 	buildarg := []string{"pull", name}
+	if opts.Platform != "" {
+		buildarg = append(buildarg, "--platform", opts.Platform)
+	}
 	s.ctx.Debug(":tea: Downloading image " + name)
 
 	s.ctx.Spinner()
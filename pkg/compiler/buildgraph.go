@@ -0,0 +1,370 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package compiler
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+	artifact "github.com/mudler/luet/pkg/api/core/types/artifact"
+)
+
+// buildStep is a single package image to build in order to compile a spec.
+// Steps are identified by the package image hash, so the same image
+// required by several specs is built only once.
+type buildStep struct {
+	hash        string
+	spec        *types.LuetCompilationSpec
+	requestedBy *types.LuetCompilationSpec
+	assertion   types.PackageAssert
+	builderHash string
+	// sourceHash is the hash of the image the step is built on top of
+	sourceHash       string
+	generateArtifact bool
+	target           bool
+
+	// parent is the step building the image this step starts from
+	parent *buildStep
+	// dependencies are the steps building the dependencies of a target
+	dependencies []*buildStep
+	// runtime are the steps building the runtime dependencies needed by the tests
+	runtime []*buildStep
+
+	artifact *artifact.PackageArtifact
+
+	status   string
+	err      error
+	duration time.Duration
+	cached   bool
+	// tests is the status of the test phase of the package, empty if it was not run
+	tests string
+}
+
+// BuildGraph is the graph of the images to build in order to compile a set of specs.
+// Each node is an image, which depends on the image it is built from.
+type BuildGraph struct {
+	steps    []*buildStep
+	index    map[string]*buildStep
+	children map[*buildStep][]*buildStep
+	// waiting are the steps which need the artifact of a step to run their tests
+	waiting map[*buildStep][]*buildStep
+	// users are the targets which need the artifact of a dependency
+	users map[*buildStep][]*buildStep
+	// targets are the last steps of each spec, in the order the specs were given
+	targets []*buildStep
+}
+
+func newBuildGraph() *BuildGraph {
+	return &BuildGraph{
+		index:    map[string]*buildStep{},
+		children: map[*buildStep][]*buildStep{},
+		waiting:  map[*buildStep][]*buildStep{},
+		users:    map[*buildStep][]*buildStep{},
+	}
+}
+
+// add adds the steps of a compilation plan to the graph, merging the steps
+// already present
+func (g *BuildGraph) add(plan []*buildStep) {
+	if t := g.merge(plan); t != nil {
+		g.targets = append(g.targets, t)
+	}
+}
+
+// addRuntime adds the compilation plan of a runtime dependency of the step,
+// which is started only once the last step of the plan is built
+func (g *BuildGraph) addRuntime(s *buildStep, plan []*buildStep) {
+	if d := g.merge(plan); d != nil {
+		s.runtime = append(s.runtime, d)
+		g.waiting[d] = append(g.waiting[d], s)
+	}
+}
+
+// merge adds the steps of the plan to the graph, and returns the step
+// of the graph matching the last one of the plan
+func (g *BuildGraph) merge(plan []*buildStep) *buildStep {
+	merged := map[*buildStep]*buildStep{}
+	resolve := func(s *buildStep) *buildStep {
+		if s == nil {
+			return nil
+		}
+		if m, ok := merged[s]; ok {
+			return m
+		}
+		return s
+	}
+
+	for _, s := range plan {
+		s.parent = resolve(s.parent)
+		for i := range s.dependencies {
+			s.dependencies[i] = resolve(s.dependencies[i])
+		}
+
+		existing, ok := g.index[s.hash]
+		if !ok {
+			g.index[s.hash] = s
+			g.steps = append(g.steps, s)
+			if s.parent != nil {
+				g.children[s.parent] = append(g.children[s.parent], s)
+			}
+			g.addUses(s)
+			continue
+		}
+
+		generate := existing.generateArtifact || s.generateArtifact
+		if s.target && !existing.target {
+			// The image is the final one of a spec, build it as such
+			parent, runtime := existing.parent, existing.runtime
+			*existing = *s
+			existing.parent, existing.runtime = parent, runtime
+			g.addUses(existing)
+		}
+		existing.generateArtifact = generate
+		merged[s] = existing
+	}
+
+	if len(plan) == 0 {
+		return nil
+	}
+	return resolve(plan[len(plan)-1])
+}
+
+// addUses records the step as a user of its dependencies
+func (g *BuildGraph) addUses(s *buildStep) {
+	for _, d := range s.uses() {
+		g.users[d] = append(g.users[d], s)
+	}
+}
+
+// uses returns the dependencies of the step it is not built on top of.
+// Dependencies with a seed image don't start from the previous ones, so
+// the target has to wait for all of them, not only for its parent.
+func (s *buildStep) uses() []*buildStep {
+	res := []*buildStep{}
+	for _, d := range s.dependencies {
+		if d != s.parent {
+			res = append(res, d)
+		}
+	}
+	return res
+}
+
+// prerequisites returns the steps which have to be built before the step: the image
+// it is built from, the dependencies of a target and the runtime dependencies needed by its tests
+func (s *buildStep) prerequisites() []*buildStep {
+	res := []*buildStep{}
+	if s.parent != nil {
+		res = append(res, s.parent)
+	}
+	res = append(res, s.uses()...)
+	return append(res, s.runtime...)
+}
+
+// failedPrerequisite returns the failed step which prevented the step to be built, if any
+func (s *buildStep) failedPrerequisite() *buildStep {
+	for _, p := range s.prerequisites() {
+		if p.status == StatusFailed {
+			return p
+		}
+		if f := p.failedPrerequisite(); f != nil {
+			return f
+		}
+	}
+	return nil
+}
+
+// dependents returns the steps which can start only once the step is built
+func (g *BuildGraph) dependents(s *buildStep) []*buildStep {
+	res := append(append([]*buildStep{}, g.children[s]...), g.users[s]...)
+	return append(res, g.waiting[s]...)
+}
+
+// checkCycles returns an error if a step has to be built before itself, which
+// happens when the runtime dependencies needed by the tests of a package require it
+func (g *BuildGraph) checkCycles() error {
+	const (
+		visiting = iota + 1
+		visited
+	)
+	state := map[*buildStep]int{}
+	var visit func(s *buildStep) error
+	visit = func(s *buildStep) error {
+		switch state[s] {
+		case visiting:
+			return fmt.Errorf("%s can't be tested: it is needed to build its own runtime dependencies", s.spec.GetPackage().HumanReadableString())
+		case visited:
+			return nil
+		}
+		state[s] = visiting
+		for _, p := range s.prerequisites() {
+			if err := visit(p); err != nil {
+				return err
+			}
+		}
+		state[s] = visited
+		return nil
+	}
+	for _, s := range g.steps {
+		if err := visit(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Len returns the number of images to build
+func (g *BuildGraph) Len() int {
+	return len(g.steps)
+}
+
+// heights returns the length of the longest chain of builds starting from each step
+func (g *BuildGraph) heights() map[*buildStep]int {
+	heights := map[*buildStep]int{}
+	var height func(s *buildStep) int
+	height = func(s *buildStep) int {
+		if h, ok := heights[s]; ok {
+			return h
+		}
+		h := 1
+		for _, c := range g.dependents(s) {
+			if ch := height(c) + 1; ch > h {
+				h = ch
+			}
+		}
+		heights[s] = h
+		return h
+	}
+	for _, s := range g.steps {
+		height(s)
+	}
+	return heights
+}
+
+// CriticalPath returns the longest chain of packages which have to be built
+// one after another. It is the lower bound of the build time, regardless
+// of the concurrency.
+func (g *BuildGraph) CriticalPath() types.Packages {
+	heights := g.heights()
+
+	var current *buildStep
+	for _, s := range g.steps {
+		if len(s.prerequisites()) == 0 && (current == nil || heights[s] > heights[current]) {
+			current = s
+		}
+	}
+
+	res := types.Packages{}
+	for current != nil {
+		res = append(res, current.spec.GetPackage())
+		var next *buildStep
+		for _, c := range g.dependents(current) {
+			if next == nil || heights[c] > heights[next] {
+				next = c
+			}
+		}
+		current = next
+	}
+	return res
+}
+
+// Artifacts returns the artifacts generated for the specs of the graph
+func (g *BuildGraph) Artifacts() []*artifact.PackageArtifact {
+	res := []*artifact.PackageArtifact{}
+	seen := map[*buildStep]interface{}{}
+	for _, t := range g.targets {
+		if _, ok := seen[t]; ok || t.artifact == nil {
+			continue
+		}
+		seen[t] = nil
+		res = append(res, t.artifact)
+	}
+	return res
+}
+
+type buildResult struct {
+	step *buildStep
+	err  error
+}
+
+// run builds the steps of the graph with the given concurrency. A step is started
+// as soon as its prerequisites are ready, preferring the steps with the
+// longest chain of builds depending on them. No new steps are started after a failure,
+// not even the ones of independent specs, unless keepGoing is set: in that case only
+// the steps depending on the failed ones are skipped.
+// The steps which are not built are marked as skipped.
+func (g *BuildGraph) run(concurrency int, keepGoing bool, build func(s *buildStep, progress string) error) []error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	heights := g.heights()
+
+	ready := []*buildStep{}
+	pending := map[*buildStep]int{}
+	for _, s := range g.steps {
+		pending[s] = len(s.prerequisites())
+		if pending[s] == 0 {
+			ready = append(ready, s)
+		}
+	}
+
+	results := make(chan buildResult)
+	running, started := 0, 0
+	var errs []error
+
+	for len(ready) > 0 || running > 0 {
+		sort.SliceStable(ready, func(i, j int) bool {
+			return heights[ready[i]] > heights[ready[j]]
+		})
+		for running < concurrency && len(ready) > 0 && (len(errs) == 0 || keepGoing) {
+			s := ready[0]
+			ready = ready[1:]
+			running++
+			started++
+			go func(s *buildStep, progress string) {
+				results <- buildResult{step: s, err: build(s, progress)}
+			}(s, fmt.Sprintf("%d/%d", started, len(g.steps)))
+		}
+		if running == 0 {
+			break
+		}
+
+		r := <-results
+		running--
+		r.step.err = r.err
+		if r.err != nil {
+			r.step.status = StatusFailed
+			errs = append(errs, r.err)
+			continue
+		}
+		r.step.status = StatusSuccess
+		for _, d := range g.dependents(r.step) {
+			pending[d]--
+			if pending[d] == 0 {
+				ready = append(ready, d)
+			}
+		}
+	}
+
+	for _, s := range g.steps {
+		if s.status == "" {
+			s.status = StatusSkipped
+		}
+	}
+
+	return errs
+}
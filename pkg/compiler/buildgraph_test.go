@@ -0,0 +1,244 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package compiler_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	. "github.com/mudler/luet/pkg/compiler"
+	sd "github.com/mudler/luet/pkg/compiler/backend"
+	pkg "github.com/mudler/luet/pkg/database"
+	"github.com/mudler/luet/pkg/tree"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Build graph", func() {
+	ctx := context.NewContext()
+
+	graph := func(opts []types.CompilerOption, packages ...*types.Package) *BuildGraph {
+		generalRecipe := tree.NewCompilerRecipe(pkg.NewInMemoryDatabase(false))
+		Expect(generalRecipe.Load("../../tests/fixtures/buildableseed")).To(Succeed())
+
+		c := NewLuetCompiler(sd.NewSimpleDockerBackend(ctx), generalRecipe.GetDatabase(), append(opts, WithContext(ctx))...)
+		specs := types.NewLuetCompilationspecs()
+		for _, p := range packages {
+			spec, err := c.FromPackage(p)
+			Expect(err).ToNot(HaveOccurred())
+			specs.Add(spec)
+		}
+		g, err := c.BuildGraph(false, specs)
+		Expect(err).ToNot(HaveOccurred())
+		return g
+	}
+
+	a := &types.Package{Name: "a", Category: "test", Version: "1.0"}
+	b := &types.Package{Name: "b", Category: "test", Version: "1.0"}
+	c := &types.Package{Name: "c", Category: "test", Version: "1.0"}
+	d := &types.Package{Name: "d", Category: "test", Version: "1.0"}
+
+	It("builds shared dependencies once", func() {
+		g := graph(nil, a, c, d)
+
+		// b is shared by all, c is both requested and a dependency of d
+		Expect(g.Len()).To(Equal(4))
+
+		path := []string{}
+		for _, p := range g.CriticalPath() {
+			path = append(path, p.GetFingerPrint())
+		}
+		Expect(path).To(Equal([]string{"b-test-1.0", "c-test-1.0", "d-test-1.0"}))
+	})
+
+	It("doesn't build dependencies if not requested", func() {
+		g := graph([]types.CompilerOption{NoDeps(true)}, a, d)
+		Expect(g.Len()).To(Equal(2))
+		Expect(len(g.CriticalPath())).To(Equal(1))
+	})
+
+	It("doesn't build the targets if only dependencies are requested", func() {
+		g := graph([]types.CompilerOption{OnlyDeps(true)}, d)
+		Expect(g.Len()).To(Equal(2))
+		Expect(g.CriticalPath()[len(g.CriticalPath())-1].GetFingerPrint()).To(Equal("c-test-1.0"))
+	})
+
+	It("builds the same spec once", func() {
+		Expect(graph(nil, b, b).Len()).To(Equal(1))
+	})
+
+	Context("Building", func() {
+		var tmpdir string
+
+		BeforeEach(func() {
+			var err error
+			tmpdir, err = ioutil.TempDir("", "buildgraph")
+			Expect(err).ToNot(HaveOccurred())
+
+			// b fails as the box backend can't parse its Dockerfile,
+			// c depends on it, while d only on a.
+			// f depends on e, which fails too, and on g: both have a seed image
+			for name, build := range map[string]string{
+				"a": `image: "scratch"`,
+				"b": "requires:\n- {category: test, name: a, version: \"1.0\"}\nenv:\n- FOO=\"broken",
+				"c": "requires:\n- {category: test, name: b, version: \"1.0\"}",
+				"d": "requires:\n- {category: test, name: a, version: \"1.0\"}",
+				"e": "image: \"scratch\"\nenv:\n- FOO=\"broken",
+				"f": "requires:\n- {category: test, name: e, version: \"1.0\"}\n- {category: test, name: g, version: \"1.0\"}",
+				"g": `image: "scratch"`,
+			} {
+				dir := filepath.Join(tmpdir, "tree", name)
+				Expect(os.MkdirAll(dir, os.ModePerm)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(dir, "definition.yaml"), []byte("category: test\nname: "+name+"\nversion: \"1.0\"\n"), os.ModePerm)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(dir, "build.yaml"), []byte(build+"\n"), os.ModePerm)).To(Succeed())
+			}
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(tmpdir)
+		})
+
+		compile := func(keepGoing bool, packages ...*types.Package) (*LuetCompiler, []error) {
+			generalRecipe := tree.NewCompilerRecipe(pkg.NewInMemoryDatabase(false))
+			Expect(generalRecipe.Load(filepath.Join(tmpdir, "tree"))).To(Succeed())
+
+			lc := NewLuetCompiler(sd.NewSimpleBoxBackend(ctx, filepath.Join(tmpdir, "images")), generalRecipe.GetDatabase(),
+				WithContext(ctx), Concurrency(1), KeepGoing(keepGoing))
+			specs := types.NewLuetCompilationspecs()
+			for _, p := range packages {
+				spec, err := lc.FromPackage(p)
+				Expect(err).ToNot(HaveOccurred())
+				spec.SetOutputPath(tmpdir)
+				specs.Add(spec)
+			}
+			_, errs := lc.CompileParallel(false, specs)
+			return lc, errs
+		}
+
+		status := func(r *BuildReport) map[string]string {
+			res := map[string]string{}
+			for _, p := range r.Packages {
+				res[p.Name] = p.Status
+			}
+			return res
+		}
+
+		It("skips only the packages depending on failed ones with keep going", func() {
+			c, errs := compile(true, c, d)
+			Expect(len(errs)).To(Equal(1))
+
+			report := c.BuildReport()
+			Expect(status(report)).To(Equal(map[string]string{
+				"a": StatusSuccess, "b": StatusFailed, "c": StatusSkipped, "d": StatusSuccess,
+			}))
+			for _, p := range report.Packages {
+				switch p.Name {
+				case "b":
+					Expect(p.Error).ToNot(BeEmpty())
+				case "c":
+					Expect(p.Error).To(Equal("test/b-1.0 failed to build"))
+				case "d":
+					Expect(p.Target).To(BeTrue())
+					Expect(p.Artifact).To(Equal(filepath.Join(tmpdir, "d-test-1.0.package.tar")))
+					Expect(p.ArtifactSize).ToNot(BeZero())
+					Expect(p.PackageImage).ToNot(BeEmpty())
+				}
+			}
+
+			// Logs are kept for successful and failed builds
+			logPath := func(name string) string {
+				return BuildLogPath(tmpdir, &types.Package{Category: "test", Name: name, Version: "1.0"})
+			}
+			dat, err := ioutil.ReadFile(logPath("d"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(dat)).To(ContainSubstring("==> Building test/d-1.0"))
+			Expect(string(dat)).To(ContainSubstring("==> Generating package image"))
+			Expect(string(dat)).To(ContainSubstring("==> Build completed"))
+			dat, err = ioutil.ReadFile(logPath("b"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(dat)).To(ContainSubstring("==> Build failed"))
+			_, err = os.Stat(logPath("c"))
+			Expect(err).To(HaveOccurred())
+
+			junit, err := report.JUnit()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(junit)).To(ContainSubstring(`<testsuite name="luet build" tests="4" failures="1" skipped="1"`))
+
+			Expect(report.WriteToFile(filepath.Join(tmpdir, "report.json"), ReportJSON)).To(Succeed())
+			Expect(report.WriteToFile(filepath.Join(tmpdir, "report.txt"), "txt")).ToNot(Succeed())
+		})
+
+		It("skips the packages depending on failed ones with a seed image", func() {
+			c, errs := compile(true, &types.Package{Name: "f", Category: "test", Version: "1.0"})
+			Expect(len(errs)).To(Equal(1))
+			Expect(status(c.BuildReport())).To(Equal(map[string]string{
+				"e": StatusFailed, "f": StatusSkipped, "g": StatusSuccess,
+			}))
+		})
+
+		It("reports the images which were already available", func() {
+			build := func() *BuildReport {
+				generalRecipe := tree.NewCompilerRecipe(pkg.NewInMemoryDatabase(false))
+				Expect(generalRecipe.Load(filepath.Join(tmpdir, "tree"))).To(Succeed())
+
+				lc := NewLuetCompiler(sd.NewSimpleBoxBackend(ctx, filepath.Join(tmpdir, "images")), generalRecipe.GetDatabase(),
+					WithContext(ctx), Concurrency(1), PullFirst(true))
+				spec, err := lc.FromPackage(d)
+				Expect(err).ToNot(HaveOccurred())
+				spec.SetOutputPath(tmpdir)
+				_, errs := lc.CompileParallel(false, types.NewLuetCompilationspecs(spec))
+				Expect(errs).To(BeEmpty())
+				return lc.BuildReport()
+			}
+
+			cacheHits := func(r *BuildReport) map[string]bool {
+				res := map[string]bool{}
+				for _, p := range r.Packages {
+					res[p.Name] = p.CacheHit
+				}
+				return res
+			}
+
+			Expect(cacheHits(build())).To(Equal(map[string]bool{"a": false, "d": false}))
+			Expect(cacheHits(build())).To(Equal(map[string]bool{"a": true, "d": true}))
+
+			// The log of the cached build is appended to the previous one
+			dat, err := ioutil.ReadFile(BuildLogPath(tmpdir, d))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(strings.Count(string(dat), "==> Building test/d-1.0")).To(Equal(2))
+			Expect(string(dat)).To(ContainSubstring("==> Generating package image"))
+		})
+
+		It("stores the logs of the packages built for an architecture apart", func() {
+			arm := &types.Package{Name: "d", Category: "test", Version: "1.0", Arch: "arm64"}
+			Expect(BuildLogPath(tmpdir, arm)).To(Equal(filepath.Join(tmpdir, LogsDir, "arm64", "test-d-1.0.log")))
+			Expect(BuildLogPath(tmpdir, d)).To(Equal(filepath.Join(tmpdir, LogsDir, "test-d-1.0.log")))
+		})
+
+		It("stops after a failure", func() {
+			c, errs := compile(false, c, d)
+			Expect(len(errs)).To(Equal(1))
+			// d doesn't depend on b, but it is not started after b failed
+			Expect(status(c.BuildReport())).To(Equal(map[string]string{
+				"a": StatusSuccess, "b": StatusFailed, "c": StatusSkipped, "d": StatusSkipped,
+			}))
+		})
+	})
+})
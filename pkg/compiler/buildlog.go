@@ -0,0 +1,119 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/pkg/errors"
+)
+
+// LogsDir is the folder inside the build destination where the build logs are stored
+const LogsDir = "logs"
+
+// BuildLogPath returns the path of the build log of a package in the build destination.
+// Logs of packages built for an architecture are stored in a subfolder named after it.
+func BuildLogPath(dst string, p *types.Package) string {
+	return filepath.Join(dst, LogsDir, p.GetArch(), fmt.Sprintf("%s-%s-%s.log", p.GetCategory(), p.GetName(), p.GetVersion()))
+}
+
+// buildLog is the log of a package build. It prefixes each line
+// of the backend output with a timestamp.
+type buildLog struct {
+	sync.Mutex
+	f    *os.File
+	line bytes.Buffer
+}
+
+func newBuildLog(path string) (*buildLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, errors.Wrap(err, "while creating the logs folder")
+	}
+	// Append to the log, so the output of the previous builds is kept when the
+	// package image is already available and it is not built again
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "while creating the build log")
+	}
+	return &buildLog{f: f}, nil
+}
+
+func (l *buildLog) writeLine(line []byte) error {
+	_, err := fmt.Fprintf(l.f, "%s %s\n", time.Now().UTC().Format(time.RFC3339), bytes.TrimRight(line, "\r"))
+	return err
+}
+
+func (l *buildLog) Write(p []byte) (int, error) {
+	l.Lock()
+	defer l.Unlock()
+
+	for _, b := range p {
+		if b != '\n' {
+			l.line.WriteByte(b)
+			continue
+		}
+		if err := l.writeLine(l.line.Bytes()); err != nil {
+			return 0, err
+		}
+		l.line.Reset()
+	}
+	return len(p), nil
+}
+
+// writer returns the log as a writer for the backends, nil if there is no log
+func (l *buildLog) writer() io.Writer {
+	if l == nil {
+		return nil
+	}
+	return l
+}
+
+// Step writes a step marker in the log
+func (l *buildLog) Step(format string, args ...interface{}) {
+	if l == nil {
+		return
+	}
+	l.Lock()
+	defer l.Unlock()
+
+	l.flush()
+	l.writeLine([]byte("==> " + fmt.Sprintf(format, args...)))
+}
+
+func (l *buildLog) flush() {
+	if l.line.Len() > 0 {
+		l.writeLine(l.line.Bytes())
+		l.line.Reset()
+	}
+}
+
+func (l *buildLog) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.Lock()
+	defer l.Unlock()
+
+	l.flush()
+	return l.f.Close()
+}
@@ -27,7 +27,6 @@ import (
 
 	"regexp"
 	"strings"
-	"sync"
 	"time"
 
 	dockerfile "github.com/asottile/dockerfile"
@@ -35,6 +34,8 @@ import (
 	bus "github.com/mudler/luet/pkg/api/core/bus"
 	"github.com/mudler/luet/pkg/api/core/context"
 	"github.com/mudler/luet/pkg/api/core/image"
+	"github.com/mudler/luet/pkg/api/core/license"
+	"github.com/mudler/luet/pkg/api/core/sbom"
 	"github.com/mudler/luet/pkg/api/core/template"
 	"github.com/mudler/luet/pkg/api/core/types"
 	artifact "github.com/mudler/luet/pkg/api/core/types/artifact"
@@ -68,13 +69,15 @@ type LuetCompiler struct {
 	Backend  CompilerBackend
 	Database types.PackageDatabase
 	Options  types.CompilerOptions
+
+	report *BuildReport
 }
 
 func NewCompiler(p ...types.CompilerOption) *LuetCompiler {
 	c := newDefaultCompiler()
 	c.Apply(p...)
 
-	return &LuetCompiler{Options: *c}
+	return &LuetCompiler{Options: *c, report: &BuildReport{}}
 }
 
 func NewLuetCompiler(backend CompilerBackend, db types.PackageDatabase, compilerOpts ...types.CompilerOption) *LuetCompiler {
@@ -91,21 +94,6 @@ func NewLuetCompiler(backend CompilerBackend, db types.PackageDatabase, compiler
 	return c
 }
 
-func (cs *LuetCompiler) compilerWorker(i int, wg *sync.WaitGroup, cspecs chan *types.LuetCompilationSpec, a *[]*artifact.PackageArtifact, m *sync.Mutex, concurrency int, keepPermissions bool, errors chan error) {
-	defer wg.Done()
-
-	for s := range cspecs {
-		ar, err := cs.compile(concurrency, keepPermissions, nil, nil, s)
-		if err != nil {
-			errors <- err
-		}
-
-		m.Lock()
-		*a = append(*a, ar)
-		m.Unlock()
-	}
-}
-
 // CompileWithReverseDeps compiles the supplied compilationspecs and their reverse dependencies
 func (cs *LuetCompiler) CompileWithReverseDeps(keepPermissions bool, ps *types.LuetCompilationspecs) ([]*artifact.PackageArtifact, []error) {
 	artifacts, err := cs.CompileParallel(keepPermissions, ps)
@@ -138,34 +126,68 @@ func (cs *LuetCompiler) CompileWithReverseDeps(keepPermissions bool, ps *types.L
 	return append(artifacts, artifacts2...), err
 }
 
-// CompileParallel compiles the supplied compilationspecs in parallel
-// to note, no specific heuristic is implemented, and the specs are run in parallel as they are.
+// CompileParallel compiles the supplied compilationspecs in parallel.
+// The images needed by all the specs are arranged in a BuildGraph, and each of them
+// is built only once, as soon as the image it starts from is available.
 func (cs *LuetCompiler) CompileParallel(keepPermissions bool, ps *types.LuetCompilationspecs) ([]*artifact.PackageArtifact, []error) {
-	all := make(chan *types.LuetCompilationSpec)
-	artifacts := []*artifact.PackageArtifact{}
-	mutex := &sync.Mutex{}
-	errors := make(chan error, ps.Len())
-	var wg = new(sync.WaitGroup)
-	for i := 0; i < cs.Options.Concurrency; i++ {
-		wg.Add(1)
-		go cs.compilerWorker(i, wg, all, &artifacts, mutex, cs.Options.Concurrency, keepPermissions, errors)
+	g, err := cs.BuildGraph(keepPermissions, ps)
+	if err != nil {
+		return nil, []error{err}
 	}
 
-	for _, p := range ps.All() {
-		all <- p
+	if g.Len() > 0 {
+		criticalPath := []string{}
+		for _, p := range g.CriticalPath() {
+			criticalPath = append(criticalPath, p.HumanReadableString())
+		}
+		cs.Options.Context.Info(fmt.Sprintf(":deciduous_tree: %d images to build, critical path (%d): %s", g.Len(), len(criticalPath), strings.Join(criticalPath, " ⤑ ")))
 	}
 
-	close(all)
-	wg.Wait()
-	close(errors)
-
-	var allErrors []error
+	errs := g.run(cs.Options.Concurrency, cs.Options.KeepGoing, func(s *buildStep, progress string) error {
+		start := time.Now()
+		_, err := cs.buildStep(cs.Options.Concurrency, keepPermissions, s, progress)
+		s.duration = time.Since(start)
+		return err
+	})
 
-	for e := range errors {
-		allErrors = append(allErrors, e)
+	cs.report.add(g)
+	if len(errs) != 0 && g.Len() > 1 {
+		failed, skipped := 0, 0
+		for _, s := range g.steps {
+			switch s.status {
+			case StatusFailed:
+				failed++
+			case StatusSkipped:
+				skipped++
+			}
+		}
+		cs.Options.Context.Warning(fmt.Sprintf("%d images built, %d failed, %d skipped", g.Len()-failed-skipped, failed, skipped))
 	}
 
-	return artifacts, allErrors
+	return g.Artifacts(), errs
+}
+
+// BuildReport returns the report of the builds done by the compiler
+func (cs *LuetCompiler) BuildReport() *BuildReport {
+	return cs.report
+}
+
+// BuildGraph returns the graph of the images to build in order to compile the specs.
+// Images shared between the specs appear only once in the graph.
+// The graph includes the runtime dependencies needed to run the tests of the packages.
+func (cs *LuetCompiler) BuildGraph(keepPermissions bool, ps *types.LuetCompilationspecs) (*BuildGraph, error) {
+	g := newBuildGraph()
+	for _, p := range ps.All() {
+		plan, err := cs.planCompilation(cs.Options.Concurrency, keepPermissions, nil, nil, p)
+		if err != nil {
+			return nil, err
+		}
+		g.add(plan)
+	}
+	if err := cs.addRuntimeDependencies(keepPermissions, g); err != nil {
+		return nil, err
+	}
+	return g, g.checkCycles()
 }
 
 func (cs *LuetCompiler) stripFromRootfs(includes []string, rootfs string, include bool) error {
@@ -262,14 +284,16 @@ func (cs *LuetCompiler) unpackFs(concurrency int, keepPermissions bool, p *types
 		toUnpack = filepath.Join(toUnpack, p.PackageDir)
 	}
 
-	a := artifact.NewPackageArtifact(p.Rel(p.GetPackage().GetFingerPrint() + ".package.tar"))
-	a.CompressionType = cs.Options.CompressionType
+	a := artifact.NewPackageArtifact(p.Rel(p.GetPackage().GetArtifactName() + ".package.tar"))
+	a.CompressionType, a.CompressionLevel = cs.compression(p)
+	a.Reproducible = cs.reproducible(p)
 
 	if err := a.Compress(toUnpack, concurrency); err != nil {
 		return nil, errors.Wrap(err, "Error met while creating package archive")
 	}
 
 	a.CompileSpec = p
+	a.Arch = p.GetPackage().GetArch()
 	return a, nil
 }
 
@@ -321,24 +345,55 @@ func (cs *LuetCompiler) unpackDelta(concurrency int, keepPermissions bool, p *ty
 	}
 
 	cs.Options.Context.Info(pkgTag, ":hammer: Extracting artifact from image", runnerOpts.ImageName)
+	compressionType, compressionLevel := cs.compression(p)
 	a, err := artifact.ImageToArtifact(
 		cs.Options.Context,
 		ref2,
-		cs.Options.CompressionType,
-		p.Rel(fmt.Sprintf("%s%s", p.GetPackage().GetFingerPrint(), ".package.tar")),
+		compressionType,
+		p.Rel(fmt.Sprintf("%s%s", p.GetPackage().GetArtifactName(), ".package.tar")),
 		filter,
+		artifact.WithLevel(compressionLevel),
+		artifact.WithReproducible(cs.reproducible(p)),
 	)
 	if err != nil {
 		return nil, err
 	}
 
 	a.CompileSpec = p
+	a.Arch = p.GetPackage().GetArch()
 	return a, nil
 }
 
+// reproducible returns true if the artifacts of the spec have to be reproducible archives
+func (cs *LuetCompiler) reproducible(p *types.LuetCompilationSpec) bool {
+	return cs.Options.Reproducible || p.Reproducible
+}
+
+// compression returns the compression type and level of the artifacts of the spec,
+// the ones set in the spec take precedence over the compiler ones
+func (cs *LuetCompiler) compression(p *types.LuetCompilationSpec) (types.CompressionImplementation, int) {
+	t, level := cs.Options.CompressionType, cs.Options.CompressionLevel
+	if p.CompressionType != "" {
+		t, level = p.CompressionType, 0
+	}
+	if p.CompressionLevel != 0 {
+		level = p.CompressionLevel
+	}
+	return t, level
+}
+
+// platform returns the image platform to build the package for,
+// empty if the package is architecture independent
+func platform(p *types.Package) string {
+	if p.GetArch() == "" {
+		return ""
+	}
+	return "linux/" + p.GetArch()
+}
+
 func (cs *LuetCompiler) buildPackageImage(image, buildertaggedImage, packageImage string,
 	concurrency int, keepPermissions bool,
-	p *types.LuetCompilationSpec) (backend.Options, backend.Options, error) {
+	p *types.LuetCompilationSpec, log *buildLog) (backend.Options, backend.Options, error) {
 
 	var runnerOpts, builderOpts backend.Options
 
@@ -372,6 +427,16 @@ func (cs *LuetCompiler) buildPackageImage(image, buildertaggedImage, packageImag
 		}
 	}
 
+	// Inject the sources, they are downloaded only if they are not already in the cache
+	if len(p.Sources) > 0 {
+		sources := cs.sourceCache()
+		for _, src := range p.Sources {
+			if err := sources.Inject(src, buildDir); err != nil {
+				return builderOpts, runnerOpts, errors.Wrap(err, "Could not inject sources")
+			}
+		}
+	}
+
 	// First we create the builder image
 	if err := p.WriteBuildImageDefinition(filepath.Join(buildDir, p.GetPackage().ImageID()+"-builder.dockerfile")); err != nil {
 		return builderOpts, runnerOpts, errors.Wrap(err, "Could not generate image definition")
@@ -396,15 +461,19 @@ func (cs *LuetCompiler) buildPackageImage(image, buildertaggedImage, packageImag
 		ImageName:      buildertaggedImage,
 		SourcePath:     buildDir,
 		DockerFileName: p.GetPackage().ImageID() + "-builder.dockerfile",
-		Destination:    p.Rel(p.GetPackage().GetFingerPrint() + "-builder.image.tar"),
+		Destination:    p.Rel(p.GetPackage().GetArtifactName() + "-builder.image.tar"),
 		BackendArgs:    cs.Options.BackendArgs,
+		Platform:       platform(p.GetPackage()),
+		Log:            log.writer(),
 	}
 	runnerOpts = backend.Options{
 		ImageName:      packageImage,
 		SourcePath:     buildDir,
 		DockerFileName: p.GetPackage().ImageID() + ".dockerfile",
-		Destination:    p.Rel(p.GetPackage().GetFingerPrint() + ".image.tar"),
+		Destination:    p.Rel(p.GetPackage().GetArtifactName() + ".image.tar"),
 		BackendArgs:    cs.Options.BackendArgs,
+		Platform:       platform(p.GetPackage()),
+		Log:            log.writer(),
 	}
 
 	buildAndPush := func(opts backend.Options) error {
@@ -412,6 +481,7 @@ func (cs *LuetCompiler) buildPackageImage(image, buildertaggedImage, packageImag
 		if cs.Options.PullFirst {
 			err := cs.Backend.DownloadImage(opts)
 			if err == nil {
+				log.Step("Downloaded image %s", opts.ImageName)
 				buildImage = false
 			} else {
 				cs.Options.Context.Warning("Failed to download '" + opts.ImageName + "'. Will keep going and build the image unless you use --fatal")
@@ -433,6 +503,7 @@ func (cs *LuetCompiler) buildPackageImage(image, buildertaggedImage, packageImag
 	// SKIPBUILD
 	//	if len(p.GetPreBuildSteps()) != 0 {
 	cs.Options.Context.Info(pkgTag, ":whale: Generating 'builder' image from", image, "as", buildertaggedImage, "with prelude steps")
+	log.Step("Generating builder image %s from %s", buildertaggedImage, image)
 	if err := buildAndPush(builderOpts); err != nil {
 		return builderOpts, runnerOpts, errors.Wrapf(err, "Could not push image: %s %s", image, builderOpts.DockerFileName)
 	}
@@ -441,6 +512,7 @@ func (cs *LuetCompiler) buildPackageImage(image, buildertaggedImage, packageImag
 	// Even if we might not have any steps to build, we do that so we can tag the image used in this moment and use that to cache it in a registry, or in the system.
 	// acting as a docker tag.
 	cs.Options.Context.Info(pkgTag, ":whale: Generating 'package' image from", buildertaggedImage, "as", packageImage, "with build steps")
+	log.Step("Generating package image %s from %s", packageImage, buildertaggedImage)
 	if err := buildAndPush(runnerOpts); err != nil {
 		return builderOpts, runnerOpts, errors.Wrapf(err, "Could not push image: %s %s", image, runnerOpts.DockerFileName)
 	}
@@ -458,7 +530,7 @@ func (cs *LuetCompiler) genArtifact(p *types.LuetCompilationSpec, builderOpts, r
 	cs.Options.Context.Debug(pkgTag, "Generating artifact")
 	// We can't generate delta in this case. It implies the package is a virtual, and nothing has to be done really
 	if p.EmptyPackage() {
-		fakePackage := p.Rel(p.GetPackage().GetFingerPrint() + ".package.tar")
+		fakePackage := p.Rel(p.GetPackage().GetArtifactName() + ".package.tar")
 
 		rootfs, err = cs.Options.Context.TempDir("rootfs")
 		if err != nil {
@@ -467,14 +539,22 @@ func (cs *LuetCompiler) genArtifact(p *types.LuetCompilationSpec, builderOpts, r
 		defer os.RemoveAll(rootfs)
 
 		a := artifact.NewPackageArtifact(fakePackage)
-		a.CompressionType = cs.Options.CompressionType
+		a.CompressionType, a.CompressionLevel = cs.compression(p)
+		a.Reproducible = cs.reproducible(p)
 
 		if err := a.Compress(rootfs, concurrency); err != nil {
 			return nil, errors.Wrap(err, "Error met while creating package archive")
 		}
 
 		a.CompileSpec = p
+		a.Arch = p.GetPackage().GetArch()
+		if err := cs.runTests(keepPermissions, a, p, runnerOpts.Log); err != nil {
+			return nil, err
+		}
 		a.CompileSpec.GetPackage().SetBuildTimestamp(time.Now().String())
+		if err := cs.generateSBOM(a, p.GetOutputPath()); err != nil {
+			return a, err
+		}
 		err = a.WriteYAML(p.GetOutputPath())
 		if err != nil {
 			return a, errors.Wrap(err, "Failed while writing metadata file")
@@ -509,8 +589,17 @@ func (cs *LuetCompiler) genArtifact(p *types.LuetCompilationSpec, builderOpts, r
 		a.Files = filelist
 	}
 
+	// The metadata is written only if the tests pass, so the package can't end up in a repository
+	if err := cs.runTests(keepPermissions, a, p, runnerOpts.Log); err != nil {
+		return nil, err
+	}
+
 	a.CompileSpec.GetPackage().SetBuildTimestamp(time.Now().String())
 
+	if err := cs.generateSBOM(a, p.GetOutputPath()); err != nil {
+		return a, err
+	}
+
 	err = a.WriteYAML(p.GetOutputPath())
 	if err != nil {
 		return a, errors.Wrap(err, "Failed while writing metadata file")
@@ -536,6 +625,9 @@ func (cs *LuetCompiler) genArtifact(p *types.LuetCompilationSpec, builderOpts, r
 
 func (cs *LuetCompiler) buildSubPackage(a *artifact.PackageArtifact, sub *types.SubPackage, spec *types.LuetCompilationSpec, keepPermissions bool, concurrency int) error {
 	sub.SetPath(spec.Package.Path)
+	if sub.Arch == "" {
+		sub.Arch = spec.Package.GetArch()
+	}
 
 	cs.Options.Context.Info(":arrow_right: Creating sub package", sub.HumanReadableString())
 	subArtifactDir, err := cs.Options.Context.TempDir("subpackage")
@@ -549,10 +641,11 @@ func (cs *LuetCompiler) buildSubPackage(a *artifact.PackageArtifact, sub *types.
 		return errors.Wrap(err, "while unpack sub package")
 	}
 
-	subP := spec.Rel(sub.GetFingerPrint() + ".package.tar")
+	subP := spec.Rel(sub.GetArtifactName() + ".package.tar")
 
 	subArtifact := artifact.NewPackageArtifact(subP)
-	subArtifact.CompressionType = cs.Options.CompressionType
+	subArtifact.CompressionType, subArtifact.CompressionLevel = cs.compression(spec)
+	subArtifact.Reproducible = cs.reproducible(spec)
 
 	if err := subArtifact.Compress(subArtifactDir, concurrency); err != nil {
 		return errors.Wrap(err, "Error met while creating package archive")
@@ -561,8 +654,13 @@ func (cs *LuetCompiler) buildSubPackage(a *artifact.PackageArtifact, sub *types.
 	subArtifact.CompileSpec = spec
 	subArtifact.CompileSpec.Package = sub.Package
 	subArtifact.Runtime = sub.Package
+	subArtifact.Arch = sub.GetArch()
 	subArtifact.CompileSpec.GetPackage().SetBuildTimestamp(time.Now().String())
 
+	if err := cs.generateSBOM(subArtifact, spec.GetOutputPath()); err != nil {
+		return err
+	}
+
 	err = subArtifact.WriteYAML(spec.GetOutputPath(), artifact.WithRuntimePackage(sub.Package))
 	if err != nil {
 		return errors.Wrap(err, "Failed while writing metadata file")
@@ -576,6 +674,37 @@ func (cs *LuetCompiler) buildSubPackage(a *artifact.PackageArtifact, sub *types.
 	return nil
 }
 
+// generateSBOM writes the SBOM document of the artifact in the destination folder,
+// if enabled in the compiler options
+func (cs *LuetCompiler) generateSBOM(a *artifact.PackageArtifact, dst string) error {
+	if cs.Options.SBOMFormat == "" {
+		return nil
+	}
+
+	format, err := sbom.ParseFormat(cs.Options.SBOMFormat)
+	if err != nil {
+		return err
+	}
+
+	if err := a.Hash(); err != nil {
+		return errors.Wrap(err, "Failed generating checksums for artifact")
+	}
+
+	c, err := sbom.FromArtifact(a)
+	if err != nil {
+		return errors.Wrapf(err, "while generating sbom for '%s'", a.CompileSpec.GetPackage().HumanReadableString())
+	}
+
+	fileName := sbom.FileName(a.CompileSpec.GetPackage(), format)
+	if err := sbom.NewDocument(a.CompileSpec.GetPackage().HumanReadableString(), c).WriteFile(format, filepath.Join(dst, fileName)); err != nil {
+		return errors.Wrapf(err, "while writing sbom for '%s'", a.CompileSpec.GetPackage().HumanReadableString())
+	}
+	a.SBOM = fileName
+
+	cs.Options.Context.Debug(":page_facing_up: Generated SBOM", fileName)
+	return nil
+}
+
 // finalizeImages finalizes images and generates final artifacts (push them as well if necessary).
 func (cs *LuetCompiler) finalizeImages(a *artifact.PackageArtifact, p *types.LuetCompilationSpec, keepPermissions bool) error {
 
@@ -747,11 +876,12 @@ func (cs *LuetCompiler) getImageArtifact(hash string, p *types.LuetCompilationSp
 // compileWithImage compiles a PackageTagHash image using the image source, and tagging an indermediate
 // image buildertaggedImage.
 // Images that can be resolved from repositories are prefered over the local ones if PullFirst is set to true
-// avoiding to rebuild images as much as possible
+// avoiding to rebuild images as much as possible.
+// cached is set to true when the package image was already available.
 func (cs *LuetCompiler) compileWithImage(image, builderHash string, packageTagHash string,
 	concurrency int,
 	keepPermissions, keepImg bool,
-	p *types.LuetCompilationSpec, generateArtifact bool) (*artifact.PackageArtifact, error) {
+	p *types.LuetCompilationSpec, generateArtifact bool, log *buildLog, cached *bool) (*artifact.PackageArtifact, error) {
 
 	// If it is a virtual, check if we have to generate an empty artifact or not.
 	if generateArtifact && p.IsVirtual() {
@@ -765,6 +895,8 @@ func (cs *LuetCompiler) compileWithImage(image, builderHash string, packageTagHa
 			// try to avoid regenerating the image if possible by checking the hash in the
 			// given repositories
 			// It is best effort. If we fail resolving, we will generate the images and keep going
+			log.Step("Package image %s already available, skipping build", packageTagHash)
+			*cached = true
 			return art, nil
 		}
 	}
@@ -796,9 +928,13 @@ func (cs *LuetCompiler) compileWithImage(image, builderHash string, packageTagHa
 		switch {
 		case remoteImageAvailable:
 			cs.Options.Context.Debug("Images available remotely for", p.Package.HumanReadableString(), "generating artifact from remote images:", resolved)
+			log.Step("Generating artifact from the remote image %s", resolved)
+			*cached = true
 			return cs.genArtifact(p, backend.Options{ImageName: builderResolved}, backend.Options{ImageName: resolved}, concurrency, keepPermissions)
 		case localImageAvailable:
 			cs.Options.Context.Debug("Images locally available for", p.Package.HumanReadableString(), "generating artifact from image:", resolved)
+			log.Step("Generating artifact from the local image %s", packageImage)
+			*cached = true
 			return cs.genArtifact(p, backend.Options{ImageName: remoteBuildertaggedImage}, backend.Options{ImageName: packageImage}, concurrency, keepPermissions)
 		default:
 			cs.Options.Context.Debug("Images not available for", p.Package.HumanReadableString())
@@ -806,7 +942,7 @@ func (cs *LuetCompiler) compileWithImage(image, builderHash string, packageTagHa
 	}
 
 	// always going to point at the destination from the repo defined
-	builderOpts, runnerOpts, err := cs.buildPackageImage(image, builderResolved, packageImage, concurrency, keepPermissions, p)
+	builderOpts, runnerOpts, err := cs.buildPackageImage(image, builderResolved, packageImage, concurrency, keepPermissions, p, log)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed building package image")
 	}
@@ -827,6 +963,7 @@ func (cs *LuetCompiler) compileWithImage(image, builderHash string, packageTagHa
 		return &artifact.PackageArtifact{}, nil
 	}
 
+	log.Step("Generating artifact")
 	return cs.genArtifact(p, builderOpts, runnerOpts, concurrency, keepPermissions)
 }
 
@@ -1028,7 +1165,7 @@ func (cs *LuetCompiler) resolveFinalImages(concurrency int, keepPermissions bool
 		}
 	} else {
 		cs.Options.Context.Info(joinTag, "No runtime db present, first level join only")
-		fromPackages = p.Package.GetRequires() // first level only
+		fromPackages = p.Package.GetActiveRequires() // first level only
 	}
 
 	// First compute a hash and check if image is available. if it is, then directly consume that
@@ -1073,7 +1210,7 @@ func (cs *LuetCompiler) resolveFinalImages(concurrency int, keepPermissions bool
 			if img := cs.findImageHash(c.ImageID(), p); cs.Options.PullFirst && img != "" {
 				cs.Options.Context.Info("Final image already found", img)
 				if !cs.Backend.ImageExists(img) {
-					if err := cs.Backend.DownloadImage(backend.Options{ImageName: img}); err != nil {
+					if err := cs.Backend.DownloadImage(backend.Options{ImageName: img, Platform: platform(p.Package)}); err != nil {
 						return errors.Wrap(err, "failed pulling image "+img+" during extraction")
 					}
 				}
@@ -1227,6 +1364,24 @@ func CompilerFinalImages(cs *LuetCompiler) (*LuetCompiler, error) {
 }
 
 func (cs *LuetCompiler) compile(concurrency int, keepPermissions bool, generateFinalArtifact *bool, generateDependenciesFinalArtifact *bool, p *types.LuetCompilationSpec) (*artifact.PackageArtifact, error) {
+	steps, err := cs.planCompilation(concurrency, keepPermissions, generateFinalArtifact, generateDependenciesFinalArtifact, p)
+	if err != nil {
+		return nil, err
+	}
+
+	var a *artifact.PackageArtifact
+	for i, s := range steps {
+		a, err = cs.buildStep(concurrency, keepPermissions, s, fmt.Sprintf("%d/%d", i+1, len(steps)))
+		if err != nil {
+			return a, err
+		}
+	}
+	return a, nil
+}
+
+// planCompilation computes the ordered list of images to build in order to compile the
+// spec: the images of its build dependencies first, and then the image of the spec itself.
+func (cs *LuetCompiler) planCompilation(concurrency int, keepPermissions bool, generateFinalArtifact *bool, generateDependenciesFinalArtifact *bool, p *types.LuetCompilationSpec) ([]*buildStep, error) {
 	cs.Options.Context.Info(":package: Compiling", p.GetPackage().HumanReadableString(), ".... :coffee:")
 
 	//Before multistage : join - same as multistage, but keep artifacts, join them, create a new one and generate a final image.
@@ -1258,6 +1413,16 @@ func (cs *LuetCompiler) compile(concurrency int, keepPermissions bool, generateF
 		return nil, errors.Wrap(err, "failed querying hashtree")
 	}
 
+	solutionPackages := types.Packages{}
+	for _, a := range packageHashTree.Solution {
+		if a.Value {
+			solutionPackages = append(solutionPackages, a.Package)
+		}
+	}
+	if err := license.Enforce(cs.Options.Context, solutionPackages); err != nil {
+		return nil, errors.Wrapf(err, "while checking licenses of %s", p.GetPackage().HumanReadableString())
+	}
+
 	// This is in order to have the metadata in the yaml
 	p.SetSourceAssertion(packageHashTree.Solution)
 	targetAssertion := packageHashTree.Target
@@ -1275,32 +1440,34 @@ func (cs *LuetCompiler) compile(concurrency int, keepPermissions bool, generateF
 	// Update compilespec build options - it will be then serialized into the compilation metadata file
 	p.BuildOptions.PushImageRepository = cs.Options.PushImageRepository
 
+	localGenerateArtifact := true
+	if generateFinalArtifact != nil {
+		localGenerateArtifact = *generateFinalArtifact
+	}
+
+	target := &buildStep{
+		hash:             targetAssertion.Hash.PackageHash,
+		spec:             p,
+		requestedBy:      p,
+		assertion:        *targetAssertion,
+		builderHash:      packageHashTree.BuilderImageHash,
+		sourceHash:       packageHashTree.SourceHash,
+		generateArtifact: localGenerateArtifact,
+		target:           true,
+	}
+
 	// - If image is set we just generate a plain dockerfile
 	// Treat last case (easier) first. The image is provided and we just compute a plain dockerfile with the images listed as above
 	if p.GetImage() != "" {
-		localGenerateArtifact := true
-		if generateFinalArtifact != nil {
-			localGenerateArtifact = *generateFinalArtifact
-		}
-
-		a, err := cs.compileWithImage(p.GetImage(), packageHashTree.BuilderImageHash, targetAssertion.Hash.PackageHash, concurrency, keepPermissions, cs.Options.KeepImg, p, localGenerateArtifact)
-		if err != nil {
-			return nil, errors.Wrap(err, "building direct image")
-		}
-		a.SourceAssertion = p.GetSourceAssertion()
-
-		a.PackageCacheImage = targetAssertion.Hash.PackageHash
-		return a, nil
+		return []*buildStep{target}, nil
 	}
 
 	// - If image is not set, we read a base_image. Then we will build one image from it to kick-off our build based
 	// on how we compute the resolvable tree.
 	// This means to recursively build all the build-images needed to reach that tree part.
 	// - We later on compute an hash used to identify the image, so each similar deptree keeps the same build image.
-	dependencies := packageHashTree.Dependencies  // at this point we should have a flattened list of deps to build, including all of them (with all constraints propagated already)
-	departifacts := []*artifact.PackageArtifact{} // TODO: Return this somehow
-	depsN := 0
-	currentN := 0
+	dependencies := packageHashTree.Dependencies // at this point we should have a flattened list of deps to build, including all of them (with all constraints propagated already)
+	steps := []*buildStep{}
 
 	packageDeps := !cs.Options.PackageTargetOnly
 	if generateDependenciesFinalArtifact != nil {
@@ -1311,17 +1478,13 @@ func (cs *LuetCompiler) compile(concurrency int, keepPermissions bool, generateF
 	buildTarget := !cs.Options.OnlyDeps
 
 	if buildDeps {
-
 		cs.Options.Context.Info(":deciduous_tree: Build dependencies for " + p.GetPackage().HumanReadableString())
 		for _, assertion := range dependencies { //highly dependent on the order
-			depsN++
 			cs.Options.Context.Info(" :arrow_right_hook:", assertion.Package.HumanReadableString(), ":leaves:")
 		}
 
+		var parent *buildStep
 		for _, assertion := range dependencies { //highly dependent on the order
-			currentN++
-			pkgTag := fmt.Sprintf(":package: %d/%d %s ⤑ :hammer: build %s", currentN, depsN, p.GetPackage().HumanReadableString(), assertion.Package.HumanReadableString())
-			cs.Options.Context.Info(pkgTag, " starts")
 			compileSpec, err := cs.FromPackage(assertion.Package)
 			if err != nil {
 				return nil, errors.Wrap(err, "Error while generating compilespec for "+assertion.Package.GetName())
@@ -1332,88 +1495,106 @@ func (cs *LuetCompiler) compile(concurrency int, keepPermissions bool, generateF
 
 			compileSpec.SetOutputPath(p.GetOutputPath())
 
-			bus.Manager.Publish(bus.EventPackagePreBuild, struct {
-				CompileSpec *types.LuetCompilationSpec
-				Assert      types.PackageAssert
-			}{
-				CompileSpec: compileSpec,
-				Assert:      assertion,
-			})
-
-			if err := cs.resolveFinalImages(concurrency, keepPermissions, compileSpec); err != nil {
-				return nil, errors.Wrap(err, "while resolving join images")
-			}
-
-			if err := cs.resolveMultiStageImages(concurrency, keepPermissions, compileSpec); err != nil {
-				return nil, errors.Wrap(err, "while resolving multi-stage images")
-			}
-
 			buildHash, err := packageHashTree.DependencyBuildImage(assertion.Package)
 			if err != nil {
 				return nil, errors.Wrap(err, "failed looking for dependency in hashtree")
 			}
 
-			cs.Options.Context.Debug(pkgTag, "    :arrow_right_hook: :whale: Builder image from hash", assertion.Hash.BuildHash)
-			cs.Options.Context.Debug(pkgTag, "    :arrow_right_hook: :whale: Package image from hash", assertion.Hash.PackageHash)
-
-			var sourceImage string
-
-			if compileSpec.GetImage() != "" {
-				cs.Options.Context.Debug(pkgTag, " :wrench: Compiling "+compileSpec.GetPackage().HumanReadableString()+" from image")
-				sourceImage = compileSpec.GetImage()
-			} else {
-				// for the source instead, pick an image and a buildertaggedImage from hashes if they exists.
-				// otherways fallback to the pushed repo
-				// Resolve images from the hashtree
-				sourceImage = cs.resolveExistingImageHash(assertion.Hash.BuildHash, compileSpec)
-				cs.Options.Context.Debug(pkgTag, " :wrench: Compiling "+compileSpec.GetPackage().HumanReadableString()+" from tree")
+			step := &buildStep{
+				hash:             assertion.Hash.PackageHash,
+				spec:             compileSpec,
+				requestedBy:      p,
+				assertion:        assertion,
+				builderHash:      buildHash,
+				sourceHash:       assertion.Hash.BuildHash,
+				generateArtifact: packageDeps,
 			}
-
-			a, err := cs.compileWithImage(
-				sourceImage,
-				buildHash,
-				assertion.Hash.PackageHash,
-				concurrency,
-				keepPermissions,
-				cs.Options.KeepImg,
-				compileSpec,
-				packageDeps,
-			)
-			if err != nil {
-				return nil, errors.Wrap(err, "Failed compiling "+compileSpec.GetPackage().HumanReadableString())
+			// Packages with a seed image are not built on top of the previous dependencies
+			if compileSpec.GetImage() == "" {
+				step.parent = parent
 			}
+			steps = append(steps, step)
+			parent = step
+		}
+		target.parent = parent
+	}
 
-			a.PackageCacheImage = assertion.Hash.PackageHash
+	if buildTarget {
+		target.dependencies = steps
+		steps = append(steps, target)
+	} else if len(steps) == 0 {
+		return nil, fmt.Errorf("%s has no dependencies to build", p.GetPackage().HumanReadableString())
+	}
 
-			cs.Options.Context.Success(pkgTag, ":white_check_mark: Done")
+	return steps, nil
+}
 
-			bus.Manager.Publish(bus.EventPackagePostBuild, struct {
-				CompileSpec *types.LuetCompilationSpec
-				Artifact    *artifact.PackageArtifact
-			}{
-				CompileSpec: compileSpec,
-				Artifact:    a,
-			})
+// buildStep builds a single step of a compilation plan, logging the build
+// in the output folder of the spec
+func (cs *LuetCompiler) buildStep(concurrency int, keepPermissions bool, s *buildStep, progress string) (*artifact.PackageArtifact, error) {
+	var log *buildLog
+	if s.spec.GetOutputPath() != "" {
+		var err error
+		log, err = newBuildLog(BuildLogPath(s.spec.GetOutputPath(), s.spec.GetPackage()))
+		if err != nil {
+			return nil, err
+		}
+		defer log.Close()
+	}
 
-			departifacts = append(departifacts, a)
+	log.Step("Building %s (package image %s)", s.spec.GetPackage().HumanReadableString(), s.hash)
+	start := time.Now()
+	a, err := cs.compileStep(concurrency, keepPermissions, s, progress, log)
+	if s.generateArtifact && s.spec.HasTests() {
+		var testErr *TestError
+		switch {
+		case cs.Options.SkipTests:
+			s.tests = StatusSkipped
+		case err == nil:
+			s.tests = StatusSuccess
+		case errors.As(err, &testErr):
+			s.tests = StatusFailed
 		}
 	}
+	if err != nil {
+		log.Step("Build failed after %s: %s", time.Since(start).Round(time.Millisecond), err.Error())
+	} else {
+		log.Step("Build completed in %s", time.Since(start).Round(time.Millisecond))
+	}
+	return a, err
+}
 
-	if buildTarget {
-		localGenerateArtifact := true
-		if generateFinalArtifact != nil {
-			localGenerateArtifact = *generateFinalArtifact
+func (cs *LuetCompiler) compileStep(concurrency int, keepPermissions bool, s *buildStep, progress string, log *buildLog) (*artifact.PackageArtifact, error) {
+	p := s.spec
+
+	if s.target {
+		if p.GetImage() != "" {
+			cs.Options.Context.Info(fmt.Sprintf(":package: %s :hammer: build %s from image %s", progress, p.GetPackage().HumanReadableString(), p.GetImage()))
+			a, err := cs.compileWithImage(p.GetImage(), s.builderHash, s.hash, concurrency, keepPermissions, cs.Options.KeepImg, p, s.generateArtifact, log, &s.cached)
+			if err != nil {
+				return nil, errors.Wrap(err, "building direct image")
+			}
+			a.SourceAssertion = p.GetSourceAssertion()
+
+			a.PackageCacheImage = s.hash
+			s.artifact = a
+			return a, nil
 		}
-		resolvedSourceImage := cs.resolveExistingImageHash(packageHashTree.SourceHash, p)
-		cs.Options.Context.Info(":rocket: All dependencies are satisfied, building package requested by the user", p.GetPackage().HumanReadableString())
+
+		resolvedSourceImage := cs.resolveExistingImageHash(s.sourceHash, p)
+		cs.Options.Context.Info(fmt.Sprintf(":package: %s :rocket: All dependencies are satisfied, building package requested by the user", progress), p.GetPackage().HumanReadableString())
 		cs.Options.Context.Info(":package:", p.GetPackage().HumanReadableString(), " Using image: ", resolvedSourceImage)
-		a, err := cs.compileWithImage(resolvedSourceImage, packageHashTree.BuilderImageHash, targetAssertion.Hash.PackageHash, concurrency, keepPermissions, cs.Options.KeepImg, p, localGenerateArtifact)
+		a, err := cs.compileWithImage(resolvedSourceImage, s.builderHash, s.hash, concurrency, keepPermissions, cs.Options.KeepImg, p, s.generateArtifact, log, &s.cached)
 		if err != nil {
 			return a, err
 		}
+		departifacts := []*artifact.PackageArtifact{}
+		for _, d := range s.dependencies {
+			departifacts = append(departifacts, d.artifact)
+		}
 		a.Dependencies = departifacts
 		a.SourceAssertion = p.GetSourceAssertion()
-		a.PackageCacheImage = targetAssertion.Hash.PackageHash
+		a.PackageCacheImage = s.hash
 		bus.Manager.Publish(bus.EventPackagePostBuild, struct {
 			CompileSpec *types.LuetCompilationSpec
 			Artifact    *artifact.PackageArtifact
@@ -1422,10 +1603,75 @@ func (cs *LuetCompiler) compile(concurrency int, keepPermissions bool, generateF
 			Artifact:    a,
 		})
 
-		return a, err
+		s.artifact = a
+		return a, nil
+	}
+
+	pkgTag := fmt.Sprintf(":package: %s %s ⤑ :hammer: build %s", progress, s.requestedBy.GetPackage().HumanReadableString(), p.GetPackage().HumanReadableString())
+	cs.Options.Context.Info(pkgTag, " starts")
+
+	bus.Manager.Publish(bus.EventPackagePreBuild, struct {
+		CompileSpec *types.LuetCompilationSpec
+		Assert      types.PackageAssert
+	}{
+		CompileSpec: p,
+		Assert:      s.assertion,
+	})
+
+	if err := cs.resolveFinalImages(concurrency, keepPermissions, p); err != nil {
+		return nil, errors.Wrap(err, "while resolving join images")
+	}
+
+	if err := cs.resolveMultiStageImages(concurrency, keepPermissions, p); err != nil {
+		return nil, errors.Wrap(err, "while resolving multi-stage images")
+	}
+
+	cs.Options.Context.Debug(pkgTag, "    :arrow_right_hook: :whale: Builder image from hash", s.assertion.Hash.BuildHash)
+	cs.Options.Context.Debug(pkgTag, "    :arrow_right_hook: :whale: Package image from hash", s.assertion.Hash.PackageHash)
+
+	var sourceImage string
+
+	if p.GetImage() != "" {
+		cs.Options.Context.Debug(pkgTag, " :wrench: Compiling "+p.GetPackage().HumanReadableString()+" from image")
+		sourceImage = p.GetImage()
 	} else {
-		return departifacts[len(departifacts)-1], nil
+		// for the source instead, pick an image and a buildertaggedImage from hashes if they exists.
+		// otherways fallback to the pushed repo
+		// Resolve images from the hashtree
+		sourceImage = cs.resolveExistingImageHash(s.sourceHash, p)
+		cs.Options.Context.Debug(pkgTag, " :wrench: Compiling "+p.GetPackage().HumanReadableString()+" from tree")
+	}
+
+	a, err := cs.compileWithImage(
+		sourceImage,
+		s.builderHash,
+		s.hash,
+		concurrency,
+		keepPermissions,
+		cs.Options.KeepImg,
+		p,
+		s.generateArtifact,
+		log,
+		&s.cached,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed compiling "+p.GetPackage().HumanReadableString())
 	}
+
+	a.PackageCacheImage = s.hash
+
+	cs.Options.Context.Success(pkgTag, ":white_check_mark: Done")
+
+	bus.Manager.Publish(bus.EventPackagePostBuild, struct {
+		CompileSpec *types.LuetCompilationSpec
+		Artifact    *artifact.PackageArtifact
+	}{
+		CompileSpec: p,
+		Artifact:    a,
+	})
+
+	s.artifact = a
+	return a, nil
 }
 
 type templatedata map[string]interface{}
@@ -1521,6 +1767,15 @@ func (cs *LuetCompiler) FromPackage(p *types.Package) (*types.LuetCompilationSpe
 		return nil, err
 	}
 
+	// Packages are built for the requested architecture
+	if cs.Options.Arch != "" {
+		if !pack.SupportsArch(cs.Options.Arch) {
+			return nil, fmt.Errorf("%s is not available for %s", pack.HumanReadableString(), cs.Options.Arch)
+		}
+		pack = pack.Clone()
+		pack.Arch = cs.Options.Arch
+	}
+
 	opts := types.CompilerOptions{}
 
 	artifactMetadataFile := filepath.Join(pack.GetTreeDir(), "..", pack.GetMetadataFilePath())
@@ -1581,7 +1836,13 @@ func (cs *LuetCompiler) FromPackage(p *types.Package) (*types.LuetCompilationSpe
 	}
 	opts.BuildValues = append(opts.BuildValues, (map[string]interface{})(dst))
 
-	bytes, err := cs.templatePackage(opts.BuildValues, pack, templatedata(dst))
+	// Expose the active use flags to the templates, they take precedence over the ones in the definition
+	vals := opts.BuildValues
+	if len(pack.GetUses()) != 0 {
+		vals = append([]map[string]interface{}{{"use_flags": pack.GetUses()}}, vals...)
+	}
+
+	bytes, err := cs.templatePackage(vals, pack, templatedata(dst))
 	if err != nil {
 		return nil, errors.Wrap(err, "while rendering package template")
 	}
@@ -16,12 +16,64 @@
 package compiler_test
 
 import (
+	b64 "encoding/base64"
+	"fmt"
+	"os"
 	"testing"
 
+	"github.com/mudler/luet/pkg/box"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
 
+// The box backend runs the build steps by executing itself as "luet exec",
+// this makes the test binary able to run them as well
+func init() {
+	if len(os.Args) < 2 || os.Args[1] != "exec" {
+		return
+	}
+
+	var rootfs, entrypoint string
+	var stdin, stdout, stderr, decode bool
+	var mounts, envs, args []string
+	for i := 2; i < len(os.Args); i++ {
+		switch a := os.Args[i]; a {
+		case "--rootfs":
+			i++
+			rootfs = os.Args[i]
+		case "--entrypoint":
+			i++
+			entrypoint = os.Args[i]
+		case "--mount":
+			i++
+			mounts = append(mounts, os.Args[i])
+		case "--env":
+			i++
+			envs = append(envs, os.Args[i])
+		case "--stdin":
+			stdin = true
+		case "--stdout":
+			stdout = true
+		case "--stderr":
+			stderr = true
+		case "--decode":
+			decode = true
+		default:
+			if decode {
+				sDec, _ := b64.StdEncoding.DecodeString(a)
+				a = string(sDec)
+			}
+			args = append(args, a)
+		}
+	}
+
+	if err := box.NewBox(entrypoint, args, mounts, envs, rootfs, stdin, stdout, stderr).Exec(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
 func TestSolver(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Compiler Suite")
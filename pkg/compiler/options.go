@@ -58,6 +58,23 @@ func WithFinalRepository(r string) func(cfg *types.CompilerOptions) error {
 	}
 }
 
+// WithSBOM sets the format of the SBOM documents
+// generated alongside the artifacts
+func WithSBOM(f string) func(cfg *types.CompilerOptions) error {
+	return func(cfg *types.CompilerOptions) error {
+		cfg.SBOMFormat = f
+		return nil
+	}
+}
+
+// WithArch sets the architecture to build the packages for
+func WithArch(a string) func(cfg *types.CompilerOptions) error {
+	return func(cfg *types.CompilerOptions) error {
+		cfg.Arch = a
+		return nil
+	}
+}
+
 func EnableGenerateFinalImages(cfg *types.CompilerOptions) error {
 	cfg.GenerateFinalImages = true
 	return nil
@@ -141,6 +158,30 @@ func Rebuild(b bool) func(cfg *types.CompilerOptions) error {
 	}
 }
 
+// KeepGoing keeps building after a failure, skipping only the packages depending on the failed ones
+func KeepGoing(b bool) func(cfg *types.CompilerOptions) error {
+	return func(cfg *types.CompilerOptions) error {
+		cfg.KeepGoing = b
+		return nil
+	}
+}
+
+// Reproducible generates reproducible artifacts, with the modification times clamped to SOURCE_DATE_EPOCH
+func Reproducible(b bool) func(cfg *types.CompilerOptions) error {
+	return func(cfg *types.CompilerOptions) error {
+		cfg.Reproducible = b
+		return nil
+	}
+}
+
+// SkipTests disables the test phase of the packages
+func SkipTests(b bool) func(cfg *types.CompilerOptions) error {
+	return func(cfg *types.CompilerOptions) error {
+		cfg.SkipTests = b
+		return nil
+	}
+}
+
 func PushImages(b bool) func(cfg *types.CompilerOptions) error {
 	return func(cfg *types.CompilerOptions) error {
 		cfg.Push = b
@@ -193,6 +234,22 @@ func WithCompressionType(t types.CompressionImplementation) func(cfg *types.Comp
 	}
 }
 
+// WithCompressionLevel sets the level of the compression of the artifacts, 0 for the default one
+func WithCompressionLevel(l int) func(cfg *types.CompilerOptions) error {
+	return func(cfg *types.CompilerOptions) error {
+		cfg.CompressionLevel = l
+		return nil
+	}
+}
+
+// WithSourcesCache sets the directory where the sources of the packages are cached
+func WithSourcesCache(dir string) func(cfg *types.CompilerOptions) error {
+	return func(cfg *types.CompilerOptions) error {
+		cfg.SourcesCachePath = dir
+		return nil
+	}
+}
+
 func WithSolverOptions(c types.LuetSolverOptions) func(cfg *types.CompilerOptions) error {
 	return func(cfg *types.CompilerOptions) error {
 		cfg.SolverOptions = c
@@ -0,0 +1,208 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package compiler
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/mudler/luet/pkg/compiler/backend"
+	"github.com/pkg/errors"
+)
+
+const (
+	StatusSuccess = "success"
+	StatusFailed  = "failed"
+	StatusSkipped = "skipped"
+
+	ReportJSON  = "json"
+	ReportJUnit = "junit"
+)
+
+// PackageBuildReport is the outcome of the build of a package image
+type PackageBuildReport struct {
+	Package  string `json:"package"`
+	Name     string `json:"name"`
+	Category string `json:"category"`
+	Version  string `json:"version"`
+	// Target is true if the package was requested, false if it was built as a dependency
+	Target bool   `json:"target"`
+	Status string `json:"status"`
+	// Duration of the build, in seconds
+	Duration float64 `json:"duration"`
+	// CacheHit is true if the package image was already available before the build
+	CacheHit     bool   `json:"cache_hit"`
+	PackageImage string `json:"package_image_hash"`
+	BuilderImage string `json:"builder_image_hash"`
+	Artifact     string `json:"artifact,omitempty"`
+	ArtifactSize int64  `json:"artifact_size,omitempty"`
+	Error        string `json:"error,omitempty"`
+	// Output is the backend output of failed builds
+	Output string `json:"output,omitempty"`
+	// Tests is the status of the test phase of the package, empty if the package has no tests
+	Tests string `json:"tests,omitempty"`
+}
+
+// BuildReport is the outcome of the builds run by a compiler
+type BuildReport struct {
+	Packages []PackageBuildReport `json:"packages"`
+
+	mu sync.Mutex
+}
+
+// Count returns the number of package images with the given status
+func (r *BuildReport) Count(status string) int {
+	n := 0
+	for _, p := range r.Packages {
+		if p.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *BuildReport) add(g *BuildGraph) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, s := range g.steps {
+		p := s.spec.GetPackage()
+		res := PackageBuildReport{
+			Package:      p.HumanReadableString(),
+			Name:         p.GetName(),
+			Category:     p.GetCategory(),
+			Version:      p.GetVersion(),
+			Target:       s.target,
+			Status:       s.status,
+			Duration:     s.duration.Seconds(),
+			CacheHit:     s.cached,
+			PackageImage: s.hash,
+			BuilderImage: s.builderHash,
+			Tests:        s.tests,
+		}
+
+		if s.artifact != nil && s.artifact.Path != "" {
+			res.Artifact = s.artifact.Path
+			if info, err := os.Stat(s.artifact.Path); err == nil {
+				res.ArtifactSize = info.Size()
+			}
+		}
+
+		switch s.status {
+		case StatusFailed:
+			res.Error = s.err.Error()
+			var cmdErr *backend.CommandError
+			if errors.As(s.err, &cmdErr) {
+				res.Output = cmdErr.Output
+			}
+		case StatusSkipped:
+			// Find the failed image which prevented the build, if any
+			if failed := s.failedPrerequisite(); failed != nil {
+				res.Error = fmt.Sprintf("%s failed to build", failed.spec.GetPackage().HumanReadableString())
+			}
+		}
+
+		r.Packages = append(r.Packages, res)
+	}
+}
+
+// JSON returns the report in JSON
+func (r *BuildReport) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Content string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr,omitempty"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+// JUnit returns the report as a JUnit XML document, where each package image is a test case
+func (r *BuildReport) JUnit() ([]byte, error) {
+	suite := junitTestSuite{
+		Name:     "luet build",
+		Tests:    len(r.Packages),
+		Failures: r.Count(StatusFailed),
+		Skipped:  r.Count(StatusSkipped),
+	}
+
+	total := 0.0
+	for _, p := range r.Packages {
+		total += p.Duration
+		tc := junitTestCase{
+			Name:      fmt.Sprintf("%s-%s", p.Name, p.Version),
+			Classname: p.Category,
+			Time:      fmt.Sprintf("%.3f", p.Duration),
+		}
+		switch p.Status {
+		case StatusFailed:
+			tc.Failure = &junitFailure{Message: p.Error, Content: p.Output}
+		case StatusSkipped:
+			tc.Skipped = &junitSkipped{Message: p.Error}
+		}
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+	suite.Time = fmt.Sprintf("%.3f", total)
+
+	dat, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), dat...), nil
+}
+
+// WriteToFile writes the report to a file in the given format (json, junit)
+func (r *BuildReport) WriteToFile(path, format string) error {
+	var dat []byte
+	var err error
+	switch format {
+	case ReportJSON, "":
+		dat, err = r.JSON()
+	case ReportJUnit:
+		dat, err = r.JUnit()
+	default:
+		return fmt.Errorf("invalid report format '%s' (available: json, junit)", format)
+	}
+	if err != nil {
+		return errors.Wrap(err, "while generating the build report")
+	}
+	return ioutil.WriteFile(path, dat, 0644)
+}
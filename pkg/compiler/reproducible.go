@@ -0,0 +1,158 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package compiler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+	artifact "github.com/mudler/luet/pkg/api/core/types/artifact"
+	"github.com/mudler/luet/pkg/compiler/backend"
+	"github.com/pkg/errors"
+)
+
+// ReproducibilityResult is the outcome of the reproducibility check of a package
+type ReproducibilityResult struct {
+	Package string `json:"package"`
+	// Artifacts are the artifacts of the two builds
+	Artifacts []string `json:"artifacts"`
+	// IdenticalArchives is true if the artifacts have the same checksum
+	IdenticalArchives bool                `json:"identical_archives"`
+	Differences       []artifact.FileDiff `json:"differences,omitempty"`
+}
+
+// Reproducible returns true if the two builds produced the same files
+func (r *ReproducibilityResult) Reproducible() bool {
+	return len(r.Differences) == 0
+}
+
+// VerifyReproducible builds the specs twice, in the build-1 and build-2 folders of dst,
+// without reusing any package image, and compares the files of the resulting artifacts.
+func (cs *LuetCompiler) VerifyReproducible(keepPermissions bool, dst string, ps *types.LuetCompilationspecs) ([]*ReproducibilityResult, error) {
+	// Both builds tag the images in the same new repository, as its name ends up in the
+	// generated Dockerfiles. The images are removed after each build.
+	repository := fmt.Sprintf("%s-repro-%d", cs.Options.PushImageRepository, time.Now().UnixNano())
+
+	builds := [][]*artifact.PackageArtifact{}
+	for i := 1; i <= 2; i++ {
+		cs.Options.Context.Info(fmt.Sprintf(":repeat: Reproducibility build %d/2", i))
+		artifacts, err := cs.isolatedBuild(keepPermissions, repository, filepath.Join(dst, fmt.Sprintf("build-%d", i)), ps)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reproducibility build %d failed", i)
+		}
+		builds = append(builds, artifacts)
+	}
+
+	second := map[string]*artifact.PackageArtifact{}
+	for _, a := range builds[1] {
+		if a.CompileSpec != nil {
+			second[a.CompileSpec.GetPackage().GetFingerPrint()] = a
+		}
+	}
+
+	res := []*ReproducibilityResult{}
+	for _, a := range builds[0] {
+		if a.CompileSpec == nil || a.Path == "" {
+			continue
+		}
+		p := a.CompileSpec.GetPackage()
+		b, ok := second[p.GetFingerPrint()]
+		if !ok {
+			return nil, fmt.Errorf("no artifact for %s in the second build", p.HumanReadableString())
+		}
+
+		diff, err := a.Diff(b)
+		if err != nil {
+			return nil, errors.Wrapf(err, "while comparing the artifacts of %s", p.HumanReadableString())
+		}
+		if err := a.Hash(); err != nil {
+			return nil, err
+		}
+		if err := b.Hash(); err != nil {
+			return nil, err
+		}
+
+		res = append(res, &ReproducibilityResult{
+			Package:           p.HumanReadableString(),
+			Artifacts:         []string{a.Path, b.Path},
+			IdenticalArchives: a.Checksums.Compare(b.Checksums) == nil,
+			Differences:       diff,
+		})
+	}
+	return res, nil
+}
+
+// isolatedBuild builds the specs in dst, tagging the images in the given repository. Images available
+// in the backend or in remote repositories are not reused, and the images built are removed once done.
+func (cs *LuetCompiler) isolatedBuild(keepPermissions bool, repository, dst string, ps *types.LuetCompilationspecs) ([]*artifact.PackageArtifact, error) {
+	opts := cs.Options
+	opts.PushImageRepository = repository
+	opts.PullImageRepository = nil
+	opts.PullFirst = false
+	opts.Push = false
+	opts.PushFinalImages = false
+	opts.GenerateFinalImages = false
+	opts.KeepImg = true
+	// Tests don't change the artifacts
+	opts.SkipTests = true
+
+	switch cs.Backend.(type) {
+	case *backend.SimpleDocker, *backend.SimpleImg:
+		// Don't reuse the layers of previous builds
+		opts.BackendArgs = append(append([]string{}, cs.Options.BackendArgs...), "--no-cache")
+	}
+
+	c := &LuetCompiler{Backend: cs.Backend, Database: cs.Database, Options: opts, report: &BuildReport{}}
+
+	if err := os.MkdirAll(dst, os.ModePerm); err != nil {
+		return nil, errors.Wrap(err, "while creating the build destination")
+	}
+
+	specs := types.NewLuetCompilationspecs()
+	for _, p := range ps.All() {
+		spec, err := c.FromPackage(p.GetPackage())
+		if err != nil {
+			return nil, err
+		}
+		// Don't look up the images in the repositories of the package metadata
+		spec.BuildOptions.PullImageRepository = nil
+		spec.SetOutputPath(dst)
+		specs.Add(spec)
+	}
+
+	defer func() {
+		for _, r := range c.report.Packages {
+			for _, hash := range []string{r.PackageImage, r.BuilderImage} {
+				img := fmt.Sprintf("%s:%s", opts.PushImageRepository, hash)
+				if hash == "" || !c.Backend.ImageExists(img) {
+					continue
+				}
+				if err := c.Backend.RemoveImage(backend.Options{ImageName: img}); err != nil {
+					c.Options.Context.Warning("Could not remove image ", img)
+				}
+			}
+		}
+	}()
+
+	artifacts, errs := c.CompileParallel(keepPermissions, specs)
+	if len(errs) != 0 {
+		return nil, errs[0]
+	}
+	return artifacts, nil
+}
@@ -0,0 +1,105 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package compiler_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	. "github.com/mudler/luet/pkg/compiler"
+	sd "github.com/mudler/luet/pkg/compiler/backend"
+	pkg "github.com/mudler/luet/pkg/database"
+	"github.com/mudler/luet/pkg/tree"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Reproducibility", func() {
+	ctx := context.NewContext()
+	var tmpdir string
+
+	BeforeEach(func() {
+		var err error
+		tmpdir, err = ioutil.TempDir("", "reproducible")
+		Expect(err).ToNot(HaveOccurred())
+
+		// The generated Dockerfiles are part of the artifacts, so the build time
+		// in the environment of f makes it not reproducible
+		for name, env := range map[string]string{
+			"e": "FOO=bar",
+			"f": `BUILD_TIME={{ now | date "150405.000000000" }}`,
+		} {
+			dir := filepath.Join(tmpdir, "tree", name)
+			Expect(os.MkdirAll(dir, os.ModePerm)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(dir, "definition.yaml"), []byte("category: test\nname: "+name+"\nversion: \"1.0\"\n"), os.ModePerm)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(dir, "build.yaml"), []byte("image: \"scratch\"\nunpack: true\nreproducible: true\nenv:\n- "+env+"\n"), os.ModePerm)).To(Succeed())
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpdir)
+	})
+
+	verify := func(name string) ([]*ReproducibilityResult, string) {
+		generalRecipe := tree.NewCompilerRecipe(pkg.NewInMemoryDatabase(false))
+		Expect(generalRecipe.Load(filepath.Join(tmpdir, "tree"))).To(Succeed())
+
+		lc := NewLuetCompiler(sd.NewSimpleBoxBackend(ctx, filepath.Join(tmpdir, "images")), generalRecipe.GetDatabase(),
+			WithContext(ctx), Concurrency(1))
+		spec, err := lc.FromPackage(&types.Package{Category: "test", Name: name, Version: "1.0"})
+		Expect(err).ToNot(HaveOccurred())
+		spec.SetOutputPath(filepath.Join(tmpdir, "build"))
+
+		dst := filepath.Join(tmpdir, "reproducibility")
+		res, err := lc.VerifyReproducible(false, dst, types.NewLuetCompilationspecs(spec))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(res)).To(Equal(1))
+		return res, dst
+	}
+
+	It("builds twice and compares the artifacts", func() {
+		res, dst := verify("e")
+
+		Expect(res[0].Package).To(Equal("test/e-1.0"))
+		Expect(res[0].Artifacts).To(Equal([]string{
+			filepath.Join(dst, "build-1", "e-test-1.0.package.tar"),
+			filepath.Join(dst, "build-2", "e-test-1.0.package.tar"),
+		}))
+		Expect(res[0].Reproducible()).To(BeTrue())
+		Expect(res[0].IdenticalArchives).To(BeTrue())
+
+		// The images of the two builds are not kept
+		index, err := ioutil.ReadFile(filepath.Join(tmpdir, "images", "index.json"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(index)).ToNot(ContainSubstring("repro"))
+	})
+
+	It("reports the files which differ", func() {
+		res, _ := verify("f")
+
+		Expect(res[0].Reproducible()).To(BeFalse())
+		Expect(res[0].IdenticalArchives).To(BeFalse())
+		paths := []string{}
+		for _, d := range res[0].Differences {
+			paths = append(paths, d.Path)
+			Expect(d.Changes).To(ConsistOf(HavePrefix("content: sha256")))
+		}
+		Expect(paths).To(Equal([]string{"/luetbuild/f-test-1.0-builder.dockerfile", "/luetbuild/f-test-1.0.dockerfile"}))
+	})
+})
@@ -0,0 +1,159 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package compiler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cavaliercoder/grab"
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/mudler/luet/pkg/helpers"
+	fileHelper "github.com/mudler/luet/pkg/helpers/file"
+	"github.com/mudler/luet/pkg/installer/client"
+	"github.com/pkg/errors"
+)
+
+// SourceCache is a content addressed cache of the sources of the compilation specs,
+// shared by all the packages and indexed by the sha256 checksum of the sources
+type SourceCache struct {
+	dir     string
+	context types.Context
+}
+
+func NewSourceCache(ctx types.Context, dir string) *SourceCache {
+	return &SourceCache{dir: dir, context: ctx}
+}
+
+// Path returns the path of the source in the cache
+func (c *SourceCache) Path(s types.SourceField) string {
+	return filepath.Join(c.dir, "sha256", strings.ToLower(s.SHA256))
+}
+
+func verifySource(path string, s types.SourceField) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return errors.Wrap(err, "while reading "+path)
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != strings.ToLower(s.SHA256) {
+		return fmt.Errorf("checksum mismatch for %s: expected sha256 %s, got %s", s.URL, s.SHA256, sum)
+	}
+	return nil
+}
+
+// Fetch downloads the source in the cache, unless it is already there, and verifies
+// its checksum. It returns the path of the source in the cache.
+func (c *SourceCache) Fetch(s types.SourceField) (string, error) {
+	if err := s.Validate(); err != nil {
+		return "", err
+	}
+
+	dst := c.Path(s)
+	if fileHelper.Exists(dst) {
+		err := verifySource(dst, s)
+		if err == nil {
+			c.context.Debug("Source", s.URL, "found in cache")
+			return dst, nil
+		}
+		c.context.Warning("Invalid source in cache, downloading it again:", err.Error())
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return "", err
+	}
+	// Download in the cache directory, so the source can be atomically moved in place
+	tmp, err := ioutil.TempDir(filepath.Dir(dst), ".download")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	c.context.Info(":arrow_down: Downloading source", s.URL)
+	req, err := grab.NewRequest(filepath.Join(tmp, "source"), s.URL)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid source url '%s'", s.URL)
+	}
+	req.NoResume = true
+
+	resp := client.NewGrabClient(c.context.GetConfig().General.HTTPTimeout).Do(req)
+	if err := resp.Err(); err != nil {
+		return "", errors.Wrapf(err, "failed downloading %s", s.URL)
+	}
+
+	if err := verifySource(resp.Filename, s); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(resp.Filename, 0644); err != nil {
+		return "", err
+	}
+	return dst, os.Rename(resp.Filename, dst)
+}
+
+// Inject fetches the source and copies it in the build context dir,
+// extracting it if the source requires so
+func (c *SourceCache) Inject(s types.SourceField, dir string) error {
+	src, err := c.Fetch(s)
+	if err != nil {
+		return err
+	}
+
+	dst := filepath.Join(dir, s.FileName())
+	if s.Extract {
+		if err := os.MkdirAll(dst, os.ModePerm); err != nil {
+			return err
+		}
+		return errors.Wrapf(helpers.Untar(src, dst), "failed extracting %s", s.URL)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return err
+	}
+	return fileHelper.CopyFile(src, dst)
+}
+
+func (cs *LuetCompiler) sourceCache() *SourceCache {
+	dir := cs.Options.SourcesCachePath
+	if dir == "" {
+		dir = filepath.Join(cs.Options.Context.GetConfig().System.PkgsCachePath, "sources")
+	}
+	return NewSourceCache(cs.Options.Context, dir)
+}
+
+// FetchSources downloads the sources of the compilation specs in the cache,
+// so the packages can be built later without network access
+func (cs *LuetCompiler) FetchSources(ps ...*types.LuetCompilationSpec) error {
+	c := cs.sourceCache()
+	for _, p := range ps {
+		for _, s := range p.Sources {
+			if _, err := c.Fetch(s); err != nil {
+				return errors.Wrapf(err, "failed fetching sources of %s", p.GetPackage().HumanReadableString())
+			}
+		}
+	}
+	return nil
+}
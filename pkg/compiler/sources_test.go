@@ -0,0 +1,166 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package compiler_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/mudler/luet/pkg/api/core/types/artifact"
+	. "github.com/mudler/luet/pkg/compiler"
+	sd "github.com/mudler/luet/pkg/compiler/backend"
+	pkg "github.com/mudler/luet/pkg/database"
+	"github.com/mudler/luet/pkg/helpers"
+	fileHelper "github.com/mudler/luet/pkg/helpers/file"
+	"github.com/mudler/luet/pkg/tree"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Sources", func() {
+	ctx := context.NewContext()
+	var tmpdir, hello, tarball string
+	var server *httptest.Server
+	var requests int32
+
+	checksum := func(path string) string {
+		data, err := ioutil.ReadFile(path)
+		Expect(err).ToNot(HaveOccurred())
+		sum := sha256.Sum256(data)
+		return hex.EncodeToString(sum[:])
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmpdir, err = ioutil.TempDir("", "sources")
+		Expect(err).ToNot(HaveOccurred())
+
+		srv := filepath.Join(tmpdir, "srv")
+		Expect(os.MkdirAll(filepath.Join(srv, "payload"), os.ModePerm)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(srv, "hello.txt"), []byte("hello"), 0644)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(srv, "payload", "inner.txt"), []byte("inner"), 0644)).To(Succeed())
+		Expect(helpers.Tar(filepath.Join(srv, "payload"), filepath.Join(srv, "payload.tar"))).To(Succeed())
+		hello = checksum(filepath.Join(srv, "hello.txt"))
+		tarball = checksum(filepath.Join(srv, "payload.tar"))
+
+		atomic.StoreInt32(&requests, 0)
+		files := http.FileServer(http.Dir(srv))
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			files.ServeHTTP(w, r)
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(tmpdir)
+	})
+
+	It("downloads the sources once in the cache", func() {
+		cache := NewSourceCache(ctx, filepath.Join(tmpdir, "cache"))
+		source := types.SourceField{URL: server.URL + "/hello.txt", SHA256: hello}
+
+		path, err := cache.Fetch(source)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(path).To(Equal(filepath.Join(tmpdir, "cache", "sha256", hello)))
+		Expect(fileHelper.Read(path)).To(Equal("hello"))
+
+		_, err = cache.Fetch(source)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(atomic.LoadInt32(&requests)).To(Equal(int32(1)))
+
+		// Sources are downloaded again if the cache content is corrupted
+		Expect(ioutil.WriteFile(path, []byte("corrupted"), 0644)).To(Succeed())
+		_, err = cache.Fetch(source)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(atomic.LoadInt32(&requests)).To(Equal(int32(2)))
+		Expect(fileHelper.Read(path)).To(Equal("hello"))
+	})
+
+	It("refuses sources with a wrong checksum", func() {
+		cache := NewSourceCache(ctx, filepath.Join(tmpdir, "cache"))
+
+		_, err := cache.Fetch(types.SourceField{URL: server.URL + "/hello.txt", SHA256: tarball})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("checksum mismatch"))
+		Expect(fileHelper.Exists(filepath.Join(tmpdir, "cache", "sha256", tarball))).To(BeFalse())
+
+		_, err = cache.Fetch(types.SourceField{URL: server.URL + "/missing.txt", SHA256: tarball})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("injects the sources in the build context", func() {
+		cache := NewSourceCache(ctx, filepath.Join(tmpdir, "cache"))
+		dir := filepath.Join(tmpdir, "context")
+
+		Expect(cache.Inject(types.SourceField{URL: server.URL + "/hello.txt", SHA256: hello}, dir)).To(Succeed())
+		Expect(cache.Inject(types.SourceField{URL: server.URL + "/hello.txt", SHA256: hello, Destination: "files/foo"}, dir)).To(Succeed())
+		Expect(cache.Inject(types.SourceField{URL: server.URL + "/payload.tar", SHA256: tarball, Extract: true, Destination: "src"}, dir)).To(Succeed())
+
+		Expect(fileHelper.Read(filepath.Join(dir, "hello.txt"))).To(Equal("hello"))
+		Expect(fileHelper.Read(filepath.Join(dir, "files", "foo"))).To(Equal("hello"))
+		Expect(fileHelper.Read(filepath.Join(dir, "src", "inner.txt"))).To(Equal("inner"))
+	})
+
+	It("builds packages with sources", func() {
+		dir := filepath.Join(tmpdir, "tree", "a")
+		Expect(os.MkdirAll(dir, os.ModePerm)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(dir, "definition.yaml"), []byte("category: test\nname: a\nversion: \"1.0\"\n"), os.ModePerm)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(dir, "build.yaml"), []byte(`image: "scratch"
+unpack: true
+sources:
+- url: `+server.URL+`/hello.txt
+  sha256: "`+hello+`"
+  destination: files/hello.txt
+- url: `+server.URL+`/payload.tar
+  sha256: "`+tarball+`"
+  extract: true
+`), os.ModePerm)).To(Succeed())
+
+		generalRecipe := tree.NewCompilerRecipe(pkg.NewInMemoryDatabase(false))
+		Expect(generalRecipe.Load(filepath.Join(tmpdir, "tree"))).To(Succeed())
+
+		lc := NewLuetCompiler(sd.NewSimpleBoxBackend(ctx, filepath.Join(tmpdir, "images")), generalRecipe.GetDatabase(),
+			WithContext(ctx), Concurrency(1), WithSourcesCache(filepath.Join(tmpdir, "cache")))
+		spec, err := lc.FromPackage(&types.Package{Category: "test", Name: "a", Version: "1.0"})
+		Expect(err).ToNot(HaveOccurred())
+		spec.SetOutputPath(filepath.Join(tmpdir, "build"))
+
+		// Sources fetched in advance don't need the network to build the package
+		Expect(lc.FetchSources(spec)).To(Succeed())
+		server.Close()
+
+		a, err := lc.Compile(false, spec)
+		Expect(err).ToNot(HaveOccurred())
+
+		files, err := a.FileList()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(files).To(ContainElements("luetbuild/files/hello.txt", "luetbuild/inner.txt"))
+
+		unpacked := filepath.Join(tmpdir, "unpacked")
+		Expect(os.MkdirAll(unpacked, os.ModePerm)).To(Succeed())
+		Expect(artifact.NewPackageArtifact(a.Path).Unpack(ctx, unpacked, false)).To(Succeed())
+		Expect(fileHelper.Read(filepath.Join(unpacked, "luetbuild", "files", "hello.txt"))).To(Equal("hello"))
+	})
+})
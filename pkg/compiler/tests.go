@@ -0,0 +1,212 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package compiler
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/mudler/luet/pkg/api/core/types/artifact"
+	"github.com/mudler/luet/pkg/compiler/backend"
+	fileHelper "github.com/mudler/luet/pkg/helpers/file"
+	"github.com/pkg/errors"
+)
+
+// TestError is returned when the tests of a package fail
+type TestError struct {
+	Package string
+	Err     error
+}
+
+func (e *TestError) Error() string {
+	return fmt.Sprintf("tests of %s failed: %s", e.Package, e.Err.Error())
+}
+
+func (e *TestError) Unwrap() error {
+	return e.Err
+}
+
+// runtimeDependencies returns the runtime dependencies of the package, resolved
+// in the runtime database
+func (cs *LuetCompiler) runtimeDependencies(p *types.LuetCompilationSpec) (types.Packages, error) {
+	if cs.Options.RuntimeDatabase == nil {
+		cs.Options.Context.Debug("No runtime db present, testing", p.GetPackage().HumanReadableString(), "without its runtime dependencies")
+		return nil, nil
+	}
+
+	runtime, err := cs.Options.RuntimeDatabase.FindPackage(p.GetPackage())
+	if err != nil {
+		cs.Options.Context.Debug(p.GetPackage().HumanReadableString(), "not found in the runtime db, testing it without its runtime dependencies")
+		return nil, nil
+	}
+
+	t, err := cs.ComputeDepTree(&types.LuetCompilationSpec{Package: runtime}, cs.Options.RuntimeDatabase)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed resolving runtime dependencies")
+	}
+
+	var deps types.Packages
+	for _, a := range t {
+		if !a.Value || a.Package.Matches(p.GetPackage()) {
+			continue
+		}
+		deps = append(deps, a.Package)
+	}
+	return deps, nil
+}
+
+// addRuntimeDependencies adds to the graph the runtime dependencies of the packages
+// having tests, so their artifacts are available before the tests are run
+func (cs *LuetCompiler) addRuntimeDependencies(keepPermissions bool, g *BuildGraph) error {
+	if cs.Options.SkipTests {
+		return nil
+	}
+
+	wantsArtifact := true
+	done := map[*buildStep]interface{}{}
+	// Steps added for the runtime dependencies can have tests as well
+	for added := true; added; {
+		added = false
+		for _, s := range append([]*buildStep{}, g.steps...) {
+			if _, ok := done[s]; ok || !s.generateArtifact || !s.spec.HasTests() {
+				continue
+			}
+			done[s] = nil
+			added = true
+
+			deps, err := cs.runtimeDependencies(s.spec)
+			if err != nil {
+				return err
+			}
+			for _, d := range deps {
+				spec, err := cs.FromPackage(d)
+				if err != nil {
+					return errors.Wrap(err, "Error while generating compilespec for "+d.GetName())
+				}
+				spec.BuildOptions.PullImageRepository = append(spec.BuildOptions.PullImageRepository, s.spec.BuildOptions.PullImageRepository...)
+				spec.SetOutputPath(s.spec.GetOutputPath())
+
+				plan, err := cs.planCompilation(cs.Options.Concurrency, keepPermissions, &wantsArtifact, nil, spec)
+				if err != nil {
+					return errors.Wrapf(err, "failed planning runtime dependency %s of %s", d.HumanReadableString(), s.spec.GetPackage().HumanReadableString())
+				}
+				if !plan[len(plan)-1].target {
+					return fmt.Errorf("runtime dependency %s of %s is not built, tests can't be run", d.HumanReadableString(), s.spec.GetPackage().HumanReadableString())
+				}
+				g.addRuntime(s, plan)
+			}
+		}
+	}
+	return nil
+}
+
+// dependencyArtifact returns the artifact of a runtime dependency of the package
+// from the output folder, where the build graph generated it
+func (cs *LuetCompiler) dependencyArtifact(p *types.LuetCompilationSpec, d *types.Package) (*artifact.PackageArtifact, error) {
+	metadata := filepath.Join(p.GetOutputPath(), d.GetMetadataFilePath())
+	if !fileHelper.Exists(metadata) {
+		return nil, fmt.Errorf("no artifact found for %s in %s", d.HumanReadableString(), p.GetOutputPath())
+	}
+	dat, err := ioutil.ReadFile(metadata)
+	if err != nil {
+		return nil, err
+	}
+	a, err := artifact.NewPackageArtifactFromYaml(dat)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid metadata "+metadata)
+	}
+	a.Path = filepath.Join(p.GetOutputPath(), filepath.Base(a.Path))
+	if !fileHelper.Exists(a.Path) {
+		return nil, fmt.Errorf("no artifact found for %s in %s", d.HumanReadableString(), p.GetOutputPath())
+	}
+	return a, nil
+}
+
+// runTests runs the test phase of the package in a container holding the artifact
+// and the runtime dependencies of the package. The artifact is removed if the tests fail.
+func (cs *LuetCompiler) runTests(keepPermissions bool, a *artifact.PackageArtifact, p *types.LuetCompilationSpec, log io.Writer) error {
+	if !p.HasTests() {
+		return nil
+	}
+
+	pkgTag := ":package: " + p.GetPackage().HumanReadableString()
+	if cs.Options.SkipTests {
+		cs.Options.Context.Warning(pkgTag, "   :fast_forward: Skipping tests")
+		return nil
+	}
+
+	cs.Options.Context.Info(pkgTag, "   :test_tube: Running tests")
+	if err := cs.testArtifact(keepPermissions, a, p, log); err != nil {
+		os.RemoveAll(a.Path)
+		return &TestError{Package: p.GetPackage().HumanReadableString(), Err: err}
+	}
+	cs.Options.Context.Success(pkgTag, "   :white_check_mark: Tests passed")
+	return nil
+}
+
+func (cs *LuetCompiler) testArtifact(keepPermissions bool, a *artifact.PackageArtifact, p *types.LuetCompilationSpec, log io.Writer) error {
+	testDir, err := cs.Options.Context.TempDir("test")
+	if err != nil {
+		return errors.Wrap(err, "could not create tempdir")
+	}
+	defer os.RemoveAll(testDir)
+
+	rootfs := filepath.Join(testDir, "rootfs")
+	if err := os.MkdirAll(rootfs, os.ModePerm); err != nil {
+		return err
+	}
+
+	deps, err := cs.runtimeDependencies(p)
+	if err != nil {
+		return err
+	}
+	for _, d := range deps {
+		cs.Options.Context.Debug("Adding runtime dependency", d.HumanReadableString(), "to the tests of", p.GetPackage().HumanReadableString())
+		da, err := cs.dependencyArtifact(p, d)
+		if err != nil {
+			return errors.Wrapf(err, "missing runtime dependency %s", d.HumanReadableString())
+		}
+		if err := da.Unpack(cs.Options.Context, rootfs, keepPermissions); err != nil {
+			return errors.Wrapf(err, "failed unpacking runtime dependency %s", d.HumanReadableString())
+		}
+	}
+
+	if err := a.Unpack(cs.Options.Context, rootfs, keepPermissions); err != nil {
+		return errors.Wrap(err, "failed unpacking artifact")
+	}
+
+	dockerfile := p.GetPackage().ImageID() + "-test.dockerfile"
+	if err := ioutil.WriteFile(filepath.Join(testDir, dockerfile), []byte(p.RenderTestImage()), 0644); err != nil {
+		return errors.Wrap(err, "could not generate test image definition")
+	}
+
+	opts := backend.Options{
+		ImageName:      fmt.Sprintf("%s:%s-test", cs.Options.PushImageRepository, p.GetPackage().ImageID()),
+		SourcePath:     testDir,
+		DockerFileName: dockerfile,
+		BackendArgs:    cs.Options.BackendArgs,
+		Platform:       platform(p.GetPackage()),
+		Log:            log,
+	}
+	// The image is needed only to run the tests
+	defer cs.Backend.RemoveImage(opts)
+
+	return cs.Backend.BuildImage(opts)
+}
@@ -0,0 +1,210 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package compiler_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	. "github.com/mudler/luet/pkg/compiler"
+	sd "github.com/mudler/luet/pkg/compiler/backend"
+	pkg "github.com/mudler/luet/pkg/database"
+	fileHelper "github.com/mudler/luet/pkg/helpers/file"
+	"github.com/mudler/luet/pkg/tree"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// copyShell copies the host shell and its libraries to dst, so the test
+// steps can run in an image built from scratch
+func copyShell(dst string) {
+	files := []string{"/bin/sh"}
+	out, _ := exec.Command("ldd", "/bin/sh").Output()
+	for _, l := range strings.Split(string(out), "\n") {
+		for _, f := range strings.Fields(l) {
+			if filepath.IsAbs(f) {
+				files = append(files, f)
+			}
+		}
+	}
+
+	for _, f := range files {
+		src, err := filepath.EvalSymlinks(f)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fileHelper.CopyFile(src, filepath.Join(dst, f))).To(Succeed())
+	}
+}
+
+var _ = Describe("Tests", func() {
+	ctx := context.NewContext()
+	var tmpdir string
+
+	// setTests replaces the test phase of app
+	setTests := func(steps ...string) {
+		def := "image: \"scratch\"\nunpack: true\ntest:\n  steps:\n"
+		for _, s := range steps {
+			def += "  - " + s + "\n"
+		}
+		Expect(ioutil.WriteFile(filepath.Join(tmpdir, "tree", "app", "build.yaml"), []byte(def), os.ModePerm)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmpdir, err = ioutil.TempDir("", "tests")
+		Expect(err).ToNot(HaveOccurred())
+
+		// app depends on dep at runtime, and its tests always fail
+		// as their environment can't be parsed. dep ships a shell
+		// to run the test steps.
+		for name, def := range map[string][2]string{
+			"dep": {"", "env:\n- DEP=1\npackage_dir: /luetbuild/rootfs\n"},
+			"app": {
+				"requires:\n- category: test\n  name: dep\n  version: \">=0\"\n",
+				"test:\n  env:\n  - FOO=\"broken\n  steps:\n  - /bin/true\n",
+			},
+		} {
+			dir := filepath.Join(tmpdir, "tree", name)
+			Expect(os.MkdirAll(dir, os.ModePerm)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(dir, "definition.yaml"), []byte("category: test\nname: "+name+"\nversion: \"1.0\"\n"+def[0]), os.ModePerm)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(dir, "build.yaml"), []byte("image: \"scratch\"\nunpack: true\n"+def[1]), os.ModePerm)).To(Succeed())
+		}
+		copyShell(filepath.Join(tmpdir, "tree", "dep", "rootfs"))
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpdir)
+	})
+
+	build := func(opts ...types.CompilerOption) (*LuetCompiler, error) {
+		generalRecipe := tree.NewCompilerRecipe(pkg.NewInMemoryDatabase(false))
+		Expect(generalRecipe.Load(filepath.Join(tmpdir, "tree"))).To(Succeed())
+		runtimeRecipe := tree.NewInstallerRecipe(pkg.NewInMemoryDatabase(false))
+		Expect(runtimeRecipe.Load(filepath.Join(tmpdir, "tree"))).To(Succeed())
+
+		lc := NewLuetCompiler(sd.NewSimpleBoxBackend(ctx, filepath.Join(tmpdir, "images")), generalRecipe.GetDatabase(),
+			append([]types.CompilerOption{WithContext(ctx), Concurrency(1), WithRuntimeDatabase(runtimeRecipe.GetDatabase())}, opts...)...)
+		spec, err := lc.FromPackage(&types.Package{Category: "test", Name: "app", Version: "1.0"})
+		Expect(err).ToNot(HaveOccurred())
+		spec.SetOutputPath(filepath.Join(tmpdir, "build"))
+
+		_, errs := lc.CompileParallel(false, types.NewLuetCompilationspecs(spec))
+		if len(errs) != 0 {
+			return lc, errs[0]
+		}
+		return lc, nil
+	}
+
+	It("fails the build if the tests fail", func() {
+		lc, err := build()
+		Expect(err).To(HaveOccurred())
+
+		var testErr *TestError
+		Expect(errors.As(err, &testErr)).To(BeTrue())
+		Expect(testErr.Package).To(Equal("test/app-1.0"))
+
+		// The runtime dependencies are built before running the tests
+		Expect(fileHelper.Exists(filepath.Join(tmpdir, "build", "dep-test-1.0.package.tar"))).To(BeTrue())
+		// and the package is not accepted
+		Expect(fileHelper.Exists(filepath.Join(tmpdir, "build", "app-test-1.0.package.tar"))).To(BeFalse())
+		Expect(fileHelper.Exists(filepath.Join(tmpdir, "build", "app-test-1.0.metadata.yaml"))).To(BeFalse())
+
+		report := lc.BuildReport()
+		Expect(len(report.Packages)).To(Equal(2))
+		for _, p := range report.Packages {
+			switch p.Name {
+			case "dep":
+				Expect(p.Status).To(Equal(StatusSuccess))
+				Expect(p.Tests).To(BeEmpty())
+			case "app":
+				Expect(p.Status).To(Equal(StatusFailed))
+				Expect(p.Tests).To(Equal(StatusFailed))
+			}
+		}
+	})
+
+	It("fails the build if a test step fails", func() {
+		setTests("test -x /bin/sh", "exit 3")
+
+		lc, err := build()
+		Expect(err).To(HaveOccurred())
+
+		var testErr *TestError
+		Expect(errors.As(err, &testErr)).To(BeTrue())
+		Expect(testErr.Package).To(Equal("test/app-1.0"))
+		Expect(err.Error()).To(ContainSubstring("exit status 3"))
+
+		Expect(fileHelper.Exists(filepath.Join(tmpdir, "build", "app-test-1.0.package.tar"))).To(BeFalse())
+		Expect(fileHelper.Exists(filepath.Join(tmpdir, "build", "app-test-1.0.metadata.yaml"))).To(BeFalse())
+
+		for _, p := range lc.BuildReport().Packages {
+			if p.Name == "app" {
+				Expect(p.Status).To(Equal(StatusFailed))
+				Expect(p.Tests).To(Equal(StatusFailed))
+			}
+		}
+	})
+
+	It("accepts the package if the tests pass", func() {
+		// The steps run with the runtime dependencies installed
+		setTests("test -x /bin/sh", "true")
+
+		lc, err := build()
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(fileHelper.Exists(filepath.Join(tmpdir, "build", "app-test-1.0.package.tar"))).To(BeTrue())
+		Expect(fileHelper.Exists(filepath.Join(tmpdir, "build", "app-test-1.0.metadata.yaml"))).To(BeTrue())
+
+		report := lc.BuildReport()
+		Expect(len(report.Packages)).To(Equal(2))
+		for _, p := range report.Packages {
+			Expect(p.Status).To(Equal(StatusSuccess))
+			switch p.Name {
+			case "dep":
+				Expect(p.Tests).To(BeEmpty())
+			case "app":
+				Expect(p.Tests).To(Equal(StatusSuccess))
+			}
+		}
+	})
+
+	It("fails if the runtime dependencies are built from the package", func() {
+		Expect(ioutil.WriteFile(filepath.Join(tmpdir, "tree", "dep", "build.yaml"), []byte("requires:\n- category: test\n  name: app\n  version: \">=0\"\n"), os.ModePerm)).To(Succeed())
+
+		lc, err := build()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(Equal("test/app-1.0 can't be tested: it is needed to build its own runtime dependencies"))
+		Expect(lc.BuildReport().Packages).To(BeEmpty())
+	})
+
+	It("skips the tests", func() {
+		lc, err := build(SkipTests(true))
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(fileHelper.Exists(filepath.Join(tmpdir, "build", "app-test-1.0.metadata.yaml"))).To(BeTrue())
+		Expect(fileHelper.Exists(filepath.Join(tmpdir, "build", "dep-test-1.0.package.tar"))).To(BeFalse())
+
+		report := lc.BuildReport()
+		Expect(len(report.Packages)).To(Equal(1))
+		Expect(report.Packages[0].Status).To(Equal(StatusSuccess))
+		Expect(report.Packages[0].Tests).To(Equal(StatusSkipped))
+	})
+})
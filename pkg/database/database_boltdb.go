@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"sort"
 	"strconv"
 	"sync"
 	"time"
@@ -38,7 +39,7 @@ type BoltDatabase struct {
 	sync.Mutex
 	timeout          time.Duration
 	Path             string
-	ProvidesDatabase map[string]map[string]*types.Package
+	ProvidesDatabase map[string]map[string]types.PackageMap
 }
 
 func checkMigrationSchema(path string) {
@@ -58,7 +59,7 @@ func NewBoltDatabase(path string) types.PackageDatabase {
 
 	return &BoltDatabase{
 		timeout: 30 * time.Second,
-		Path:    path, ProvidesDatabase: map[string]map[string]*types.Package{}}
+		Path:    path, ProvidesDatabase: map[string]map[string]types.PackageMap{}}
 }
 
 func (db *BoltDatabase) Clone(to types.PackageDatabase) error {
@@ -230,48 +231,78 @@ func (db *BoltDatabase) CreatePackage(p *types.Package) (string, error) {
 	// Provides: Store package provides, we will reuse this when walking deps
 	for _, provide := range p.Provides {
 		if _, ok := db.ProvidesDatabase[provide.GetPackageName()]; !ok {
-			db.ProvidesDatabase[provide.GetPackageName()] = make(map[string]*types.Package)
-
+			db.ProvidesDatabase[provide.GetPackageName()] = make(map[string]types.PackageMap)
+		}
+		if _, ok := db.ProvidesDatabase[provide.GetPackageName()][provide.GetVersion()]; !ok {
+			db.ProvidesDatabase[provide.GetPackageName()][provide.GetVersion()] = types.PackageMap{}
 		}
 
-		db.ProvidesDatabase[provide.GetPackageName()][provide.GetVersion()] = p
+		db.ProvidesDatabase[provide.GetPackageName()][provide.GetVersion()][p.GetFingerPrint()] = p
 	}
 
 	return strconv.Itoa(p.ID), err
 }
 
-// Dup from memory implementation
-func (db *BoltDatabase) getProvide(p *types.Package) (*types.Package, error) {
+// getProviders returns the packages providing p, sorted by fingerprint.
+// A package selector matches all the packages providing a version in its range.
+func (db *BoltDatabase) getProviders(p *types.Package) (types.Packages, error) {
 	db.Lock()
-	pa, ok := db.ProvidesDatabase[p.GetPackageName()][p.GetVersion()]
+	versions, ok := db.ProvidesDatabase[p.GetPackageName()]
 	if !ok {
-		versions, ok := db.ProvidesDatabase[p.GetPackageName()]
 		db.Unlock()
+		return nil, errors.New(fmt.Sprintf("No versions found for: %s", p.HumanReadableString()))
+	}
 
-		if !ok {
-			return nil, errors.New(fmt.Sprintf("No versions found for: %s", p.HumanReadableString()))
+	found := types.PackageMap{}
+	for ve, providers := range versions {
+		if !p.MatchProvide(&types.Package{Name: p.GetName(), Category: p.GetCategory(), Version: ve}) {
+			continue
 		}
-
-		for ve, _ := range versions {
-
-			match, err := p.VersionMatchSelector(ve, nil)
-			if err != nil {
-				return nil, errors.Wrap(err, "Error on match version")
-			}
-			if match {
-				pa, ok := db.ProvidesDatabase[p.GetPackageName()][ve]
-				if !ok {
-					return nil, errors.New(fmt.Sprintf("No versions found for: %s", p.HumanReadableString()))
-				}
-				return pa, nil //pick the first (we shouldn't have providers that are conflicting)
-				// TODO: A find dbcall here would recurse, but would give chance to have providers of providers
-			}
+		for fp, pa := range providers {
+			found[fp] = pa
 		}
+	}
+	db.Unlock()
 
+	if len(found) == 0 {
 		return nil, errors.New("No package provides this")
 	}
-	db.Unlock()
-	return db.FindPackage(pa)
+
+	keys := []string{}
+	for fp := range found {
+		keys = append(keys, fp)
+	}
+	sort.Strings(keys)
+
+	bolt, err := storm.Open(db.Path, storm.BoltOptions(0600, &bbolt.Options{Timeout: 30 * time.Second}))
+	if err != nil {
+		return nil, errors.Wrap(err, "Error opening boltdb "+db.Path)
+	}
+	defer bolt.Close()
+
+	providers := types.Packages{}
+	for _, fp := range keys {
+		// Skip providers which were removed from the database
+		pa := &types.Package{}
+		err := bolt.Select(q.Eq("Name", found[fp].GetName()), q.Eq("Category", found[fp].GetCategory()), q.Eq("Version", found[fp].GetVersion())).Limit(1).First(pa)
+		if err != nil {
+			continue
+		}
+		providers = append(providers, pa)
+	}
+	if len(providers) == 0 {
+		return nil, errors.New("No package provides this")
+	}
+
+	return providers, nil
+}
+
+func (db *BoltDatabase) getProvide(p *types.Package) (*types.Package, error) {
+	providers, err := db.getProviders(p)
+	if err != nil {
+		return nil, err
+	}
+	return providers[0], nil
 }
 
 func (db *BoltDatabase) Clean() error {
@@ -382,6 +413,10 @@ func (db *BoltDatabase) FindPackageCandidate(p *types.Package) (*types.Package,
 // FIXME: Optimize, see inmemorydb
 func (db *BoltDatabase) FindPackages(p *types.Package) (types.Packages, error) {
 	if !p.IsSelector() {
+		// Provides: All the packages providing the requested version are candidates
+		if providers, err := db.getProviders(p); err == nil {
+			return providers, nil
+		}
 		pack, err := db.FindPackage(p)
 		if err != nil {
 			return []*types.Package{}, err
@@ -389,15 +424,16 @@ func (db *BoltDatabase) FindPackages(p *types.Package) (types.Packages, error) {
 		return []*types.Package{pack}, nil
 	}
 
-	// Provides: Treat as the replaced package here
-	if provided, err := db.getProvide(p); err == nil {
-		p = provided
-		if !provided.IsSelector() {
-			return types.Packages{provided}, nil
-		}
+	// Provides: All the packages providing a version in the requested range are candidates
+	providers, _ := db.getProviders(p)
+
+	found := map[string]interface{}{}
+	versionsInWorld := types.Packages{}
+	for _, pa := range providers {
+		found[pa.GetFingerPrint()] = nil
+		versionsInWorld = append(versionsInWorld, pa)
 	}
 
-	var versionsInWorld []*types.Package
 	for _, w := range db.World() {
 		if w.GetName() != p.GetName() || w.GetCategory() != p.GetCategory() {
 			continue
@@ -407,11 +443,21 @@ func (db *BoltDatabase) FindPackages(p *types.Package) (types.Packages, error) {
 		if err != nil {
 			return nil, errors.Wrap(err, "Error on match selector")
 		}
-		if match {
-			versionsInWorld = append(versionsInWorld, w)
+		if !match {
+			continue
 		}
+
+		// Replaced versions resolve to their provider
+		if provided, err := db.getProvide(w); err == nil {
+			w = provided
+		}
+		if _, ok := found[w.GetFingerPrint()]; ok {
+			continue
+		}
+		found[w.GetFingerPrint()] = nil
+		versionsInWorld = append(versionsInWorld, w)
 	}
-	return types.Packages(versionsInWorld), nil
+	return versionsInWorld, nil
 }
 
 // FindPackageVersions return the list of the packages beloging to cat/name
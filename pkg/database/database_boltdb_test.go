@@ -304,6 +304,76 @@ var _ = Describe("BoltDB Database", func() {
 					Expect(err).ToNot(HaveOccurred())
 					Expect(packs).To(ContainElement(z))
 				})
+
+				It("matches versioned provides", func() {
+					o := types.NewPackage("openssl", "3.0.2", []*types.Package{}, []*types.Package{})
+					l := types.NewPackage("libressl", "3.5", []*types.Package{}, []*types.Package{})
+					old := types.NewPackage("oldssl", "1.1", []*types.Package{}, []*types.Package{})
+
+					o.SetProvides([]*types.Package{{Name: "libssl", Category: "", Version: "3.0"}})
+					l.SetProvides([]*types.Package{{Name: "libssl", Category: "", Version: "3.1"}})
+					old.SetProvides([]*types.Package{{Name: "libssl", Category: "", Version: "1.1"}})
+
+					for _, p := range []*types.Package{o, l, old} {
+						_, err := db.CreatePackage(p)
+						Expect(err).ToNot(HaveOccurred())
+					}
+
+					packs, err := db.FindPackages(&types.Package{Name: "libssl", Category: "", Version: ">=3"})
+					Expect(err).ToNot(HaveOccurred())
+					Expect(packs).To(ConsistOf(o, l))
+
+					pack, err := db.FindPackage(&types.Package{Name: "libssl", Category: "", Version: ">=3"})
+					Expect(err).ToNot(HaveOccurred())
+					Expect(pack).To(Equal(l))
+
+					packs, err = db.FindPackages(&types.Package{Name: "libssl", Category: "", Version: "1.1"})
+					Expect(err).ToNot(HaveOccurred())
+					Expect(packs).To(ConsistOf(old))
+				})
+			})
+
+			It("returns all the providers of the same version", func() {
+				o := types.NewPackage("openssl", "3.0.2", []*types.Package{}, []*types.Package{})
+				l := types.NewPackage("libressl", "3.5", []*types.Package{}, []*types.Package{})
+
+				o.SetProvides([]*types.Package{{Name: "libssl", Category: "", Version: "3.0"}})
+				l.SetProvides([]*types.Package{{Name: "libssl", Category: "", Version: "3.0"}})
+
+				for _, p := range []*types.Package{o, l} {
+					_, err := db.CreatePackage(p)
+					Expect(err).ToNot(HaveOccurred())
+				}
+
+				packs, err := db.FindPackages(&types.Package{Name: "libssl", Category: "", Version: "3.0"})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(packs).To(ConsistOf(o, l))
+			})
+
+			It("doesn't return the removed providers", func() {
+				o := types.NewPackage("openssl", "3.0.2", []*types.Package{}, []*types.Package{})
+				l := types.NewPackage("libressl", "3.5", []*types.Package{}, []*types.Package{})
+
+				o.SetProvides([]*types.Package{{Name: "libssl", Category: "", Version: "3.0"}})
+				l.SetProvides([]*types.Package{{Name: "libssl", Category: "", Version: "3.0"}})
+
+				for _, p := range []*types.Package{o, l} {
+					_, err := db.CreatePackage(p)
+					Expect(err).ToNot(HaveOccurred())
+				}
+				Expect(db.RemovePackage(l)).To(Succeed())
+
+				packs, err := db.FindPackages(&types.Package{Name: "libssl", Category: "", Version: "3.0"})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(packs).To(ConsistOf(o))
+
+				pack, err := db.FindPackage(&types.Package{Name: "libssl", Category: "", Version: "3.0"})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(pack).To(Equal(o))
+
+				Expect(db.RemovePackage(o)).To(Succeed())
+				_, err = db.FindPackage(&types.Package{Name: "libssl", Category: "", Version: "3.0"})
+				Expect(err).To(HaveOccurred())
 			})
 
 		})
@@ -20,6 +20,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"regexp"
+	"sort"
 	"sync"
 
 	"github.com/mudler/luet/pkg/api/core/types"
@@ -31,7 +32,7 @@ var DBInMemoryInstance = &InMemoryDatabase{
 	FileDatabase:     map[string][]string{},
 	Database:         map[string]string{},
 	CacheNoVersion:   map[string]map[string]interface{}{},
-	ProvidesDatabase: map[string]map[string]*types.Package{},
+	ProvidesDatabase: map[string]map[string]types.PackageMap{},
 	RevDepsDatabase:  map[string]map[string]*types.Package{},
 	cached:           map[string]interface{}{},
 }
@@ -41,7 +42,7 @@ type InMemoryDatabase struct {
 	Database         map[string]string
 	FileDatabase     map[string][]string
 	CacheNoVersion   map[string]map[string]interface{}
-	ProvidesDatabase map[string]map[string]*types.Package
+	ProvidesDatabase map[string]map[string]types.PackageMap
 	RevDepsDatabase  map[string]map[string]*types.Package
 	cached           map[string]interface{}
 }
@@ -54,7 +55,7 @@ func NewInMemoryDatabase(singleton bool) types.PackageDatabase {
 			FileDatabase:     map[string][]string{},
 			Database:         map[string]string{},
 			CacheNoVersion:   map[string]map[string]interface{}{},
-			ProvidesDatabase: map[string]map[string]*types.Package{},
+			ProvidesDatabase: map[string]map[string]types.PackageMap{},
 			RevDepsDatabase:  map[string]map[string]*types.Package{},
 			cached:           map[string]interface{}{},
 		}
@@ -218,11 +219,13 @@ func (db *InMemoryDatabase) populateCaches(pd *types.Package) {
 	// Provides: Store package provides, we will reuse this when walking deps
 	for _, provide := range pd.Provides {
 		if _, ok := db.ProvidesDatabase[provide.GetPackageName()]; !ok {
-			db.ProvidesDatabase[provide.GetPackageName()] = make(map[string]*types.Package)
-
+			db.ProvidesDatabase[provide.GetPackageName()] = make(map[string]types.PackageMap)
+		}
+		if _, ok := db.ProvidesDatabase[provide.GetPackageName()][provide.GetVersion()]; !ok {
+			db.ProvidesDatabase[provide.GetPackageName()][provide.GetVersion()] = types.PackageMap{}
 		}
 
-		db.ProvidesDatabase[provide.GetPackageName()][provide.GetVersion()] = pd
+		db.ProvidesDatabase[provide.GetPackageName()][provide.GetVersion()][pd.GetFingerPrint()] = pd
 	}
 
 	_, ok := db.CacheNoVersion[pd.GetPackageName()]
@@ -241,61 +244,81 @@ func (db *InMemoryDatabase) populateCaches(pd *types.Package) {
 	toUpdate, ok := db.RevDepsDatabase[pd.GetPackageName()]
 	if ok {
 		for _, pp := range toUpdate {
-			for _, re := range pp.GetRequires() {
-				if match, _ := pd.VersionMatchSelector(re.GetVersion(), nil); match {
-					db.updateRevDep(pd.GetFingerPrint(), pp.GetFingerPrint(), pp)
+			for _, req := range pp.GetActiveRequires() {
+				for _, re := range req.AnyOf() {
+					if match, _ := pd.VersionMatchSelector(re.GetVersion(), nil); match {
+						db.updateRevDep(pd.GetFingerPrint(), pp.GetFingerPrint(), pp)
+					}
 				}
 			}
 		}
 	}
 	db.Unlock()
 
-	for _, re := range pd.GetRequires() {
-		packages, _ := db.FindPackages(re)
-		db.Lock()
-		for _, pa := range packages {
-			db.updateRevDep(pa.GetFingerPrint(), pd.GetFingerPrint(), pd)
-			db.updateRevDep(pa.GetPackageName(), pd.GetPackageName(), pd)
+	for _, req := range pd.GetActiveRequires() {
+		for _, re := range req.AnyOf() {
+			packages, _ := db.FindPackages(re)
+			db.Lock()
+			for _, pa := range packages {
+				db.updateRevDep(pa.GetFingerPrint(), pd.GetFingerPrint(), pd)
+				db.updateRevDep(pa.GetPackageName(), pd.GetPackageName(), pd)
+			}
+			db.updateRevDep(re.GetFingerPrint(), pd.GetFingerPrint(), pd)
+			db.updateRevDep(re.GetPackageName(), pd.GetPackageName(), pd)
+			db.Unlock()
 		}
-		db.updateRevDep(re.GetFingerPrint(), pd.GetFingerPrint(), pd)
-		db.updateRevDep(re.GetPackageName(), pd.GetPackageName(), pd)
-		db.Unlock()
 	}
 }
 
-func (db *InMemoryDatabase) getProvide(p *types.Package) (*types.Package, error) {
-
+// getProviders returns the packages providing p, sorted by fingerprint.
+// A package selector matches all the packages providing a version in its range.
+func (db *InMemoryDatabase) getProviders(p *types.Package) (types.Packages, error) {
 	db.Lock()
-
-	pa, ok := db.ProvidesDatabase[p.GetPackageName()][p.GetVersion()]
+	versions, ok := db.ProvidesDatabase[p.GetPackageName()]
 	if !ok {
-		versions, ok := db.ProvidesDatabase[p.GetPackageName()]
-		defer db.Unlock()
+		db.Unlock()
+		return nil, errors.New("No versions found for package")
+	}
 
-		if !ok {
-			return nil, errors.New("No versions found for package")
+	fingerprints := map[string]interface{}{}
+	for ve, providers := range versions {
+		if !p.MatchProvide(&types.Package{Name: p.GetName(), Category: p.GetCategory(), Version: ve}) {
+			continue
+		}
+		for fp := range providers {
+			fingerprints[fp] = nil
 		}
+	}
+	db.Unlock()
 
-		for ve, _ := range versions {
+	keys := []string{}
+	for fp := range fingerprints {
+		keys = append(keys, fp)
+	}
+	sort.Strings(keys)
 
-			match, err := p.VersionMatchSelector(ve, nil)
-			if err != nil {
-				return nil, errors.Wrap(err, "Error on match version")
-			}
-			if match {
-				pa, ok := db.ProvidesDatabase[p.GetPackageName()][ve]
-				if !ok {
-					return nil, errors.New("No versions found for package")
-				}
-				return pa, nil
-			}
+	providers := types.Packages{}
+	for _, fp := range keys {
+		// Skip providers which were removed from the database
+		pa, err := db.GetPackage(fp)
+		if err != nil {
+			continue
 		}
-
+		providers = append(providers, pa)
+	}
+	if len(providers) == 0 {
 		return nil, errors.New("No package provides this")
 	}
-	db.Unlock()
 
-	return db.FindPackage(pa)
+	return providers, nil
+}
+
+func (db *InMemoryDatabase) getProvide(p *types.Package) (*types.Package, error) {
+	providers, err := db.getProviders(p)
+	if err != nil {
+		return nil, err
+	}
+	return providers[0], nil
 }
 
 func (db *InMemoryDatabase) Clone(to types.PackageDatabase) error {
@@ -352,19 +375,18 @@ func (db *InMemoryDatabase) FindPackageVersions(p *types.Package) (types.Package
 // FindPackages return the list of the packages beloging to cat/name (any versions in requested range)
 func (db *InMemoryDatabase) FindPackages(p *types.Package) (types.Packages, error) {
 	if !p.IsSelector() {
+		// Provides: All the packages providing the requested version are candidates
+		if providers, err := db.getProviders(p); err == nil {
+			return providers, nil
+		}
 		pack, err := db.FindPackage(p)
 		if err != nil {
 			return []*types.Package{}, err
 		}
 		return []*types.Package{pack}, nil
 	}
-	// Provides: Treat as the replaced package here
-	if provided, err := db.getProvide(p); err == nil {
-		p = provided
-		if !provided.IsSelector() {
-			return types.Packages{provided}, nil
-		}
-	}
+	// Provides: All the packages providing a version in the requested range are candidates
+	providers, _ := db.getProviders(p)
 
 	db.Lock()
 	var matches []*types.Package
@@ -376,18 +398,29 @@ func (db *InMemoryDatabase) FindPackages(p *types.Package) (types.Packages, erro
 		}
 	}
 	db.Unlock()
-	if !ok {
+	if !ok && len(providers) == 0 {
 		return nil, fmt.Errorf("No versions found for: %s", p.HumanReadableString())
 	}
-	var versionsInWorld []*types.Package
+
+	found := map[string]interface{}{}
+	versionsInWorld := types.Packages{}
+	for _, pa := range providers {
+		found[pa.GetFingerPrint()] = nil
+		versionsInWorld = append(versionsInWorld, pa)
+	}
 	for _, p := range matches {
 		w, err := db.FindPackage(p)
 		if err != nil {
 			return nil, errors.Wrap(err, "Cache mismatch - this shouldn't happen")
 		}
+		// Replaced versions resolve to their provider
+		if _, ok := found[w.GetFingerPrint()]; ok {
+			continue
+		}
+		found[w.GetFingerPrint()] = nil
 		versionsInWorld = append(versionsInWorld, w)
 	}
-	return types.Packages(versionsInWorld), nil
+	return versionsInWorld, nil
 }
 
 func (db *InMemoryDatabase) UpdatePackage(p *types.Package) error {
@@ -266,8 +266,73 @@ var _ = Describe("Database", func() {
 					Expect(err).ToNot(HaveOccurred())
 					Expect(packs).To(ContainElement(z))
 				})
+
+				It("matches versioned provides", func() {
+					db := NewInMemoryDatabase(false)
+					o := types.NewPackage("openssl", "3.0.2", []*types.Package{}, []*types.Package{})
+					l := types.NewPackage("libressl", "3.5", []*types.Package{}, []*types.Package{})
+					old := types.NewPackage("oldssl", "1.1", []*types.Package{}, []*types.Package{})
+
+					o.SetProvides([]*types.Package{{Name: "libssl", Category: "", Version: "3.0"}})
+					l.SetProvides([]*types.Package{{Name: "libssl", Category: "", Version: "3.1"}})
+					old.SetProvides([]*types.Package{{Name: "libssl", Category: "", Version: "1.1"}})
+
+					for _, p := range []*types.Package{o, l, old} {
+						_, err := db.CreatePackage(p)
+						Expect(err).ToNot(HaveOccurred())
+					}
+
+					packs, err := db.FindPackages(&types.Package{Name: "libssl", Category: "", Version: ">=3"})
+					Expect(err).ToNot(HaveOccurred())
+					Expect(packs).To(ConsistOf(o, l))
+
+					pack, err := db.FindPackage(&types.Package{Name: "libssl", Category: "", Version: ">=3"})
+					Expect(err).ToNot(HaveOccurred())
+					Expect(pack).To(Equal(l))
+
+					packs, err = db.FindPackages(&types.Package{Name: "libssl", Category: "", Version: "1.1"})
+					Expect(err).ToNot(HaveOccurred())
+					Expect(packs).To(ConsistOf(old))
+				})
 			})
 
+			It("returns all the providers of the same version", func() {
+				db := NewInMemoryDatabase(false)
+				o := types.NewPackage("openssl", "3.0.2", []*types.Package{}, []*types.Package{})
+				l := types.NewPackage("libressl", "3.5", []*types.Package{}, []*types.Package{})
+
+				o.SetProvides([]*types.Package{{Name: "libssl", Category: "", Version: "3.0"}})
+				l.SetProvides([]*types.Package{{Name: "libssl", Category: "", Version: "3.0"}})
+
+				for _, p := range []*types.Package{o, l} {
+					_, err := db.CreatePackage(p)
+					Expect(err).ToNot(HaveOccurred())
+				}
+
+				packs, err := db.FindPackages(&types.Package{Name: "libssl", Category: "", Version: "3.0"})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(packs).To(ConsistOf(o, l))
+			})
+
+		})
+
+		It("ignores the inactive requires in the reverse dependencies", func() {
+			revdeps := func(flags ...string) types.Packages {
+				db := NewInMemoryDatabase(false)
+				ssl := types.NewPackage("openssl", "1.0", []*types.Package{}, []*types.Package{})
+				curl := types.NewPackage("curl", "1.0", []*types.Package{{Name: "openssl", Version: ">=0", UseConditions: []string{"ssl"}}}, []*types.Package{})
+				curl.UseFlags = flags
+				for _, p := range []*types.Package{ssl, curl} {
+					_, err := db.CreatePackage(p)
+					Expect(err).ToNot(HaveOccurred())
+				}
+				packs, err := db.GetRevdeps(ssl)
+				Expect(err).ToNot(HaveOccurred())
+				return packs
+			}
+
+			Expect(revdeps()).To(BeEmpty())
+			Expect(revdeps("ssl")).To(HaveLen(1))
 		})
 
 	})
@@ -16,12 +16,67 @@
 package helpers
 
 import (
+	"archive/tar"
+	"bufio"
+	"bytes"
 	"io"
+	"io/ioutil"
 	"os"
+	"strconv"
+	"time"
 
+	containerdCompression "github.com/containerd/containerd/archive/compression"
 	"github.com/moby/moby/pkg/archive"
+	"github.com/pierrec/lz4/v4"
+	"github.com/pkg/errors"
+	"github.com/ulikunitz/xz"
 )
 
+var (
+	xzMagic  = []byte{0xFD, '7', 'z', 'X', 'Z', 0x00}
+	lz4Magic = []byte{0x04, 0x22, 0x4D, 0x18}
+)
+
+// DecompressStream returns a reader decompressing the given stream, detecting
+// the compression from its header. Uncompressed, gzip, zstd, xz and lz4 streams are supported.
+func DecompressStream(r io.Reader) (io.ReadCloser, error) {
+	buf := bufio.NewReader(r)
+	header, err := buf.Peek(len(xzMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(header, xzMagic):
+		xr, err := xz.NewReader(buf)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(xr), nil
+	case bytes.HasPrefix(header, lz4Magic):
+		return ioutil.NopCloser(lz4.NewReader(buf)), nil
+	}
+	return containerdCompression.DecompressStream(buf)
+}
+
+// Untar extracts the tarball src in the dest directory, detecting its compression.
+// The ownership of the files in the tarball is not preserved.
+func Untar(src, dest string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r, err := DecompressStream(f)
+	if err != nil {
+		return errors.Wrap(err, "cannot decompress "+src)
+	}
+	defer r.Close()
+
+	return archive.UntarUncompressed(r, dest, &archive.TarOptions{NoLchown: true})
+}
+
 func Tar(src, dest string) error {
 	out, err := os.Create(dest)
 	if err != nil {
@@ -46,3 +101,69 @@ func Tar(src, dest string) error {
 	}
 	return err
 }
+
+// SourceDateEpoch returns the time set in the SOURCE_DATE_EPOCH environment variable,
+// or the Unix epoch if it is not set.
+// See https://reproducible-builds.org/specs/source-date-epoch/
+func SourceDateEpoch() (time.Time, error) {
+	v := os.Getenv("SOURCE_DATE_EPOCH")
+	if v == "" {
+		return time.Unix(0, 0).UTC(), nil
+	}
+	sec, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "invalid SOURCE_DATE_EPOCH '%s'", v)
+	}
+	return time.Unix(sec, 0).UTC(), nil
+}
+
+// TarReproducible archives src to dest like Tar, but the result depends only on
+// the content, modes and ownership of the files: entries are sorted, modification
+// times newer than epoch are clamped to it, access and change times are dropped
+// and owners are stored only by numeric id, as user and group names depend on the host.
+func TarReproducible(src, dest string, epoch time.Time) error {
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	// archive.Tar walks the source with filepath.Walk, so entries come in lexical order
+	fs, err := archive.Tar(src, archive.Uncompressed)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+
+	tr := tar.NewReader(fs)
+	tw := tar.NewWriter(out)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if hdr.ModTime.After(epoch) {
+			hdr.ModTime = epoch
+		}
+		hdr.AccessTime = time.Time{}
+		hdr.ChangeTime = time.Time{}
+		hdr.Uname = ""
+		hdr.Gname = ""
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return out.Sync()
+}
@@ -0,0 +1,130 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package helpers_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/mudler/luet/pkg/helpers"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Archive", func() {
+	Context("Reproducible tarballs", func() {
+		var tmpdir string
+
+		BeforeEach(func() {
+			var err error
+			tmpdir, err = ioutil.TempDir(os.TempDir(), "tar")
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(tmpdir)
+			os.Unsetenv("SOURCE_DATE_EPOCH")
+		})
+
+		It("reads SOURCE_DATE_EPOCH", func() {
+			epoch, err := SourceDateEpoch()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(epoch.Unix()).To(Equal(int64(0)))
+
+			os.Setenv("SOURCE_DATE_EPOCH", "1640995200")
+			epoch, err = SourceDateEpoch()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(epoch.Unix()).To(Equal(int64(1640995200)))
+
+			os.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+			_, err = SourceDateEpoch()
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("sorts entries, clamps modification times and drops owner names", func() {
+			src := filepath.Join(tmpdir, "src")
+			Expect(os.MkdirAll(filepath.Join(src, "b"), os.ModePerm)).To(Succeed())
+			for _, f := range []string{"c", "b/a", "a"} {
+				Expect(ioutil.WriteFile(filepath.Join(src, f), []byte(f), 0644)).To(Succeed())
+			}
+			old := time.Unix(1000, 0)
+			Expect(os.Chtimes(filepath.Join(src, "a"), old, old)).To(Succeed())
+
+			epoch := time.Unix(5000, 0)
+			dst := filepath.Join(tmpdir, "out.tar")
+			Expect(TarReproducible(src, dst, epoch)).To(Succeed())
+
+			f, err := os.Open(dst)
+			Expect(err).ToNot(HaveOccurred())
+			defer f.Close()
+
+			names := []string{}
+			tr := tar.NewReader(f)
+			for {
+				hdr, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				Expect(err).ToNot(HaveOccurred())
+				names = append(names, hdr.Name)
+
+				Expect(hdr.Uname).To(BeEmpty())
+				Expect(hdr.Gname).To(BeEmpty())
+				Expect(hdr.AccessTime.IsZero()).To(BeTrue())
+				Expect(hdr.ChangeTime.IsZero()).To(BeTrue())
+				if hdr.Name == "a" {
+					Expect(hdr.ModTime.Unix()).To(Equal(old.Unix()))
+				} else {
+					Expect(hdr.ModTime.Unix()).To(Equal(epoch.Unix()))
+				}
+			}
+			Expect(names).To(Equal([]string{"a", "b/", "b/a", "c"}))
+		})
+	})
+
+	Context("Extraction", func() {
+		It("extracts compressed tarballs", func() {
+			tmpdir, err := ioutil.TempDir(os.TempDir(), "untar")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(tmpdir)
+
+			src := filepath.Join(tmpdir, "src.tar.gz")
+			f, err := os.Create(src)
+			Expect(err).ToNot(HaveOccurred())
+			gz := gzip.NewWriter(f)
+			tw := tar.NewWriter(gz)
+			Expect(tw.WriteHeader(&tar.Header{Name: "dir/foo", Mode: 0644, Size: 3, Typeflag: tar.TypeReg})).To(Succeed())
+			_, err = tw.Write([]byte("foo"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tw.Close()).To(Succeed())
+			Expect(gz.Close()).To(Succeed())
+			Expect(f.Close()).To(Succeed())
+
+			dst := filepath.Join(tmpdir, "dst")
+			Expect(os.MkdirAll(dst, os.ModePerm)).To(Succeed())
+			Expect(Untar(src, dst)).To(Succeed())
+
+			content, err := ioutil.ReadFile(filepath.Join(dst, "dir", "foo"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(content)).To(Equal("foo"))
+		})
+	})
+})
@@ -93,3 +93,49 @@ func printMatches(artefacts map[string]ArtifactMatch) {
 	pterm.DefaultTable.WithHasHeader().WithData(d).Render()
 	fmt.Println()
 }
+
+// upgradeChangelog returns the changelog entries between the installed
+// and the candidate versions of the packages that are going to be upgraded
+func upgradeChangelog(install, uninstall types.Packages) map[*types.Package]types.Changelog {
+	res := map[*types.Package]types.Changelog{}
+	for _, m := range install {
+		from := ""
+		if old, err := uninstall.Find(m.GetPackageName()); err == nil {
+			from = old.GetVersion()
+		}
+		if entries := m.GetChangelog().Between(from, m.GetVersion()); len(entries) != 0 {
+			res[m] = entries
+		}
+	}
+	return res
+}
+
+func printChangelogs(changes map[*types.Package]types.Changelog) {
+	packs := types.Packages{}
+	for p := range changes {
+		packs = append(packs, p)
+	}
+	sort.Slice(packs, func(i, j int) bool {
+		return packs[i].HumanReadableString() < packs[j].HumanReadableString()
+	})
+
+	fmt.Println()
+	for _, p := range packs {
+		printChangelog(p, changes[p])
+	}
+}
+
+func printChangelog(p *types.Package, entries types.Changelog) {
+	fmt.Println(pterm.LightCyan(p.HumanReadableString()))
+	for _, e := range entries {
+		header := e.Version
+		if e.Date != "" {
+			header = fmt.Sprintf("%s (%s)", e.Version, e.Date)
+		}
+		fmt.Println("  " + pterm.LightGreen(header))
+		for _, c := range e.Changes {
+			fmt.Println("    - " + c)
+		}
+	}
+	fmt.Println()
+}
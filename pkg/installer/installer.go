@@ -33,7 +33,9 @@ import (
 
 	"github.com/pterm/pterm"
 
+	"github.com/mudler/luet/pkg/api/core/advisory"
 	"github.com/mudler/luet/pkg/api/core/bus"
+	"github.com/mudler/luet/pkg/api/core/license"
 	"github.com/mudler/luet/pkg/api/core/types"
 	artifact "github.com/mudler/luet/pkg/api/core/types/artifact"
 	pkg "github.com/mudler/luet/pkg/database"
@@ -48,6 +50,7 @@ type LuetInstallerOptions struct {
 	Concurrency                                                    int
 	NoDeps                                                         bool
 	OnlyDeps                                                       bool
+	NoRecommends                                                   bool
 	Force                                                          bool
 	PreserveSystemEssentialData                                    bool
 	FullUninstall, FullCleanUninstall                              bool
@@ -76,6 +79,21 @@ func NewLuetInstaller(opts LuetInstallerOptions) *LuetInstaller {
 	return &LuetInstaller{Options: opts}
 }
 
+// solverOptions returns the options of the solvers used by the installer. The priorities of
+// the repositories are computed only if the optimizing solver is used, as it's the only one using them
+func (l *LuetInstaller) solverOptions(repos Repositories) types.SolverOptions {
+	opts := types.SolverOptions{
+		Type:        l.Options.SolverOptions.Implementation,
+		Concurrency: l.Options.Concurrency,
+		Race:        l.Options.SolverOptions.Race,
+		CacheDir:    l.Options.SolverOptions.CacheDir,
+	}
+	if opts.Type == types.SolverOptimizing {
+		opts.Priorities = repos.Priorities()
+	}
+	return opts
+}
+
 // computeUpgrade returns the packages to be uninstalled and installed in a system to perform an upgrade
 // based on the system repositories
 func (l *LuetInstaller) computeUpgrade(syncedRepos Repositories, s *System) (types.Packages, types.Packages, error) {
@@ -87,9 +105,7 @@ func (l *LuetInstaller) computeUpgrade(syncedRepos Repositories, s *System) (typ
 	syncedRepos.SyncDatabase(allRepos)
 	// compute a "big" world
 	solv := solver.NewResolver(
-		types.SolverOptions{
-			Type:        l.Options.SolverOptions.Implementation,
-			Concurrency: l.Options.Concurrency},
+		l.solverOptions(syncedRepos),
 		s.Database, allRepos, pkg.NewInMemoryDatabase(false),
 		solver.NewSolverFromOptions(l.Options.SolverOptions))
 	var solution types.PackagesAssertions
@@ -161,6 +177,12 @@ func (l *LuetInstaller) SyncRepositories() (Repositories, error) {
 
 	for _, r := range SystemRepositories(l.Options.PackageRepositories) {
 		repo, err := r.Sync(l.Options.Context, false)
+		if err == nil {
+			err = l.Options.Context.GetConfig().UseFlags.ApplyDatabase(repo.GetTree().GetDatabase())
+		}
+		if err == nil {
+			err = repo.FilterArch(l.Options.Context.GetConfig().System.GetArch())
+		}
 		if err == nil {
 			syncedRepos = append(syncedRepos, repo)
 		} else {
@@ -313,6 +335,7 @@ type Option struct {
 	FullCleanUninstall bool
 	OnlyDeps           bool
 	RunFinalizers      bool
+	Recommends         bool
 
 	CheckFileConflicts bool
 }
@@ -470,6 +493,18 @@ func (l *LuetInstaller) checkAndUpgrade(r Repositories, s *System) error {
 	} else {
 		l.Options.Context.Info(":zap: Proposed version changes to the system:\n ")
 		printUpgradeList(toInstall, uninstall)
+		if changes := upgradeChangelog(toInstall, uninstall); len(changes) != 0 {
+			l.Options.Context.Info(":memo: Changelog of the upgraded packages:")
+			printChangelogs(changes)
+		}
+	}
+
+	if err := license.Enforce(l.Options.Context, toInstall); err != nil {
+		return errors.Wrap(err, "while checking licenses of the upgrade")
+	}
+
+	if err := advisory.Enforce(l.Options.Context, toInstall); err != nil {
+		return errors.Wrap(err, "while checking advisories of the upgrade")
 	}
 
 	// We don't want any conflict with the installed to raise during the upgrade.
@@ -548,6 +583,7 @@ func (l *LuetInstaller) Install(cp types.Packages, s *System) error {
 		OnlyDeps:           l.Options.OnlyDeps,
 		CheckFileConflicts: true,
 		RunFinalizers:      true,
+		Recommends:         !l.Options.NoRecommends,
 	}
 	match, packages, assertions, allRepos, err := l.computeInstall(o, syncedRepos, cp, s)
 	if err != nil {
@@ -619,6 +655,18 @@ func (l *LuetInstaller) Install(cp types.Packages, s *System) error {
 
 	printMatches(match)
 
+	toInstall := types.Packages{}
+	for _, m := range match {
+		toInstall = append(toInstall, m.Package)
+	}
+	if err := license.Enforce(l.Options.Context, toInstall); err != nil {
+		return errors.Wrap(err, "while checking licenses of the packages to install")
+	}
+
+	if err := advisory.Enforce(l.Options.Context, toInstall); err != nil {
+		return errors.Wrap(err, "while checking advisories of the packages to install")
+	}
+
 	if l.Options.Ask {
 		l.Options.Context.Info("By going forward, you are also accepting the licenses of the packages that you are going to install in your system.")
 		if l.Options.Context.Ask() {
@@ -631,6 +679,44 @@ func (l *LuetInstaller) Install(cp types.Packages, s *System) error {
 	return l.install(o, syncedRepos, match, packages, assertions, allRepos, s)
 }
 
+// WhyNot checks if the package can be installed in the system from the repositories.
+// It returns the solution computed by the solver if it can be installed, otherwise an error
+// describing why: when the constraints can't be satisfied it wraps a solver.UnsatError
+// with the explanation of the conflict.
+func (l *LuetInstaller) WhyNot(p *types.Package, s *System) (types.PackagesAssertions, error) {
+	syncedRepos, err := l.SyncRepositories()
+	if err != nil {
+		return nil, err
+	}
+
+	allRepos := pkg.NewInMemoryDatabase(false)
+	syncedRepos.SyncDatabase(allRepos)
+
+	if packs, err := allRepos.FindPackages(p); err != nil || len(packs) == 0 {
+		available := []string{}
+		if versions, err := allRepos.FindPackageVersions(p); err == nil {
+			for _, v := range versions {
+				available = append(available, v.GetVersion())
+			}
+		}
+		if len(available) == 0 {
+			return nil, fmt.Errorf("%s is not available in the repositories", p.HumanReadableString())
+		}
+		return nil, fmt.Errorf("%s is not available in the repositories, available versions: %s", p.HumanReadableString(), strings.Join(available, ", "))
+	}
+
+	solv := solver.NewResolver(l.solverOptions(syncedRepos),
+		s.Database, allRepos, pkg.NewInMemoryDatabase(false),
+		solver.NewSolverFromOptions(l.Options.SolverOptions),
+	)
+
+	solution, err := solv.Install(syncedRepos.ResolveSelectors(types.Packages{p}))
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s can't be installed", p.HumanReadableString())
+	}
+	return solution, nil
+}
+
 func (l *LuetInstaller) download(syncedRepos Repositories, toDownload map[string]ArtifactMatch) error {
 
 	// Don't attempt to download stuff that is already in cache
@@ -767,9 +853,7 @@ func (l *LuetInstaller) computeInstall(o Option, syncedRepos Repositories, cp ty
 	var err error
 
 	if !o.NoDeps {
-		solv := solver.NewResolver(types.SolverOptions{
-			Type:        l.Options.SolverOptions.Implementation,
-			Concurrency: l.Options.Concurrency},
+		solv := solver.NewResolver(l.solverOptions(syncedRepos),
 			s.Database, allRepos, pkg.NewInMemoryDatabase(false),
 			solver.NewSolverFromOptions(l.Options.SolverOptions),
 		)
@@ -783,6 +867,9 @@ func (l *LuetInstaller) computeInstall(o Option, syncedRepos Repositories, cp ty
 		if err != nil && !o.Force {
 			return toInstall, p, solution, allRepos, errors.Wrap(err, "Failed solving solution for package")
 		}
+		if err == nil && o.Recommends {
+			solution = l.addRecommends(solv, syncedRepos, p, solution, s)
+		}
 		// Gathers things to install
 		for _, assertion := range solution {
 			if assertion.Value {
@@ -828,6 +915,98 @@ func (l *LuetInstaller) computeInstall(o Option, syncedRepos Repositories, cp ty
 	return toInstall, p, solution, allRepos, nil
 }
 
+// addRecommends extends the solution with the packages recommended by the ones being installed.
+// Recommends are soft goals: they are all added to the wanted packages at once, and only if the
+// solver doesn't find a solution anymore each of them is added alone, skipping the ones which
+// can't be installed.
+func (l *LuetInstaller) addRecommends(solv types.PackageSolver, syncedRepos Repositories, wanted types.Packages, solution types.PackagesAssertions, s *System) types.PackagesAssertions {
+	type recommend struct {
+		by         *types.Package
+		candidates types.Packages
+	}
+
+	install := func(goals types.Packages) (types.PackagesAssertions, error) {
+		if l.Options.Relaxed {
+			return solv.RelaxedInstall(goals)
+		}
+		return solv.Install(goals)
+	}
+
+	added := func(r recommend) {
+		l.Options.Context.Info(fmt.Sprintf(":bulb: %s recommends %s, adding it", r.by.HumanReadableString(), r.candidates[0].HumanReadableString()))
+	}
+
+	visited := map[string]interface{}{}
+	// The recommends of the recommended packages are added in the following rounds
+	for {
+		recommends := []recommend{}
+		for _, a := range solution {
+			if !a.Value {
+				continue
+			}
+			if _, err := s.Database.FindPackage(a.Package); err == nil {
+				// Recommends of installed packages were already considered, or removed by the user
+				continue
+			}
+			for _, r := range a.Package.GetRecommends() {
+				if _, ok := visited[r.HumanReadableString()]; ok {
+					continue
+				}
+				visited[r.HumanReadableString()] = nil
+
+				if vers, _ := s.Database.FindPackageVersions(r); len(vers) > 0 || inSolution(solution, r) {
+					continue
+				}
+
+				candidates := syncedRepos.ResolveSelectors(types.Packages{r})
+				if len(candidates) == 0 {
+					l.Options.Context.Info(fmt.Sprintf(":bulb: %s recommends %s, skipping it: not available in the repositories", a.Package.HumanReadableString(), r.HumanReadableString()))
+					continue
+				}
+				recommends = append(recommends, recommend{by: a.Package, candidates: candidates})
+			}
+		}
+		if len(recommends) == 0 {
+			return solution
+		}
+
+		goals := append(types.Packages{}, wanted...)
+		for _, r := range recommends {
+			goals = append(goals, r.candidates...)
+		}
+		if sol, err := install(goals); err == nil {
+			for _, r := range recommends {
+				added(r)
+			}
+			wanted = goals
+			solution = sol
+			continue
+		}
+
+		for _, r := range recommends {
+			goals := append(append(types.Packages{}, wanted...), r.candidates...)
+			sol, err := install(goals)
+			if err != nil {
+				l.Options.Context.Info(fmt.Sprintf(":bulb: %s recommends %s, skipping it: %s", r.by.HumanReadableString(), r.candidates[0].HumanReadableString(), err.Error()))
+				continue
+			}
+			added(r)
+			wanted = goals
+			solution = sol
+		}
+	}
+}
+
+// inSolution returns true if any version of the package is part of the solution
+func inSolution(solution types.PackagesAssertions, p *types.Package) bool {
+	for _, a := range solution {
+		if a.Value && a.Package.AtomMatches(p) {
+			return true
+		}
+	}
+	return false
+}
+
 func (l *LuetInstaller) getFinalizers(allRepos types.PackageDatabase, solution types.PackagesAssertions, toInstall map[string]ArtifactMatch, nodeps bool) ([]*types.Package, error) {
 	var toFinalize []*types.Package
 	if !nodeps {
@@ -1209,10 +1388,7 @@ func (l *LuetInstaller) computeUninstall(o Option, s *System, packs ...*types.Pa
 
 	if !o.NoDeps {
 		solv := solver.NewResolver(
-			types.SolverOptions{
-				Type:        l.Options.SolverOptions.Implementation,
-				Concurrency: l.Options.Concurrency,
-			},
+			l.solverOptions(nil),
 			installedtmp,
 			installedtmp,
 			pkg.NewInMemoryDatabase(false),
@@ -1237,6 +1237,149 @@ urls:
 
 	})
 
+	Context("Recommends", func() {
+		It("Installs the recommended packages which can be installed", func() {
+			generalRecipe := tree.NewCompilerRecipe(pkg.NewInMemoryDatabase(false))
+
+			err := generalRecipe.Load("../../tests/fixtures/recommends")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(len(generalRecipe.GetDatabase().GetPackages())).To(Equal(3))
+
+			c := compiler.NewLuetCompiler(backend.NewSimpleDockerBackend(ctx), generalRecipe.GetDatabase(), compiler.Concurrency(2))
+
+			tmpdir, err := ioutil.TempDir("", "tree")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(tmpdir) // clean up
+
+			specs := types.NewLuetCompilationspecs()
+			for _, name := range []string{"a", "b", "c"} {
+				spec, err := c.FromPackage(&types.Package{Name: name, Category: "test", Version: "1.0"})
+				Expect(err).ToNot(HaveOccurred())
+				spec.SetOutputPath(tmpdir)
+				specs.Add(spec)
+			}
+
+			_, errs := c.CompileParallel(false, specs)
+			Expect(errs).To(BeEmpty())
+
+			repo, err := stubRepo(tmpdir, "../../tests/fixtures/recommends")
+			Expect(err).ToNot(HaveOccurred())
+			err = repo.Write(ctx, tmpdir, false, false)
+			Expect(err).ToNot(HaveOccurred())
+
+			repo2, err := NewLuetSystemRepositoryFromYaml([]byte(`
+name: "test"
+type: "disk"
+enable: true
+urls:
+  - "`+tmpdir+`"
+`), pkg.NewInMemoryDatabase(false))
+			Expect(err).ToNot(HaveOccurred())
+
+			fakeroot, err := ioutil.TempDir("", "fakeroot")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(fakeroot) // clean up
+
+			fakeroot2, err := ioutil.TempDir("", "fakeroot")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(fakeroot2) // clean up
+
+			install := func(fakeroot string, noRecommends bool) *System {
+				inst := NewLuetInstaller(LuetInstallerOptions{
+					Concurrency: 1, Context: ctx, CheckConflicts: true,
+					NoRecommends:        noRecommends,
+					PackageRepositories: types.LuetRepositories{*repo2.LuetRepository},
+				})
+				system := &System{Database: pkg.NewInMemoryDatabase(false), Target: fakeroot}
+				err := inst.Install([]*types.Package{{Name: "a", Category: "test", Version: "1.0"}}, system)
+				Expect(err).ToNot(HaveOccurred())
+				return system
+			}
+
+			system := install(fakeroot, false)
+			Expect(fileHelper.Exists(filepath.Join(system.Target, "a"))).To(BeTrue())
+			Expect(fileHelper.Exists(filepath.Join(system.Target, "b"))).To(BeTrue())
+			Expect(fileHelper.Exists(filepath.Join(system.Target, "c"))).To(BeFalse())
+			Expect(len(system.Database.GetPackages())).To(Equal(2))
+
+			// Recommended packages can be removed without removing the packages recommending them
+			inst := NewLuetInstaller(LuetInstallerOptions{Concurrency: 1, Context: ctx, CheckConflicts: true})
+			err = inst.Uninstall(system, &types.Package{Name: "b", Category: "test", Version: "1.0"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fileHelper.Exists(filepath.Join(system.Target, "b"))).To(BeFalse())
+			_, err = system.Database.FindPackage(&types.Package{Name: "a", Category: "test", Version: "1.0"})
+			Expect(err).ToNot(HaveOccurred())
+
+			system = install(fakeroot2, true)
+			Expect(fileHelper.Exists(filepath.Join(system.Target, "a"))).To(BeTrue())
+			Expect(fileHelper.Exists(filepath.Join(system.Target, "b"))).To(BeFalse())
+			Expect(len(system.Database.GetPackages())).To(Equal(1))
+		})
+
+		It("Skips only the recommended packages which can't be installed", func() {
+			tmpdir, err := ioutil.TempDir("", "tree")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(tmpdir) // clean up
+
+			// a recommends b, c and d, but c conflicts with a. b recommends e
+			for name, def := range map[string]string{
+				"a": "recommends:\n- category: test\n  name: b\n  version: \">=0\"\n- category: test\n  name: c\n  version: \">=0\"\n- category: test\n  name: d\n  version: \">=0\"\n",
+				"b": "recommends:\n- category: test\n  name: e\n  version: \">=0\"\n",
+				"c": "conflicts:\n- category: test\n  name: a\n  version: \">=0\"\n",
+				"d": "",
+				"e": "",
+			} {
+				dir := filepath.Join(tmpdir, "tree", name)
+				Expect(os.MkdirAll(dir, os.ModePerm)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(dir, "definition.yaml"), []byte("category: test\nname: "+name+"\nversion: \"1.0\"\n"+def), os.ModePerm)).To(Succeed())
+				// Each package ships only its own image definition, so the packages don't have files in common
+				Expect(ioutil.WriteFile(filepath.Join(dir, "build.yaml"), []byte("image: \"scratch\"\nunpack: true\nincludes:\n- /luetbuild/"+name+"-test-1.0.dockerfile\n"), os.ModePerm)).To(Succeed())
+			}
+
+			generalRecipe := tree.NewCompilerRecipe(pkg.NewInMemoryDatabase(false))
+			Expect(generalRecipe.Load(filepath.Join(tmpdir, "tree"))).To(Succeed())
+
+			c := compiler.NewLuetCompiler(backend.NewSimpleBoxBackend(ctx, filepath.Join(tmpdir, "images")), generalRecipe.GetDatabase(), compiler.Concurrency(1))
+			specs := types.NewLuetCompilationspecs()
+			for _, name := range []string{"a", "b", "c", "d", "e"} {
+				spec, err := c.FromPackage(&types.Package{Name: name, Category: "test", Version: "1.0"})
+				Expect(err).ToNot(HaveOccurred())
+				spec.SetOutputPath(filepath.Join(tmpdir, "build"))
+				specs.Add(spec)
+			}
+			_, errs := c.CompileParallel(false, specs)
+			Expect(errs).To(BeEmpty())
+
+			repo, err := stubRepo(filepath.Join(tmpdir, "build"), filepath.Join(tmpdir, "tree"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(repo.Write(ctx, filepath.Join(tmpdir, "build"), false, false)).To(Succeed())
+
+			repo2, err := NewLuetSystemRepositoryFromYaml([]byte(`
+name: "test"
+type: "disk"
+enable: true
+urls:
+  - "`+filepath.Join(tmpdir, "build")+`"
+`), pkg.NewInMemoryDatabase(false))
+			Expect(err).ToNot(HaveOccurred())
+
+			inst := NewLuetInstaller(LuetInstallerOptions{
+				Concurrency: 1, Context: ctx, CheckConflicts: true,
+				PackageRepositories: types.LuetRepositories{*repo2.LuetRepository},
+			})
+			system := &System{Database: pkg.NewInMemoryDatabase(false), Target: filepath.Join(tmpdir, "root")}
+			Expect(os.MkdirAll(system.Target, os.ModePerm)).To(Succeed())
+			Expect(inst.Install([]*types.Package{{Name: "a", Category: "test", Version: "1.0"}}, system)).To(Succeed())
+
+			installed := []string{}
+			for _, p := range system.Database.World() {
+				installed = append(installed, p.GetName())
+			}
+			Expect(installed).To(ConsistOf("a", "b", "d", "e"))
+		})
+	})
+
 	Context("Uninstallation", func() {
 		It("fails if package is required by others which are installed", func() {
 
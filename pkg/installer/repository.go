@@ -35,6 +35,7 @@ import (
 	"github.com/mudler/luet/pkg/api/core/types"
 	"github.com/mudler/luet/pkg/compiler"
 	"github.com/mudler/luet/pkg/installer/client"
+	"github.com/mudler/luet/pkg/solver"
 
 	pkg "github.com/mudler/luet/pkg/database"
 	tree "github.com/mudler/luet/pkg/tree"
@@ -59,9 +60,10 @@ const (
 )
 
 type LuetRepositoryFile struct {
-	FileName        string                          `json:"filename"`
-	CompressionType types.CompressionImplementation `json:"compressiontype,omitempty"`
-	Checksums       artifact.Checksums              `json:"checksums,omitempty"`
+	FileName         string                          `json:"filename"`
+	CompressionType  types.CompressionImplementation `json:"compressiontype,omitempty"`
+	CompressionLevel int                             `json:"compressionlevel,omitempty"`
+	Checksums        artifact.Checksums              `json:"checksums,omitempty"`
 }
 
 type LuetSystemRepository struct {
@@ -250,6 +252,17 @@ func (f *LuetRepositoryFile) GetCompressionType() types.CompressionImplementatio
 	return f.CompressionType
 }
 
+// SetCompressionLevel sets the level of the compression of the repository file,
+// 0 for the default one of the compression type
+func (f *LuetRepositoryFile) SetCompressionLevel(l int) {
+	f.CompressionLevel = l
+}
+
+// GetCompressionLevel gets the level of the compression of the repository file
+func (f *LuetRepositoryFile) GetCompressionLevel() int {
+	return f.CompressionLevel
+}
+
 // SetChecksums sets the checksum of the repository file.
 // Each repository can ship arbitrary file that will be downloaded by the client
 // in case of need, this sets the checksums that the client will use to verify the artifact
@@ -303,7 +316,7 @@ func GenerateRepository(p ...RepositoryOption) (*LuetSystemRepository, error) {
 
 	// Pick only atoms in db which have a real metadata for runtime db (tr)
 	for _, p := range tempTree.World() {
-		if _, err := os.Stat(filepath.Join(c.Src, p.GetMetadataFilePath())); err == nil {
+		if _, err := os.Stat(filepath.Join(c.Src, p.GetMetadataFilePath())); err == nil || hasArchMetadata(c.Src, p) {
 			runtimeTree.CreatePackage(p)
 		}
 	}
@@ -369,6 +382,25 @@ func GenerateRepository(p ...RepositoryOption) (*LuetSystemRepository, error) {
 	return repo, nil
 }
 
+// hasArchMetadata returns true if the package was built for any architecture in the given folder
+func hasArchMetadata(src string, p *types.Package) bool {
+	matches, _ := filepath.Glob(filepath.Join(src, fmt.Sprintf("%s-*.%s", p.GetFingerPrint(), types.PackageMetaSuffix)))
+	for _, m := range matches {
+		dat, err := ioutil.ReadFile(m)
+		if err != nil {
+			continue
+		}
+		art, err := artifact.NewPackageArtifactFromYaml(dat)
+		if err != nil || art.CompileSpec == nil || art.CompileSpec.Package == nil {
+			continue
+		}
+		if art.CompileSpec.Package.Matches(p) && art.CompileSpec.Package.GetArch() != "" {
+			return true
+		}
+	}
+	return false
+}
+
 func NewSystemRepository(repo types.LuetRepository) *LuetSystemRepository {
 	return &LuetSystemRepository{
 		LuetRepository:  &repo,
@@ -613,7 +645,7 @@ func (r *LuetSystemRepository) Snapshot(id, dst string) (artifacts []*artifact.P
 	var snapshotFmt string = "%s-%s"
 
 	repospec := filepath.Join(dst, REPOSITORY_SPECFILE)
-	snapshotIndex = filepath.Join(dst, fmt.Sprintf(snapshotFmt, id, REPOSITORY_SPECFILE))
+	snapshotIndex = filepath.Join(dst, SnapshotReferenceID(id))
 
 	err = fileHelper.CopyFile(repospec, filepath.Join(dst, snapshotIndex))
 	if err != nil {
@@ -674,6 +706,7 @@ func (r *LuetSystemRepository) AddRepositoryFile(src, fileKey, repositoryRoot st
 
 	a := artifact.NewPackageArtifact(filepath.Join(repositoryRoot, treeFile.GetFileName()))
 	a.CompressionType = treeFile.GetCompressionType()
+	a.CompressionLevel = treeFile.GetCompressionLevel()
 	err = a.Compress(src, 1)
 	if err != nil {
 		return a, errors.Wrap(err, "Error met while creating package archive")
@@ -798,6 +831,40 @@ func (r *LuetSystemRepository) SearchArtefact(p *types.Package) (*artifact.Packa
 	return nil, errors.New("Not found")
 }
 
+// FilterArch drops from the repository the artifacts and the packages which are not
+// available for the given architecture, so they are not considered while solving.
+// Packages without any artifact in the index are kept, as their availability can't be told.
+func (r *LuetSystemRepository) FilterArch(arch string) error {
+	available := map[string]bool{}
+	index := compiler.ArtifactIndex{}
+	for _, a := range r.GetIndex() {
+		p := a.CompileSpec.GetPackage()
+		if p == nil {
+			continue
+		}
+		if _, ok := available[p.GetFingerPrint()]; !ok {
+			available[p.GetFingerPrint()] = false
+		}
+		if a.Arch == "" || a.Arch == arch {
+			available[p.GetFingerPrint()] = true
+			index = append(index, a)
+		}
+	}
+	r.Index = index
+
+	db := r.GetTree().GetDatabase()
+	for _, p := range db.World() {
+		if ok, indexed := available[p.GetFingerPrint()]; p.SupportsArch(arch) && (ok || !indexed) {
+			continue
+		}
+		if err := db.RemovePackage(p); err != nil {
+			return errors.Wrapf(err, "while removing %s", p.HumanReadableString())
+		}
+	}
+
+	return nil
+}
+
 func (r *LuetSystemRepository) getRepoFile(c Client, key string) (*artifact.PackageArtifact, error) {
 
 	treeFile, err := r.GetRepositoryFile(key)
@@ -852,7 +919,12 @@ func (r *LuetSystemRepository) SyncBuildMetadata(ctx types.Context, path string)
 		return errors.Wrapf(err, "while unpacking: %s", REPOFILE_COMPILER_TREE_KEY)
 	}
 
-	for _, ai := range repo.GetTree().GetDatabase().World() {
+	// Artifacts of all the architectures served by the repository are retrieved
+	for _, a := range repo.GetIndex() {
+		ai := a.CompileSpec.GetPackage()
+		if ai == nil {
+			continue
+		}
 		// Retrieve remote repository.yaml for retrieve revision and date
 		file, err := c.DownloadFile(ai.GetMetadataFilePath())
 		if err != nil {
@@ -990,6 +1062,12 @@ func (r *LuetSystemRepository) Sync(ctx types.Context, force bool) (*LuetSystemR
 			os.RemoveAll(treefs)
 			// Remove previous meta dir
 			os.RemoveAll(metafs)
+			// Results solved against the previous revision are not useful anymore
+			if cacheDir := ctx.GetConfig().Solver.CacheDir; cacheDir != "" {
+				if err := solver.NewCache(cacheDir).Clean(); err != nil {
+					ctx.Warning("Failed cleaning the solver cache:", err.Error())
+				}
+			}
 		}
 		ctx.Debug("Decompress tree of the repository " + r.Name + "...")
 
@@ -1122,6 +1200,23 @@ func (r Repositories) SyncDatabase(d types.PackageDatabase) {
 	}
 }
 
+// Priorities returns the priority of the repositories providing each package, keyed by
+// package fingerprint. If a package is in more repositories, the highest priority is used.
+func (r Repositories) Priorities() map[string]int {
+	res := map[string]int{}
+	for _, repo := range r {
+		if repo.GetTree() == nil {
+			continue
+		}
+		for _, p := range repo.GetTree().GetDatabase().World() {
+			if prio, ok := res[p.GetFingerPrint()]; !ok || repo.GetPriority() < prio {
+				res[p.GetFingerPrint()] = repo.GetPriority()
+			}
+		}
+	}
+	return res
+}
+
 type PackageMatch struct {
 	Repo     *LuetSystemRepository
 	Artifact *artifact.PackageArtifact
@@ -1207,6 +1302,28 @@ func (re Repositories) SearchPackages(p string, t LuetSearchModeType) []PackageM
 	return matches
 }
 
+// SearchProviders returns the packages in the repositories providing the given virtual package
+func (re Repositories) SearchProviders(p *types.Package) []PackageMatch {
+	sort.Sort(re)
+	var matches []PackageMatch
+
+	for _, r := range re {
+		packs, err := r.GetTree().GetDatabase().FindPackages(p)
+		if err != nil {
+			continue
+		}
+		for _, pack := range packs {
+			if !pack.IsProviderOf(p) {
+				continue
+			}
+			a, _ := r.SearchArtefact(pack)
+			matches = append(matches, PackageMatch{Package: pack, Repo: r, Artifact: a})
+		}
+	}
+
+	return matches
+}
+
 func (re Repositories) SearchLabelMatch(s string) []PackageMatch {
 	return re.SearchPackages(s, SRegexLabel)
 }
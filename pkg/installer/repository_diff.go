@@ -0,0 +1,310 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+	pkg "github.com/mudler/luet/pkg/database"
+	"github.com/mudler/luet/pkg/tree"
+
+	"github.com/pkg/errors"
+)
+
+// SnapshotReferenceID returns the reference ID of the repository index of a snapshot
+func SnapshotReferenceID(id string) string {
+	return fmt.Sprintf("%s-%s", id, REPOSITORY_SPECFILE)
+}
+
+// Fetch downloads the repository index with the given reference ID (e.g. the one of a snapshot)
+// along with its tree and metadata, without touching the local repository cache.
+// The tree is loaded in memory, and the downloaded files are removed.
+// If referenceID is empty, the one of the repository is used.
+func (r *LuetSystemRepository) Fetch(ctx types.Context, referenceID string) (*LuetSystemRepository, error) {
+	if referenceID == "" {
+		referenceID = r.referenceID()
+	}
+
+	c := r.Client(ctx)
+	if c == nil {
+		return nil, errors.New("no client could be generated from repository")
+	}
+
+	file, err := c.DownloadFile(referenceID)
+	if err != nil {
+		return nil, errors.Wrap(err, "while downloading "+referenceID)
+	}
+	defer os.RemoveAll(file)
+
+	repo, err := r.ReadSpecFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	treefs, err := ctx.TempDir("treefs")
+	if err != nil {
+		return nil, errors.Wrap(err, "Error met while creating tempdir for rootfs")
+	}
+	defer os.RemoveAll(treefs)
+	metafs, err := ctx.TempDir("metafs")
+	if err != nil {
+		return nil, errors.Wrap(err, "Error met whilte creating tempdir for metafs")
+	}
+	defer os.RemoveAll(metafs)
+
+	for key, dst := range map[string]string{REPOFILE_TREE_KEY: treefs, REPOFILE_META_KEY: metafs} {
+		a, err := repo.getRepoFile(c, key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "while fetching '%s'", key)
+		}
+		err = a.Unpack(ctx, dst, false)
+		os.Remove(a.Path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "while unpacking '%s'", key)
+		}
+	}
+
+	return r.load(repo, treefs, metafs)
+}
+
+// LoadCached loads the copy of the repository available in the local cache,
+// as left by the last sync
+func (r *LuetSystemRepository) LoadCached(ctx types.Context) (*LuetSystemRepository, error) {
+	if !r.Cached {
+		return nil, fmt.Errorf("repository '%s' is not cached", r.GetName())
+	}
+
+	repobasedir := ctx.GetConfig().System.GetRepoDatabaseDirPath(r.GetName())
+	repo, err := r.ReadSpecFile(filepath.Join(repobasedir, r.referenceID()))
+	if err != nil {
+		return nil, errors.Wrapf(err, "repository '%s' was not synced yet", r.GetName())
+	}
+
+	treefs := r.GetTreePath()
+	if treefs == "" {
+		treefs = filepath.Join(repobasedir, "treefs")
+	}
+	metafs := r.GetMetaPath()
+	if metafs == "" {
+		metafs = filepath.Join(repobasedir, "metafs")
+	}
+
+	return r.load(repo, treefs, metafs)
+}
+
+// load sets the index and the tree of a repository from the unpacked metadata and tree
+func (r *LuetSystemRepository) load(repo *LuetSystemRepository, treefs, metafs string) (*LuetSystemRepository, error) {
+	meta, err := NewLuetSystemRepositoryMetadata(
+		filepath.Join(metafs, REPOSITORY_METAFILE), false,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "While processing "+REPOSITORY_METAFILE)
+	}
+	repo.SetIndex(meta.ToArtifactIndex())
+
+	reciper := tree.NewInstallerRecipe(pkg.NewInMemoryDatabase(false))
+	if err := reciper.Load(treefs); err != nil {
+		return nil, errors.Wrap(err, "Error met while loading tree")
+	}
+	repo.SetTree(reciper)
+	repo.SetTreePath(treefs)
+
+	r.fill(repo)
+	return repo, nil
+}
+
+// RepositoryRevision identifies one of the repositories compared in a RepositoryDiff
+type RepositoryRevision struct {
+	Revision   int    `json:"revision"`
+	LastUpdate string `json:"last_update"`
+}
+
+// VersionChange is a package which is available with different versions
+type VersionChange struct {
+	Package string   `json:"package"`
+	From    []string `json:"from"`
+	To      []string `json:"to"`
+}
+
+// DependencyChange lists the requires and conflicts changed for a package
+type DependencyChange struct {
+	Package          string   `json:"package"`
+	AddedRequires    []string `json:"added_requires,omitempty"`
+	RemovedRequires  []string `json:"removed_requires,omitempty"`
+	AddedConflicts   []string `json:"added_conflicts,omitempty"`
+	RemovedConflicts []string `json:"removed_conflicts,omitempty"`
+}
+
+// ChecksumChange is a package whose artifact changed without a version bump
+type ChecksumChange struct {
+	Package string `json:"package"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+}
+
+// RepositoryDiff is the difference between two revisions of a repository
+type RepositoryDiff struct {
+	Name         string             `json:"name"`
+	From         RepositoryRevision `json:"from"`
+	To           RepositoryRevision `json:"to"`
+	Added        []string           `json:"added"`
+	Removed      []string           `json:"removed"`
+	Changed      []VersionChange    `json:"changed"`
+	Dependencies []DependencyChange `json:"dependencies"`
+	Checksums    []ChecksumChange   `json:"checksums"`
+}
+
+// Empty returns true if there are no differences between the two repositories
+func (d *RepositoryDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0 &&
+		len(d.Dependencies) == 0 && len(d.Checksums) == 0
+}
+
+func packageKey(p *types.Package) string {
+	return fmt.Sprintf("%s/%s", p.GetCategory(), p.GetName())
+}
+
+func artifactChecksums(r *LuetSystemRepository) map[string]string {
+	res := map[string]string{}
+	for _, a := range r.GetIndex() {
+		if a.CompileSpec == nil || a.CompileSpec.GetPackage() == nil {
+			continue
+		}
+		sum := ""
+		for _, c := range a.Checksums.List() {
+			sum += fmt.Sprintf("%s:%s ", c[0], c[1])
+		}
+		if len(sum) > 0 {
+			sum = sum[:len(sum)-1]
+		}
+		res[a.CompileSpec.GetPackage().HumanReadableString()] = sum
+	}
+	return res
+}
+
+func dependencyStrings(packs []*types.Package) []string {
+	res := []string{}
+	for _, p := range packs {
+		res = append(res, p.DependencyString())
+	}
+	return res
+}
+
+// difference returns the elements of a missing in b, sorted
+func difference(a, b []string) []string {
+	m := map[string]interface{}{}
+	for _, s := range b {
+		m[s] = nil
+	}
+	res := []string{}
+	for _, s := range a {
+		if _, ok := m[s]; !ok {
+			res = append(res, s)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// DiffRepositories compares two loaded revisions of a repository, returning the packages added, removed and
+// changed in version, the packages with changed dependencies and the ones with changed artifacts
+func DiffRepositories(from, to *LuetSystemRepository) *RepositoryDiff {
+	d := &RepositoryDiff{
+		Name:         to.GetName(),
+		From:         RepositoryRevision{Revision: from.GetRevision(), LastUpdate: from.GetLastUpdate()},
+		To:           RepositoryRevision{Revision: to.GetRevision(), LastUpdate: to.GetLastUpdate()},
+		Added:        []string{},
+		Removed:      []string{},
+		Changed:      []VersionChange{},
+		Dependencies: []DependencyChange{},
+		Checksums:    []ChecksumChange{},
+	}
+
+	versions := func(r *LuetSystemRepository) (map[string][]string, map[string]*types.Package) {
+		byName := map[string][]string{}
+		byString := map[string]*types.Package{}
+		if r.GetTree() == nil {
+			return byName, byString
+		}
+		for _, p := range r.GetTree().GetDatabase().World() {
+			byName[packageKey(p)] = append(byName[packageKey(p)], p.GetVersion())
+			byString[p.HumanReadableString()] = p
+		}
+		return byName, byString
+	}
+	fromVersions, fromPackages := versions(from)
+	toVersions, toPackages := versions(to)
+
+	for name, vers := range toVersions {
+		old, ok := fromVersions[name]
+		if !ok {
+			for _, v := range vers {
+				d.Added = append(d.Added, fmt.Sprintf("%s-%s", name, v))
+			}
+			continue
+		}
+		if len(difference(vers, old)) != 0 || len(difference(old, vers)) != 0 {
+			sort.Strings(old)
+			sort.Strings(vers)
+			d.Changed = append(d.Changed, VersionChange{Package: name, From: old, To: vers})
+		}
+	}
+	for name, vers := range fromVersions {
+		if _, ok := toVersions[name]; !ok {
+			for _, v := range vers {
+				d.Removed = append(d.Removed, fmt.Sprintf("%s-%s", name, v))
+			}
+		}
+	}
+
+	fromSums := artifactChecksums(from)
+	toSums := artifactChecksums(to)
+	for s, p := range toPackages {
+		old, ok := fromPackages[s]
+		if !ok {
+			continue
+		}
+
+		newReq, oldReq := dependencyStrings(p.GetRequires()), dependencyStrings(old.GetRequires())
+		newConf, oldConf := dependencyStrings(p.GetConflicts()), dependencyStrings(old.GetConflicts())
+		c := DependencyChange{
+			Package:          s,
+			AddedRequires:    difference(newReq, oldReq),
+			RemovedRequires:  difference(oldReq, newReq),
+			AddedConflicts:   difference(newConf, oldConf),
+			RemovedConflicts: difference(oldConf, newConf),
+		}
+		if len(c.AddedRequires)+len(c.RemovedRequires)+len(c.AddedConflicts)+len(c.RemovedConflicts) != 0 {
+			d.Dependencies = append(d.Dependencies, c)
+		}
+
+		if fromSums[s] != toSums[s] {
+			d.Checksums = append(d.Checksums, ChecksumChange{Package: s, From: fromSums[s], To: toSums[s]})
+		}
+	}
+
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	sort.Slice(d.Changed, func(i, j int) bool { return d.Changed[i].Package < d.Changed[j].Package })
+	sort.Slice(d.Dependencies, func(i, j int) bool { return d.Dependencies[i].Package < d.Dependencies[j].Package })
+	sort.Slice(d.Checksums, func(i, j int) bool { return d.Checksums[i].Package < d.Checksums[j].Package })
+
+	return d
+}
@@ -84,6 +84,13 @@ func (l *dockerRepositoryGenerator) Initialize(path string, db types.PackageData
 			return nil
 		}
 
+		// SBOM documents are published alongside the metadata
+		if a.SBOM != "" {
+			if err := l.pushImageFromArtifact(artifact.NewPackageArtifact(filepath.Join(filepath.Dir(currentpath), a.SBOM)), l.b, true); err != nil {
+				return errors.Wrap(err, "while pushing sbom file associated to the artifact")
+			}
+		}
+
 		packageImage := fmt.Sprintf("%s:%s", l.imagePrefix, a.CompileSpec.GetPackage().ImageID())
 
 		if l.imagePush && l.b.ImageAvailable(packageImage) && !l.force {
@@ -71,6 +71,15 @@ func buildPackageIndex(ctx types.Context, path string, db types.PackageDatabase)
 			return nil
 		}
 
+		// SBOM documents are published alongside the metadata
+		if a.SBOM != "" {
+			if _, err := os.Stat(filepath.Join(filepath.Dir(currentpath), a.SBOM)); err != nil {
+				ctx.Warning(fmt.Sprintf("SBOM '%s' of package %s not found. Ignoring it.",
+					a.SBOM, a.CompileSpec.GetPackage().HumanReadableString()))
+				a.SBOM = ""
+			}
+		}
+
 		art = append(art, a)
 
 		return nil
@@ -463,6 +463,156 @@ urls:
 
 		})
 	})
+	Context("Architectures", func() {
+		It("filters packages and artifacts by architecture", func() {
+			// a is built for both architectures, b only for amd64, c only for arm64
+			// and d is a noarch package. e has no artifacts, f is restricted to arm64.
+			a := &types.Package{Name: "a", Category: "test", Version: "1.0"}
+			b := &types.Package{Name: "b", Category: "test", Version: "1.0"}
+			c := &types.Package{Name: "c", Category: "test", Version: "1.0"}
+			d := &types.Package{Name: "d", Category: "test", Version: "1.0"}
+			e := &types.Package{Name: "e", Category: "test", Version: "1.0"}
+			f := &types.Package{Name: "f", Category: "test", Version: "1.0", Arch: "arm64"}
+
+			builder := tree.NewInstallerRecipe(pkg.NewInMemoryDatabase(false))
+			for _, p := range []*types.Package{a, b, c, d, e, f} {
+				_, err := builder.GetDatabase().CreatePackage(p)
+				Expect(err).ToNot(HaveOccurred())
+			}
+
+			art := func(p *types.Package, arch string) *artifact.PackageArtifact {
+				built := p.Clone()
+				built.Arch = arch
+				return &artifact.PackageArtifact{
+					Path:        built.GetArtifactName() + ".package.tar",
+					CompileSpec: &types.LuetCompilationSpec{Package: built},
+					Arch:        arch,
+				}
+			}
+
+			repo := &LuetSystemRepository{
+				LuetRepository: &types.LuetRepository{Name: "test"},
+				Tree:           builder,
+				Index: compiler.ArtifactIndex{
+					art(a, "amd64"), art(a, "arm64"), art(b, "amd64"), art(c, "arm64"), art(d, ""), art(f, "arm64"),
+				},
+			}
+
+			Expect(repo.FilterArch("amd64")).To(Succeed())
+
+			names := []string{}
+			for _, p := range repo.GetTree().GetDatabase().World() {
+				names = append(names, p.GetName())
+			}
+			Expect(names).To(ConsistOf("a", "b", "d", "e"))
+
+			paths := []string{}
+			for _, a := range repo.GetIndex() {
+				paths = append(paths, a.Path)
+			}
+			Expect(paths).To(Equal([]string{
+				"a-test-1.0-amd64.package.tar",
+				"b-test-1.0-amd64.package.tar",
+				"d-test-1.0.package.tar",
+			}))
+
+			matches := Repositories{repo}.PackageMatches(types.Packages{c})
+			Expect(matches).To(BeEmpty())
+		})
+	})
+	Context("Diff", func() {
+		It("compares two revisions of a repository", func() {
+			a := &types.Package{Name: "a", Category: "test", Version: "1.0"}
+			b := &types.Package{Name: "b", Category: "test", Version: "1.0"}
+			c := &types.Package{Name: "c", Category: "test", Version: "1.0"}
+			a2 := &types.Package{Name: "a", Category: "test", Version: "1.1"}
+			b2 := &types.Package{Name: "b", Category: "test", Version: "1.0",
+				PackageRequires: []*types.Package{{Name: "c", Category: "test", Version: ">=1.0"}}}
+			d := &types.Package{Name: "d", Category: "test", Version: "0.1"}
+
+			repository := func(rev int, checksum string, packs ...*types.Package) *LuetSystemRepository {
+				builder := tree.NewInstallerRecipe(pkg.NewInMemoryDatabase(false))
+				index := compiler.ArtifactIndex{}
+				for _, p := range packs {
+					_, err := builder.GetDatabase().CreatePackage(p)
+					Expect(err).ToNot(HaveOccurred())
+					index = append(index, &artifact.PackageArtifact{
+						CompileSpec: &types.LuetCompilationSpec{Package: p},
+						Checksums:   artifact.Checksums{"sha256": checksum + p.GetName()},
+					})
+				}
+				return &LuetSystemRepository{LuetRepository: &types.LuetRepository{Name: "test", Revision: rev}, Tree: builder, Index: index}
+			}
+
+			from := repository(1, "old", a, b, c)
+			to := repository(2, "new", a2, b2, d)
+			// c is unchanged
+			to.Index[1].Checksums = artifact.Checksums{"sha256": "oldb"}
+
+			diff := DiffRepositories(from, to)
+			Expect(diff.Empty()).To(BeFalse())
+			Expect(diff.From.Revision).To(Equal(1))
+			Expect(diff.To.Revision).To(Equal(2))
+			Expect(diff.Added).To(Equal([]string{"test/d-0.1"}))
+			Expect(diff.Removed).To(Equal([]string{"test/c-1.0"}))
+			Expect(diff.Changed).To(Equal([]VersionChange{{Package: "test/a", From: []string{"1.0"}, To: []string{"1.1"}}}))
+			Expect(diff.Dependencies).To(Equal([]DependencyChange{{Package: "test/b-1.0", AddedRequires: []string{"test/c->=1.0"}, RemovedRequires: []string{}, AddedConflicts: []string{}, RemovedConflicts: []string{}}}))
+			Expect(diff.Checksums).To(BeEmpty())
+
+			to.Index[1].Checksums = artifact.Checksums{"sha256": "newb"}
+			diff = DiffRepositories(from, to)
+			Expect(diff.Checksums).To(Equal([]ChecksumChange{{Package: "test/b-1.0", From: "sha256:oldb", To: "sha256:newb"}}))
+
+			Expect(DiffRepositories(from, from).Empty()).To(BeTrue())
+		})
+
+		It("fetches revisions and snapshots of a repository", func() {
+			ctx := context.NewContext()
+			tmpdir, err := ioutil.TempDir("", "diff")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(tmpdir)
+
+			recipe := tree.NewCompilerRecipe(pkg.NewInMemoryDatabase(false))
+			Expect(recipe.Load("../../tests/fixtures/changelog")).ToNot(HaveOccurred())
+			for _, p := range recipe.GetDatabase().World() {
+				file := filepath.Join(tmpdir, p.GetName()+".tar")
+				Expect(ioutil.WriteFile(file, []byte(p.GetName()), os.ModePerm)).ToNot(HaveOccurred())
+				a := artifact.NewPackageArtifact(file)
+				a.CompileSpec = &types.LuetCompilationSpec{Package: p}
+				Expect(a.WriteYAML(tmpdir)).ToNot(HaveOccurred())
+			}
+
+			repo, err := GenerateRepository(
+				WithName("test"),
+				WithType("disk"),
+				WithUrls(tmpdir),
+				WithSource(tmpdir),
+				WithTree("../../tests/fixtures/changelog"),
+				WithDatabase(pkg.NewInMemoryDatabase(false)),
+				WithContext(ctx),
+			)
+			Expect(err).ToNot(HaveOccurred())
+			repo.SetSnapshotID("snap")
+			Expect(repo.Write(ctx, tmpdir, false, false)).ToNot(HaveOccurred())
+
+			sysRepo := NewSystemRepository(types.LuetRepository{Name: "test", Type: "disk", Urls: []string{tmpdir}})
+			latest, err := sysRepo.Fetch(ctx, "")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(latest.GetTree().GetDatabase().World())).To(Equal(2))
+			Expect(len(latest.GetIndex())).To(Equal(2))
+
+			snapshot, err := sysRepo.Fetch(ctx, SnapshotReferenceID("snap"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(snapshot.GetRevision()).To(Equal(latest.GetRevision()))
+			Expect(DiffRepositories(snapshot, latest).Empty()).To(BeTrue())
+
+			_, err = sysRepo.Fetch(ctx, SnapshotReferenceID("missing"))
+			Expect(err).To(HaveOccurred())
+
+			_, err = sysRepo.LoadCached(ctx)
+			Expect(err).To(HaveOccurred())
+		})
+	})
 	Context("Docker repository", func() {
 		repoImage := os.Getenv("UNIT_TEST_DOCKER_IMAGE_REPOSITORY")
 		ctx := context.NewContext()
@@ -3,6 +3,7 @@ package installer
 import (
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 
 	"github.com/hashicorp/go-multierror"
@@ -10,6 +11,7 @@ import (
 	"github.com/mudler/luet/pkg/api/core/types"
 	fileHelper "github.com/mudler/luet/pkg/helpers/file"
 	"github.com/mudler/luet/pkg/tree"
+	"github.com/pkg/errors"
 )
 
 type System struct {
@@ -24,6 +26,93 @@ func (s *System) World() (types.Packages, error) {
 	return s.Database.World(), nil
 }
 
+// Why returns the dependency chains which require the given installed package.
+// Each chain starts from a top level package, which is not required by any
+// other installed package, and ends with the package itself. A package which
+// is not required by others is returned as the only element of its chain.
+func (s *System) Why(p *types.Package) ([]types.Packages, error) {
+	db, err := s.Database.Copy()
+	if err != nil {
+		return nil, errors.Wrap(err, "while copying the system database")
+	}
+
+	pack, err := db.FindPackageCandidate(p)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s is not installed", p.HumanReadableString())
+	}
+
+	revdeps, err := db.GetRevdeps(pack)
+	if err != nil {
+		return nil, errors.Wrap(err, "while computing reverse dependencies")
+	}
+
+	set := map[string]*types.Package{pack.GetFingerPrint(): pack}
+	for _, r := range revdeps {
+		set[r.GetFingerPrint()] = r
+	}
+
+	// Direct requirements between the packages which are requiring the
+	// one we are looking for
+	requiredBy := map[string]map[string]*types.Package{}
+	for _, q := range set {
+		for _, r := range q.GetActiveRequires() {
+			for _, alt := range r.AnyOf() {
+				deps, _ := db.FindPackages(alt)
+				for _, d := range deps {
+					if _, ok := set[d.GetFingerPrint()]; !ok || d.Matches(q) {
+						continue
+					}
+					if _, ok := requiredBy[d.GetFingerPrint()]; !ok {
+						requiredBy[d.GetFingerPrint()] = map[string]*types.Package{}
+					}
+					requiredBy[d.GetFingerPrint()][q.GetFingerPrint()] = q
+				}
+			}
+		}
+	}
+
+	chains := []types.Packages{}
+	var walk func(current *types.Package, chain types.Packages)
+	walk = func(current *types.Package, chain types.Packages) {
+		chain = append(types.Packages{current}, chain...)
+		walked := false
+		for _, parent := range requiredBy[current.GetFingerPrint()] {
+			// Skip dependency cycles
+			if inPackage(chain, parent) {
+				continue
+			}
+			walked = true
+			walk(parent, chain)
+		}
+		if !walked {
+			chains = append(chains, chain)
+		}
+	}
+	walk(pack, types.Packages{})
+
+	sort.Slice(chains, func(i, j int) bool {
+		return chainString(chains[i]) < chainString(chains[j])
+	})
+	return chains, nil
+}
+
+func inPackage(list types.Packages, p *types.Package) bool {
+	for _, l := range list {
+		if l.Matches(p) {
+			return true
+		}
+	}
+	return false
+}
+
+func chainString(chain types.Packages) string {
+	res := ""
+	for _, p := range chain {
+		res += p.HumanReadableString() + " "
+	}
+	return res
+}
+
 func (s *System) OSCheck(ctx types.Context) (notFound types.Packages) {
 	s.buildFileIndex()
 	s.Lock()
@@ -87,4 +87,60 @@ var _ = Describe("System", func() {
 			Expect(len(notfound)).To(Equal(1))
 		})
 	})
+
+	Context("Why", func() {
+		var s *System
+		var a, b, c, d *types.Package
+
+		BeforeEach(func() {
+			db := pkg.NewInMemoryDatabase(false)
+			s = &System{Database: db}
+
+			c = &types.Package{Name: "c", Version: "1", Category: "t"}
+			b = &types.Package{Name: "b", Version: "1", Category: "t", PackageRequires: []*types.Package{c}}
+			a = &types.Package{Name: "a", Version: "1", Category: "t", PackageRequires: []*types.Package{b}}
+			d = &types.Package{Name: "d", Version: "1", Category: "t", PackageRequires: []*types.Package{c}}
+
+			for _, p := range []*types.Package{a, b, c, d} {
+				_, err := db.CreatePackage(p)
+				Expect(err).ToNot(HaveOccurred())
+			}
+		})
+
+		chains := func(res []types.Packages) [][]string {
+			out := [][]string{}
+			for _, c := range res {
+				chain := []string{}
+				for _, p := range c {
+					chain = append(chain, p.HumanReadableString())
+				}
+				out = append(out, chain)
+			}
+			return out
+		}
+
+		It("returns all the chains requiring a package", func() {
+			res, err := s.Why(c)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(chains(res)).To(Equal([][]string{
+				{"t/a-1", "t/b-1", "t/c-1"},
+				{"t/d-1", "t/c-1"},
+			}))
+
+			res, err = s.Why(b)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(chains(res)).To(Equal([][]string{{"t/a-1", "t/b-1"}}))
+		})
+
+		It("returns only the package if nothing requires it", func() {
+			res, err := s.Why(a)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(chains(res)).To(Equal([][]string{{"t/a-1"}}))
+		})
+
+		It("fails if the package is not installed", func() {
+			_, err := s.Why(&types.Package{Name: "e", Version: "1", Category: "t"})
+			Expect(err).To(HaveOccurred())
+		})
+	})
 })
@@ -0,0 +1,103 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package solver
+
+import (
+	"github.com/crillab/gophersat/bf"
+	gsolver "github.com/crillab/gophersat/solver"
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/pkg/errors"
+)
+
+// avoidedAlternatives returns the encoded packages of the alternative groups having an
+// installed alternative, which are not installed: the solver selects them only if needed,
+// so an installed alternative is preferred to the others.
+func (s *Solver) avoidedAlternatives() (map[string]interface{}, error) {
+	avoid := map[string]interface{}{}
+	if s.InstalledDatabase == nil {
+		return avoid, nil
+	}
+
+	installed := map[string]interface{}{}
+	for _, p := range s.Installed() {
+		installed[p.GetPackageName()] = nil
+	}
+	if len(installed) == 0 {
+		return avoid, nil
+	}
+
+	for _, p := range append(s.World(), s.Installed()...) {
+		for _, r := range p.GetActiveRequires() {
+			if len(r.GetAlternatives()) == 0 {
+				continue
+			}
+
+			candidates := types.Packages{}
+			hasInstalled := false
+			for _, alternative := range r.AnyOf() {
+				packages, err := s.DefinitionDatabase.FindPackages(alternative)
+				if err != nil {
+					continue
+				}
+				for _, c := range packages {
+					if _, ok := installed[c.GetPackageName()]; ok {
+						hasInstalled = true
+					} else {
+						candidates = append(candidates, c)
+					}
+				}
+			}
+			if !hasInstalled {
+				continue
+			}
+
+			for _, c := range candidates {
+				encoded, err := c.Encode(s.SolverDatabase)
+				if err != nil {
+					return nil, err
+				}
+				avoid[encoded] = nil
+			}
+		}
+	}
+	return avoid, nil
+}
+
+// solveAvoiding returns the model of the formula selecting the fewest of the
+// given variables, or nil if the formula is unsatisfiable
+func solveAvoiding(f bf.Formula, avoid map[string]interface{}) (map[string]bool, error) {
+	c, err := toCNF(f)
+	if err != nil {
+		return nil, errors.Wrap(err, "while converting the formula to prefer the installed alternatives")
+	}
+
+	lits := []gsolver.Lit{}
+	weights := []int{}
+	for idx, name := range c.vars {
+		if _, ok := avoid[name]; ok {
+			lits = append(lits, gsolver.IntToLit(int32(idx)))
+			weights = append(weights, 1)
+		}
+	}
+
+	pb := gsolver.ParseSliceNb(c.clauses, c.nbVars)
+	pb.SetCostFunc(lits, weights)
+	gs := gsolver.New(pb)
+	if gs.Minimize() < 0 {
+		return nil, nil
+	}
+	return c.decode(gs.Model()), nil
+}
@@ -0,0 +1,127 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package solver_test
+
+import (
+	"errors"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+
+	pkg "github.com/mudler/luet/pkg/database"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/mudler/luet/pkg/solver"
+)
+
+var _ = Describe("Alternative dependencies", func() {
+	var dbInstalled, dbDefinitions types.PackageDatabase
+	var s types.PackageSolver
+
+	mta := &types.Package{
+		Name: "postfix", Category: "mta", Version: ">=0",
+		Alternatives: []*types.Package{{Name: "exim", Category: "mta", Version: ">=0"}},
+	}
+
+	BeforeEach(func() {
+		dbInstalled = pkg.NewInMemoryDatabase(false)
+		dbDefinitions = pkg.NewInMemoryDatabase(false)
+		s = NewSolver(types.SolverOptions{Type: types.SolverSingleCoreSimple}, dbInstalled, dbDefinitions, pkg.NewInMemoryDatabase(false))
+
+		create(dbDefinitions, &types.Package{Name: "postfix", Category: "mta", Version: "1.0"})
+		create(dbDefinitions, &types.Package{Name: "exim", Category: "mta", Version: "1.0"})
+		create(dbDefinitions, &types.Package{Name: "cron", Category: "app", Version: "1.0", PackageRequires: []*types.Package{mta}})
+	})
+
+	It("installs one of the alternatives", func() {
+		solution, err := s.Install([]*types.Package{{Name: "cron", Category: "app", Version: "1.0"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(trueAssertions(solution)).To(ContainElement("app/cron-1.0"))
+		Expect(trueAssertions(solution)).To(Or(ContainElement("mta/postfix-1.0"), ContainElement("mta/exim-1.0")))
+		Expect(len(trueAssertions(solution))).To(Equal(2))
+	})
+
+	It("prefers an installed alternative", func() {
+		create(dbInstalled, &types.Package{Name: "exim", Category: "mta", Version: "1.0"})
+
+		solution, err := s.Install([]*types.Package{{Name: "cron", Category: "app", Version: "1.0"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(trueAssertions(solution)).To(ConsistOf("app/cron-1.0", "mta/exim-1.0"))
+	})
+
+	It("prefers an installed alternative which is not available anymore", func() {
+		create(dbInstalled, &types.Package{Name: "exim", Category: "mta", Version: "0.9"})
+
+		for _, t := range []types.SolverType{types.SolverSingleCoreSimple, types.SolverOptimizing} {
+			s = NewSolver(types.SolverOptions{Type: t}, dbInstalled, dbDefinitions, pkg.NewInMemoryDatabase(false))
+			solution, err := s.Install([]*types.Package{{Name: "cron", Category: "app", Version: "1.0"}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(trueAssertions(solution)).To(ConsistOf("app/cron-1.0", "mta/exim-1.0"))
+		}
+	})
+
+	It("uses an alternative when the others conflict", func() {
+		create(dbDefinitions, &types.Package{Name: "sendmail", Category: "mta", Version: "1.0",
+			PackageConflicts: []*types.Package{{Name: "postfix", Category: "mta", Version: ">=0"}}})
+		create(dbInstalled, &types.Package{Name: "sendmail", Category: "mta", Version: "1.0",
+			PackageConflicts: []*types.Package{{Name: "postfix", Category: "mta", Version: ">=0"}}})
+
+		solution, err := s.Install([]*types.Package{{Name: "cron", Category: "app", Version: "1.0"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(trueAssertions(solution)).To(ConsistOf("app/cron-1.0", "mta/exim-1.0", "mta/sendmail-1.0"))
+	})
+
+	It("conflicts with all the alternatives of a group", func() {
+		create(dbDefinitions, &types.Package{Name: "nullmailer", Category: "mta", Version: "1.0",
+			PackageConflicts: []*types.Package{mta}})
+		create(dbInstalled, &types.Package{Name: "exim", Category: "mta", Version: "1.0"})
+
+		_, err := s.Install([]*types.Package{{Name: "nullmailer", Category: "mta", Version: "1.0"}})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("explains when no alternative can be installed", func() {
+		create(dbDefinitions, &types.Package{Name: "nullmailer", Category: "mta", Version: "1.0",
+			PackageConflicts: []*types.Package{mta}})
+		create(dbInstalled, &types.Package{Name: "nullmailer", Category: "mta", Version: "1.0",
+			PackageConflicts: []*types.Package{mta}})
+
+		_, err := s.Install([]*types.Package{{Name: "cron", Category: "app", Version: "1.0"}})
+		Expect(err).To(HaveOccurred())
+		unsat := &UnsatError{}
+		Expect(errors.As(err, &unsat)).To(BeTrue())
+		Expect(unsat.Explanation.String()).To(ContainSubstring("app/cron-1.0 requires one of mta/postfix>=0, mta/exim>=0"))
+	})
+
+	It("orders the selected alternative before the package", func() {
+		create(dbInstalled, &types.Package{Name: "exim", Category: "mta", Version: "1.0"})
+
+		solution, err := s.Install([]*types.Package{{Name: "cron", Category: "app", Version: "1.0"}})
+		Expect(err).ToNot(HaveOccurred())
+		ordered, err := solution.Order(dbDefinitions, "cron-app-1.0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(trueAssertions(ordered)).To(Equal([]string{"mta/exim-1.0", "app/cron-1.0"}))
+	})
+
+	It("finds the reverse dependencies through the alternatives", func() {
+		exim, err := dbDefinitions.FindPackage(&types.Package{Name: "exim", Category: "mta", Version: "1.0"})
+		Expect(err).ToNot(HaveOccurred())
+		revdeps, err := dbDefinitions.GetRevdeps(exim)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(revdeps)).To(Equal(1))
+		Expect(revdeps[0].GetName()).To(Equal("cron"))
+	})
+})
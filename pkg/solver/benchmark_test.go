@@ -20,6 +20,7 @@ import (
 	"io/ioutil"
 	"os"
 	"strconv"
+	"testing"
 
 	types "github.com/mudler/luet/pkg/api/core/types"
 	pkg "github.com/mudler/luet/pkg/database"
@@ -95,7 +96,7 @@ var _ = Describe("Solver Benchmarks", func() {
 			db = pkg.NewInMemoryDatabase(false)
 			dbInstalled = pkg.NewInMemoryDatabase(false)
 			dbDefinitions = pkg.NewInMemoryDatabase(false)
-			s = NewSolver(types.SolverOptions{Type: types.SolverSingleCoreSimple, Concurrency: 10}, dbInstalled, dbDefinitions, db)
+			s = NewSolver(types.SolverOptions{Type: types.SolverConcurrent, Concurrency: 10}, dbInstalled, dbDefinitions, db)
 			if os.Getenv("BENCHMARK_TESTS") != "true" {
 				Skip("BENCHMARK_TESTS not enabled")
 			}
@@ -153,7 +154,7 @@ var _ = Describe("Solver Benchmarks", func() {
 
 			//	dbInstalled = pkg.NewInMemoryDatabase(false)
 			dbDefinitions = pkg.NewInMemoryDatabase(false)
-			s = NewSolver(types.SolverOptions{Type: types.SolverSingleCoreSimple, Concurrency: 100}, dbInstalled, dbDefinitions, db)
+			s = NewSolver(types.SolverOptions{Type: types.SolverConcurrent, Concurrency: 100}, dbInstalled, dbDefinitions, db)
 			if os.Getenv("BENCHMARK_TESTS") != "true" {
 				Skip("BENCHMARK_TESTS not enabled")
 			}
@@ -298,3 +299,53 @@ var _ = Describe("Solver Benchmarks", func() {
 	})
 
 })
+
+// benchmarkTree returns a definition database with n chains of packages, each
+// package available in two versions and requiring the next one with a selector
+func benchmarkTree(b *testing.B, n int) (types.PackageDatabase, types.Packages) {
+	defs := pkg.NewInMemoryDatabase(false)
+	wanted := types.Packages{}
+	for i := 0; i < n; i++ {
+		chain := []string{"A", "B", "C", "D"}
+		for j, name := range chain {
+			for _, v := range []string{"1.0", "2.0"} {
+				requires := []*types.Package{}
+				if j < len(chain)-1 {
+					requires = append(requires, &types.Package{Name: chain[j+1] + strconv.Itoa(i), Category: "bench", Version: ">=1.0"})
+				}
+				p := types.NewPackage(name+strconv.Itoa(i), v, requires, []*types.Package{})
+				p.Category = "bench"
+				if _, err := defs.CreatePackage(p); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+		if i%10 == 0 {
+			wanted = append(wanted, &types.Package{Name: "A" + strconv.Itoa(i), Category: "bench", Version: "2.0"})
+		}
+	}
+	return defs, wanted
+}
+
+func benchmarkInstall(b *testing.B, opts types.SolverOptions) {
+	defs, wanted := benchmarkTree(b, 500)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s := NewSolver(opts, pkg.NewInMemoryDatabase(false), defs, pkg.NewInMemoryDatabase(false))
+		if _, err := s.Install(wanted); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkInstallSingleCore(b *testing.B) {
+	benchmarkInstall(b, types.SolverOptions{Type: types.SolverSingleCoreSimple})
+}
+
+func BenchmarkInstallConcurrent(b *testing.B) {
+	benchmarkInstall(b, types.SolverOptions{Type: types.SolverConcurrent, Concurrency: 4})
+}
+
+func BenchmarkInstallConcurrentRace(b *testing.B) {
+	benchmarkInstall(b, types.SolverOptions{Type: types.SolverConcurrent, Concurrency: 4, Race: true})
+}
@@ -0,0 +1,287 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package solver
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	types "github.com/mudler/luet/pkg/api/core/types"
+	"github.com/pkg/errors"
+)
+
+// Cache is an on-disk cache of solver results.
+// Results are keyed by a hash of the installed and definition databases, of the request
+// and of the solver options, so they are reused only when solving the same request
+// against the same packages.
+type Cache struct {
+	path string
+}
+
+type cacheEntry struct {
+	Packages   types.Packages           `json:"packages,omitempty"`
+	Assertions types.PackagesAssertions `json:"assertions,omitempty"`
+}
+
+// NewCache returns a solver cache stored in the given directory
+func NewCache(path string) *Cache {
+	return &Cache{path: path}
+}
+
+// Clean invalidates all the cached results
+func (c *Cache) Clean() error {
+	return os.RemoveAll(c.path)
+}
+
+func (c *Cache) file(key string) string {
+	return filepath.Join(c.path, key+".json")
+}
+
+func (c *Cache) get(key string) (*cacheEntry, bool) {
+	dat, err := ioutil.ReadFile(c.file(key))
+	if err != nil {
+		return nil, false
+	}
+	e := &cacheEntry{}
+	if err := json.Unmarshal(dat, e); err != nil {
+		return nil, false
+	}
+	return e, true
+}
+
+func (c *Cache) put(key string, e *cacheEntry) error {
+	dat, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.path, os.ModePerm); err != nil {
+		return errors.Wrap(err, "while creating the solver cache")
+	}
+
+	// Write to a temporary file first, so concurrent runs never read partial results
+	f, err := ioutil.TempFile(c.path, key)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(dat); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), c.file(key))
+}
+
+// databaseHash returns a hash of the packages in the database, considering only the
+// fields which are relevant to the solver
+func databaseHash(db types.PackageDatabase) string {
+	deps := func(list []*types.Package) string {
+		res := []string{}
+		for _, d := range list {
+			res = append(res, d.DependencyString())
+		}
+		sort.Strings(res)
+		return strings.Join(res, ",")
+	}
+
+	lines := []string{}
+	for _, p := range db.World() {
+		lines = append(lines, fmt.Sprintf("%s|%s|%s|%s|%s|%s|%t",
+			p.GetFingerPrint(),
+			deps(p.GetActiveRequires()),
+			deps(p.GetActiveConflicts()),
+			deps(p.GetProvides()),
+			p.GetBuildTimestamp(),
+			p.GetArch(),
+			p.IsHidden(),
+		))
+	}
+	sort.Strings(lines)
+
+	h := sha256.New()
+	for _, l := range lines {
+		io.WriteString(h, l+"\n")
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// CachedSolver is a PackageSolver which caches on disk the results of
+// install and upgrade requests
+type CachedSolver struct {
+	types.PackageSolver
+
+	Cache *Cache
+
+	options            types.SolverOptions
+	installedDatabase  types.PackageDatabase
+	definitionDatabase types.PackageDatabase
+	resolver           types.PackageResolver
+}
+
+// NewCachedSolver wraps a solver, caching its results in the given cache
+func NewCachedSolver(s types.PackageSolver, c *Cache, t types.SolverOptions, installed, definitiondb types.PackageDatabase, re types.PackageResolver) *CachedSolver {
+	return &CachedSolver{
+		PackageSolver:      s,
+		Cache:              c,
+		options:            t,
+		installedDatabase:  installed,
+		definitionDatabase: definitiondb,
+		resolver:           re,
+	}
+}
+
+// SetDefinitionDatabase is a setter for the definition Database
+func (s *CachedSolver) SetDefinitionDatabase(db types.PackageDatabase) {
+	s.definitionDatabase = db
+	s.PackageSolver.SetDefinitionDatabase(db)
+}
+
+// SetResolver is a setter for the unsat resolver backend
+func (s *CachedSolver) SetResolver(r types.PackageResolver) {
+	s.resolver = r
+	s.PackageSolver.SetResolver(r)
+}
+
+func (s *CachedSolver) key(op string, request ...interface{}) string {
+	priorities := []string{}
+	for k, v := range s.options.Priorities {
+		priorities = append(priorities, fmt.Sprintf("%s=%d", k, v))
+	}
+	sort.Strings(priorities)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%t\n%s\n%T\n", op, s.options.Type, s.options.Race, strings.Join(priorities, ","), s.resolver)
+	for _, r := range request {
+		if packs, ok := r.(types.Packages); ok {
+			fps := []string{}
+			for _, p := range packs {
+				fps = append(fps, p.GetFingerPrint())
+			}
+			sort.Strings(fps)
+			r = strings.Join(fps, ",")
+		}
+		fmt.Fprintf(h, "%v\n", r)
+	}
+	fmt.Fprintf(h, "%s\n%s\n", databaseHash(s.installedDatabase), databaseHash(s.definitionDatabase))
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// lookup returns the package from the solver databases, as the cached
+// entries might be outdated in fields which are not relevant to the solver (e.g. paths)
+func (s *CachedSolver) lookup(p *types.Package) (*types.Package, bool) {
+	if pack, err := s.definitionDatabase.FindPackage(p); err == nil {
+		return pack, true
+	}
+	if pack, err := s.installedDatabase.FindPackage(p); err == nil {
+		return pack, true
+	}
+	return nil, false
+}
+
+func (s *CachedSolver) load(key string) (types.Packages, types.PackagesAssertions, bool) {
+	e, ok := s.Cache.get(key)
+	if !ok {
+		return nil, nil, false
+	}
+
+	packs := types.Packages{}
+	for _, p := range e.Packages {
+		pack, ok := s.lookup(p)
+		if !ok {
+			return nil, nil, false
+		}
+		packs = append(packs, pack)
+	}
+
+	assertions := types.PackagesAssertions{}
+	for _, a := range e.Assertions {
+		pack, ok := s.lookup(a.Package)
+		if !ok {
+			return nil, nil, false
+		}
+		a.Package = pack
+		assertions = append(assertions, a)
+	}
+
+	return packs, assertions, true
+}
+
+func (s *CachedSolver) install(op string, c types.Packages, f func(types.Packages) (types.PackagesAssertions, error)) (types.PackagesAssertions, error) {
+	key := s.key(op, c)
+	if _, assertions, ok := s.load(key); ok {
+		return assertions, nil
+	}
+
+	assertions, err := f(c)
+	if err != nil {
+		return assertions, err
+	}
+
+	// Failing to cache is not fatal, the result is still valid
+	s.Cache.put(key, &cacheEntry{Assertions: assertions})
+	return assertions, nil
+}
+
+// Install returns the assertions needed to install the given packages,
+// from the cache if the same request was already solved
+func (s *CachedSolver) Install(c types.Packages) (types.PackagesAssertions, error) {
+	return s.install("install", c, s.PackageSolver.Install)
+}
+
+// RelaxedInstall returns the assertions needed to install the given packages,
+// from the cache if the same request was already solved
+func (s *CachedSolver) RelaxedInstall(c types.Packages) (types.PackagesAssertions, error) {
+	return s.install("relaxed-install", c, s.PackageSolver.RelaxedInstall)
+}
+
+func (s *CachedSolver) upgrade(key string, f func() (types.Packages, types.PackagesAssertions, error)) (types.Packages, types.PackagesAssertions, error) {
+	if packs, assertions, ok := s.load(key); ok {
+		return packs, assertions, nil
+	}
+
+	packs, assertions, err := f()
+	if err != nil {
+		return packs, assertions, err
+	}
+
+	s.Cache.put(key, &cacheEntry{Packages: packs, Assertions: assertions})
+	return packs, assertions, nil
+}
+
+// Upgrade returns the packages to remove and the assertions to upgrade the system,
+// from the cache if the same request was already solved
+func (s *CachedSolver) Upgrade(checkconflicts, full bool) (types.Packages, types.PackagesAssertions, error) {
+	return s.upgrade(s.key("upgrade", checkconflicts, full), func() (types.Packages, types.PackagesAssertions, error) {
+		return s.PackageSolver.Upgrade(checkconflicts, full)
+	})
+}
+
+// UpgradeUniverse returns the packages to remove and the assertions to upgrade the system,
+// from the cache if the same request was already solved
+func (s *CachedSolver) UpgradeUniverse(dropremoved bool) (types.Packages, types.PackagesAssertions, error) {
+	return s.upgrade(s.key("upgrade-universe", dropremoved), func() (types.Packages, types.PackagesAssertions, error) {
+		return s.PackageSolver.UpgradeUniverse(dropremoved)
+	})
+}
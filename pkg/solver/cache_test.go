@@ -0,0 +1,153 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package solver_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+
+	pkg "github.com/mudler/luet/pkg/database"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/mudler/luet/pkg/solver"
+)
+
+// countingSolver counts the requests which reach the real solver
+type countingSolver struct {
+	types.PackageSolver
+	installs, upgrades int
+}
+
+func (s *countingSolver) Install(p types.Packages) (types.PackagesAssertions, error) {
+	s.installs++
+	return s.PackageSolver.Install(p)
+}
+
+func (s *countingSolver) Upgrade(checkconflicts, full bool) (types.Packages, types.PackagesAssertions, error) {
+	s.upgrades++
+	return s.PackageSolver.Upgrade(checkconflicts, full)
+}
+
+var _ = Describe("Solver cache", func() {
+	var dbInstalled, dbDefinitions types.PackageDatabase
+	var dir string
+	var counter *countingSolver
+	var s *CachedSolver
+
+	opts := types.SolverOptions{Type: types.SolverSingleCoreSimple}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "solvercache")
+		Expect(err).ToNot(HaveOccurred())
+
+		dbInstalled = pkg.NewInMemoryDatabase(false)
+		dbDefinitions = pkg.NewInMemoryDatabase(false)
+
+		for _, p := range []*types.Package{
+			{Name: "a", Category: "test", Version: "1.0", PackageRequires: []*types.Package{{Name: "b", Category: "test", Version: ">=0"}}},
+			{Name: "b", Category: "test", Version: "1.0"},
+			{Name: "b", Category: "test", Version: "1.1"},
+		} {
+			_, err := dbDefinitions.CreatePackage(p)
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		counter = &countingSolver{PackageSolver: NewSolver(opts, dbInstalled, dbDefinitions, pkg.NewInMemoryDatabase(false))}
+		s = NewCachedSolver(counter, NewCache(dir), opts, dbInstalled, dbDefinitions, &Explainer{})
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("reuses the results of the same request", func() {
+		solution, err := s.Install(types.Packages{{Name: "a", Category: "test", Version: "1.0"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(trueAssertions(solution)).To(ConsistOf("test/a-1.0", "test/b-1.1"))
+		Expect(counter.installs).To(Equal(1))
+
+		cached, err := s.Install(types.Packages{{Name: "a", Category: "test", Version: "1.0"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(trueAssertions(cached)).To(ConsistOf("test/a-1.0", "test/b-1.1"))
+		Expect(counter.installs).To(Equal(1))
+
+		files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(files)).To(Equal(1))
+	})
+
+	It("solves again when the databases change", func() {
+		_, err := s.Install(types.Packages{{Name: "a", Category: "test", Version: "1.0"}})
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = dbDefinitions.CreatePackage(&types.Package{Name: "b", Category: "test", Version: "1.2"})
+		Expect(err).ToNot(HaveOccurred())
+
+		solution, err := s.Install(types.Packages{{Name: "a", Category: "test", Version: "1.0"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(trueAssertions(solution)).To(ConsistOf("test/a-1.0", "test/b-1.2"))
+		Expect(counter.installs).To(Equal(2))
+
+		_, err = dbInstalled.CreatePackage(&types.Package{Name: "b", Category: "test", Version: "1.0"})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = s.Install(types.Packages{{Name: "a", Category: "test", Version: "1.0"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(counter.installs).To(Equal(3))
+	})
+
+	It("caches upgrades", func() {
+		_, err := dbInstalled.CreatePackage(&types.Package{Name: "b", Category: "test", Version: "1.0"})
+		Expect(err).ToNot(HaveOccurred())
+
+		uninstall, solution, err := s.Upgrade(false, true)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(counter.upgrades).To(Equal(1))
+
+		cachedUninstall, cachedSolution, err := s.Upgrade(false, true)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(counter.upgrades).To(Equal(1))
+		Expect(cachedUninstall).To(Equal(uninstall))
+		Expect(trueAssertions(cachedSolution)).To(Equal(trueAssertions(solution)))
+
+		_, _, err = s.Upgrade(true, true)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(counter.upgrades).To(Equal(2))
+	})
+
+	It("is invalidated when cleaned", func() {
+		_, err := s.Install(types.Packages{{Name: "a", Category: "test", Version: "1.0"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(NewCache(dir).Clean()).To(Succeed())
+
+		_, err = s.Install(types.Packages{{Name: "a", Category: "test", Version: "1.0"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(counter.installs).To(Equal(2))
+	})
+
+	It("is enabled by the solver options", func() {
+		solv := NewSolver(types.SolverOptions{Type: types.SolverSingleCoreSimple, CacheDir: dir}, dbInstalled, dbDefinitions, pkg.NewInMemoryDatabase(false))
+		Expect(solv).To(BeAssignableToTypeOf(&CachedSolver{}))
+
+		solution, err := solv.Install(types.Packages{{Name: "a", Category: "test", Version: "1.0"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(trueAssertions(solution)).To(ConsistOf("test/a-1.0", "test/b-1.1"))
+	})
+})
@@ -103,7 +103,7 @@ func parseVars(r io.Reader) (map[string]string, error) {
 }
 
 // Solve tries to find the MUS (minimum unsat) formula from the original problem.
-// it returns an error with the decoded dimacs
+// it returns an UnsatError explaining the dependencies and conflicts found in it
 func (*Explainer) Solve(f bf.Formula, s types.PackageSolver) (types.PackagesAssertions, error) {
 	buf := bytes.NewBufferString("")
 	if err := bf.Dimacs(f, buf); err != nil {
@@ -131,5 +131,11 @@ func (*Explainer) Solve(f bf.Formula, s types.PackageSolver) (types.PackagesAsse
 		return nil, errors.Wrap(err, "could not parse dimacs")
 	}
 
-	return nil, fmt.Errorf("could not satisfy the constraints: \n%s", res)
+	explanation, err := explainCore(variables, pb2.CNF(), s)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not explain the constraints")
+	}
+	explanation.Constraints = res
+
+	return nil, &UnsatError{Explanation: explanation}
 }
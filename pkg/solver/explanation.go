@@ -0,0 +1,362 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package solver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	types "github.com/mudler/luet/pkg/api/core/types"
+)
+
+// Kinds of the steps of an Explanation
+const (
+	ExplanationRequested       = "requested"
+	ExplanationInstalled       = "installed"
+	ExplanationRequires        = "requires"
+	ExplanationVersionConflict = "version_conflict"
+	ExplanationConflicts       = "conflicts"
+	ExplanationConstraint      = "constraint"
+)
+
+var explanationOrder = map[string]int{
+	ExplanationRequested:       0,
+	ExplanationInstalled:       1,
+	ExplanationRequires:        2,
+	ExplanationVersionConflict: 3,
+	ExplanationConflicts:       4,
+	ExplanationConstraint:      5,
+}
+
+// ExplanationStep is a single constraint of the minimal unsatisfiable core,
+// translated to the dependency relation it comes from
+type ExplanationStep struct {
+	Kind        string   `json:"kind"`
+	Packages    []string `json:"packages"`
+	Requirement string   `json:"requirement,omitempty"`
+	Message     string   `json:"message"`
+}
+
+// Explanation describes why a set of packages can't be installed, as the
+// chain of dependencies and conflicts which cannot be satisfied together
+type Explanation struct {
+	Steps []ExplanationStep `json:"steps"`
+	// Constraints is the decoded minimal unsatisfiable formula
+	Constraints string `json:"constraints"`
+}
+
+func (e *Explanation) String() string {
+	lines := []string{}
+	for _, s := range e.Steps {
+		lines = append(lines, s.Message)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// JSON returns the JSON representation of the explanation
+func (e *Explanation) JSON() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+// UnsatError is returned when the solver cannot find a solution. It carries
+// the explanation of the conflict, which can be retrieved with errors.As
+type UnsatError struct {
+	Explanation *Explanation
+}
+
+func (e *UnsatError) Error() string {
+	return fmt.Sprintf("could not satisfy the constraints:\n%s", e.Explanation.String())
+}
+
+// literal is a variable of a clause, decoded to the package it represents
+type literal struct {
+	name     string
+	negative bool
+	pack     *types.Package
+}
+
+func (l literal) String() string {
+	if l.negative {
+		return fmt.Sprintf("!(%s)", l.name)
+	}
+	return l.name
+}
+
+// describe returns a short representation of a package, keeping the
+// operators of selectors (e.g. cat/foo>=1.0)
+func describe(p *types.Package) string {
+	name := p.GetName()
+	if p.GetCategory() != "" {
+		name = fmt.Sprintf("%s/%s", p.GetCategory(), name)
+	}
+	switch {
+	case p.GetVersion() == "":
+		return name
+	case p.IsSelector():
+		return name + p.GetVersion()
+	default:
+		return fmt.Sprintf("%s-%s", name, p.GetVersion())
+	}
+}
+
+// declares returns the dependency of the list matching all the given packages
+func declares(deps types.Packages, targets []*types.Package) *types.Package {
+DEPS:
+	for _, d := range deps {
+		for _, t := range targets {
+			if !anyMatches(d.AnyOf(), t) {
+				continue DEPS
+			}
+		}
+		return d
+	}
+	return nil
+}
+
+// anyMatches returns true if the package satisfies any of the dependencies
+func anyMatches(deps []*types.Package, t *types.Package) bool {
+	for _, d := range deps {
+		if !d.AtomMatches(t) {
+			continue
+		}
+		switch {
+		case d.IsSelector():
+			if ok, _ := d.SelectorMatchVersion(t.GetVersion(), nil); !ok {
+				continue
+			}
+		case d.GetVersion() != "" && d.GetVersion() != t.GetVersion():
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// describeDependency returns the human readable form of a requires or conflicts entry
+func describeDependency(d *types.Package) string {
+	if len(d.GetAlternatives()) == 0 {
+		return describe(d)
+	}
+	res := []string{}
+	for _, a := range d.AnyOf() {
+		res = append(res, describe(a))
+	}
+	return "one of " + strings.Join(res, ", ")
+}
+
+type explainer struct {
+	solver *Solver
+}
+
+func (e *explainer) decode(name string) *types.Package {
+	if e.solver == nil || e.solver.SolverDatabase == nil || name == "" {
+		return nil
+	}
+	p, err := types.DecodePackage(name, e.solver.SolverDatabase)
+	if err != nil {
+		return nil
+	}
+	return p
+}
+
+func (e *explainer) wanted(p *types.Package) bool {
+	if e.solver == nil {
+		return false
+	}
+	for _, w := range e.solver.Wanted {
+		if w.Matches(p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *explainer) installed(p *types.Package) bool {
+	if e.solver == nil || e.solver.InstalledDatabase == nil {
+		return false
+	}
+	_, err := e.solver.InstalledDatabase.FindPackage(p)
+	return err == nil
+}
+
+func names(lits []literal) []string {
+	res := []string{}
+	for _, l := range lits {
+		res = append(res, describe(l.pack))
+	}
+	return res
+}
+
+// step translates a clause to the relation between packages it encodes
+func (e *explainer) step(clause []literal) ExplanationStep {
+	raw := []string{}
+	for _, l := range clause {
+		raw = append(raw, l.String())
+	}
+	fallback := ExplanationStep{
+		Kind:     ExplanationConstraint,
+		Packages: []string{},
+		Message:  strings.Join(raw, " or "),
+	}
+
+	var positive, negative []literal
+	for _, l := range clause {
+		if l.pack == nil {
+			return fallback
+		}
+		if l.negative {
+			negative = append(negative, l)
+		} else {
+			positive = append(positive, l)
+		}
+	}
+
+	switch {
+	case len(negative) == 0 && len(positive) == 1:
+		p := positive[0].pack
+		s := ExplanationStep{Packages: names(positive)}
+		switch {
+		case e.wanted(p):
+			s.Kind, s.Message = ExplanationRequested, fmt.Sprintf("%s is requested", describe(p))
+		case e.installed(p):
+			s.Kind, s.Message = ExplanationInstalled, fmt.Sprintf("%s is installed", describe(p))
+		default:
+			s.Kind, s.Message = ExplanationConstraint, fmt.Sprintf("%s is required", describe(p))
+		}
+		return s
+	case len(negative) == 1 && len(positive) > 0:
+		a := negative[0].pack
+		targets := []*types.Package{}
+		for _, l := range positive {
+			targets = append(targets, l.pack)
+		}
+		s := ExplanationStep{Kind: ExplanationRequires, Packages: append(names(negative), names(positive)...)}
+		if r := declares(a.GetRequires(), targets); r != nil {
+			s.Requirement = describeDependency(r)
+		} else if len(positive) == 1 {
+			s.Requirement = describe(positive[0].pack)
+		} else {
+			s.Requirement = "one of " + strings.Join(names(positive), ", ")
+		}
+		s.Message = fmt.Sprintf("%s requires %s", describe(a), s.Requirement)
+		return s
+	case len(positive) == 0 && len(negative) >= 2:
+		// Two versions of the same package (possibly guarded by the package
+		// requiring them) can't be selected together
+		for i := range negative {
+			for j := i + 1; j < len(negative); j++ {
+				a, b := negative[i].pack, negative[j].pack
+				if a.AtomMatches(b) && !a.Matches(b) {
+					pair := []string{describe(a), describe(b)}
+					sort.Strings(pair)
+					return ExplanationStep{
+						Kind:     ExplanationVersionConflict,
+						Packages: pair,
+						Message:  fmt.Sprintf("%s and %s conflict because only one version may be installed", pair[0], pair[1]),
+					}
+				}
+			}
+		}
+		if len(negative) == 2 {
+			a, b := negative[0].pack, negative[1].pack
+			if declares(a.GetConflicts(), []*types.Package{b}) == nil &&
+				declares(b.GetConflicts(), []*types.Package{a}) != nil {
+				a, b = b, a
+			}
+			return ExplanationStep{
+				Kind:     ExplanationConflicts,
+				Packages: []string{describe(a), describe(b)},
+				Message:  fmt.Sprintf("%s conflicts with %s", describe(a), describe(b)),
+			}
+		}
+	}
+	return fallback
+}
+
+// parseClauses reads the clauses of a CNF in DIMACS format, decoding the variables
+// with the given names
+func (e *explainer) parseClauses(vars map[string]string, dimacs string) ([][]literal, error) {
+	res := [][]literal{}
+	sc := bufio.NewScanner(bytes.NewBufferString(dimacs))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || fields[0] == "p" || fields[0] == "c" {
+			continue
+		}
+		clause := []literal{}
+		seen := map[string]interface{}{}
+		for _, f := range fields {
+			if f == "0" {
+				break
+			}
+			if _, ok := seen[f]; ok {
+				continue
+			}
+			seen[f] = nil
+			l := literal{negative: strings.HasPrefix(f, "-")}
+			v := strings.TrimLeft(f, "-")
+			if name, ok := vars[v]; ok {
+				l.name = name
+				l.pack = e.decode(name)
+			} else {
+				l.name = "x" + v
+			}
+			clause = append(clause, l)
+		}
+		res = append(res, clause)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("could not parse problem: %v", err)
+	}
+	return res, nil
+}
+
+// explainCore translates a minimal unsatisfiable CNF to an Explanation, using
+// the solver databases to decode the packages and their relations
+func explainCore(vars map[string]string, mus string, s types.PackageSolver) (*Explanation, error) {
+	e := &explainer{}
+	if solver, ok := s.(*Solver); ok {
+		e.solver = solver
+	}
+
+	clauses, err := e.parseClauses(vars, mus)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Explanation{Steps: []ExplanationStep{}}
+	seen := map[string]interface{}{}
+	for _, c := range clauses {
+		s := e.step(c)
+		if _, ok := seen[s.Message]; ok {
+			continue
+		}
+		seen[s.Message] = nil
+		res.Steps = append(res.Steps, s)
+	}
+	// The order of the clauses in the core isn't stable across runs
+	sort.SliceStable(res.Steps, func(i, j int) bool {
+		if res.Steps[i].Kind != res.Steps[j].Kind {
+			return explanationOrder[res.Steps[i].Kind] < explanationOrder[res.Steps[j].Kind]
+		}
+		return res.Steps[i].Message < res.Steps[j].Message
+	})
+	return res, nil
+}
@@ -0,0 +1,93 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package solver_test
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+
+	pkg "github.com/mudler/luet/pkg/database"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/mudler/luet/pkg/solver"
+)
+
+var _ = Describe("Explanation", func() {
+	var dbInstalled, dbDefinitions types.PackageDatabase
+	var s types.PackageSolver
+
+	BeforeEach(func() {
+		dbInstalled = pkg.NewInMemoryDatabase(false)
+		dbDefinitions = pkg.NewInMemoryDatabase(false)
+		s = NewSolver(types.SolverOptions{Type: types.SolverSingleCoreSimple}, dbInstalled, dbDefinitions, pkg.NewInMemoryDatabase(false))
+	})
+
+	It("explains conflicting version selectors", func() {
+		B1 := types.NewPackage("B", "1.0", []*types.Package{}, []*types.Package{})
+		B2 := types.NewPackage("B", "2.0", []*types.Package{}, []*types.Package{})
+		A := types.NewPackage("A", "1.0", []*types.Package{{Name: "B", Category: "test", Version: ">=2"}}, []*types.Package{})
+		C := types.NewPackage("C", "1.0", []*types.Package{{Name: "B", Category: "test", Version: "<2"}}, []*types.Package{})
+		for _, p := range []*types.Package{A, B1, B2, C} {
+			p.Category = "test"
+			_, err := dbDefinitions.CreatePackage(p)
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		_, err := s.Install([]*types.Package{A, C})
+		Expect(err).To(HaveOccurred())
+
+		unsat := &UnsatError{}
+		Expect(errors.As(err, &unsat)).To(BeTrue())
+		Expect(unsat.Explanation.String()).To(Equal(`test/A-1.0 is requested
+test/C-1.0 is requested
+test/A-1.0 requires test/B>=2
+test/C-1.0 requires test/B<2
+test/B-1.0 and test/B-2.0 conflict because only one version may be installed`))
+		Expect(unsat.Explanation.Constraints).ToNot(BeEmpty())
+	})
+
+	It("is available as JSON", func() {
+		C := types.NewPackage("C", "", []*types.Package{}, []*types.Package{})
+		B := types.NewPackage("B", "", []*types.Package{}, []*types.Package{C})
+		A := types.NewPackage("A", "", []*types.Package{B}, []*types.Package{})
+		for _, p := range []*types.Package{A, B, C} {
+			_, err := dbDefinitions.CreatePackage(p)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		_, err := dbInstalled.CreatePackage(C)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = s.Install([]*types.Package{A})
+		Expect(err).To(HaveOccurred())
+
+		unsat := &UnsatError{}
+		Expect(errors.As(err, &unsat)).To(BeTrue())
+		data, err := unsat.Explanation.JSON()
+		Expect(err).ToNot(HaveOccurred())
+
+		e := &Explanation{}
+		Expect(json.Unmarshal(data, e)).To(Succeed())
+		Expect(e.Steps).To(Equal([]ExplanationStep{
+			{Kind: ExplanationRequested, Packages: []string{"A"}, Message: "A is requested"},
+			{Kind: ExplanationInstalled, Packages: []string{"C"}, Message: "C is installed"},
+			{Kind: ExplanationRequires, Packages: []string{"A", "B"}, Requirement: "B", Message: "A requires B"},
+			{Kind: ExplanationConflicts, Packages: []string{"B", "C"}, Message: "B conflicts with C"},
+		}))
+	})
+})
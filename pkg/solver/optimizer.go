@@ -0,0 +1,162 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package solver
+
+import (
+	"sort"
+
+	"github.com/crillab/gophersat/bf"
+	gsolver "github.com/crillab/gophersat/solver"
+	"github.com/mudler/luet/pkg/api/core/types"
+	version "github.com/mudler/luet/pkg/versioner"
+	"github.com/pkg/errors"
+)
+
+// Weights of the soft constraints of the optimizing solver, which picks the
+// solution with the lowest sum of weights. Picking an alternative which is not
+// installed, when another one of the group is, weights more than changing an
+// installed package, which weights more than picking a package from a lower
+// priority repository, which weights more than picking an older version, which
+// weights more than installing an additional package. As the weights are summed, this is not a strict ordering:
+// for example, picking ten packages one version older than the newest costs as much
+// as picking one package from the repository ranked next by priority.
+const (
+	AlternativeWeight   = 10000
+	KeepInstalledWeight = 1000
+	PriorityWeight      = 100
+	VersionWeight       = 10
+	PackageWeight       = 1
+)
+
+// optimizer computes the cost of the variables of a problem
+type optimizer struct {
+	s *Solver
+
+	installed  map[string]map[string]interface{}
+	versions   map[string][]string
+	priorities map[int]int
+}
+
+func newOptimizer(s *Solver) *optimizer {
+	o := &optimizer{
+		s:          s,
+		installed:  map[string]map[string]interface{}{},
+		versions:   map[string][]string{},
+		priorities: map[int]int{},
+	}
+
+	if s.InstalledDatabase != nil {
+		for _, p := range s.Installed() {
+			if _, ok := o.installed[p.GetPackageName()]; !ok {
+				o.installed[p.GetPackageName()] = map[string]interface{}{}
+			}
+			o.installed[p.GetPackageName()][p.GetFingerPrint()] = nil
+		}
+	}
+
+	// Rank the priorities, so the distance between them doesn't matter
+	prios := []int{}
+	for _, p := range s.Priorities {
+		if _, ok := o.priorities[p]; !ok {
+			o.priorities[p] = 0
+			prios = append(prios, p)
+		}
+	}
+	sort.Ints(prios)
+	for i, p := range prios {
+		o.priorities[p] = i
+	}
+	return o
+}
+
+// versionRank returns the number of available versions newer than the package
+func (o *optimizer) versionRank(p *types.Package) int {
+	versions, ok := o.versions[p.GetPackageName()]
+	if !ok {
+		versions = []string{}
+		if o.s.DefinitionDatabase != nil {
+			packs, _ := o.s.DefinitionDatabase.FindPackageVersions(p)
+			for _, v := range packs {
+				versions = append(versions, v.GetVersion())
+			}
+		}
+		versions = version.DefaultVersioner().Sort(versions)
+		o.versions[p.GetPackageName()] = versions
+	}
+	for i := len(versions) - 1; i >= 0; i-- {
+		if versions[i] == p.GetVersion() {
+			return len(versions) - 1 - i
+		}
+	}
+	return 0
+}
+
+// cost returns the literal to avoid for a variable and its weight
+func (o *optimizer) cost(idx int, p *types.Package) (int, int) {
+	versions, installed := o.installed[p.GetPackageName()]
+	if installed {
+		if _, ok := versions[p.GetFingerPrint()]; ok {
+			// Removing an installed package
+			return -idx, KeepInstalledWeight
+		}
+	}
+
+	weight := PackageWeight + VersionWeight*o.versionRank(p)
+	if installed {
+		// Switching version of an installed package
+		weight += KeepInstalledWeight
+	}
+	if prio, ok := o.s.Priorities[p.GetFingerPrint()]; ok {
+		weight += PriorityWeight * o.priorities[prio]
+	}
+	return idx, weight
+}
+
+// optimize returns the model of the formula with the lowest cost, or nil if
+// the formula is unsatisfiable.
+// The cost of a model is the sum of the weights of the literals with a cost
+// that hold in it, and it is minimized by the pseudo-boolean solver of gophersat.
+// The avoided variables are the alternatives to avoid, see avoidedAlternatives.
+func (s *Solver) optimize(f bf.Formula, avoid map[string]interface{}) (map[string]bool, error) {
+	c, err := toCNF(f)
+	if err != nil {
+		return nil, errors.Wrap(err, "while converting the formula for the optimizing solver")
+	}
+
+	o := newOptimizer(s)
+	lits := []gsolver.Lit{}
+	weights := []int{}
+	for idx, name := range c.vars {
+		p, err := types.DecodePackage(name, s.SolverDatabase)
+		if err != nil {
+			continue
+		}
+		l, w := o.cost(idx, p)
+		if _, ok := avoid[name]; ok {
+			w += AlternativeWeight
+		}
+		lits = append(lits, gsolver.IntToLit(int32(l)))
+		weights = append(weights, w)
+	}
+
+	pb := gsolver.ParseSliceNb(c.clauses, c.nbVars)
+	pb.SetCostFunc(lits, weights)
+	gs := gsolver.New(pb)
+	if gs.Minimize() < 0 {
+		return nil, nil
+	}
+	return c.decode(gs.Model()), nil
+}
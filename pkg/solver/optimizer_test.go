@@ -0,0 +1,152 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package solver_test
+
+import (
+	"errors"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+
+	pkg "github.com/mudler/luet/pkg/database"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/mudler/luet/pkg/solver"
+)
+
+var _ = Describe("Optimizing solver", func() {
+	var dbInstalled, dbDefinitions types.PackageDatabase
+
+	BeforeEach(func() {
+		dbInstalled = pkg.NewInMemoryDatabase(false)
+		dbDefinitions = pkg.NewInMemoryDatabase(false)
+	})
+
+	It("picks the newest version matching a selector", func() {
+		for _, v := range []string{"1.0", "1.1", "2.0"} {
+			create(dbDefinitions, testPackage("B", v, []*types.Package{}, []*types.Package{}))
+		}
+		create(dbDefinitions, testPackage("A", "1.0", []*types.Package{{Name: "B", Category: "test", Version: ">=1.0"}}, []*types.Package{}))
+
+		s := NewSolver(types.SolverOptions{Type: types.SolverOptimizing}, dbInstalled, dbDefinitions, pkg.NewInMemoryDatabase(false))
+		solution, err := s.Install([]*types.Package{{Name: "A", Category: "test", Version: "1.0"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(trueAssertions(solution)).To(ConsistOf("test/A-1.0", "test/B-2.0"))
+	})
+
+	It("keeps the installed version instead of a newer one", func() {
+		for _, v := range []string{"1.0", "1.1", "2.0"} {
+			create(dbDefinitions, testPackage("B", v, []*types.Package{}, []*types.Package{}))
+		}
+		create(dbDefinitions, testPackage("A", "1.0", []*types.Package{{Name: "B", Category: "test", Version: ">=1.0"}}, []*types.Package{}))
+		create(dbInstalled, testPackage("B", "1.1", []*types.Package{}, []*types.Package{}))
+
+		install := func(t types.SolverType, version string) []string {
+			s := NewSolver(types.SolverOptions{Type: t}, dbInstalled, dbDefinitions, pkg.NewInMemoryDatabase(false))
+			solution, err := s.Install([]*types.Package{{Name: "A", Category: "test", Version: version}})
+			Expect(err).ToNot(HaveOccurred())
+			return trueAssertions(solution)
+		}
+		Expect(install(types.SolverOptimizing, "1.0")).To(ConsistOf("test/A-1.0", "test/B-1.1"))
+		Expect(install(types.SolverOptimizing, ">=0")).To(ConsistOf("test/A-1.0", "test/B-1.1"))
+		// The other solvers upgrade the dependencies on install
+		Expect(install(types.SolverSingleCoreSimple, "1.0")).To(ConsistOf("test/A-1.0", "test/B-2.0"))
+	})
+
+	It("upgrades the installed packages which are not available anymore", func() {
+		create(dbDefinitions, testPackage("B", "2.0", []*types.Package{}, []*types.Package{}))
+		create(dbDefinitions, testPackage("A", "1.0", []*types.Package{{Name: "B", Category: "test", Version: ">=2.0"}}, []*types.Package{}))
+		create(dbInstalled, testPackage("B", "1.0", []*types.Package{}, []*types.Package{}))
+
+		s := NewSolver(types.SolverOptions{Type: types.SolverOptimizing}, dbInstalled, dbDefinitions, pkg.NewInMemoryDatabase(false))
+		solution, err := s.Install([]*types.Package{{Name: "A", Category: "test", Version: "1.0"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(trueAssertions(solution)).To(ContainElements("test/A-1.0", "test/B-2.0"))
+		Expect(trueAssertions(solution)).ToNot(ContainElement("test/B-1.0"))
+	})
+
+	It("upgrades the packages requested without a version like the other solvers", func() {
+		for _, v := range []string{"1.0", "2.0"} {
+			create(dbDefinitions, testPackage("A", v, []*types.Package{}, []*types.Package{}))
+		}
+		create(dbInstalled, testPackage("A", "1.0", []*types.Package{}, []*types.Package{}))
+
+		install := func(t types.SolverType) []string {
+			s := NewSolver(types.SolverOptions{Type: t}, dbInstalled, dbDefinitions, pkg.NewInMemoryDatabase(false))
+			solution, err := s.Install([]*types.Package{{Name: "A", Category: "test", Version: ">=0"}})
+			Expect(err).ToNot(HaveOccurred())
+			return trueAssertions(solution)
+		}
+		for _, t := range []types.SolverType{types.SolverOptimizing, types.SolverSingleCoreSimple} {
+			installed := install(t)
+			Expect(installed).To(ContainElement("test/A-2.0"))
+			Expect(installed).ToNot(ContainElement("test/A-1.0"))
+		}
+	})
+
+	It("prefers packages from higher priority repositories", func() {
+		old := create(dbDefinitions, testPackage("B", "1.0", []*types.Package{}, []*types.Package{}))
+		newer := create(dbDefinitions, testPackage("B", "2.0", []*types.Package{}, []*types.Package{}))
+		create(dbDefinitions, testPackage("A", "1.0", []*types.Package{{Name: "B", Category: "test", Version: ">=1.0"}}, []*types.Package{}))
+
+		s := NewSolver(types.SolverOptions{
+			Type:       types.SolverOptimizing,
+			Priorities: map[string]int{old.GetFingerPrint(): 1, newer.GetFingerPrint(): 50},
+		}, dbInstalled, dbDefinitions, pkg.NewInMemoryDatabase(false))
+		solution, err := s.RelaxedInstall([]*types.Package{{Name: "A", Category: "test", Version: "1.0"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(trueAssertions(solution)).To(ConsistOf("test/A-1.0", "test/B-1.0"))
+	})
+
+	It("doesn't install unrelated packages", func() {
+		create(dbDefinitions, testPackage("A", "1.0", []*types.Package{}, []*types.Package{}))
+		create(dbDefinitions, testPackage("C", "1.0", []*types.Package{}, []*types.Package{}))
+		create(dbDefinitions, testPackage("D", "1.0", []*types.Package{{Name: "C", Category: "test", Version: "1.0"}}, []*types.Package{}))
+
+		s := NewSolver(types.SolverOptions{Type: types.SolverOptimizing}, dbInstalled, dbDefinitions, pkg.NewInMemoryDatabase(false))
+		solution, err := s.Install([]*types.Package{{Name: "A", Category: "test", Version: "1.0"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(trueAssertions(solution)).To(ConsistOf("test/A-1.0"))
+	})
+
+	It("upgrades the installed packages", func() {
+		for _, v := range []string{"1.0", "1.1"} {
+			create(dbDefinitions, testPackage("B", v, []*types.Package{}, []*types.Package{}))
+			create(dbDefinitions, testPackage("A", v, []*types.Package{{Name: "B", Category: "test", Version: ">=" + v}}, []*types.Package{}))
+		}
+		create(dbInstalled, testPackage("A", "1.0", []*types.Package{{Name: "B", Category: "test", Version: ">=1.0"}}, []*types.Package{}))
+		create(dbInstalled, testPackage("B", "1.0", []*types.Package{}, []*types.Package{}))
+
+		s := NewSolver(types.SolverOptions{Type: types.SolverOptimizing}, dbInstalled, dbDefinitions, pkg.NewInMemoryDatabase(false))
+		uninstall, solution, err := s.Upgrade(false, true)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(uninstall)).To(Equal(2))
+		Expect(trueAssertions(solution)).To(ConsistOf("test/A-1.1", "test/B-1.1"))
+	})
+
+	It("explains unsatisfiable constraints", func() {
+		create(dbDefinitions, testPackage("B", "1.0", []*types.Package{}, []*types.Package{}))
+		create(dbDefinitions, testPackage("A", "1.0", []*types.Package{{Name: "B", Category: "test", Version: "1.0"}}, []*types.Package{{Name: "C", Category: "test", Version: "1.0"}}))
+		create(dbDefinitions, testPackage("C", "1.0", []*types.Package{}, []*types.Package{}))
+		create(dbInstalled, testPackage("C", "1.0", []*types.Package{}, []*types.Package{}))
+
+		s := NewSolver(types.SolverOptions{Type: types.SolverOptimizing}, dbInstalled, dbDefinitions, pkg.NewInMemoryDatabase(false))
+		_, err := s.Install([]*types.Package{{Name: "A", Category: "test", Version: "1.0"}})
+		Expect(err).To(HaveOccurred())
+		var unsat *UnsatError
+		Expect(errors.As(err, &unsat)).To(BeTrue())
+	})
+})
@@ -0,0 +1,284 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package solver
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/crillab/gophersat/bf"
+	gsolver "github.com/crillab/gophersat/solver"
+	"github.com/mudler/luet/pkg/api/core/types"
+)
+
+// encodingCache wraps the solver database so that each package is
+// encoded only once while building formulas concurrently
+type encodingCache struct {
+	types.PackageDatabase
+	ids sync.Map
+}
+
+// encoding is the result of storing a package in the solver database
+type encoding struct {
+	once sync.Once
+	id   string
+	err  error
+}
+
+func newEncodingCache(db types.PackageDatabase) *encodingCache {
+	return &encodingCache{PackageDatabase: db}
+}
+
+// CreatePackage stores the package in the underlying database, unless
+// a package with the same fingerprint was already encoded
+func (c *encodingCache) CreatePackage(p *types.Package) (string, error) {
+	e, _ := c.ids.LoadOrStore(p.GetFingerPrint(), &encoding{})
+	enc := e.(*encoding)
+	enc.once.Do(func() {
+		enc.id, enc.err = c.PackageDatabase.CreatePackage(p)
+	})
+	return enc.id, enc.err
+}
+
+// encodingCache returns the cache of the packages encoded in the solver database,
+// kept across the formulas built by the solver
+func (s *Solver) encodingCache() *encodingCache {
+	if s.encoded == nil || s.encoded.PackageDatabase != s.SolverDatabase {
+		s.encoded = newEncodingCache(s.SolverDatabase)
+	}
+	return s.encoded
+}
+
+// buildFormulas returns the formulas of the given packages, resolving their
+// requirements against db. The concurrent solver builds them with a pool of
+// workers, keeping the order of the packages in the result so the generated
+// problem is the same of the single core solver.
+func (s *Solver) buildFormulas(packages types.Packages, db types.PackageDatabase) ([]bf.Formula, error) {
+	var formulas []bf.Formula
+	if s.Concurrency <= 1 {
+		for _, p := range packages {
+			solvable, err := p.BuildFormula(db, s.SolverDatabase)
+			if err != nil {
+				return nil, err
+			}
+			formulas = append(formulas, solvable...)
+		}
+		return formulas, nil
+	}
+
+	solverdb := s.encodingCache()
+	results := make([][]bf.Formula, len(packages))
+	errs := make([]error, len(packages))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < s.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				results[j], errs[j] = packages[j].BuildFormula(db, solverdb)
+			}
+		}()
+	}
+	for i := range packages {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i := range packages {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		formulas = append(formulas, results[i]...)
+	}
+	return formulas, nil
+}
+
+// strategies are the SAT strategies raced by the concurrent solver. The same
+// problem with the clauses in a different order leads the SAT solver through a
+// different search path, which can be considerably shorter on some problems.
+var strategies = []func(clauses [][]int) [][]int{
+	func(clauses [][]int) [][]int { return clauses },
+	reversed,
+}
+
+// raceSolve solves the formula with all the strategies concurrently, and returns
+// the first model found. The other strategies are stopped, and raceSolve returns
+// once all of them are done. Note the model might differ between runs, as any
+// strategy can return a different valid solution.
+func raceSolve(f bf.Formula) (map[string]bool, error) {
+	c, err := toCNF(f)
+	if err != nil {
+		return nil, err
+	}
+
+	stop := make(chan struct{})
+	results := make(chan []bool, len(strategies))
+	var wg sync.WaitGroup
+	for _, strategy := range strategies {
+		wg.Add(1)
+		go func(clauses [][]int) {
+			defer wg.Done()
+			results <- solveUntil(clauses, c.nbVars, stop)
+		}(strategy(c.clauses))
+	}
+
+	model := <-results
+	close(stop)
+	wg.Wait()
+
+	if model == nil {
+		return nil, nil
+	}
+	return c.decode(model), nil
+}
+
+// solveUntil returns a model of the clauses, or nil if they are unsatisfiable
+// or stop was closed before the solver was done.
+// The SAT solver can't be interrupted, so it runs in certified mode: it hands
+// each clause it learns over a channel before going on with the search, and the
+// channel is closed on stop. The solver then panics on the next learnt clause,
+// unwinding the search, and the panic is recovered here.
+func solveUntil(clauses [][]int, nbVars int, stop <-chan struct{}) (model []bool) {
+	certs := make(chan string)
+	done, exited := make(chan struct{}), make(chan struct{})
+	defer func() {
+		close(done)
+		<-exited
+	}()
+	go func() {
+		defer close(exited)
+		for {
+			select {
+			case <-certs:
+			case <-stop:
+				close(certs)
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	defer func() {
+		if r := recover(); r != nil {
+			select {
+			case <-stop:
+				model = nil
+			default:
+				panic(r)
+			}
+		}
+	}()
+
+	s := gsolver.New(gsolver.ParseSliceNb(clauses, nbVars))
+	s.Certified = true
+	s.CertChan = certs
+	if s.Solve() != gsolver.Sat {
+		return nil
+	}
+	return s.Model()
+}
+
+// reversed returns the clauses in reverse order
+func reversed(clauses [][]int) [][]int {
+	res := make([][]int, len(clauses))
+	for i, c := range clauses {
+		res[len(clauses)-1-i] = c
+	}
+	return res
+}
+
+// cnf is a formula in conjunctive normal form, as fed to the SAT solver
+type cnf struct {
+	clauses [][]int
+	// vars maps the index of the variables to their names. Variables
+	// introduced while converting the formula are not named.
+	vars   map[int]string
+	nbVars int
+}
+
+// toCNF converts a formula to its CNF form
+func toCNF(f bf.Formula) (*cnf, error) {
+	buf := bytes.NewBufferString("")
+	if err := bf.Dimacs(f, buf); err != nil {
+		return nil, err
+	}
+
+	res := &cnf{vars: map[int]string{}, clauses: [][]int{}}
+	sc := bufio.NewScanner(buf)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "p":
+			if len(fields) > 2 {
+				res.nbVars, _ = strconv.Atoi(fields[2])
+			}
+		case "c":
+			data := strings.Split(fields[1], "=")
+			idx, err := strconv.Atoi(data[len(data)-1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid variable '%s'", fields[1])
+			}
+			res.vars[idx] = strings.Join(data[:len(data)-1], "=")
+		default:
+			// Literals can be repeated in the clauses, which is not handled by
+			// the pseudo-boolean constraints of the optimizer: drop duplicates
+			// and clauses which are always true
+			clause := []int{}
+			seen := map[int]interface{}{}
+			tautology := false
+			for _, l := range fields {
+				lit, err := strconv.Atoi(l)
+				if err != nil {
+					return nil, fmt.Errorf("invalid literal '%s'", l)
+				}
+				if lit == 0 {
+					break
+				}
+				if _, ok := seen[-lit]; ok {
+					tautology = true
+				}
+				if _, ok := seen[lit]; !ok {
+					seen[lit] = nil
+					clause = append(clause, lit)
+				}
+			}
+			if !tautology {
+				res.clauses = append(res.clauses, clause)
+			}
+		}
+	}
+	return res, sc.Err()
+}
+
+// decode returns the value of the named variables in the model
+func (c *cnf) decode(m []bool) map[string]bool {
+	model := make(map[string]bool, len(c.vars))
+	for idx, name := range c.vars {
+		model[name] = m[idx-1]
+	}
+	return model
+}
@@ -0,0 +1,128 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package solver_test
+
+import (
+	"errors"
+	"runtime"
+	"strconv"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+
+	pkg "github.com/mudler/luet/pkg/database"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/mudler/luet/pkg/solver"
+)
+
+var _ = Describe("Concurrent solver", func() {
+	var dbInstalled, dbDefinitions types.PackageDatabase
+
+	BeforeEach(func() {
+		dbInstalled = pkg.NewInMemoryDatabase(false)
+		dbDefinitions = pkg.NewInMemoryDatabase(false)
+		for i := 0; i < 20; i++ {
+			for _, v := range []string{"1.0", "2.0"} {
+				requires := []*types.Package{}
+				if i < 19 {
+					requires = append(requires, &types.Package{Name: "pkg" + strconv.Itoa(i+1), Category: "test", Version: ">=" + v})
+				}
+				conflicts := []*types.Package{}
+				if i == 0 && v == "1.0" {
+					conflicts = append(conflicts, &types.Package{Name: "other", Category: "test", Version: "1.0"})
+				}
+				p := types.NewPackage("pkg"+strconv.Itoa(i), v, requires, conflicts)
+				p.Category = "test"
+				_, err := dbDefinitions.CreatePackage(p)
+				Expect(err).ToNot(HaveOccurred())
+			}
+		}
+		other := types.NewPackage("other", "1.0", []*types.Package{}, []*types.Package{})
+		other.Category = "test"
+		_, err := dbDefinitions.CreatePackage(other)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("gives the same solution of the single core solver", func() {
+		wanted := []*types.Package{{Name: "pkg0", Category: "test", Version: "2.0"}}
+
+		s := NewSolver(types.SolverOptions{Type: types.SolverSingleCoreSimple}, dbInstalled, dbDefinitions, pkg.NewInMemoryDatabase(false))
+		expected, err := s.Install(wanted)
+		Expect(err).ToNot(HaveOccurred())
+
+		concurrent := NewSolver(types.SolverOptions{Type: types.SolverConcurrent, Concurrency: 4}, dbInstalled, dbDefinitions, pkg.NewInMemoryDatabase(false))
+		solution, err := concurrent.Install(wanted)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(trueAssertions(solution)).To(ConsistOf(trueAssertions(expected)))
+		Expect(trueAssertions(solution)).To(ContainElement("test/pkg19-2.0"))
+	})
+
+	It("finds a valid solution racing strategies", func() {
+		s := NewSolver(types.SolverOptions{Type: types.SolverConcurrent, Concurrency: 4, Race: true}, dbInstalled, dbDefinitions, pkg.NewInMemoryDatabase(false))
+		solution, err := s.Install([]*types.Package{{Name: "pkg0", Category: "test", Version: "2.0"}})
+		Expect(err).ToNot(HaveOccurred())
+
+		installed := trueAssertions(solution)
+		Expect(installed).To(ContainElement("test/pkg0-2.0"))
+		for i := 1; i < 20; i++ {
+			Expect(installed).To(ContainElement("test/pkg" + strconv.Itoa(i) + "-2.0"))
+		}
+	})
+
+	It("stops the strategies losing the race", func() {
+		s := NewSolver(types.SolverOptions{Type: types.SolverConcurrent, Concurrency: 4, Race: true}, dbInstalled, dbDefinitions, pkg.NewInMemoryDatabase(false))
+		goroutines := runtime.NumGoroutine()
+		for i := 0; i < 10; i++ {
+			_, err := s.Install([]*types.Package{{Name: "pkg0", Category: "test", Version: "2.0"}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(runtime.NumGoroutine()).To(BeNumerically("<=", goroutines))
+		}
+
+		_, err := s.Install([]*types.Package{{Name: "pkg0", Category: "test", Version: "1.0"}, {Name: "other", Category: "test", Version: "1.0"}})
+		Expect(err).To(HaveOccurred())
+		Expect(runtime.NumGoroutine()).To(BeNumerically("<=", goroutines))
+	})
+
+	It("upgrades the installed packages", func() {
+		for i := 0; i < 20; i++ {
+			p, err := dbDefinitions.FindPackage(&types.Package{Name: "pkg" + strconv.Itoa(i), Category: "test", Version: "1.0"})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = dbInstalled.CreatePackage(p)
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		s := NewSolver(types.SolverOptions{Type: types.SolverConcurrent, Concurrency: 4}, dbInstalled, dbDefinitions, pkg.NewInMemoryDatabase(false))
+		uninstall, solution, err := s.Upgrade(false, true)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(uninstall)).To(Equal(20))
+		Expect(trueAssertions(solution)).To(ContainElement("test/pkg0-2.0"))
+	})
+
+	It("explains unsatisfiable constraints", func() {
+		_, err := dbInstalled.CreatePackage(&types.Package{Name: "other", Category: "test", Version: "1.0"})
+		Expect(err).ToNot(HaveOccurred())
+
+		s := NewSolver(types.SolverOptions{Type: types.SolverConcurrent, Concurrency: 4}, dbInstalled, dbDefinitions, pkg.NewInMemoryDatabase(false))
+		_, err = s.Install([]*types.Package{{Name: "pkg0", Category: "test", Version: "1.0"}})
+		Expect(err).To(HaveOccurred())
+
+		unsat := &UnsatError{}
+		Expect(errors.As(err, &unsat)).To(BeTrue())
+		Expect(unsat.Explanation.String()).To(ContainSubstring("test/pkg0-1.0 conflicts with test/other-1.0"))
+	})
+})
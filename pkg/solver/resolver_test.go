@@ -16,6 +16,8 @@
 package solver_test
 
 import (
+	"errors"
+
 	"github.com/mudler/luet/pkg/api/core/types"
 
 	pkg "github.com/mudler/luet/pkg/database"
@@ -173,8 +175,15 @@ var _ = Describe("Resolver", func() {
 
 				solution, err := s.Install([]*types.Package{A, D})
 				Expect(err).To(HaveOccurred())
-				Expect(err.Error()).To(Equal(`could not satisfy the constraints: 
-A-- and 
+				Expect(err.Error()).To(Equal(`could not satisfy the constraints:
+A is requested
+C is installed
+A requires B
+B conflicts with C`))
+
+				unsat := &UnsatError{}
+				Expect(errors.As(err, &unsat)).To(BeTrue())
+				Expect(unsat.Explanation.Constraints).To(Equal(`A-- and 
 C-- and 
 !(A--) or B-- and 
 !(B--) or !(C--)`))
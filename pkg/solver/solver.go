@@ -19,6 +19,7 @@ import (
 
 	//. "github.com/mudler/luet/pkg/logger"
 	"fmt"
+	"runtime"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -38,6 +39,19 @@ type Solver struct {
 	InstalledDatabase  types.PackageDatabase
 
 	Resolver types.PackageResolver
+
+	// Concurrency is the number of workers building the package formulas,
+	// used by the concurrent solver
+	Concurrency int
+	// Race solves the problem with different strategies concurrently
+	Race bool
+	// encoded caches the packages stored in the solver database by the concurrent solver
+	encoded *encodingCache
+
+	// Optimize picks the best solution according to the preferences of the optimizing solver
+	Optimize bool
+	// Priorities are the repository priorities of the packages, keyed by fingerprint
+	Priorities map[string]int
 }
 
 // IsRelaxedResolver returns true wether a solver might
@@ -73,10 +87,22 @@ func NewSolverFromOptions(t types.LuetSolverOptions) types.PackageResolver {
 func NewResolver(t types.SolverOptions, installed types.PackageDatabase, definitiondb types.PackageDatabase, solverdb types.PackageDatabase, re types.PackageResolver) types.PackageSolver {
 	var s types.PackageSolver
 	switch t.Type {
+	case types.SolverConcurrent:
+		concurrency := t.Concurrency
+		if concurrency <= 0 {
+			concurrency = runtime.NumCPU()
+		}
+		s = &Solver{InstalledDatabase: installed, DefinitionDatabase: definitiondb, SolverDatabase: solverdb, Resolver: re, Concurrency: concurrency, Race: t.Race}
+	case types.SolverOptimizing:
+		s = &Solver{InstalledDatabase: installed, DefinitionDatabase: definitiondb, SolverDatabase: solverdb, Resolver: re, Concurrency: t.Concurrency, Optimize: true, Priorities: t.Priorities}
 	default:
 		s = &Solver{InstalledDatabase: installed, DefinitionDatabase: definitiondb, SolverDatabase: solverdb, Resolver: re}
 	}
 
+	if t.CacheDir != "" {
+		return NewCachedSolver(s, NewCache(t.CacheDir), t, installed, definitiondb, re)
+	}
+
 	return s
 }
 
@@ -86,6 +112,17 @@ func (s *Solver) SetDefinitionDatabase(db types.PackageDatabase) {
 	s.DefinitionDatabase = db
 }
 
+// Options returns the options of the solver, to create solvers of the same type
+func (s *Solver) Options() types.SolverOptions {
+	if s.Optimize {
+		return types.SolverOptions{Type: types.SolverOptimizing, Concurrency: s.Concurrency, Priorities: s.Priorities}
+	}
+	if s.Concurrency > 0 {
+		return types.SolverOptions{Type: types.SolverConcurrent, Concurrency: s.Concurrency, Race: s.Race}
+	}
+	return types.SolverOptions{Type: types.SolverSingleCoreSimple}
+}
+
 // SetResolver is a setter for the unsat resolver backend
 func (s *Solver) SetResolver(r types.PackageResolver) {
 	s.Resolver = r
@@ -121,7 +158,6 @@ func (s *Solver) noRulesInstalled() bool {
 }
 
 func (s *Solver) BuildInstalled() (bf.Formula, error) {
-	var formulas []bf.Formula
 	var packages types.Packages
 	for _, p := range s.Installed() {
 		packages = append(packages, p)
@@ -130,14 +166,9 @@ func (s *Solver) BuildInstalled() (bf.Formula, error) {
 		}
 	}
 
-	for _, p := range packages {
-		solvable, err := p.BuildFormula(s.InstalledDatabase, s.SolverDatabase)
-		if err != nil {
-			return nil, err
-		}
-		//f = bf.And(f, solvable)
-		formulas = append(formulas, solvable...)
-
+	formulas, err := s.buildFormulas(packages, s.InstalledDatabase)
+	if err != nil {
+		return nil, err
 	}
 	return bf.And(formulas...), nil
 
@@ -157,13 +188,11 @@ func (s *Solver) BuildWorld(includeInstalled bool) (bf.Formula, error) {
 		formulas = append(formulas, solvable)
 	}
 
-	for _, p := range s.World() {
-		solvable, err := p.BuildFormula(s.DefinitionDatabase, s.SolverDatabase)
-		if err != nil {
-			return nil, err
-		}
-		formulas = append(formulas, solvable...)
+	solvable, err := s.buildFormulas(s.World(), s.DefinitionDatabase)
+	if err != nil {
+		return nil, err
 	}
+	formulas = append(formulas, solvable...)
 	return bf.And(formulas...), nil
 }
 
@@ -190,13 +219,11 @@ func (s *Solver) BuildPartialWorld(includeInstalled bool) (bf.Formula, error) {
 
 	}
 
-	for _, p := range packages {
-		solvable, err := p.BuildFormula(s.DefinitionDatabase, s.SolverDatabase)
-		if err != nil {
-			return nil, err
-		}
-		formulas = append(formulas, solvable...)
+	solvable, err := s.buildFormulas(packages, s.DefinitionDatabase)
+	if err != nil {
+		return nil, err
 	}
+	formulas = append(formulas, solvable...)
 
 	if len(formulas) != 0 {
 		return bf.And(formulas...), nil
@@ -484,6 +511,15 @@ func (s *Solver) UpgradeUniverse(dropremoved bool) (types.Packages, types.Packag
 	return markedForRemoval, assertion, nil
 }
 
+// isInstalled returns true if the package is installed in the system
+func (s *Solver) isInstalled(p *types.Package) bool {
+	if s.InstalledDatabase == nil {
+		return false
+	}
+	_, err := s.InstalledDatabase.FindPackage(p)
+	return err == nil
+}
+
 func inPackage(list []*types.Package, p *types.Package) bool {
 	for _, l := range list {
 		if l.AtomMatches(p) {
@@ -539,7 +575,7 @@ func assertionToMemDB(assertions types.PackagesAssertions) types.PackageDatabase
 func (s *Solver) upgrade(psToUpgrade, psToNotUpgrade types.Packages, fn func(defDB types.PackageDatabase, installDB types.PackageDatabase) (types.Packages, types.Packages, types.PackageDatabase, []*types.Package), defDB types.PackageDatabase, installDB types.PackageDatabase, checkconflicts, full bool) (types.Packages, types.PackagesAssertions, error) {
 
 	toUninstall, toInstall, installedcopy, packsToUpgrade := fn(defDB, installDB)
-	s2 := NewSolver(types.SolverOptions{Type: types.SolverSingleCoreSimple}, installedcopy, defDB, pkg.NewInMemoryDatabase(false))
+	s2 := NewSolver(s.Options(), installedcopy, defDB, pkg.NewInMemoryDatabase(false))
 	s2.SetResolver(s.Resolver)
 	if !full {
 		ass := types.PackagesAssertions{}
@@ -667,7 +703,7 @@ func (s *Solver) Uninstall(checkconflicts, full bool, packs ...*types.Package) (
 		}
 	}
 
-	s2 := NewSolver(types.SolverOptions{Type: types.SolverSingleCoreSimple}, pkg.NewInMemoryDatabase(false), s.InstalledDatabase, pkg.NewInMemoryDatabase(false))
+	s2 := NewSolver(s.Options(), pkg.NewInMemoryDatabase(false), s.InstalledDatabase, pkg.NewInMemoryDatabase(false))
 	s2.SetResolver(s.Resolver)
 
 	// Get the requirements to install the candidate
@@ -748,7 +784,24 @@ func (s *Solver) BuildFormula() (bf.Formula, error) {
 }
 
 func (s *Solver) solve(f bf.Formula) (map[string]bool, bf.Formula, error) {
-	model := bf.Solve(f)
+	var model map[string]bool
+	avoid, err := s.avoidedAlternatives()
+	if err != nil {
+		return nil, f, err
+	}
+	switch {
+	case s.Optimize:
+		model, err = s.optimize(f, avoid)
+	case len(avoid) != 0:
+		model, err = solveAvoiding(f, avoid)
+	case s.Race && s.Concurrency > 1:
+		model, err = raceSolve(f)
+	default:
+		model = bf.Solve(f)
+	}
+	if err != nil {
+		return nil, f, err
+	}
 	if model == nil {
 		return model, f, errors.New("Unsolvable")
 	}
@@ -829,10 +882,22 @@ func (s *Solver) Install(c types.Packages) (types.PackagesAssertions, error) {
 			toNotUpgrade = append(toNotUpgrade, p)
 		}
 	}
+	versions := map[string]int{}
+	for _, p := range assertions {
+		if p.Value {
+			versions[p.Package.GetPackageName()]++
+		}
+	}
 	for _, p := range assertions {
 		if p.Value {
 			systemAfterInstall.CreatePackage(p.Package)
 			if !inPackage(c, p.Package) && !inPackage(toUpgrade, p.Package) && !inPackage(toNotUpgrade, p.Package) {
+				if s.Optimize && s.isInstalled(p.Package) && versions[p.Package.GetPackageName()] == 1 {
+					// The optimizing solver keeps the installed dependencies,
+					// unless the solution picked another version
+					toNotUpgrade = append(toNotUpgrade, p.Package)
+					continue
+				}
 				toUpgrade = append(toUpgrade, p.Package)
 			}
 		}
@@ -18,6 +18,8 @@ package solver_test
 import (
 	"testing"
 
+	"github.com/mudler/luet/pkg/api/core/types"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
@@ -26,3 +28,28 @@ func TestSolver(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Solver Suite")
 }
+
+// trueAssertions returns the packages selected by a solution
+func trueAssertions(ass types.PackagesAssertions) []string {
+	res := []string{}
+	for _, a := range ass {
+		if a.Value {
+			res = append(res, a.Package.HumanReadableString())
+		}
+	}
+	return res
+}
+
+// create adds the package to the database
+func create(db types.PackageDatabase, p *types.Package) *types.Package {
+	_, err := db.CreatePackage(p)
+	Expect(err).ToNot(HaveOccurred())
+	return p
+}
+
+// testPackage returns a package of the test category
+func testPackage(name, version string, requires, conflicts []*types.Package) *types.Package {
+	p := types.NewPackage(name, version, requires, conflicts)
+	p.Category = "test"
+	return p
+}
@@ -713,6 +713,78 @@ var _ = Describe("Solver", func() {
 			Expect(err).ToNot(HaveOccurred())
 		})
 
+		It("Support versioned provides required with selectors", func() {
+			O := types.NewPackage("openssl", "3.0.2", []*types.Package{}, []*types.Package{})
+			L := types.NewPackage("libressl", "3.5", []*types.Package{}, []*types.Package{})
+			Old := types.NewPackage("oldssl", "1.1", []*types.Package{}, []*types.Package{})
+			A := types.NewPackage("A", "1.0", []*types.Package{{Name: "libssl", Version: ">=3"}}, []*types.Package{})
+
+			O.SetProvides([]*types.Package{{Name: "libssl", Version: "3.0"}})
+			L.SetProvides([]*types.Package{{Name: "libssl", Version: "3.1"}})
+			Old.SetProvides([]*types.Package{{Name: "libssl", Version: "1.1"}})
+
+			for _, p := range []*types.Package{O, L, Old, A} {
+				_, err := dbDefinitions.CreatePackage(p)
+				Expect(err).ToNot(HaveOccurred())
+			}
+			s = NewSolver(types.SolverOptions{Type: types.SolverSingleCoreSimple}, dbInstalled, dbDefinitions, db)
+
+			solution, err := s.Install([]*types.Package{A})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(solution).To(ContainElement(types.PackageAssert{Package: A, Value: true}))
+			Expect(solution).ToNot(ContainElement(types.PackageAssert{Package: Old, Value: true}))
+			Expect(solution).To(Or(
+				ContainElements(types.PackageAssert{Package: O, Value: true}, types.PackageAssert{Package: L, Value: false}),
+				ContainElements(types.PackageAssert{Package: O, Value: false}, types.PackageAssert{Package: L, Value: true}),
+			))
+		})
+
+		It("Chooses between the providers of a virtual package", func() {
+			O := types.NewPackage("openssl", "3.0.2", []*types.Package{}, []*types.Package{})
+			L := types.NewPackage("libressl", "3.5", []*types.Package{}, []*types.Package{})
+			A := types.NewPackage("A", "1.0", []*types.Package{{Name: "libssl", Version: ">=3"}}, []*types.Package{{Name: "openssl", Version: ">=0"}})
+
+			O.SetProvides([]*types.Package{{Name: "libssl", Version: "3.0"}})
+			L.SetProvides([]*types.Package{{Name: "libssl", Version: "3.1"}})
+
+			for _, p := range []*types.Package{O, L, A} {
+				_, err := dbDefinitions.CreatePackage(p)
+				Expect(err).ToNot(HaveOccurred())
+			}
+			s = NewSolver(types.SolverOptions{Type: types.SolverSingleCoreSimple}, dbInstalled, dbDefinitions, db)
+
+			solution, err := s.Install([]*types.Package{A})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(solution).To(ContainElement(types.PackageAssert{Package: A, Value: true}))
+			Expect(solution).To(ContainElement(types.PackageAssert{Package: L, Value: true}))
+			Expect(solution).ToNot(ContainElement(types.PackageAssert{Package: O, Value: true}))
+		})
+
+		It("Conflicts with all the providers of a virtual package", func() {
+			O := types.NewPackage("openssl", "3.0.2", []*types.Package{}, []*types.Package{})
+			L := types.NewPackage("libressl", "3.5", []*types.Package{}, []*types.Package{})
+			A := types.NewPackage("A", "1.0", []*types.Package{}, []*types.Package{{Name: "libssl", Version: "3.0"}})
+			B := types.NewPackage("B", "1.0", []*types.Package{{Name: "libssl", Version: ">=3"}}, []*types.Package{})
+
+			O.SetProvides([]*types.Package{{Name: "libssl", Version: "3.0"}})
+			L.SetProvides([]*types.Package{{Name: "libssl", Version: "3.0"}})
+
+			for _, p := range []*types.Package{O, L, A, B} {
+				_, err := dbDefinitions.CreatePackage(p)
+				Expect(err).ToNot(HaveOccurred())
+			}
+			s = NewSolver(types.SolverOptions{Type: types.SolverSingleCoreSimple}, dbInstalled, dbDefinitions, db)
+
+			solution, err := s.Install([]*types.Package{A})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(solution).To(ContainElement(types.PackageAssert{Package: A, Value: true}))
+			Expect(solution).ToNot(ContainElement(types.PackageAssert{Package: O, Value: true}))
+			Expect(solution).ToNot(ContainElement(types.PackageAssert{Package: L, Value: true}))
+
+			_, err = s.Install([]*types.Package{A, B})
+			Expect(err).To(HaveOccurred())
+		})
+
 		Context("Uninstall", func() {
 			It("Uninstalls simple package correctly", func() {
 
@@ -740,6 +812,35 @@ var _ = Describe("Solver", func() {
 				//	Expect(solution).To(ContainElement(types.PackageAssert{Package: C, Value: true}))
 				Expect(len(solution)).To(Equal(1))
 			})
+			It("Uninstalls recommended packages correctly", func() {
+
+				B := types.NewPackage("B", "", []*types.Package{}, []*types.Package{})
+				A := types.NewPackage("A", "", []*types.Package{}, []*types.Package{})
+				A.Recommends = []*types.Package{B}
+
+				for _, p := range []*types.Package{A, B} {
+					_, err := dbDefinitions.CreatePackage(p)
+					Expect(err).ToNot(HaveOccurred())
+				}
+
+				for _, p := range []*types.Package{A, B} {
+					_, err := dbInstalled.CreatePackage(p)
+					Expect(err).ToNot(HaveOccurred())
+				}
+				s = NewSolver(types.SolverOptions{Type: types.SolverSingleCoreSimple}, dbInstalled, dbDefinitions, db)
+
+				solution, err := s.Uninstall(true, false, B)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(solution).To(Equal(types.Packages{B}))
+
+				solution, err = s.Uninstall(true, true, B)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(solution).To(Equal(types.Packages{B}))
+
+				solution, err = s.Uninstall(true, true, A)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(solution).To(Equal(types.Packages{A}))
+			})
 			It("Uninstalls simple package expanded correctly", func() {
 
 				C := types.NewPackage("C", "", []*types.Package{}, []*types.Package{})
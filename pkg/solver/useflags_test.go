@@ -0,0 +1,89 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package solver_test
+
+import (
+	"github.com/mudler/luet/pkg/api/core/types"
+
+	pkg "github.com/mudler/luet/pkg/database"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/mudler/luet/pkg/solver"
+)
+
+var _ = Describe("Use flags", func() {
+	var dbInstalled, dbDefinitions types.PackageDatabase
+	var s types.PackageSolver
+	var curl *types.Package
+
+	BeforeEach(func() {
+		dbInstalled = pkg.NewInMemoryDatabase(false)
+		dbDefinitions = pkg.NewInMemoryDatabase(false)
+		s = NewSolver(types.SolverOptions{Type: types.SolverSingleCoreSimple}, dbInstalled, dbDefinitions, pkg.NewInMemoryDatabase(false))
+
+		curl = &types.Package{Name: "curl", Category: "net", Version: "1.0",
+			PackageRequires: []*types.Package{
+				{Name: "openssl", Category: "libs", Version: ">=0", UseConditions: []string{"ssl"}},
+				{Name: "zlib", Category: "libs", Version: ">=0"},
+			},
+			PackageConflicts: []*types.Package{
+				{Name: "nossl", Category: "libs", Version: ">=0", UseConditions: []string{"ssl"}},
+			},
+		}
+		for _, p := range []*types.Package{
+			{Name: "openssl", Category: "libs", Version: "1.0"},
+			{Name: "zlib", Category: "libs", Version: "1.0"},
+			{Name: "nossl", Category: "libs", Version: "1.0"},
+		} {
+			_, err := dbDefinitions.CreatePackage(p)
+			Expect(err).ToNot(HaveOccurred())
+		}
+	})
+
+	It("skips the requires whose conditions are not met", func() {
+		_, err := dbDefinitions.CreatePackage(curl)
+		Expect(err).ToNot(HaveOccurred())
+
+		solution, err := s.Install([]*types.Package{{Name: "curl", Category: "net", Version: "1.0"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(trueAssertions(solution)).To(ConsistOf("net/curl-1.0", "libs/zlib-1.0"))
+	})
+
+	It("considers the requires whose conditions are met", func() {
+		types.LuetUseFlags{Global: []string{"ssl"}}.Apply(curl)
+		_, err := dbDefinitions.CreatePackage(curl)
+		Expect(err).ToNot(HaveOccurred())
+
+		solution, err := s.Install([]*types.Package{{Name: "curl", Category: "net", Version: "1.0"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(trueAssertions(solution)).To(ConsistOf("net/curl-1.0", "libs/zlib-1.0", "libs/openssl-1.0"))
+	})
+
+	It("considers the conflicts whose conditions are met", func() {
+		_, err := dbInstalled.CreatePackage(&types.Package{Name: "nossl", Category: "libs", Version: "1.0"})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = dbDefinitions.CreatePackage(curl)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = s.Install([]*types.Package{{Name: "curl", Category: "net", Version: "1.0"}})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(types.LuetUseFlags{Global: []string{"ssl"}}.ApplyDatabase(dbDefinitions)).To(Succeed())
+		_, err = s.Install([]*types.Package{{Name: "curl", Category: "net", Version: "1.0"}})
+		Expect(err).To(HaveOccurred())
+	})
+})
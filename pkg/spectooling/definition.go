@@ -27,9 +27,14 @@ type PackageSanitized struct {
 	Version          string              `json:"version" yaml:"version"`
 	Category         string              `json:"category" yaml:"category"`
 	UseFlags         []string            `json:"use_flags,omitempty" yaml:"use_flags,omitempty"`
+	Arch             string              `json:"arch,omitempty" yaml:"arch,omitempty"`
 	PackageRequires  []*PackageSanitized `json:"requires,omitempty" yaml:"requires,omitempty"`
 	PackageConflicts []*PackageSanitized `json:"conflicts,omitempty" yaml:"conflicts,omitempty"`
 	Provides         []*PackageSanitized `json:"provides,omitempty" yaml:"provides,omitempty"`
+	Alternatives     []*PackageSanitized `json:"alternatives,omitempty" yaml:"alternatives,omitempty"`
+	Recommends       []*PackageSanitized `json:"recommends,omitempty" yaml:"recommends,omitempty"`
+	Suggests         []*PackageSanitized `json:"suggests,omitempty" yaml:"suggests,omitempty"`
+	UseConditions    []string            `json:"if_use,omitempty" yaml:"if_use,omitempty"`
 
 	Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
 
@@ -42,6 +47,8 @@ type PackageSanitized struct {
 	Hidden      bool     `json:"hidden,omitempty" yaml:"hidden,omitempty"`
 
 	Labels map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+
+	Changelog types.Changelog `json:"changelog,omitempty" yaml:"changelog,omitempty"`
 }
 
 func NewDefaultPackageSanitizedFromYaml(data []byte) (*PackageSanitized, error) {
@@ -52,6 +59,22 @@ func NewDefaultPackageSanitizedFromYaml(data []byte) (*PackageSanitized, error)
 	return ans, nil
 }
 
+// newDependencySanitized returns a requires or conflicts entry, with its alternatives
+// and use conditions
+func newDependencySanitized(d *types.Package) *PackageSanitized {
+	ans := &PackageSanitized{
+		Name:          d.Name,
+		Version:       d.Version,
+		Category:      d.Category,
+		Hidden:        d.IsHidden(),
+		UseConditions: d.UseConditions,
+	}
+	for _, a := range d.GetAlternatives() {
+		ans.Alternatives = append(ans.Alternatives, newDependencySanitized(a))
+	}
+	return ans
+}
+
 func NewDefaultPackageSanitized(p *types.Package) (ans *PackageSanitized) {
 
 	ann := map[string]string{}
@@ -68,6 +91,7 @@ func NewDefaultPackageSanitized(p *types.Package) (ans *PackageSanitized) {
 		Version:     p.GetVersion(),
 		Category:    p.GetCategory(),
 		UseFlags:    p.GetUses(),
+		Arch:        p.GetArch(),
 		Hidden:      p.IsHidden(),
 		Path:        p.GetPath(),
 		Description: p.GetDescription(),
@@ -75,20 +99,14 @@ func NewDefaultPackageSanitized(p *types.Package) (ans *PackageSanitized) {
 		License:     p.GetLicense(),
 		Labels:      p.GetLabels(),
 		Annotations: ann,
+		Changelog:   p.GetChangelog(),
 	}
 
 	if p.GetRequires() != nil && len(p.GetRequires()) > 0 {
 		ans.PackageRequires = []*PackageSanitized{}
 		for _, r := range p.GetRequires() {
 			// I avoid recursive call of NewDefaultPackageSanitized
-			ans.PackageRequires = append(ans.PackageRequires,
-				&PackageSanitized{
-					Name:     r.Name,
-					Version:  r.Version,
-					Category: r.Category,
-					Hidden:   r.IsHidden(),
-				},
-			)
+			ans.PackageRequires = append(ans.PackageRequires, newDependencySanitized(r))
 		}
 	}
 
@@ -96,17 +114,18 @@ func NewDefaultPackageSanitized(p *types.Package) (ans *PackageSanitized) {
 		ans.PackageConflicts = []*PackageSanitized{}
 		for _, c := range p.GetConflicts() {
 			// I avoid recursive call of NewDefaultPackageSanitized
-			ans.PackageConflicts = append(ans.PackageConflicts,
-				&PackageSanitized{
-					Name:     c.Name,
-					Version:  c.Version,
-					Category: c.Category,
-					Hidden:   c.IsHidden(),
-				},
-			)
+			ans.PackageConflicts = append(ans.PackageConflicts, newDependencySanitized(c))
 		}
 	}
 
+	for _, r := range p.GetRecommends() {
+		ans.Recommends = append(ans.Recommends, newDependencySanitized(r))
+	}
+
+	for _, s := range p.GetSuggests() {
+		ans.Suggests = append(ans.Suggests, newDependencySanitized(s))
+	}
+
 	if p.GetProvides() != nil && len(p.GetProvides()) > 0 {
 		ans.Provides = []*PackageSanitized{}
 		for _, prov := range p.GetProvides() {
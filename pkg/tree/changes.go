@@ -0,0 +1,143 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package tree
+
+import (
+	"bytes"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/pkg/errors"
+)
+
+func git(dir string, args ...string) ([]string, error) {
+	var stdout, stderr bytes.Buffer
+	// Paths with unusual characters are not quoted in the output
+	cmd := exec.Command("git", append([]string{"-C", dir, "-c", "core.quotepath=off"}, args...)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Wrapf(err, "git %s: %s", strings.Join(args, " "), strings.TrimSpace(stderr.String()))
+	}
+
+	lines := []string{}
+	for _, l := range strings.Split(stdout.String(), "\n") {
+		if l != "" {
+			lines = append(lines, l)
+		}
+	}
+	return lines, nil
+}
+
+// realPath returns the absolute path of p, with the symlinks resolved if it exists
+func realPath(p string) (string, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	if real, err := filepath.EvalSymlinks(abs); err == nil {
+		return real, nil
+	}
+	return abs, nil
+}
+
+// ChangedFiles returns the absolute paths of the files changed in the git repository
+// holding dir since the given revision. Uncommitted and untracked files are included.
+func ChangedFiles(dir, revision string) ([]string, error) {
+	top, err := git(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	if len(top) != 1 {
+		return nil, errors.New("cannot find the git repository of " + dir)
+	}
+
+	// Renames are listed as a removal and an addition, so both the old and the new paths are considered
+	changed, err := git(dir, "diff", "--name-only", "--no-renames", revision, "--")
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := git(dir, "ls-files", "--others", "--exclude-standard", "--full-name")
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+	for _, f := range append(changed, untracked...) {
+		files = append(files, filepath.Join(top[0], f))
+	}
+	return files, nil
+}
+
+func isIn(file, dir string) bool {
+	rel, err := filepath.Rel(dir, file)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// ChangedPackages returns the packages of the database affected by the given files. A package
+// is affected by the changes of the files in its folder, such as its definition.yaml, build.yaml
+// or collection.yaml, unless they belong to a package in a nested folder. As templates can be
+// used by any package, a change in the templates folders affects all the packages.
+func ChangedPackages(db types.PackageDatabase, files []string, templateFolders []string) (types.Packages, error) {
+	templates := []string{}
+	for _, t := range templateFolders {
+		p, err := realPath(t)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, p)
+	}
+
+	// Collections define several packages in the same folder
+	packageDirs := map[string]types.Packages{}
+	for _, p := range db.World() {
+		if p.GetPath() == "" {
+			continue
+		}
+		dir, err := realPath(p.GetPath())
+		if err != nil {
+			return nil, err
+		}
+		packageDirs[dir] = append(packageDirs[dir], p)
+	}
+
+	res := types.Packages{}
+	seen := map[string]interface{}{}
+	for _, f := range files {
+		for _, t := range templates {
+			if isIn(f, t) {
+				return db.World(), nil
+			}
+		}
+
+		// The package owning the file is the one in the closest folder
+		for dir := filepath.Dir(f); ; dir = filepath.Dir(dir) {
+			if packs, ok := packageDirs[dir]; ok {
+				if _, ok := seen[dir]; !ok {
+					seen[dir] = nil
+					res = append(res, packs...)
+				}
+				break
+			}
+			if dir == filepath.Dir(dir) {
+				break
+			}
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,136 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package tree_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+	pkg "github.com/mudler/luet/pkg/database"
+	. "github.com/mudler/luet/pkg/tree"
+)
+
+var _ = Describe("Changes", func() {
+	var tmpdir, treeDir string
+
+	git := func(args ...string) {
+		out, err := exec.Command("git", append([]string{"-C", tmpdir, "-c", "user.email=luet@example.com", "-c", "user.name=luet"}, args...)...).CombinedOutput()
+		Expect(err).ToNot(HaveOccurred(), string(out))
+	}
+
+	write := func(path, content string) {
+		path = filepath.Join(treeDir, path)
+		Expect(os.MkdirAll(filepath.Dir(path), os.ModePerm)).To(Succeed())
+		Expect(ioutil.WriteFile(path, []byte(content), os.ModePerm)).To(Succeed())
+	}
+
+	names := func(packs types.Packages) []string {
+		res := []string{}
+		for _, p := range packs {
+			res = append(res, p.GetName())
+		}
+		return res
+	}
+
+	BeforeEach(func() {
+		if _, err := exec.LookPath("git"); err != nil {
+			Skip("git is not available")
+		}
+
+		var err error
+		tmpdir, err = ioutil.TempDir("", "changes")
+		Expect(err).ToNot(HaveOccurred())
+		treeDir = filepath.Join(tmpdir, "tree")
+
+		// b is nested in the folder of a, c and d are defined in a collection
+		write("a/definition.yaml", "category: test\nname: a\nversion: \"1.0\"\n")
+		write("a/build.yaml", "image: scratch\n")
+		write("a/b/definition.yaml", "category: test\nname: b\nversion: \"1.0\"\n")
+		write("a/b/build.yaml", "image: scratch\n")
+		write("coll/collection.yaml", "packages:\n- category: test\n  name: c\n  version: \"1.0\"\n- category: test\n  name: d\n  version: \"1.0\"\n")
+		write("coll/build.yaml", "image: scratch\n")
+		write("templates/foo.yaml", "{{ define \"foo\" }}{{ end }}\n")
+
+		git("init", "-q")
+		git("add", "-A")
+		git("commit", "-q", "-m", "init")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpdir)
+	})
+
+	changed := func() types.Packages {
+		generalRecipe := NewCompilerRecipe(pkg.NewInMemoryDatabase(false))
+		Expect(generalRecipe.Load(treeDir)).To(Succeed())
+
+		files, err := ChangedFiles(treeDir, "HEAD")
+		Expect(err).ToNot(HaveOccurred())
+		packs, err := ChangedPackages(generalRecipe.GetDatabase(), files, []string{filepath.Join(treeDir, "templates")})
+		Expect(err).ToNot(HaveOccurred())
+		return packs
+	}
+
+	It("lists the changed files", func() {
+		files, err := ChangedFiles(treeDir, "HEAD")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(files).To(BeEmpty())
+
+		write("a/build.yaml", "image: alpine\n")
+		write("a/files/new", "")
+		git("mv", "tree/coll/build.yaml", "tree/coll/renamed.yaml")
+
+		top, err := filepath.EvalSymlinks(tmpdir)
+		Expect(err).ToNot(HaveOccurred())
+		files, err = ChangedFiles(filepath.Join(treeDir, "a"), "HEAD")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(files).To(ConsistOf(
+			filepath.Join(top, "tree", "a", "build.yaml"),
+			filepath.Join(top, "tree", "a", "files", "new"),
+			filepath.Join(top, "tree", "coll", "build.yaml"),
+			filepath.Join(top, "tree", "coll", "renamed.yaml"),
+		))
+
+		_, err = ChangedFiles(treeDir, "notarevision")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("finds the packages owning the changed files", func() {
+		Expect(changed()).To(BeEmpty())
+
+		write("a/files/new", "")
+		Expect(names(changed())).To(ConsistOf("a"))
+
+		write("a/b/build.yaml", "image: alpine\n")
+		Expect(names(changed())).To(ConsistOf("a", "b"))
+	})
+
+	It("selects all the packages of a collection", func() {
+		write("coll/build.yaml", "image: alpine\n")
+		Expect(names(changed())).To(ConsistOf("c", "d"))
+	})
+
+	It("selects all the packages when templates change", func() {
+		write("templates/foo.yaml", "{{ define \"foo\" }}bar{{ end }}\n")
+		Expect(names(changed())).To(ConsistOf("a", "b", "c", "d"))
+	})
+})
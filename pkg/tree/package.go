@@ -43,6 +43,9 @@ func RuntimeDefinitionParser(srcDir, currentpath, name string, templates []strin
 
 	// Path is set only internally when tree is loaded from disk
 	pack.SetPath(filepath.Dir(currentpath))
+	if err := pack.LoadChangelog(); err != nil {
+		return err
+	}
 	_, err = db.CreatePackage(&pack)
 	if err != nil {
 		return errors.Wrap(err, "Error creating package "+pack.GetName())
@@ -88,6 +91,9 @@ func BuildDefinitionParser(srcDir, currentpath, name string, templates []string,
 	// Path is set only internally when tree is loaded from disk
 	pack.SetPath(filepath.Dir(currentpath))
 	pack.SetTreeDir(srcDir)
+	if err := pack.LoadChangelog(); err != nil {
+		return err
+	}
 
 	// Instead of rdeps, have a different tree for build deps.
 	compileDefPath := pack.Rel(CompilerDefinitionFile)
@@ -188,4 +188,36 @@ var _ = Describe("Tree", func() {
 		})
 	})
 
+	Context("Simple tree with changelogs", func() {
+		It("Reads changelogs from files and definitions", func() {
+			db := pkg.NewInMemoryDatabase(false)
+			generalRecipe := NewCompilerRecipe(db)
+
+			err := generalRecipe.Load("../../tests/fixtures/changelog")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(len(generalRecipe.GetDatabase().World())).To(Equal(2))
+			pack, err := generalRecipe.GetDatabase().FindPackage(&types.Package{Name: "pkgA", Category: "test", Version: "0.2"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(pack.GetChangelog())).To(Equal(2))
+			Expect(pack.GetChangelog().Between("0.1", "0.2")[0].Changes).To(Equal([]string{"Fix file1 content"}))
+
+			pack, err = generalRecipe.GetDatabase().FindPackage(&types.Package{Name: "pkgB", Category: "test", Version: "1.1"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(pack.GetChangelog())).To(Equal(1))
+		})
+
+		It("Keeps changelogs in the runtime tree", func() {
+			db := pkg.NewInMemoryDatabase(false)
+			runtimeRecipe := NewInstallerRecipe(db)
+
+			err := runtimeRecipe.Load("../../tests/fixtures/changelog")
+			Expect(err).ToNot(HaveOccurred())
+
+			pack, err := runtimeRecipe.GetDatabase().FindPackage(&types.Package{Name: "pkgA", Category: "test", Version: "0.2"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(pack.GetChangelog())).To(Equal(2))
+		})
+	})
+
 })